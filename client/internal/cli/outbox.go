@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var outboxCmd = &cobra.Command{
+	Use:   "outbox",
+	Short: "Manage deliveries waiting for a retry",
+}
+
+func init() {
+	outboxCmd.AddCommand(outboxListCmd)
+	outboxCmd.AddCommand(outboxRetryCmd)
+	outboxCmd.AddCommand(outboxDiscardCmd)
+}
+
+var outboxListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List queued and dead-letter deliveries",
+	RunE:  runOutboxList,
+}
+
+func init() {
+	outboxListCmd.Flags().Bool("json", false, "Output as JSON")
+	outboxListCmd.Flags().Bool("dead", false, "Only show deliveries that exhausted their retries")
+}
+
+func runOutboxList(cmd *cobra.Command, args []string) error {
+	c := getClient()
+
+	state := ""
+	if dead, _ := cmd.Flags().GetBool("dead"); dead {
+		state = "dead"
+	}
+	items, err := c.ListOutbox(cmd.Context(), state)
+	if err != nil {
+		return fmt.Errorf("list outbox: %w", err)
+	}
+
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	}
+
+	if len(items) == 0 {
+		fmt.Println("Outbox is empty")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTARGET\tSTATE\tATTEMPTS\tNEXT ATTEMPT\tDOCUMENT\tLAST ERROR")
+	for _, item := range items {
+		next := "-"
+		if !item.NextAttempt.IsZero() {
+			next = item.NextAttempt.Local().Format(time.DateTime)
+		}
+		doc := item.Document.Title
+		if doc == "" {
+			doc = item.Document.Filename
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			item.ID, item.Target, item.State, item.Attempts, next, doc, item.LastError)
+	}
+	return w.Flush()
+}
+
+var outboxRetryCmd = &cobra.Command{
+	Use:   "retry <id>...",
+	Short: "Retry queued or dead-letter deliveries now",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := getClient()
+		for _, id := range args {
+			if err := c.RetryOutbox(cmd.Context(), id); err != nil {
+				return fmt.Errorf("retry %s: %w", id, err)
+			}
+			fmt.Printf("Retry scheduled: %s\n", id)
+		}
+		return nil
+	},
+}
+
+var outboxDiscardCmd = &cobra.Command{
+	Use:   "discard <id>...",
+	Short: "Delete deliveries and their documents from the outbox",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := getClient()
+		for _, id := range args {
+			if err := c.DiscardOutbox(cmd.Context(), id); err != nil {
+				return fmt.Errorf("discard %s: %w", id, err)
+			}
+			fmt.Printf("Discarded: %s\n", id)
+		}
+		return nil
+	},
+}
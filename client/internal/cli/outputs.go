@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thoscut/scanflow/client/internal/client"
+)
+
+var outputsCmd = &cobra.Command{
+	Use:   "outputs",
+	Short: "Manage output targets",
+}
+
+func init() {
+	outputsCmd.AddCommand(outputsListCmd)
+	outputsCmd.AddCommand(outputsTestCmd)
+}
+
+var outputsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured output targets",
+	RunE:  runOutputsList,
+}
+
+func init() {
+	outputsListCmd.Flags().Bool("json", false, "Output as JSON")
+}
+
+func runOutputsList(cmd *cobra.Command, args []string) error {
+	c := getClient()
+
+	outputs, err := c.ListOutputs(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("list outputs: %w", err)
+	}
+
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(outputs)
+	}
+
+	if len(outputs) == 0 {
+		fmt.Println("No outputs configured")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tAVAILABLE")
+	for _, o := range outputs {
+		fmt.Fprintf(w, "%s\t%s\t%t\n", o.Name, o.Type, o.Available)
+	}
+	return w.Flush()
+}
+
+var outputsTestCmd = &cobra.Command{
+	Use:   "test [name]...",
+	Short: "Test the connection to output targets",
+	Long:  "Test that output targets are reachable and accept documents without leaving anything behind. Without names, all configured targets are tested.",
+	RunE:  runOutputsTest,
+}
+
+func init() {
+	outputsTestCmd.Flags().Bool("json", false, "Output as JSON")
+}
+
+func runOutputsTest(cmd *cobra.Command, args []string) error {
+	c := getClient()
+
+	names := args
+	if len(names) == 0 {
+		outputs, err := c.ListOutputs(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("list outputs: %w", err)
+		}
+		for _, o := range outputs {
+			names = append(names, o.Name)
+		}
+	}
+
+	var results []*client.OutputTestResult
+	failed := 0
+	for _, name := range names {
+		res, err := c.TestOutput(cmd.Context(), name)
+		if err != nil {
+			return fmt.Errorf("test %s: %w", name, err)
+		}
+		if !res.OK {
+			failed++
+		}
+		results = append(results, res)
+	}
+
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else if len(results) == 0 {
+		fmt.Println("No outputs configured")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTYPE\tOK\tDURATION\tERROR")
+		for _, res := range results {
+			msg := res.Error
+			if res.OK && !res.Supported {
+				msg = "configuration only"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", res.Target, res.Type, res.OK,
+				time.Duration(res.DurationMS)*time.Millisecond, msg)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d output tests failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thoscut/scanflow/client/internal/client"
+	"github.com/thoscut/scanflow/client/internal/config"
+)
+
+// paperlessKinds maps command arguments to the server's object kinds.
+var paperlessKinds = map[string]string{
+	"tags":           "tags",
+	"correspondents": "correspondents",
+	"document-types": "document_types",
+	"storage-paths":  "storage_paths",
+}
+
+var paperlessCmd = &cobra.Command{
+	Use:       "paperless {tags|correspondents|document-types|storage-paths}",
+	Short:     "List Paperless tags, correspondents, document types or storage paths",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"tags", "correspondents", "document-types", "storage-paths"},
+	RunE:      runPaperlessList,
+}
+
+func init() {
+	paperlessCmd.Flags().StringP("output", "o", "paperless", "Paperless output target")
+	paperlessCmd.Flags().StringP("query", "q", "", "Only show names containing this text")
+	paperlessCmd.Flags().Bool("json", false, "Output as JSON")
+}
+
+func runPaperlessList(cmd *cobra.Command, args []string) error {
+	kind, ok := paperlessKinds[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown kind %q", args[0])
+	}
+	output, _ := cmd.Flags().GetString("output")
+	query, _ := cmd.Flags().GetString("query")
+
+	objects, err := getClient().ListPaperless(cmd.Context(), output, kind, query)
+	if err != nil {
+		return fmt.Errorf("list paperless %s: %w", args[0], err)
+	}
+
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(objects)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME")
+	for _, o := range objects {
+		fmt.Fprintf(w, "%d\t%s\n", o.ID, o.Name)
+	}
+	return w.Flush()
+}
+
+// paperlessRef splits a flag value into a Paperless ID or name.
+func paperlessRef(value string) (int, string) {
+	if id, err := strconv.Atoi(value); err == nil && id > 0 {
+		return id, ""
+	}
+	return 0, value
+}
+
+// completePaperless returns a completion function offering the names of a
+// Paperless object kind from the output selected with --output.
+func completePaperless(kind string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		c, err := completionClient()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			output = "paperless"
+		}
+
+		// Comma-separated flags complete the last entry.
+		prefix := ""
+		if i := strings.LastIndex(toComplete, ","); i >= 0 {
+			prefix, toComplete = toComplete[:i+1], toComplete[i+1:]
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		objects, err := c.ListPaperless(ctx, output, kind, toComplete)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names := make([]string, 0, len(objects))
+		for _, o := range objects {
+			names = append(names, prefix+o.Name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completionClient returns the API client during shell completion, where
+// the root command's PersistentPreRunE does not run.
+func completionClient() (*client.Client, error) {
+	if apiClient != nil {
+		return apiClient, nil
+	}
+	var err error
+	if cfgFile != "" {
+		cfg, err = config.LoadFrom(cfgFile)
+	} else {
+		cfg, err = config.Load()
+	}
+	if err != nil {
+		return nil, err
+	}
+	apiClient = client.New(cfg.Server.URL, cfg.Server.APIKey)
+	return apiClient, nil
+}
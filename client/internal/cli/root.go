@@ -43,6 +43,9 @@ func init() {
 	rootCmd.AddCommand(scanCmd)
 	rootCmd.AddCommand(devicesCmd)
 	rootCmd.AddCommand(profilesCmd)
+	rootCmd.AddCommand(outputsCmd)
+	rootCmd.AddCommand(outboxCmd)
+	rootCmd.AddCommand(paperlessCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(tuiCmd)
@@ -48,3 +48,43 @@ func TestVersionCommandUsesConfiguredVersion(t *testing.T) {
 		t.Fatalf("unexpected version output: %q", got.String())
 	}
 }
+
+func TestScanMetadataSplitsIDsAndNames(t *testing.T) {
+	cmd := &cobra.Command{Use: "scan"}
+	cmd.Flags().AddFlagSet(scanCmd.Flags())
+	if err := cmd.ParseFlags([]string{"--tags", "3,Tax 2026, 7", "--correspondent", "ACME", "--document-type", "4",
+		"--custom-field", "Amount=EUR12.50", "--custom-field", "Note=a=b", "--view-groups", "Accounting"}); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	md, err := scanMetadata(cmd)
+	if err != nil {
+		t.Fatalf("scanMetadata: %v", err)
+	}
+	if md == nil || len(md.Tags) != 2 || md.Tags[1] != 7 || len(md.TagNames) != 1 || md.TagNames[0] != "Tax 2026" {
+		t.Fatalf("unexpected tags: %+v", md)
+	}
+	if md.CorrespondentName != "ACME" || md.Correspondent != 0 || md.DocumentType != 4 || md.DocumentTypeName != "" {
+		t.Fatalf("unexpected metadata: %+v", md)
+	}
+	if md.CustomFields["Amount"] != "EUR12.50" || md.CustomFields["Note"] != "a=b" ||
+		md.Permissions == nil || md.Permissions.ViewGroups[0] != "Accounting" {
+		t.Fatalf("unexpected Paperless values: %+v", md)
+	}
+}
+
+func TestScanMetadataRecipients(t *testing.T) {
+	cmd := &cobra.Command{Use: "scan"}
+	cmd.Flags().AddFlagSet(scanCmd.Flags())
+	if err := cmd.ParseFlags([]string{"--to", "tax@example.com,office@example.com", "--bcc", "archive@example.com"}); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	md, err := scanMetadata(cmd)
+	if err != nil {
+		t.Fatalf("scanMetadata: %v", err)
+	}
+	if md == nil || md.Recipients == nil || len(md.Recipients.To) != 2 || len(md.Recipients.Cc) != 0 || md.Recipients.Bcc[0] != "archive@example.com" {
+		t.Fatalf("unexpected recipients: %+v", md)
+	}
+}
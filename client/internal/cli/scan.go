@@ -20,14 +20,45 @@ var scanCmd = &cobra.Command{
 
 func init() {
 	scanCmd.Flags().StringP("profile", "p", "", "Scan profile (default: from config)")
-	scanCmd.Flags().StringP("output", "o", "", "Output target (paperless, smb, filesystem)")
+	scanCmd.Flags().StringP("output", "o", "", "Output target name (see 'scanflow outputs list')")
+	scanCmd.Flags().StringSlice("also", nil, "Additional output targets; suffix with '?' to make one optional (e.g. nas?)")
 	scanCmd.Flags().StringP("title", "t", "", "Document title")
 	scanCmd.Flags().BoolP("interactive", "i", false, "Interactive mode")
-	scanCmd.Flags().IntSlice("tags", nil, "Paperless tag IDs")
-	scanCmd.Flags().Int("correspondent", 0, "Paperless correspondent ID")
-	scanCmd.Flags().Int("document-type", 0, "Paperless document type ID")
+	scanCmd.Flags().StringSlice("tags", nil, "Paperless tags (IDs or names)")
+	scanCmd.Flags().String("correspondent", "", "Paperless correspondent (ID or name)")
+	scanCmd.Flags().String("document-type", "", "Paperless document type (ID or name)")
+	scanCmd.Flags().String("storage-path", "", "Paperless storage path name")
+	scanCmd.Flags().StringArray("custom-field", nil, "Paperless custom field as name=value (repeatable)")
+	scanCmd.Flags().String("owner", "", "Paperless owner (user name or ID)")
+	scanCmd.Flags().StringSlice("view-users", nil, "Paperless users allowed to view the document")
+	scanCmd.Flags().StringSlice("view-groups", nil, "Paperless groups allowed to view the document")
+	scanCmd.Flags().StringSlice("change-users", nil, "Paperless users allowed to change the document")
+	scanCmd.Flags().StringSlice("change-groups", nil, "Paperless groups allowed to change the document")
+	scanCmd.Flags().StringSlice("to", nil, "Email recipients (replace those of the email output)")
+	scanCmd.Flags().StringSlice("cc", nil, "Email copy recipients")
+	scanCmd.Flags().StringSlice("bcc", nil, "Email blind copy recipients")
 	scanCmd.Flags().String("filename", "", "Output filename")
+	scanCmd.Flags().Int("resolution", 0, "Resolution in DPI (overrides profile)")
+	scanCmd.Flags().String("mode", "", "Color mode: color, gray, lineart (overrides profile)")
+	scanCmd.Flags().String("source", "", "Source: flatbed, adf, adf_duplex (overrides profile)")
+	scanCmd.Flags().Int("brightness", 0, "Scanner brightness (device range, e.g. -100..100)")
+	scanCmd.Flags().Int("contrast", 0, "Scanner contrast (device range, e.g. -100..100)")
+	scanCmd.Flags().String("paper-size", "", "Paper size preset (a4, a5, letter, legal, ...)")
+	scanCmd.Flags().String("batch-mode", "", "Batch mode: single, wait_for_paper, continuous")
+	scanCmd.Flags().Float64Slice("area", nil, "Scan region in mm: left,top,right,bottom (e.g. from a preview)")
 	scanCmd.Flags().Bool("json", false, "Output as JSON")
+
+	scanCmd.RegisterFlagCompletionFunc("tags", completePaperless("tags"))
+	scanCmd.RegisterFlagCompletionFunc("correspondent", completePaperless("correspondents"))
+	scanCmd.RegisterFlagCompletionFunc("document-type", completePaperless("document_types"))
+	scanCmd.RegisterFlagCompletionFunc("storage-path", completePaperless("storage_paths"))
+	scanCmd.RegisterFlagCompletionFunc("owner", completePaperless("users"))
+	for _, flag := range []string{"view-users", "change-users"} {
+		scanCmd.RegisterFlagCompletionFunc(flag, completePaperless("users"))
+	}
+	for _, flag := range []string{"view-groups", "change-groups"} {
+		scanCmd.RegisterFlagCompletionFunc(flag, completePaperless("groups"))
+	}
 }
 
 func runScan(cmd *cobra.Command, args []string) error {
@@ -61,22 +92,39 @@ func runScan(cmd *cobra.Command, args []string) error {
 		}
 		req.Output.Filename = filename
 	}
+	if also, _ := cmd.Flags().GetStringSlice("also"); len(also) > 0 {
+		if req.Output == nil {
+			req.Output = &client.OutputConfig{}
+		}
+		req.Output.Targets = parseTargets(also)
+	}
 
-	// Metadata
-	title, _ := cmd.Flags().GetString("title")
-	tags, _ := cmd.Flags().GetIntSlice("tags")
-	correspondent, _ := cmd.Flags().GetInt("correspondent")
-	documentType, _ := cmd.Flags().GetInt("document-type")
-
-	if title != "" || len(tags) > 0 || correspondent > 0 || documentType > 0 {
-		req.Metadata = &client.DocumentMetadata{
-			Title:         title,
-			Tags:          tags,
-			Correspondent: correspondent,
-			DocumentType:  documentType,
+	// Scanner overrides
+	opts := &client.ScanOptions{}
+	opts.Resolution, _ = cmd.Flags().GetInt("resolution")
+	opts.Mode, _ = cmd.Flags().GetString("mode")
+	opts.Source, _ = cmd.Flags().GetString("source")
+	opts.Brightness, _ = cmd.Flags().GetInt("brightness")
+	opts.Contrast, _ = cmd.Flags().GetInt("contrast")
+	opts.PaperSize, _ = cmd.Flags().GetString("paper-size")
+	opts.BatchMode, _ = cmd.Flags().GetString("batch-mode")
+	if area, _ := cmd.Flags().GetFloat64Slice("area"); len(area) > 0 {
+		if len(area) != 4 {
+			return fmt.Errorf("--area needs four values: left,top,right,bottom")
 		}
+		opts.Area = &client.ScanArea{TLX: area[0], TLY: area[1], BRX: area[2], BRY: area[3]}
+	}
+	if *opts != (client.ScanOptions{}) {
+		req.Options = opts
 	}
 
+	// Metadata
+	md, err := scanMetadata(cmd)
+	if err != nil {
+		return err
+	}
+	req.Metadata = md
+
 	fmt.Printf("Starting scan (profile: %s, output: %s)...\n", profile, outputStr)
 
 	job, err := c.StartScan(cmd.Context(), req)
@@ -118,18 +166,115 @@ func waitForJob(cmd *cobra.Command, c *client.Client, jobID string) error {
 		return fmt.Errorf("wait for job: %w", err)
 	}
 
+	printDeliveries(job.Deliveries)
+
 	switch job.Status {
 	case "completed":
 		fmt.Printf("Scan completed successfully (%d pages)\n", len(job.Pages))
+	case "delivering":
+		fmt.Printf("Scan processed (%d pages); required outputs are queued for retry, see 'scanflow outbox list'\n", len(job.Pages))
 	case "failed":
 		return fmt.Errorf("scan failed: %s", job.Error)
 	case "cancelled":
 		fmt.Println("Scan was cancelled")
+	case "needs_attention":
+		return fmt.Errorf("scanner needs attention after %d pages: %s (clear the fault, then resume with POST /api/v1/scan/%s/continue or finish with POST /api/v1/scan/%s/finish)",
+			len(job.Pages), job.Error, job.ID, job.ID)
 	}
 
 	return nil
 }
 
+// scanMetadata builds the document metadata from the flags. Paperless
+// objects may be given by ID or by name.
+func scanMetadata(cmd *cobra.Command) (*client.DocumentMetadata, error) {
+	md := &client.DocumentMetadata{}
+	md.Title, _ = cmd.Flags().GetString("title")
+	md.StoragePath, _ = cmd.Flags().GetString("storage-path")
+	md.Owner, _ = cmd.Flags().GetString("owner")
+
+	fields, _ := cmd.Flags().GetStringArray("custom-field")
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("--custom-field %q: expected name=value", field)
+		}
+		if md.CustomFields == nil {
+			md.CustomFields = make(map[string]any)
+		}
+		md.CustomFields[strings.TrimSpace(name)] = value
+	}
+
+	perms := &client.Permissions{}
+	perms.ViewUsers, _ = cmd.Flags().GetStringSlice("view-users")
+	perms.ViewGroups, _ = cmd.Flags().GetStringSlice("view-groups")
+	perms.ChangeUsers, _ = cmd.Flags().GetStringSlice("change-users")
+	perms.ChangeGroups, _ = cmd.Flags().GetStringSlice("change-groups")
+	if len(perms.ViewUsers)+len(perms.ViewGroups)+len(perms.ChangeUsers)+len(perms.ChangeGroups) > 0 {
+		md.Permissions = perms
+	}
+
+	rcpt := &client.Recipients{}
+	rcpt.To, _ = cmd.Flags().GetStringSlice("to")
+	rcpt.Cc, _ = cmd.Flags().GetStringSlice("cc")
+	rcpt.Bcc, _ = cmd.Flags().GetStringSlice("bcc")
+	if len(rcpt.To)+len(rcpt.Cc)+len(rcpt.Bcc) > 0 {
+		md.Recipients = rcpt
+	}
+
+	if v, _ := cmd.Flags().GetString("correspondent"); v != "" {
+		md.Correspondent, md.CorrespondentName = paperlessRef(v)
+	}
+	if v, _ := cmd.Flags().GetString("document-type"); v != "" {
+		md.DocumentType, md.DocumentTypeName = paperlessRef(v)
+	}
+	tags, _ := cmd.Flags().GetStringSlice("tags")
+	for _, tag := range tags {
+		if id, name := paperlessRef(strings.TrimSpace(tag)); id > 0 {
+			md.Tags = append(md.Tags, id)
+		} else if name != "" {
+			md.TagNames = append(md.TagNames, name)
+		}
+	}
+	if md.Title == "" && md.StoragePath == "" && md.Correspondent == 0 && md.CorrespondentName == "" &&
+		md.DocumentType == 0 && md.DocumentTypeName == "" && len(md.Tags) == 0 && len(md.TagNames) == 0 &&
+		md.CustomFields == nil && md.Owner == "" && md.Permissions == nil && md.Recipients == nil {
+		return nil, nil
+	}
+	return md, nil
+}
+
+// parseTargets converts "name" and "name?" (optional) flag values into
+// output targets.
+func parseTargets(names []string) []client.DeliveryTarget {
+	targets := make([]client.DeliveryTarget, 0, len(names))
+	for _, n := range names {
+		optional := strings.HasSuffix(n, "?")
+		targets = append(targets, client.DeliveryTarget{
+			Name:     strings.TrimSuffix(n, "?"),
+			Optional: optional,
+		})
+	}
+	return targets
+}
+
+func printDeliveries(deliveries []client.Delivery) {
+	for _, d := range deliveries {
+		kind := "required"
+		if !d.Required {
+			kind = "optional"
+		}
+		line := fmt.Sprintf("  %s (%s): %s", d.Target, kind, d.Status)
+		if d.Error != "" {
+			line += " - " + d.Error
+		}
+		if d.Result != nil && d.Result.URL != "" {
+			line += " - " + d.Result.URL
+		}
+		fmt.Println(line)
+	}
+}
+
 func runInteractiveScan(cmd *cobra.Command, c *client.Client) error {
 	profile, _ := cmd.Flags().GetString("profile")
 	if profile == "" {
@@ -163,12 +308,16 @@ func runInteractiveScan(cmd *cobra.Command, c *client.Client) error {
 			return err
 		}
 
-		if job.Status == "completed" || job.Status == "failed" || job.Status == "cancelled" {
+		if job.Status == "completed" || job.Status == "delivering" || job.Status == "failed" || job.Status == "cancelled" {
 			fmt.Printf("\nScan %s (%d pages)\n", job.Status, len(job.Pages))
 			return nil
 		}
 
 		fmt.Printf("\n%d page(s) scanned\n", len(job.Pages))
+		if job.Status == "needs_attention" {
+			fmt.Printf("Scanner needs attention: %s\n", job.Error)
+			fmt.Println("Clear the fault, then scan more pages to resume or finish with the pages scanned so far.")
+		}
 		fmt.Println()
 		fmt.Println("[W] Scan more pages")
 		fmt.Println("[F] Finish and create PDF")
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -38,16 +39,50 @@ type ScanRequest struct {
 }
 
 type ScanOptions struct {
-	Resolution int     `json:"resolution,omitempty"`
-	Mode       string  `json:"mode,omitempty"`
-	Source     string  `json:"source,omitempty"`
-	PageWidth  float64 `json:"page_width,omitempty"`
-	PageHeight float64 `json:"page_height,omitempty"`
+	Resolution int       `json:"resolution,omitempty"`
+	Mode       string    `json:"mode,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	PageWidth  float64   `json:"page_width,omitempty"`
+	PageHeight float64   `json:"page_height,omitempty"`
+	Brightness int       `json:"brightness,omitempty"`
+	Contrast   int       `json:"contrast,omitempty"`
+	PaperSize  string    `json:"paper_size,omitempty"`
+	Area       *ScanArea `json:"area,omitempty"`
+	BatchMode  string    `json:"batch_mode,omitempty"`
+}
+
+// ScanArea is a scan region in millimetres from the top-left corner.
+type ScanArea struct {
+	TLX float64 `json:"tl_x"`
+	TLY float64 `json:"tl_y"`
+	BRX float64 `json:"br_x"`
+	BRY float64 `json:"br_y"`
 }
 
 type OutputConfig struct {
+	Target   string           `json:"target"`
+	Targets  []DeliveryTarget `json:"targets,omitempty"`
+	Filename string           `json:"filename,omitempty"`
+}
+
+// DeliveryTarget is an additional output a job is delivered to.
+type DeliveryTarget struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// Delivery is the delivery state of a job for one output target.
+type Delivery struct {
 	Target   string `json:"target"`
-	Filename string `json:"filename,omitempty"`
+	Required bool   `json:"required"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+	Result   *struct {
+		DocumentID string            `json:"document_id,omitempty"`
+		URL        string            `json:"url,omitempty"`
+		Fields     map[string]string `json:"fields,omitempty"`
+	} `json:"result,omitempty"`
 }
 
 type DocumentMetadata struct {
@@ -56,18 +91,55 @@ type DocumentMetadata struct {
 	Correspondent int    `json:"correspondent,omitempty"`
 	DocumentType  int    `json:"document_type,omitempty"`
 	Tags          []int  `json:"tags,omitempty"`
+
+	// Paperless objects by name, resolved by the server
+	CorrespondentName string   `json:"correspondent_name,omitempty"`
+	DocumentTypeName  string   `json:"document_type_name,omitempty"`
+	TagNames          []string `json:"tag_names,omitempty"`
+	StoragePath       string   `json:"storage_path,omitempty"`
+
+	// Paperless values applied after consumption, by name or ID
+	CustomFields map[string]any `json:"custom_fields,omitempty"`
+	Owner        string         `json:"owner,omitempty"`
+	Permissions  *Permissions   `json:"permissions,omitempty"`
+
+	// Email recipients, must be allowed by the server's email output
+	Recipients *Recipients `json:"recipients,omitempty"`
+}
+
+// Recipients address a document sent by email.
+type Recipients struct {
+	To  []string `json:"to,omitempty"`
+	Cc  []string `json:"cc,omitempty"`
+	Bcc []string `json:"bcc,omitempty"`
+}
+
+// Permissions are the view and change permissions of a Paperless document.
+type Permissions struct {
+	ViewUsers    []string `json:"view_users,omitempty"`
+	ViewGroups   []string `json:"view_groups,omitempty"`
+	ChangeUsers  []string `json:"change_users,omitempty"`
+	ChangeGroups []string `json:"change_groups,omitempty"`
+}
+
+// PaperlessObject is a tag, correspondent, document type or storage path
+// of a Paperless output.
+type PaperlessObject struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
 }
 
 // ScanJob represents a scan job returned by the API.
 type ScanJob struct {
-	ID        string    `json:"id"`
-	Status    string    `json:"status"`
-	Profile   string    `json:"profile"`
-	Pages     []Page    `json:"pages"`
-	Progress  int       `json:"progress"`
-	Error     string    `json:"error,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Profile    string     `json:"profile"`
+	Pages      []Page     `json:"pages"`
+	Progress   int        `json:"progress"`
+	Error      string     `json:"error,omitempty"`
+	Deliveries []Delivery `json:"deliveries,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
 }
 
 type Page struct {
@@ -98,6 +170,44 @@ type Profile struct {
 	} `json:"scanner"`
 }
 
+// OutputTarget is a configured output instance on the server.
+type OutputTarget struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Enabled   bool   `json:"enabled"`
+	Available bool   `json:"available"`
+}
+
+// OutputTestResult is the outcome of a connectivity test of an output
+// target.
+type OutputTestResult struct {
+	Target     string    `json:"target"`
+	Type       string    `json:"type"`
+	OK         bool      `json:"ok"`
+	Supported  bool      `json:"supported"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// OutboxItem is a delivery waiting in the server's outbox.
+type OutboxItem struct {
+	ID          string    `json:"id"`
+	JobID       string    `json:"job_id,omitempty"`
+	Target      string    `json:"target"`
+	Required    bool      `json:"required"`
+	State       string    `json:"state"` // pending, dead
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	NextAttempt time.Time `json:"next_attempt,omitzero"`
+	Document    struct {
+		Filename string `json:"filename,omitempty"`
+		Title    string `json:"title,omitempty"`
+		Size     int64  `json:"size"`
+	} `json:"document"`
+}
+
 // ServerStatus contains the server status response.
 type ServerStatus struct {
 	Status     string `json:"status"`
@@ -194,6 +304,102 @@ func (c *Client) GetProfile(ctx context.Context, name string) (*Profile, error)
 	return &profile, nil
 }
 
+// ListOutputs returns the configured output targets.
+func (c *Client) ListOutputs(ctx context.Context) ([]OutputTarget, error) {
+	resp, err := c.doRequest(ctx, "GET", "/api/v1/outputs", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Outputs []OutputTarget `json:"outputs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return result.Outputs, nil
+}
+
+// TestOutput runs the connectivity test of an output target.
+func (c *Client) TestOutput(ctx context.Context, name string) (*OutputTestResult, error) {
+	resp, err := c.doRequest(ctx, "POST", "/api/v1/outputs/"+url.PathEscape(name)+"/test", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result OutputTestResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// ListOutbox returns the deliveries waiting in the outbox, optionally only
+// those in the given state.
+func (c *Client) ListOutbox(ctx context.Context, state string) ([]OutboxItem, error) {
+	path := "/api/v1/outbox"
+	if state != "" {
+		path += "?state=" + url.QueryEscape(state)
+	}
+	resp, err := c.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Items []OutboxItem `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return result.Items, nil
+}
+
+// ListPaperless lists the objects of a kind (tags, correspondents,
+// document_types, storage_paths) of a Paperless output whose name contains q.
+func (c *Client) ListPaperless(ctx context.Context, output, kind, q string) ([]PaperlessObject, error) {
+	path := "/api/v1/outputs/" + url.PathEscape(output) + "/paperless/" + url.PathEscape(kind)
+	if q != "" {
+		path += "?q=" + url.QueryEscape(q)
+	}
+	resp, err := c.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Items []PaperlessObject `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return result.Items, nil
+}
+
+// RetryOutbox schedules an outbox item for an immediate delivery attempt.
+func (c *Client) RetryOutbox(ctx context.Context, id string) error {
+	resp, err := c.doRequest(ctx, "POST", "/api/v1/outbox/"+url.PathEscape(id)+"/retry", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DiscardOutbox deletes an outbox item and its document.
+func (c *Client) DiscardOutbox(ctx context.Context, id string) error {
+	resp, err := c.doRequest(ctx, "DELETE", "/api/v1/outbox/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
 // StartScan initiates a new scan job.
 func (c *Client) StartScan(ctx context.Context, req *ScanRequest) (*ScanJob, error) {
 	resp, err := c.doRequest(ctx, "POST", "/api/v1/scan", req)
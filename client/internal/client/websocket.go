@@ -49,7 +49,9 @@ func (c *Client) ConnectWebSocket(ctx context.Context) (<-chan ProgressUpdate, e
 	return updates, nil
 }
 
-// WaitForJob polls the job status until it reaches a terminal state.
+// WaitForJob polls the job status until it reaches a terminal state, is
+// paused by a scanner fault (needs_attention) or waits for queued deliveries
+// (delivering).
 func (c *Client) WaitForJob(ctx context.Context, jobID string, onUpdate func(ScanJob)) (*ScanJob, error) {
 	// Try WebSocket first
 	updates, err := c.ConnectWebSocket(ctx)
@@ -69,7 +71,7 @@ func (c *Client) WaitForJob(ctx context.Context, jobID string, onUpdate func(Sca
 			}
 
 			switch job.Status {
-			case "completed", "failed", "cancelled":
+			case "completed", "failed", "cancelled", "needs_attention", "delivering":
 				return job, nil
 			}
 		}
@@ -94,7 +96,7 @@ func (c *Client) pollJobStatus(ctx context.Context, jobID string, onUpdate func(
 		}
 
 		switch job.Status {
-		case "completed", "failed", "cancelled":
+		case "completed", "failed", "cancelled", "needs_attention", "delivering":
 			return job, nil
 		}
 
@@ -110,12 +110,18 @@ func (m scanModel) update(msg tea.Msg) (scanModel, tea.Cmd) {
 		case "completed":
 			m.done = true
 			m.status = "Completed"
+		case "delivering":
+			m.done = true
+			m.status = "Processed, queued for delivery"
 		case "failed":
 			m.done = true
 			m.err = fmt.Errorf("%s", msg.job.Error)
 		case "cancelled":
 			m.done = true
 			m.status = "Cancelled"
+		case "needs_attention":
+			m.status = "Needs attention: " + msg.job.Error
+			return m, m.pollJob()
 		default:
 			return m, m.pollJob()
 		}
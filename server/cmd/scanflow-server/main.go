@@ -15,7 +15,9 @@ import (
 	"github.com/thoscut/scanflow/server/internal/api"
 	"github.com/thoscut/scanflow/server/internal/config"
 	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/mqtt"
 	"github.com/thoscut/scanflow/server/internal/output"
+	"github.com/thoscut/scanflow/server/internal/pattern"
 	"github.com/thoscut/scanflow/server/internal/processor"
 	"github.com/thoscut/scanflow/server/internal/scanner"
 	"github.com/thoscut/scanflow/server/internal/service"
@@ -143,40 +145,36 @@ func main() {
 	}
 	jobQueue.StartCleanup(ctx, retentionAge)
 
-	// Setup button watcher if enabled
-	if cfg.Button.Enabled {
-		btnCfg := scanner.ButtonConfig{
-			Enabled:           cfg.Button.Enabled,
-			PollInterval:      cfg.Button.PollInterval.Duration(),
-			LongPressDuration: cfg.Button.LongPressDuration.Duration(),
-			ShortPressProfile: cfg.Button.ShortPressProfile,
-			LongPressProfile:  cfg.Button.LongPressProfile,
-			Output:            cfg.Button.Output,
-			BeepOnLongPress:   cfg.Button.BeepOnLongPress,
+	// Create and start API server
+	srv := api.NewServer(cfg, sc, jobQueue, profiles, proc, outputs)
+	if cfg.Storage.LocalDirectory != "" {
+		srv.SetCounter(pattern.NewCounter(filepath.Join(cfg.Storage.LocalDirectory, "counter")))
+	}
+	if cfg.Output.Outbox.Enabled {
+		outboxDir := cfg.Output.Outbox.Directory
+		if outboxDir == "" {
+			outboxDir = filepath.Join(cfg.Storage.LocalDirectory, "outbox")
 		}
-
-		onShortPress := func() {
-			job := jobs.NewJob(btnCfg.ShortPressProfile, jobs.OutputConfig{
-				Target: btnCfg.Output,
-			}, nil, nil)
-			slog.Info("button short press scan", "profile", btnCfg.ShortPressProfile)
-			jobQueue.Submit(job)
+		outbox, err := output.NewOutbox(outboxDir, cfg.Output.Outbox.RetrySchedule(), outputs)
+		if err != nil {
+			slog.Warn("failed to open delivery outbox, failed deliveries will not be retried", "dir", outboxDir, "error", err)
+		} else {
+			srv.SetOutbox(outbox)
 		}
+	}
 
-		onLongPress := func() {
-			job := jobs.NewJob(btnCfg.LongPressProfile, jobs.OutputConfig{
-				Target: btnCfg.Output,
-			}, nil, nil)
-			slog.Info("button long press scan", "profile", btnCfg.LongPressProfile)
-			jobQueue.Submit(job)
+	if path := cfg.Output.Managed.Path(cfg.Storage.LocalDirectory); path != "" {
+		store, err := config.NewOutputStore(path)
+		if err != nil {
+			slog.Warn("failed to open managed outputs, output management through the API is disabled", "file", path, "error", err)
+		} else {
+			srv.SetOutputStore(store)
 		}
-
-		bw := scanner.NewButtonWatcher(sc, btnCfg, onShortPress, onLongPress)
-		go bw.Start(ctx)
 	}
 
-	// Create and start API server
-	srv := api.NewServer(cfg, sc, jobQueue, profiles, proc, outputs)
+	if cfg.MQTT.Enabled {
+		srv.SetMQTT(mqtt.New(cfg.MQTT))
+	}
 
 	// Handle shutdown signals
 	sigCh := make(chan os.Signal, 1)
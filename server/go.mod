@@ -5,16 +5,24 @@ go 1.26.0
 toolchain go1.26.1
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/go-chi/chi/v5 v5.1.0
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/hirochachacha/go-smb2 v1.1.0
+	github.com/mochi-mqtt/server/v2 v2.6.6
 	github.com/pelletier/go-toml/v2 v2.2.2
+	github.com/pkg/sftp v1.13.9
 	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.25.0
 )
 
 require (
 	github.com/geoffgarside/ber v1.1.0 // indirect
-	golang.org/x/net v0.21.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	golang.org/x/sync v0.12.0 // indirect
+	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
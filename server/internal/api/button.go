@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/scanner"
+)
+
+// newButtonWatcher creates the hardware button watcher for the configured
+// bindings. Recognised gestures are dispatched to handleButtonEvent.
+func (s *Server) newButtonWatcher() *scanner.ButtonWatcher {
+	btn := s.cfg.Button
+	bindings, actions := btn.EffectiveBindings()
+
+	cfg := scanner.ButtonConfig{
+		PollInterval:          btn.PollInterval.Duration(),
+		LongPressDuration:     btn.LongPressDuration.Duration(),
+		VeryLongPressDuration: btn.VeryLongPressDuration.Duration(),
+		DoublePressWindow:     btn.DoublePressWindow.Duration(),
+		BeepOnLongPress:       btn.BeepOnLongPress,
+	}
+	for _, b := range bindings {
+		function := -1
+		if b.Function != nil {
+			function = *b.Function
+		}
+		var beep []time.Duration
+		for _, ms := range actions[b.Action].Beep {
+			beep = append(beep, time.Duration(ms)*time.Millisecond)
+		}
+		cfg.Bindings = append(cfg.Bindings, scanner.ButtonBinding{
+			Button:   b.Button,
+			Gesture:  scanner.Gesture(b.Gesture),
+			Function: function,
+			Action:   b.Action,
+			Beep:     beep,
+		})
+	}
+
+	return scanner.NewGestureWatcher(s.scanner, cfg, s.handleButtonEvent)
+}
+
+// handleButtonEvent starts the scan configured for a button gesture. A press
+// during a wait-for-paper or continuous feed session ends that session
+// instead of starting a new scan.
+func (s *Server) handleButtonEvent(ev scanner.ButtonEvent) {
+	if s.mqtt != nil {
+		s.mqtt.ButtonPressed(ev.Button, string(ev.Gesture))
+	}
+
+	if s.scanner.FinishBatch() {
+		slog.Info("button press finished feed session", "button", ev.Button, "gesture", ev.Gesture)
+		return
+	}
+
+	_, actions := s.cfg.Button.EffectiveBindings()
+	action, ok := actions[ev.Action]
+	if !ok {
+		slog.Warn("button action not configured", "action", ev.Action)
+		return
+	}
+
+	profile := action.Profile
+	if profile == "" {
+		profile = "standard"
+	}
+	if _, ok := s.profiles.Get(profile); !ok {
+		slog.Warn("button action references unknown profile", "action", ev.Action, "profile", profile)
+		return
+	}
+
+	// The title pattern is expanded when the job is processed.
+	var metadata *jobs.DocumentMetadata
+	md := action.Metadata
+	if md.TitlePattern != "" || md.Correspondent > 0 || md.DocumentType > 0 || len(md.Tags) > 0 ||
+		md.CorrespondentName != "" || md.DocumentTypeName != "" || len(md.TagNames) > 0 || md.StoragePath != "" {
+		metadata = &jobs.DocumentMetadata{
+			Title:             md.TitlePattern,
+			Correspondent:     md.Correspondent,
+			DocumentType:      md.DocumentType,
+			Tags:              md.Tags,
+			CorrespondentName: md.CorrespondentName,
+			DocumentTypeName:  md.DocumentTypeName,
+			TagNames:          md.TagNames,
+			StoragePath:       md.StoragePath,
+		}
+	}
+
+	job := jobs.NewJob(profile, jobs.OutputConfig{Target: action.Output}, metadata, nil)
+	if err := s.jobQueue.Submit(job); err != nil {
+		slog.Error("failed to submit button scan", "action", ev.Action, "error", err)
+		return
+	}
+	slog.Info("button scan started", "job_id", job.ID, "action", ev.Action,
+		"button", ev.Button, "gesture", ev.Gesture, "profile", profile)
+
+	s.broadcast(jobs.ProgressUpdate{
+		Type:    "button_pressed",
+		JobID:   job.ID,
+		Status:  string(jobs.StatusPending),
+		Message: fmt.Sprintf("%s button %s press: %s", ev.Button, ev.Gesture, ev.Action),
+	})
+}
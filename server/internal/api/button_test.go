@@ -0,0 +1,91 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/scanner"
+)
+
+func TestHandleButtonEventStartsActionScan(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cfg.Button.Bindings = []config.ButtonBinding{
+		{Button: "email", Gesture: "double", Action: "mail"},
+	}
+	srv.cfg.Button.Actions = map[string]config.ButtonAction{
+		"mail": {
+			Profile:  "photo",
+			Output:   "email",
+			Metadata: config.MetadataConfig{Correspondent: 3, Tags: []int{1, 2}},
+		},
+	}
+
+	srv.handleButtonEvent(scanner.ButtonEvent{Button: "email", Gesture: scanner.GestureDouble, Action: "mail"})
+
+	var job *jobs.Job
+	select {
+	case job = <-srv.jobQueue.Pending():
+	default:
+		t.Fatal("expected a job to be submitted")
+	}
+	if job.Profile != "photo" || job.Output.Target != "email" {
+		t.Errorf("job profile/output = %s/%s, want photo/email", job.Profile, job.Output.Target)
+	}
+	if job.Metadata == nil || job.Metadata.Correspondent != 3 || len(job.Metadata.Tags) != 2 {
+		t.Errorf("action metadata not applied: %+v", job.Metadata)
+	}
+}
+
+func TestHandleButtonEventLegacyProfiles(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.handleButtonEvent(scanner.ButtonEvent{Button: "scan", Gesture: scanner.GestureLong, Action: config.LongPressAction})
+
+	select {
+	case job := <-srv.jobQueue.Pending():
+		if job.Profile != srv.cfg.Button.LongPressProfile {
+			t.Errorf("profile = %s, want %s", job.Profile, srv.cfg.Button.LongPressProfile)
+		}
+		if job.Output.Target != srv.cfg.Button.Output {
+			t.Errorf("output = %s, want %s", job.Output.Target, srv.cfg.Button.Output)
+		}
+	default:
+		t.Fatal("expected a job to be submitted")
+	}
+}
+
+func TestHandleButtonEventUnknownAction(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.handleButtonEvent(scanner.ButtonEvent{Button: "file", Gesture: scanner.GestureShort, Action: "nope"})
+
+	if len(srv.jobQueue.List()) != 0 {
+		t.Fatal("unknown action must not submit a job")
+	}
+}
+
+func TestHandleButtonEventAppliesTitlePattern(t *testing.T) {
+	srv := newTestServer(t)
+	srv.cfg.Button.Metadata = config.MetadataConfig{
+		TitlePattern:  "Scan_{date:YYYY}_{pages}p",
+		Correspondent: 5,
+		DocumentType:  2,
+	}
+
+	srv.handleButtonEvent(scanner.ButtonEvent{Button: "scan", Gesture: scanner.GestureShort, Action: config.ShortPressAction})
+
+	job := <-srv.jobQueue.Pending()
+	if job.Metadata == nil || job.Metadata.Correspondent != 5 || job.Metadata.DocumentType != 2 {
+		t.Fatalf("paperless IDs not applied: %+v", job.Metadata)
+	}
+
+	job.AddPage(&jobs.Page{Number: 1})
+	job.AddPage(&jobs.Page{Number: 2})
+	srv.expandPatterns(job)
+
+	want := "Scan_" + job.CreatedAt.Format("2006") + "_2p"
+	if job.Metadata.Title != want {
+		t.Errorf("title = %q, want %q", job.Metadata.Title, want)
+	}
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/output"
+)
+
+func newDeliveryServer(t *testing.T) (*Server, string, string) {
+	t.Helper()
+	srv := newTestServer(t)
+	archive, nas := t.TempDir(), t.TempDir()
+	srv.outputs = output.NewManager(config.OutputConfig{
+		Filesystem: config.FilesystemConfig{
+			Destinations: map[string]config.FilesystemTarget{
+				"archive": {Directory: archive},
+				"nas":     {Directory: nas},
+			},
+		},
+	})
+	return srv, archive, nas
+}
+
+func TestDeliverFanOut(t *testing.T) {
+	srv, archive, nas := newDeliveryServer(t)
+	profile := &config.Profile{Output: config.ProfileOutput{
+		DefaultTarget: "archive",
+		Targets: []config.ProfileTarget{
+			{Name: "nas"},
+			{Name: "offline", Optional: true},
+		},
+	}}
+	job := jobs.NewJob("standard", jobs.OutputConfig{Filename: "doc.pdf"}, nil, nil)
+	doc := &jobs.Document{Filename: "doc.pdf", Open: jobs.BytesSource([]byte("pdf"))}
+
+	warnings, _, err := srv.deliver(context.Background(), job, profile, doc)
+	if err != nil {
+		t.Fatalf("expected success with optional failure, got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "offline" {
+		t.Errorf("expected warning for offline target, got %v", warnings)
+	}
+
+	for _, dir := range []string{archive, nas} {
+		if _, err := os.Stat(filepath.Join(dir, "doc.pdf")); err != nil {
+			t.Errorf("expected document in %s: %v", dir, err)
+		}
+	}
+
+	deliveries := job.DeliveryStatuses()
+	if len(deliveries) != 3 {
+		t.Fatalf("expected 3 deliveries on the job, got %+v", deliveries)
+	}
+	if deliveries[2].Target != "offline" || deliveries[2].Status != jobs.DeliveryFailed || deliveries[2].Required {
+		t.Errorf("unexpected optional delivery: %+v", deliveries[2])
+	}
+}
+
+func TestDeliverRequiredFailure(t *testing.T) {
+	srv, _, _ := newDeliveryServer(t)
+	profile := &config.Profile{Output: config.ProfileOutput{DefaultTarget: "archive"}}
+	job := jobs.NewJob("standard", jobs.OutputConfig{
+		Targets: []jobs.OutputTarget{{Name: "offline"}},
+	}, nil, nil)
+	doc := &jobs.Document{Filename: "doc.pdf", Open: jobs.BytesSource([]byte("pdf"))}
+
+	_, _, err := srv.deliver(context.Background(), job, profile, doc)
+	if err == nil || !strings.Contains(err.Error(), "offline") {
+		t.Fatalf("expected required target failure, got %v", err)
+	}
+}
+
+func TestOutboxQueueAndRetry(t *testing.T) {
+	srv, archive, _ := newDeliveryServer(t)
+	outbox, err := output.NewOutbox(t.TempDir(), []time.Duration{time.Hour}, srv.outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetOutbox(outbox)
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{Target: "archive"}, nil, nil)
+	srv.jobQueue.Submit(job)
+	job.StartDeliveries([]jobs.OutputTarget{{Name: "archive"}})
+	doc := &jobs.Document{JobID: job.ID, Filename: "doc.pdf", Open: jobs.BytesSource([]byte("pdf"))}
+
+	d := jobs.Delivery{Target: "archive", Required: true, Status: jobs.DeliveryFailed, Attempts: 4, Error: "NAS offline"}
+	if !srv.queueDelivery(doc, &d) || d.Status != jobs.DeliveryQueued {
+		t.Fatalf("expected delivery to be queued, got %+v", d)
+	}
+	unknown := jobs.Delivery{Target: "offline", Status: jobs.DeliveryFailed}
+	if srv.queueDelivery(doc, &unknown) {
+		t.Fatal("unknown targets must not be queued")
+	}
+	job.UpdateDelivery(d)
+	if status := job.Settle(); status != jobs.StatusDelivering {
+		t.Fatalf("job with a queued required delivery is %s, want delivering", status)
+	}
+
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/outbox?state=pending", nil))
+	var list struct {
+		Items []output.OutboxItem `json:"items"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if w.Code != http.StatusOK || len(list.Items) != 1 || list.Items[0].Target != "archive" {
+		t.Fatalf("unexpected outbox list: %d %+v", w.Code, list.Items)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outbox.Run(ctx)
+
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/outbox/"+list.Items[0].ID+"/retry", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.DeliveryStatuses()[0].Status != jobs.DeliveryDelivered {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery not completed: %+v", job.DeliveryStatuses())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(filepath.Join(archive, "doc.pdf")); err != nil {
+		t.Fatalf("expected delivered document: %v", err)
+	}
+	if got := job.DeliveryStatuses()[0].Attempts; got != 5 {
+		t.Errorf("expected outbox attempt to be counted, got %d attempts", got)
+	}
+	if status := job.CurrentStatus(); status != jobs.StatusCompleted {
+		t.Errorf("expected job to complete after delivery, got %s", status)
+	}
+
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/v1/outbox/"+list.Items[0].ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for delivered item, got %d", w.Code)
+	}
+}
+
+func TestOutboxRetryAfterDeadLetterCompletesJob(t *testing.T) {
+	srv := newTestServer(t)
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The target directory cannot be created while blocker is a file.
+	srv.outputs = output.NewManager(config.OutputConfig{
+		Filesystem: config.FilesystemConfig{
+			Destinations: map[string]config.FilesystemTarget{
+				"nas": {Directory: filepath.Join(blocker, "nas")},
+			},
+		},
+	})
+	outbox, err := output.NewOutbox(t.TempDir(), []time.Duration{0}, srv.outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetOutbox(outbox)
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{Target: "nas"}, nil, nil)
+	srv.jobQueue.Submit(job)
+	job.StartDeliveries([]jobs.OutputTarget{{Name: "nas"}})
+	job.SetStatus(jobs.StatusDelivering)
+	doc := &jobs.Document{JobID: job.ID, Filename: "doc.pdf", Open: jobs.BytesSource([]byte("pdf"))}
+
+	d := jobs.Delivery{Target: "nas", Required: true, Status: jobs.DeliveryFailed, Error: "NAS offline"}
+	if !srv.queueDelivery(doc, &d) {
+		t.Fatal("expected delivery to be queued")
+	}
+	job.UpdateDelivery(d)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outbox.Run(ctx)
+
+	waitFor := func(status jobs.JobStatus) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for job.CurrentStatus() != status {
+			if time.Now().After(deadline) {
+				t.Fatalf("job status %s, want %s: %+v", job.CurrentStatus(), status, job.DeliveryStatuses())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(jobs.StatusFailed)
+	items := outbox.List()
+	if len(items) != 1 || items[0].State != output.OutboxDead {
+		t.Fatalf("expected a dead-letter item, got %+v", items)
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/outbox/"+items[0].ID+"/retry", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	waitFor(jobs.StatusCompleted)
+	if job.Error != "" {
+		t.Errorf("expected error to be cleared, got %q", job.Error)
+	}
+}
+
+func TestOutboxDiscardFailsDeliveringJob(t *testing.T) {
+	srv, _, _ := newDeliveryServer(t)
+	outbox, err := output.NewOutbox(t.TempDir(), []time.Duration{time.Hour}, srv.outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetOutbox(outbox)
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{Target: "archive"}, nil, nil)
+	srv.jobQueue.Submit(job)
+	job.StartDeliveries([]jobs.OutputTarget{{Name: "archive"}})
+	doc := &jobs.Document{JobID: job.ID, Filename: "doc.pdf", Open: jobs.BytesSource([]byte("pdf"))}
+
+	d := jobs.Delivery{Target: "archive", Required: true, Status: jobs.DeliveryFailed, Error: "NAS offline"}
+	if !srv.queueDelivery(doc, &d) {
+		t.Fatal("expected delivery to be queued")
+	}
+	job.UpdateDelivery(d)
+	job.Settle()
+
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/v1/outbox/"+outbox.List()[0].ID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if status := job.CurrentStatus(); status != jobs.StatusFailed {
+		t.Fatalf("expected discarded required delivery to fail the job, got %s", status)
+	}
+	if !strings.Contains(job.Error, "discarded") {
+		t.Errorf("unexpected job error %q", job.Error)
+	}
+}
+
+func TestDeliverRecordsPaperlessDocument(t *testing.T) {
+	paperless := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/documents/post_document/":
+			w.Write([]byte(`"task-1"`))
+		case "/api/tasks/":
+			w.Write([]byte(`[{"task_id":"task-1","status":"SUCCESS","related_document":"314"}]`))
+		}
+	}))
+	defer paperless.Close()
+
+	srv := newTestServer(t)
+	srv.outputs = output.NewManager(config.OutputConfig{
+		Paperless: config.PaperlessConfig{Enabled: true, URL: paperless.URL, Token: "tok", PublicURL: "https://docs.example.com"},
+	})
+	outbox, err := output.NewOutbox(t.TempDir(), []time.Duration{time.Hour}, srv.outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetOutbox(outbox)
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{Target: "paperless"}, nil, nil)
+	doc := &jobs.Document{JobID: job.ID, Open: jobs.BytesSource([]byte("pdf"))}
+	if _, _, err := srv.deliver(context.Background(), job, &config.Profile{}, doc); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	d := job.DeliveryStatuses()[0]
+	if d.Status != jobs.DeliveryDelivered || d.Result == nil || d.Result.DocumentID != "314" ||
+		d.Result.URL != "https://docs.example.com/documents/314/details" {
+		t.Fatalf("expected Paperless document on the job, got %+v (%+v)", d, d.Result)
+	}
+
+	rejected := jobs.Delivery{Target: "paperless", Status: jobs.DeliveryFailed, Permanent: true, Error: "duplicate"}
+	if srv.queueDelivery(doc, &rejected) {
+		t.Fatal("permanent failures must not be queued in the outbox")
+	}
+}
+
+func TestListPaperlessObjects(t *testing.T) {
+	paperless := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"next":null,"results":[{"id":1,"name":"Inbox"},{"id":2,"name":"Tax 2026"},{"id":3,"name":"Taxi"}]}`))
+	}))
+	defer paperless.Close()
+
+	srv, _, _ := newDeliveryServer(t)
+	srv.outputs = output.NewManager(config.OutputConfig{
+		Paperless:  config.PaperlessConfig{Enabled: true, URL: paperless.URL, Token: "tok"},
+		Filesystem: config.FilesystemConfig{Enabled: true, FilesystemTarget: config.FilesystemTarget{Directory: t.TempDir()}},
+	})
+
+	tests := []struct {
+		path  string
+		code  int
+		items int
+	}{
+		{"/api/v1/outputs/paperless/paperless/tags?q=tax", http.StatusOK, 2},
+		{"/api/v1/outputs/paperless/paperless/tags", http.StatusOK, 3},
+		{"/api/v1/outputs/paperless/paperless/mail_accounts", http.StatusBadRequest, 0},
+		{"/api/v1/outputs/paperless/paperless/correspondents", http.StatusBadGateway, 0},
+		{"/api/v1/outputs/filesystem/paperless/tags", http.StatusBadRequest, 0},
+		{"/api/v1/outputs/missing/paperless/tags", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d: %s", tt.path, tt.code, w.Code, w.Body.String())
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var resp struct {
+			Items []output.PaperlessObject `json:"items"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if len(resp.Items) != tt.items {
+			t.Errorf("%s: expected %d items, got %+v", tt.path, tt.items, resp.Items)
+		}
+	}
+}
@@ -1,18 +1,27 @@
 package api
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image/jpeg"
+	"io"
 	"log/slog"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	toml "github.com/pelletier/go-toml/v2"
 	"github.com/thoscut/scanflow/server/internal/config"
 	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/output"
+	"github.com/thoscut/scanflow/server/internal/scanner"
 )
 
 // validOCRLangAPI matches Tesseract language codes for API input validation.
@@ -45,6 +54,10 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}, r)
 }
 
+// readyTestInterval is the age after which the readiness probe retests the
+// output targets.
+const readyTestInterval = 5 * time.Minute
+
 // Readiness probe
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 	if !s.scanner.IsConnected() {
@@ -54,9 +67,21 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 		}, r)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]string{
-		"status": "ready",
-	}, r)
+
+	// Output tests run in the background so that probes stay fast. Failed
+	// outputs degrade readiness without failing it: deliveries to them wait
+	// in the outbox.
+	s.outputs.RefreshTests(readyTestInterval)
+	resp := map[string]any{"status": "ready"}
+	if results := s.outputs.TestResults(); len(results) > 0 {
+		for _, res := range results {
+			if !res.OK {
+				resp["status"] = "degraded"
+			}
+		}
+		resp["outputs"] = results
+	}
+	writeJSON(w, http.StatusOK, resp, r)
 }
 
 // Server status
@@ -105,6 +130,7 @@ func (s *Server) handleOpenDevice(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, err.Error(), r)
 		return
 	}
+	s.metrics.SetScannerOnline(true)
 	writeJSON(w, http.StatusOK, map[string]string{"status": "opened"}, r)
 }
 
@@ -113,6 +139,7 @@ func (s *Server) handleCloseDevice(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, err.Error(), r)
 		return
 	}
+	s.metrics.SetScannerOnline(false)
 	writeJSON(w, http.StatusOK, map[string]string{"status": "closed"}, r)
 }
 
@@ -122,6 +149,63 @@ func (s *Server) handleGetCapabilities(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, caps, r)
 }
 
+// previewResponse is returned by the preview endpoint. Regions selected on the
+// image are converted to millimetres with width_mm/height_mm and passed as
+// options.area in a scan request.
+type previewResponse struct {
+	Image      string  `json:"image"` // data URL (image/jpeg)
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Resolution int     `json:"resolution"`
+	WidthMM    float64 `json:"width_mm"`
+	HeightMM   float64 `json:"height_mm"`
+}
+
+func (s *Server) handlePreviewScan(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Resolution int    `json:"resolution"`
+		Mode       string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body", r)
+		return
+	}
+	if req.Resolution < 0 || req.Resolution > 300 {
+		writeError(w, http.StatusBadRequest, "preview resolution must be between 1 and 300 dpi, or 0 for the default", r)
+		return
+	}
+
+	preview, err := s.scanner.Preview(r.Context(), req.Resolution, req.Mode)
+	switch {
+	case errors.Is(err, scanner.ErrNotConnected):
+		writeError(w, http.StatusServiceUnavailable, err.Error(), r)
+		return
+	case errors.Is(err, scanner.ErrBusy):
+		writeError(w, http.StatusConflict, err.Error(), r)
+		return
+	case err != nil:
+		slog.Error("preview scan failed", "error", err)
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, preview.Image, &jpeg.Options{Quality: 75}); err != nil {
+		writeError(w, http.StatusInternalServerError, "encode preview: "+err.Error(), r)
+		return
+	}
+
+	bounds := preview.Image.Bounds()
+	writeJSON(w, http.StatusOK, previewResponse{
+		Image:      "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		Resolution: preview.Resolution,
+		WidthMM:    preview.WidthMM,
+		HeightMM:   preview.HeightMM,
+	}, r)
+}
+
 // Scan operations
 func (s *Server) handleStartScan(w http.ResponseWriter, r *http.Request) {
 	var req jobs.ScanRequest
@@ -130,30 +214,51 @@ func (s *Server) handleStartScan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	job, err := s.newScanJob(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), r)
+		return
+	}
+
+	if err := s.jobQueue.Submit(job); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+
+	slog.Info("scan started via API", "job_id", job.ID, "profile", job.Profile)
+	writeJSON(w, http.StatusAccepted, job, r)
+}
+
+// newScanJob validates a scan request and creates its job. The profile
+// defaults to "standard" and the output target to the profile's default.
+func (s *Server) newScanJob(req jobs.ScanRequest) (*jobs.Job, error) {
 	profile := req.Profile
 	if profile == "" {
 		profile = "standard"
 	}
 
-	if _, ok := s.profiles.Get(profile); !ok {
-		writeError(w, http.StatusBadRequest, "unknown profile: "+profile, r)
-		return
+	prof, ok := s.profiles.Get(profile)
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s", profile)
+	}
+	if err := s.scanner.ValidateOptions(scanOptions(prof, req.Options)); err != nil {
+		return nil, fmt.Errorf("invalid scan options: %w", err)
 	}
 
-	outputCfg := jobs.OutputConfig{Target: "paperless"}
+	var outputCfg jobs.OutputConfig
 	if req.Output != nil {
 		outputCfg = *req.Output
 	}
-
-	job := jobs.NewJob(profile, outputCfg, req.Metadata, req.OcrEnabled)
-
-	if err := s.jobQueue.Submit(job); err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error(), r)
-		return
+	if err := s.validateOutput(outputCfg); err != nil {
+		return nil, err
+	}
+	if outputCfg.Target == "" {
+		outputCfg.Target = prof.Output.DefaultTarget
 	}
 
-	slog.Info("scan started via API", "job_id", job.ID, "profile", profile)
-	writeJSON(w, http.StatusAccepted, job, r)
+	job := jobs.NewJob(profile, outputCfg, req.Metadata, req.OcrEnabled)
+	job.Options = req.Options
+	return job, nil
 }
 
 func (s *Server) handleGetJobStatus(w http.ResponseWriter, r *http.Request) {
@@ -211,6 +316,18 @@ func (s *Server) handleContinueScan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Resume a job that was paused by a scanner fault once the operator has
+	// cleared it; scanning continues with the next page. Resume succeeds only
+	// once, so a repeated request cannot queue the job twice.
+	if job.Resume(jobs.StatusScanning) {
+		if err := s.jobQueue.Requeue(jobID); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error(), r)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "resuming"}, r)
+		return
+	}
+
 	if job.Status != jobs.StatusScanning && job.Status != jobs.StatusPending {
 		writeError(w, http.StatusBadRequest, "job is not in scanning state", r)
 		return
@@ -229,6 +346,12 @@ func (s *Server) handleFinishScan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A pending job has no pages yet; the worker would scan it anyway.
+	if job.CurrentStatus() == jobs.StatusPending {
+		writeError(w, http.StatusConflict, "job has not started scanning", r)
+		return
+	}
+
 	// Parse optional output/metadata overrides
 	var req struct {
 		Output   *jobs.OutputConfig     `json:"output,omitempty"`
@@ -239,12 +362,41 @@ func (s *Server) handleFinishScan(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.Output != nil {
+		if err := s.validateOutput(*req.Output); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error(), r)
+			return
+		}
 		job.Output = *req.Output
 	}
 	if req.Metadata != nil {
 		job.Metadata = req.Metadata
 	}
 
+	// A job paused by a scanner fault is finished with the pages scanned so
+	// far by sending it back to the worker for processing and delivery.
+	if job.CurrentStatus() == jobs.StatusNeedsAttention {
+		if job.PageCount() == 0 {
+			writeError(w, http.StatusBadRequest, "job has no scanned pages", r)
+			return
+		}
+		if job.Resume(jobs.StatusProcessing) {
+			job.MarkFinish()
+			if err := s.jobQueue.Requeue(jobID); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error(), r)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"status": "finishing"}, r)
+			return
+		}
+	}
+
+	// A wait_for_paper or continuous session only ends on request; the
+	// worker then processes the pages scanned so far.
+	if job.CurrentStatus() == jobs.StatusScanning && s.scanner.FinishBatch() {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "finishing"}, r)
+		return
+	}
+
 	job.SetStatus(jobs.StatusProcessing)
 	writeJSON(w, http.StatusOK, map[string]string{"status": "finishing"}, r)
 }
@@ -301,6 +453,20 @@ func (s *Server) handleReorderPages(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "reordered"}, r)
 }
 
+// validateOutput checks that every output target named in a request is
+// configured. An empty primary target falls back to the profile default.
+func (s *Server) validateOutput(out jobs.OutputConfig) error {
+	if out.Target != "" && !s.outputs.Has(out.Target) {
+		return fmt.Errorf("unknown output target: %s", out.Target)
+	}
+	for _, t := range out.Targets {
+		if !s.outputs.Has(t.Name) {
+			return fmt.Errorf("unknown output target: %s", t.Name)
+		}
+	}
+	return nil
+}
+
 // Output targets
 func (s *Server) handleListOutputs(w http.ResponseWriter, r *http.Request) {
 	outputs := s.outputs.ListTargets()
@@ -326,6 +492,51 @@ func (s *Server) handleSendOutput(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "sending"}, r)
 }
 
+// handleTestOutput runs the connectivity test of an output target.
+func (s *Server) handleTestOutput(w http.ResponseWriter, r *http.Request) {
+	res, ok := s.outputs.Test(r.Context(), chi.URLParam(r, "name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "output not found", r)
+		return
+	}
+	writeJSON(w, http.StatusOK, res, r)
+}
+
+// handleListPaperlessObjects proxies the tags, correspondents, document
+// types or storage paths of a Paperless output, so clients can offer
+// completion for metadata names.
+func (s *Server) handleListPaperlessObjects(w http.ResponseWriter, r *http.Request) {
+	h, ok := s.outputs.Handler(chi.URLParam(r, "name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "output not found", r)
+		return
+	}
+	paperless, ok := h.(*output.PaperlessHandler)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "output is not a paperless output", r)
+		return
+	}
+
+	objects, err := paperless.ListObjects(r.Context(), chi.URLParam(r, "kind"))
+	if errors.Is(err, output.ErrUnknownPaperlessKind) {
+		writeError(w, http.StatusBadRequest, err.Error(), r)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error(), r)
+		return
+	}
+
+	items := []output.PaperlessObject{}
+	q := strings.ToLower(r.URL.Query().Get("q"))
+	for _, obj := range objects {
+		if q == "" || strings.Contains(strings.ToLower(obj.Name), q) {
+			items = append(items, obj)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items}, r)
+}
+
 // Profiles
 func (s *Server) handleListProfiles(w http.ResponseWriter, r *http.Request) {
 	profiles := s.profiles.List()
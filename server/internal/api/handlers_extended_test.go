@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/thoscut/scanflow/server/internal/config"
 	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/scanner"
 )
 
 func TestGetJobStatusFound(t *testing.T) {
@@ -399,6 +402,40 @@ func TestStartScanWithOutputOverride(t *testing.T) {
 	}
 }
 
+func TestStartScanUnknownOutput(t *testing.T) {
+	srv := newTestServer(t)
+
+	body, _ := json.Marshal(jobs.ScanRequest{
+		Profile: "standard",
+		Output:  &jobs.OutputConfig{Target: "smb-missing"},
+	})
+	req := httptest.NewRequest("POST", "/api/v1/scan", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStartScanUsesProfileDefaultOutput(t *testing.T) {
+	srv := newTestServer(t)
+
+	body, _ := json.Marshal(jobs.ScanRequest{Profile: "photo"})
+	req := httptest.NewRequest("POST", "/api/v1/scan", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job jobs.Job
+	json.NewDecoder(w.Body).Decode(&job)
+	if job.Output.Target != "filesystem" {
+		t.Fatalf("expected photo profile default target 'filesystem', got %q", job.Output.Target)
+	}
+}
+
 func TestStartScanWithMetadata(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -493,3 +530,346 @@ func TestStartScanDefaultProfile(t *testing.T) {
 		t.Fatalf("expected profile 'standard', got %s", job.Profile)
 	}
 }
+
+func TestDeviceOfflineAbortsScanningJobs(t *testing.T) {
+	srv := newTestServer(t)
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{}, nil, nil)
+	srv.jobQueue.Submit(job)
+	job.SetStatus(jobs.StatusScanning)
+
+	srv.handleDeviceEvent(scanner.DeviceEvent{Type: scanner.DeviceOffline, Device: "test:0"})
+
+	if job.CurrentStatus() != jobs.StatusFailed {
+		t.Fatalf("expected job to be failed, got %s", job.CurrentStatus())
+	}
+	if !strings.Contains(job.Error, "offline") {
+		t.Fatalf("expected offline error, got %q", job.Error)
+	}
+
+	select {
+	case update := <-srv.wsHub.broadcast:
+		if update.Type != "device_offline" || update.Device != "test:0" {
+			t.Fatalf("unexpected broadcast: %+v", update)
+		}
+	default:
+		t.Fatal("expected device_offline broadcast")
+	}
+}
+
+func TestProcessJobPausesOnPaperJam(t *testing.T) {
+	srv := newTestServer(t)
+	srv.scanner.SetBackend(scanner.NewFaultBackend(2, scanner.ErrJammed))
+	srv.scanner.Init()
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{}, nil, nil)
+	srv.jobQueue.Submit(job)
+	<-srv.jobQueue.Pending()
+
+	srv.processJob(job)
+
+	if job.CurrentStatus() != jobs.StatusNeedsAttention {
+		t.Fatalf("expected needs_attention, got %s (%s)", job.CurrentStatus(), job.Error)
+	}
+	if job.PageCount() != 2 {
+		t.Fatalf("expected 2 pages kept, got %d", job.PageCount())
+	}
+	if job.Error == "" {
+		t.Fatal("expected fault to be recorded on the job")
+	}
+
+	// Resume: the job goes back on the queue in scanning state.
+	req := httptest.NewRequest("POST", "/api/v1/scan/"+job.ID+"/continue", nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case requeued := <-srv.jobQueue.Pending():
+		if requeued.ID != job.ID {
+			t.Fatalf("expected job %s to be requeued, got %s", job.ID, requeued.ID)
+		}
+	default:
+		t.Fatal("expected job to be requeued")
+	}
+	if job.CurrentStatus() != jobs.StatusScanning || job.Error != "" {
+		t.Fatalf("expected scanning without error, got %s (%q)", job.CurrentStatus(), job.Error)
+	}
+}
+
+func TestContinueScanRequeuesPausedJobOnce(t *testing.T) {
+	srv := newTestServer(t)
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{}, nil, nil)
+	srv.jobQueue.Submit(job)
+	<-srv.jobQueue.Pending()
+	job.SetNeedsAttention(scanner.ErrJammed)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/api/v1/scan/"+job.ID+"/continue", nil)
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("continue %d: expected 200, got %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+
+	<-srv.jobQueue.Pending()
+	select {
+	case <-srv.jobQueue.Pending():
+		t.Fatal("job was requeued twice")
+	default:
+	}
+}
+
+func TestFinishScanAfterPaperJam(t *testing.T) {
+	srv := newTestServer(t)
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{}, nil, nil)
+	srv.jobQueue.Submit(job)
+	<-srv.jobQueue.Pending()
+	job.AddPage(&jobs.Page{Number: 1})
+	job.SetNeedsAttention(scanner.ErrJammed)
+
+	req := httptest.NewRequest("POST", "/api/v1/scan/"+job.ID+"/finish", nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if job.CurrentStatus() != jobs.StatusProcessing {
+		t.Fatalf("expected processing, got %s", job.CurrentStatus())
+	}
+	select {
+	case <-srv.jobQueue.Pending():
+	default:
+		t.Fatal("expected job to be requeued for processing")
+	}
+	if !job.TakeFinish() {
+		t.Fatal("expected the requeued job to skip scanning")
+	}
+}
+
+func TestFinishScanEndsContinuousSession(t *testing.T) {
+	srv := newTestServer(t)
+	srv.scanner.SetBackend(scanner.NewTestBackend(1))
+	srv.scanner.Init()
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{}, nil, nil)
+	job.Options = &jobs.ScanOptions{BatchMode: "continuous"}
+	srv.jobQueue.Submit(job)
+	<-srv.jobQueue.Pending()
+
+	processed := make(chan struct{})
+	go func() {
+		srv.processJob(job)
+		close(processed)
+	}()
+
+	// The feeder empties after one page and the session waits for more.
+	deadline := time.After(5 * time.Second)
+	for job.PageCount() == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("first page was not scanned")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/api/v1/scan/"+job.ID+"/finish", nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("continuous session kept scanning after finish")
+	}
+	if job.PageCount() != 1 {
+		t.Fatalf("expected 1 page, got %d", job.PageCount())
+	}
+	if status := job.CurrentStatus(); status == jobs.StatusScanning {
+		t.Fatalf("job still scanning after finish")
+	}
+}
+
+func TestFinishScanRejectsPendingJob(t *testing.T) {
+	srv := newTestServer(t)
+
+	job := jobs.NewJob("standard", jobs.OutputConfig{}, nil, nil)
+	srv.jobQueue.Submit(job)
+
+	req := httptest.NewRequest("POST", "/api/v1/scan/"+job.ID+"/finish", nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if job.CurrentStatus() != jobs.StatusPending || job.TakeFinish() {
+		t.Fatalf("pending job must be left alone, got %s", job.CurrentStatus())
+	}
+}
+
+func TestStartScanRejectsInvalidOptions(t *testing.T) {
+	srv := newTestServer(t)
+
+	body, _ := json.Marshal(jobs.ScanRequest{
+		Profile: "standard",
+		Options: &jobs.ScanOptions{Brightness: 500},
+	})
+	req := httptest.NewRequest("POST", "/api/v1/scan", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "brightness") {
+		t.Errorf("expected brightness in error, got %s", w.Body.String())
+	}
+}
+
+func TestStartScanStoresOptions(t *testing.T) {
+	srv := newTestServer(t)
+
+	body, _ := json.Marshal(jobs.ScanRequest{
+		Profile: "standard",
+		Options: &jobs.ScanOptions{Resolution: 150, PaperSize: "a5"},
+	})
+	req := httptest.NewRequest("POST", "/api/v1/scan", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job jobs.Job
+	json.NewDecoder(w.Body).Decode(&job)
+	if job.Options == nil || job.Options.Resolution != 150 || job.Options.PaperSize != "a5" {
+		t.Fatalf("request options not stored on job: %+v", job.Options)
+	}
+}
+
+func TestScanOptionsMergesOverrides(t *testing.T) {
+	srv := newTestServer(t)
+	profile, ok := srv.profiles.Get("standard")
+	if !ok {
+		t.Fatal("standard profile missing")
+	}
+
+	base := scanOptions(profile, nil)
+	if base.Resolution != profile.Scanner.Resolution || base.Mode != profile.Scanner.Mode {
+		t.Fatalf("profile settings not applied: %+v", base)
+	}
+
+	opts := scanOptions(profile, &jobs.ScanOptions{
+		Resolution: 600,
+		Mode:       "gray",
+		Brightness: 15,
+		Contrast:   -5,
+		PaperSize:  "letter",
+		Area:       &jobs.ScanArea{TLX: 5, TLY: 5, BRX: 100, BRY: 100},
+		BatchMode:  "continuous",
+	})
+	if opts.Resolution != 600 || opts.Mode != "gray" {
+		t.Errorf("resolution/mode not overridden: %+v", opts)
+	}
+	if opts.Source != profile.Scanner.Source {
+		t.Errorf("source = %q, want profile value %q", opts.Source, profile.Scanner.Source)
+	}
+	if opts.Brightness != 15 || opts.Contrast != -5 {
+		t.Errorf("brightness/contrast not overridden: %+v", opts)
+	}
+	if opts.PaperSize != "letter" || opts.PageWidth != 0 || opts.PageHeight != 0 {
+		t.Errorf("paper size should replace page dimensions: %+v", opts)
+	}
+	if opts.Area == nil || opts.Area.BRX != 100 {
+		t.Errorf("area not applied: %+v", opts.Area)
+	}
+	if opts.BatchMode != scanner.BatchContinuous {
+		t.Errorf("batch mode = %q, want continuous", opts.BatchMode)
+	}
+}
+
+func TestPreviewScanEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+	srv.scanner.SetBackend(scanner.NewTestBackend(1))
+	srv.scanner.Init()
+
+	req := httptest.NewRequest("POST", "/api/v1/scanner/preview", nil)
+	w := httptest.NewRecorder()
+
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp previewResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !strings.HasPrefix(resp.Image, "data:image/jpeg;base64,") {
+		t.Errorf("expected JPEG data URL, got %.40q", resp.Image)
+	}
+	if resp.Resolution != scanner.DefaultPreviewResolution || resp.Width == 0 || resp.WidthMM == 0 || resp.HeightMM == 0 {
+		t.Errorf("missing preview dimensions: %+v", resp)
+	}
+	if len(srv.jobQueue.List()) != 0 {
+		t.Error("preview must not create a job")
+	}
+}
+
+func TestPreviewScanInvalidResolution(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := httptest.NewRequest("POST", "/api/v1/scanner/preview", strings.NewReader(`{"resolution": 1200}`))
+	w := httptest.NewRecorder()
+
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestPreviewScanNotConnected(t *testing.T) {
+	srv := newTestServer(t)
+	srv.scanner.Close()
+
+	req := httptest.NewRequest("POST", "/api/v1/scanner/preview", nil)
+	w := httptest.NewRecorder()
+
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", w.Code)
+	}
+}
+
+func TestExpandPatternsForAPIJob(t *testing.T) {
+	srv := newTestServer(t)
+
+	job := jobs.NewJob("standard",
+		jobs.OutputConfig{Target: "filesystem", Filename: "{profile}_{counter:3}"},
+		&jobs.DocumentMetadata{Title: "Invoice {counter} ({job_id:8})"}, nil)
+	srv.expandPatterns(job)
+
+	if want := "Invoice 1 (" + job.ID[:8] + ")"; job.Metadata.Title != want {
+		t.Errorf("title = %q, want %q", job.Metadata.Title, want)
+	}
+	// Title and filename share one counter value per job.
+	if job.Output.Filename != "standard_001" {
+		t.Errorf("filename = %q, want standard_001", job.Output.Filename)
+	}
+}
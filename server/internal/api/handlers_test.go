@@ -2,9 +2,13 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/thoscut/scanflow/server/internal/config"
@@ -19,6 +23,7 @@ func newTestServer(t *testing.T) *Server {
 
 	cfg := config.DefaultConfig()
 	cfg.Server.Auth.Enabled = false // Disable auth for tests
+	cfg.Output.Filesystem.Directory = t.TempDir()
 
 	sc := scanner.New("", true, scanner.ScanOptions{})
 	sc.Init()
@@ -419,6 +424,47 @@ func TestReadyEndpoint(t *testing.T) {
 	}
 }
 
+func TestTestOutputEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := httptest.NewRequest("POST", "/api/v1/outputs/filesystem/test", nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var res output.TestResult
+	json.NewDecoder(w.Body).Decode(&res)
+	if !res.OK || !res.Supported || res.Target != "filesystem" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	req = httptest.NewRequest("POST", "/api/v1/outputs/missing/test", nil)
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown output, got %d", w.Code)
+	}
+
+	// Failed outputs degrade readiness without failing it.
+	srv.cfg.Output.Filesystem.Directory = "/dev/null/archive"
+	srv.outputs = output.NewManager(srv.cfg.Output)
+	srv.outputs.Test(context.Background(), "filesystem")
+
+	req = httptest.NewRequest("GET", "/api/v1/ready", nil)
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	var ready struct {
+		Status  string              `json:"status"`
+		Outputs []output.TestResult `json:"outputs"`
+	}
+	json.NewDecoder(w.Body).Decode(&ready)
+	if w.Code != http.StatusOK || ready.Status != "degraded" || len(ready.Outputs) != 1 || ready.Outputs[0].OK {
+		t.Fatalf("expected degraded readiness, got %d %+v", w.Code, ready)
+	}
+}
+
 func TestRequestIDInErrorResponse(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -592,3 +638,139 @@ func TestGetCapabilitiesEndpoint(t *testing.T) {
 		t.Fatalf("expected positive max_height_mm, got %f", caps.MaxHeight)
 	}
 }
+
+func TestManagedOutputLifecycle(t *testing.T) {
+	srv := newTestServer(t)
+	store, err := config.NewOutputStore(filepath.Join(t.TempDir(), "outputs.toml"))
+	if err != nil {
+		t.Fatalf("NewOutputStore: %v", err)
+	}
+	srv.SetOutputStore(store)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	archive := t.TempDir()
+	w := do("POST", "/api/v1/outputs", `{"name": "archiv-2", "type": "filesystem", "filesystem": {"directory": "`+archive+`"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/api/v1/outputs/archiv-2/test", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ok":true`) {
+		t.Fatalf("new output not applied: %d %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", "/api/v1/outputs", `{"name": "smb-tax", "type": "smb", "smb": {"server": "//nas.local", "share": "scans"}, "secrets": {"password": "s3cret"}}`)
+	if w.Code != http.StatusCreated || strings.Contains(w.Body.String(), "s3cret") || !strings.Contains(w.Body.String(), `"secrets":["password"]`) {
+		t.Fatalf("unexpected create response %d: %s", w.Code, w.Body.String())
+	}
+	for _, tt := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/api/v1/outputs", `{"name": "filesystem", "type": "filesystem", "filesystem": {"directory": "/tmp"}}`, http.StatusConflict},
+		{"POST", "/api/v1/outputs", `{"name": "x", "type": "smb", "smb": {"server": "//nas.local"}}`, http.StatusBadRequest},
+		{"PUT", "/api/v1/outputs/filesystem", `{}`, http.StatusConflict},
+		{"GET", "/api/v1/outputs/missing", "", http.StatusNotFound},
+		{"PUT", "/api/v1/outputs/smb-tax", `{"name": "other", "type": "smb", "smb": {"server": "//nas.local", "share": "scans"}}`, http.StatusBadRequest},
+	} {
+		if w := do(tt.method, tt.path, tt.body); w.Code != tt.code {
+			t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.code, w.Code, w.Body.String())
+		}
+	}
+
+	w = do("PUT", "/api/v1/outputs/smb-tax", `{"type": "smb", "smb": {"server": "//nas.local", "share": "scans", "directory": "Steuer"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got struct {
+		SMB     map[string]any `json:"smb"`
+		Secrets []string       `json:"secrets"`
+	}
+	json.NewDecoder(do("GET", "/api/v1/outputs/smb-tax", "").Body).Decode(&got)
+	if got.SMB["directory"] != "Steuer" || len(got.Secrets) != 1 {
+		t.Errorf("unexpected output %+v", got)
+	}
+
+	var list struct {
+		Outputs []output.Target `json:"outputs"`
+	}
+	json.NewDecoder(do("GET", "/api/v1/outputs", "").Body).Decode(&list)
+	managed := 0
+	for _, o := range list.Outputs {
+		if o.Managed {
+			managed++
+		}
+	}
+	if managed != 2 {
+		t.Errorf("expected 2 managed outputs, got %+v", list.Outputs)
+	}
+
+	if w := do("DELETE", "/api/v1/outputs/smb-tax", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if srv.outputs.Has("smb-tax") {
+		t.Error("deleted output is still registered")
+	}
+}
+
+// fileSettings lists the TOML keys of t and its embedded structs that name
+// files on the server.
+func fileSettings(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			keys = append(keys, fileSettings(f.Type)...)
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if strings.HasSuffix(key, "_file") || strings.HasSuffix(key, "_files") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestManagedOutputRejectsFileSettings(t *testing.T) {
+	srv := newTestServer(t)
+	store, err := config.NewOutputStore(filepath.Join(t.TempDir(), "outputs.toml"))
+	if err != nil {
+		t.Fatalf("NewOutputStore: %v", err)
+	}
+	srv.SetOutputStore(store)
+
+	tested := map[string]bool{}
+	inst := reflect.TypeOf(config.OutputInstance{})
+	for i := 0; i < inst.NumField(); i++ {
+		f := inst.Field(i)
+		if f.Type.Kind() != reflect.Pointer {
+			continue
+		}
+		typ, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		for _, key := range fileSettings(f.Type.Elem()) {
+			var value any = "/etc/shadow"
+			if strings.HasSuffix(key, "_files") {
+				value = map[string]string{"Authorization": "/etc/shadow"}
+			}
+			body, _ := json.Marshal(map[string]any{"name": "leak", "type": typ, typ: map[string]any{key: value}})
+
+			w := httptest.NewRecorder()
+			srv.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/outputs", bytes.NewReader(body)))
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), key) {
+				t.Errorf("%s.%s: expected 400 naming the setting, got %d: %s", typ, key, w.Code, w.Body.String())
+			}
+			tested[typ+"."+key] = true
+		}
+	}
+	for _, key := range []string{"s3.access_key_id_file", "sftp.known_hosts_file", "http.header_files"} {
+		if !tested[key] {
+			t.Errorf("%s was not tested", key)
+		}
+	}
+	if len(store.List()) != 0 {
+		t.Error("outputs with file settings must not be stored")
+	}
+}
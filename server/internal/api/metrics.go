@@ -23,6 +23,11 @@ type Metrics struct {
 	// Page counter.
 	scanPagesTotal atomic.Int64
 
+	// Scanner device availability.
+	scannerOnline      atomic.Int64
+	scannerOnlineTotal atomic.Int64
+	scannerOffline     atomic.Int64
+
 	// HTTP request counter by status code bucket.
 	httpRequests2xx atomic.Int64
 	httpRequests3xx atomic.Int64
@@ -86,6 +91,31 @@ func (m *Metrics) PageScanned() {
 	m.scanPagesTotal.Add(1)
 }
 
+// ---------------------------------------------------------------------------
+// Scanner device helpers
+// ---------------------------------------------------------------------------
+
+// SetScannerOnline sets the scanner-online gauge without counting an event.
+func (m *Metrics) SetScannerOnline(online bool) {
+	if online {
+		m.scannerOnline.Store(1)
+	} else {
+		m.scannerOnline.Store(0)
+	}
+}
+
+// DeviceOnline records a scanner reconnect and sets the online gauge.
+func (m *Metrics) DeviceOnline() {
+	m.scannerOnline.Store(1)
+	m.scannerOnlineTotal.Add(1)
+}
+
+// DeviceOffline records a scanner disconnect and clears the online gauge.
+func (m *Metrics) DeviceOffline() {
+	m.scannerOnline.Store(0)
+	m.scannerOffline.Add(1)
+}
+
 // ---------------------------------------------------------------------------
 // HTTP helpers
 // ---------------------------------------------------------------------------
@@ -142,6 +172,16 @@ func (m *Metrics) Handler() http.HandlerFunc {
 		fmt.Fprint(w, "# TYPE scanflow_scan_pages_total counter\n")
 		fmt.Fprintf(w, "scanflow_scan_pages_total %d\n", m.scanPagesTotal.Load())
 
+		// Scanner device
+		fmt.Fprint(w, "# HELP scanflow_scanner_online Whether the scanner device is connected (1) or not (0).\n")
+		fmt.Fprint(w, "# TYPE scanflow_scanner_online gauge\n")
+		fmt.Fprintf(w, "scanflow_scanner_online %d\n", m.scannerOnline.Load())
+
+		fmt.Fprint(w, "# HELP scanflow_scanner_device_events_total Total number of scanner device availability changes.\n")
+		fmt.Fprint(w, "# TYPE scanflow_scanner_device_events_total counter\n")
+		fmt.Fprintf(w, "scanflow_scanner_device_events_total{event=\"online\"} %d\n", m.scannerOnlineTotal.Load())
+		fmt.Fprintf(w, "scanflow_scanner_device_events_total{event=\"offline\"} %d\n", m.scannerOffline.Load())
+
 		// HTTP requests
 		fmt.Fprint(w, "# HELP scanflow_http_requests_total Total number of HTTP requests by status code class.\n")
 		fmt.Fprint(w, "# TYPE scanflow_http_requests_total counter\n")
@@ -208,3 +208,28 @@ func TestMetricsEndpointViaRouter(t *testing.T) {
 		t.Fatalf("expected metrics output, got:\n%s", body)
 	}
 }
+
+func TestMetricsScannerDeviceEvents(t *testing.T) {
+	m := NewMetrics()
+
+	m.SetScannerOnline(true)
+	m.DeviceOffline()
+	m.DeviceOnline()
+	m.DeviceOffline()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, req)
+
+	body := w.Body.String()
+	expect := []string{
+		`scanflow_scanner_online 0`,
+		`scanflow_scanner_device_events_total{event="online"} 1`,
+		`scanflow_scanner_device_events_total{event="offline"} 2`,
+	}
+	for _, e := range expect {
+		if !strings.Contains(body, e) {
+			t.Errorf("expected %q in output, body:\n%s", e, body)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/mqtt"
+)
+
+// SetMQTT mirrors events to an MQTT broker. The publisher connects when the
+// server starts.
+func (s *Server) SetMQTT(p *mqtt.Publisher) {
+	s.mqtt = p
+}
+
+// broadcast sends an event to WebSocket clients and the MQTT broker.
+func (s *Server) broadcast(update jobs.ProgressUpdate) {
+	s.wsHub.Broadcast(update)
+	if s.mqtt != nil {
+		s.mqtt.Publish(update)
+	}
+}
+
+// mqttBridge gives the MQTT publisher access to the server.
+type mqttBridge struct {
+	s *Server
+}
+
+func (b mqttBridge) ScannerOnline() bool {
+	return b.s.scanner.IsConnected()
+}
+
+func (b mqttBridge) Profiles() []string {
+	return b.s.profiles.Names()
+}
+
+func (b mqttBridge) ButtonTriggers() []mqtt.ButtonTrigger {
+	if !b.s.cfg.Button.Enabled {
+		return nil
+	}
+	bindings, _ := b.s.cfg.Button.EffectiveBindings()
+	triggers := make([]mqtt.ButtonTrigger, 0, len(bindings))
+	seen := make(map[mqtt.ButtonTrigger]bool)
+	for _, bind := range bindings {
+		t := mqtt.ButtonTrigger{Button: bind.Button, Gesture: bind.Gesture}
+		if !seen[t] {
+			seen[t] = true
+			triggers = append(triggers, t)
+		}
+	}
+	return triggers
+}
+
+func (b mqttBridge) StartScan(req jobs.ScanRequest) (*jobs.Job, error) {
+	job, err := b.s.newScanJob(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.s.jobQueue.Submit(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+func TestMQTTBridgeStartScan(t *testing.T) {
+	srv := newTestServer(t)
+	bridge := mqttBridge{srv}
+
+	if _, err := bridge.StartScan(jobs.ScanRequest{Profile: "nonexistent"}); err == nil || !strings.Contains(err.Error(), "unknown profile") {
+		t.Errorf("expected unknown profile error, got %v", err)
+	}
+	if _, err := bridge.StartScan(jobs.ScanRequest{Output: &jobs.OutputConfig{Target: "nowhere"}}); err == nil {
+		t.Error("expected an error for an unknown output target")
+	}
+
+	job, err := bridge.StartScan(jobs.ScanRequest{
+		Profile:  "photo",
+		Output:   &jobs.OutputConfig{Target: "filesystem"},
+		Metadata: &jobs.DocumentMetadata{Title: "Urlaub"},
+	})
+	if err != nil {
+		t.Fatalf("StartScan: %v", err)
+	}
+	if queued, ok := srv.jobQueue.Get(job.ID); !ok || queued.Profile != "photo" || queued.Output.Target != "filesystem" {
+		t.Errorf("job not queued as requested: %+v", queued)
+	}
+}
+
+func TestMQTTBridgeButtonTriggers(t *testing.T) {
+	srv := newTestServer(t)
+	bridge := mqttBridge{srv}
+
+	if got := bridge.ButtonTriggers(); len(got) != 0 {
+		t.Errorf("expected no triggers with buttons disabled, got %v", got)
+	}
+
+	srv.cfg.Button.Enabled = true
+	got := bridge.ButtonTriggers()
+	if len(got) != 2 || got[0].Button != "scan" || got[0].Gesture != "short" || got[1].Gesture != "long" {
+		t.Errorf("unexpected triggers %v", got)
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/output"
+)
+
+// SetOutbox enables the persistent delivery outbox. Deliveries that fail
+// their immediate retries are queued there instead of failing the job.
+func (s *Server) SetOutbox(o *output.Outbox) {
+	s.outbox = o
+	o.Notify(s.handleOutboxUpdate)
+}
+
+// queueDelivery moves a failed delivery to the outbox. It reports false when
+// the delivery cannot be queued and has to be treated as failed.
+func (s *Server) queueDelivery(doc *jobs.Document, d *jobs.Delivery) bool {
+	if s.outbox == nil || d.Permanent || !s.outputs.Has(d.Target) {
+		return false
+	}
+	item, err := s.outbox.Enqueue(doc, d.Target, d.Required, errors.New(d.Error))
+	if err != nil {
+		slog.Error("failed to queue delivery in outbox", "job_id", doc.JobID, "target", d.Target, "error", err)
+		return false
+	}
+	d.Status = jobs.DeliveryQueued
+	d.UpdatedAt = item.CreatedAt
+	return true
+}
+
+// handleOutboxUpdate records the outcome of an outbox attempt on the job it
+// belongs to. A required delivery that reaches the dead-letter list fails
+// the job; a delivering or failed job completes once every required
+// delivery succeeded.
+func (s *Server) handleOutboxUpdate(item output.OutboxItem) {
+	d := jobs.Delivery{Target: item.Target, Required: item.Required}
+	job, ok := s.jobQueue.Get(item.JobID)
+	if ok {
+		for _, existing := range job.DeliveryStatuses() {
+			if existing.Target == item.Target {
+				d = existing
+			}
+		}
+	}
+	d.Status = outboxDeliveryStatus(item)
+	d.Attempts++
+	d.Error = item.LastError
+	d.Result = item.Result
+	d.UpdatedAt = item.UpdatedAt
+	s.broadcast(deliveryUpdate(item.JobID, d))
+	if !ok {
+		return
+	}
+
+	job.UpdateDelivery(d)
+	switch {
+	case d.Status == jobs.DeliveryFailed && d.Required:
+		job.SetError(fmt.Errorf("output failed: %s moved to dead-letter list: %s", item.Target, item.LastError))
+	case d.Status == jobs.DeliveryDelivered:
+		if status := job.CurrentStatus(); status == jobs.StatusDelivering || status == jobs.StatusFailed {
+			job.Settle()
+		}
+	}
+	s.jobQueue.SaveJob(job.ID)
+	s.broadcastJobUpdate(job)
+}
+
+func outboxDeliveryStatus(item output.OutboxItem) jobs.DeliveryStatus {
+	switch {
+	case item.LastError == "":
+		return jobs.DeliveryDelivered
+	case item.State == output.OutboxDead:
+		return jobs.DeliveryFailed
+	default:
+		return jobs.DeliveryQueued
+	}
+}
+
+func (s *Server) handleListOutbox(w http.ResponseWriter, r *http.Request) {
+	items := []output.OutboxItem{}
+	if s.outbox != nil {
+		state := output.OutboxState(r.URL.Query().Get("state"))
+		for _, item := range s.outbox.List() {
+			if state == "" || item.State == state {
+				items = append(items, item)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items}, r)
+}
+
+func (s *Server) handleRetryOutbox(w http.ResponseWriter, r *http.Request) {
+	if s.outbox == nil {
+		writeError(w, http.StatusNotFound, output.ErrOutboxItemNotFound.Error(), r)
+		return
+	}
+	item, err := s.outbox.Retry(chi.URLParam(r, "id"))
+	if errors.Is(err, output.ErrOutboxItemNotFound) {
+		writeError(w, http.StatusNotFound, err.Error(), r)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, item, r)
+}
+
+func (s *Server) handleDiscardOutbox(w http.ResponseWriter, r *http.Request) {
+	if s.outbox == nil {
+		writeError(w, http.StatusNotFound, output.ErrOutboxItemNotFound.Error(), r)
+		return
+	}
+	item, ok := s.outbox.Get(chi.URLParam(r, "id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, output.ErrOutboxItemNotFound.Error(), r)
+		return
+	}
+	if err := s.outbox.Discard(item.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+
+	if job, ok := s.jobQueue.Get(item.JobID); ok {
+		for _, d := range job.DeliveryStatuses() {
+			if d.Target == item.Target && d.Status == jobs.DeliveryQueued {
+				d.Status = jobs.DeliveryFailed
+				d.Error = "discarded from outbox"
+				d.UpdatedAt = time.Now()
+				job.UpdateDelivery(d)
+				// Without the required delivery the job cannot complete.
+				if d.Required {
+					job.SetError(fmt.Errorf("output failed: %s discarded from outbox", d.Target))
+				}
+				s.jobQueue.SaveJob(job.ID)
+				s.broadcastJobUpdate(job)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "discarded"}, r)
+}
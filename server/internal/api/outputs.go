@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/output"
+)
+
+// maxOutputBody limits the size of output instance requests.
+const maxOutputBody = 1 << 20
+
+// SetOutputStore enables managing output instances through the API and
+// registers the stored instances with the output manager. Instances whose
+// name is taken by an output from server.toml are skipped.
+func (s *Server) SetOutputStore(store *config.OutputStore) {
+	s.outputStore = store
+	for _, inst := range store.List() {
+		if s.outputs.Has(inst.Name) {
+			slog.Error("skipping managed output, the name is configured in server.toml", "name", inst.Name)
+			continue
+		}
+		h, err := output.NewHandler(inst)
+		if err != nil {
+			slog.Error("skipping managed output", "name", inst.Name, "error", err)
+			continue
+		}
+		s.outputs.SetManaged(inst.Name, h)
+	}
+}
+
+func (s *Server) handleCreateOutput(w http.ResponseWriter, r *http.Request) {
+	if s.outputStore == nil {
+		writeError(w, http.StatusForbidden, "output management is disabled", r)
+		return
+	}
+	inst, secrets, ok := decodeOutput(w, r)
+	if !ok {
+		return
+	}
+	if s.outputs.Has(inst.Name) {
+		writeError(w, http.StatusConflict, "output already exists", r)
+		return
+	}
+	s.applyOutput(w, r, http.StatusCreated, inst, secrets)
+}
+
+func (s *Server) handleGetOutput(w http.ResponseWriter, r *http.Request) {
+	inst, ok := s.managedOutput(w, r)
+	if !ok {
+		return
+	}
+	body, err := config.EncodeOutputJSON(inst)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+	writeJSON(w, http.StatusOK, body, r)
+}
+
+func (s *Server) handleUpdateOutput(w http.ResponseWriter, r *http.Request) {
+	current, ok := s.managedOutput(w, r)
+	if !ok {
+		return
+	}
+	inst, secrets, ok := decodeOutput(w, r)
+	if !ok {
+		return
+	}
+	if inst.Name != "" && inst.Name != current.Name {
+		writeError(w, http.StatusBadRequest, "output name cannot be changed", r)
+		return
+	}
+	inst.Name = current.Name
+	s.applyOutput(w, r, http.StatusOK, inst, secrets)
+}
+
+func (s *Server) handleDeleteOutput(w http.ResponseWriter, r *http.Request) {
+	inst, ok := s.managedOutput(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.outputStore.Delete(inst.Name); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+	s.outputs.RemoveManaged(inst.Name)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"}, r)
+}
+
+// managedOutput looks up the output instance named in the URL. Outputs from
+// server.toml exist but cannot be managed through the API.
+func (s *Server) managedOutput(w http.ResponseWriter, r *http.Request) (config.OutputInstance, bool) {
+	name := chi.URLParam(r, "name")
+	if s.outputStore != nil {
+		if inst, ok := s.outputStore.Get(name); ok {
+			return inst, true
+		}
+	}
+	if s.outputs.Has(name) {
+		writeError(w, http.StatusConflict, "output is configured in server.toml", r)
+	} else {
+		writeError(w, http.StatusNotFound, "output not found", r)
+	}
+	return config.OutputInstance{}, false
+}
+
+func decodeOutput(w http.ResponseWriter, r *http.Request) (config.OutputInstance, map[string]string, bool) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxOutputBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", r)
+		return config.OutputInstance{}, nil, false
+	}
+	inst, secrets, err := config.DecodeOutputJSON(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), r)
+		return config.OutputInstance{}, nil, false
+	}
+	return inst, secrets, true
+}
+
+// applyOutput stores an instance and replaces its handler, so that the next
+// delivery uses the new settings.
+func (s *Server) applyOutput(w http.ResponseWriter, r *http.Request, status int, inst config.OutputInstance, secrets map[string]string) {
+	inst, err := s.outputStore.Put(inst, secrets)
+	if errors.Is(err, config.ErrInvalidOutput) {
+		writeError(w, http.StatusBadRequest, err.Error(), r)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+	h, err := output.NewHandler(inst)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+	s.outputs.SetManaged(inst.Name, h)
+
+	body, err := config.EncodeOutputJSON(inst)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), r)
+		return
+	}
+	writeJSON(w, status, body, r)
+}
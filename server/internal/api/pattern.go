@@ -0,0 +1,47 @@
+package api
+
+import (
+	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/pattern"
+)
+
+// SetCounter replaces the counter used for the {counter} placeholder, e.g.
+// with one persisted in the storage directory.
+func (s *Server) SetCounter(c *pattern.Counter) {
+	s.counter = c
+}
+
+// patternVars returns the placeholder values for a job. The counter advances
+// at most once per job, however many patterns use it.
+func (s *Server) patternVars(job *jobs.Job) pattern.Vars {
+	n := 0
+	return pattern.Vars{
+		Time:    job.CreatedAt,
+		Profile: job.Profile,
+		Device:  s.scanner.DeviceName(),
+		JobID:   job.ID,
+		Pages:   job.PageCount(),
+		Counter: func() int {
+			if n == 0 {
+				n = s.counter.Next()
+			}
+			return n
+		},
+	}
+}
+
+// expandPatterns fills in title and filename placeholders once the pages
+// are scanned, so that {pages} is known. Both button and API jobs may use
+// placeholders. The returned values carry the job's device and counter on
+// to the output filename patterns.
+func (s *Server) expandPatterns(job *jobs.Job) pattern.Vars {
+	vars := s.patternVars(job)
+	if job.Metadata != nil && job.Metadata.Title != "" {
+		vars.Title = pattern.Expand(job.Metadata.Title, vars)
+		job.SetTitle(vars.Title)
+	}
+	if job.Output.Filename != "" {
+		job.SetFilename(pattern.Expand(job.Output.Filename, vars))
+	}
+	return vars
+}
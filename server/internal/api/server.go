@@ -2,9 +2,11 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -12,7 +14,9 @@ import (
 	"github.com/thoscut/scanflow/server/internal/acme"
 	"github.com/thoscut/scanflow/server/internal/config"
 	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/mqtt"
 	"github.com/thoscut/scanflow/server/internal/output"
+	"github.com/thoscut/scanflow/server/internal/pattern"
 	"github.com/thoscut/scanflow/server/internal/processor"
 	"github.com/thoscut/scanflow/server/internal/scanner"
 )
@@ -26,12 +30,16 @@ type Server struct {
 	profiles    *config.ProfileStore
 	processor   *processor.Pipeline
 	outputs     *output.Manager
+	outbox      *output.Outbox      // nil when the outbox is disabled
+	outputStore *config.OutputStore // nil when output management is disabled
+	mqtt        *mqtt.Publisher     // nil when MQTT is disabled
 	wsHub       *WebSocketHub
 	metrics     *Metrics
 	server      *http.Server
 	acmeMgr     *acme.Manager
 	acmeHTTPSrv *http.Server // port 80 listener for ACME HTTP-01 challenges
 	jobTimeout  time.Duration
+	counter     *pattern.Counter
 	done        chan struct{} // closed when jobWorker exits
 }
 
@@ -47,6 +55,7 @@ func NewServer(cfg *config.Config, sc *scanner.Scanner, q *jobs.Queue, profiles
 		wsHub:      NewWebSocketHub(),
 		metrics:    NewMetrics(),
 		jobTimeout: cfg.Processing.JobTimeout.Duration(),
+		counter:    pattern.NewCounter(""),
 		done:       make(chan struct{}),
 	}
 
@@ -86,6 +95,7 @@ func (s *Server) setupRouter() {
 		r.Post("/api/v1/scanner/devices/{id}/open", s.handleOpenDevice)
 		r.Delete("/api/v1/scanner/devices/{id}/close", s.handleCloseDevice)
 		r.Get("/api/v1/scanner/capabilities", s.handleGetCapabilities)
+		r.Post("/api/v1/scanner/preview", s.handlePreviewScan)
 
 		// Scan operations
 		r.Post("/api/v1/scan", s.handleStartScan)
@@ -102,7 +112,18 @@ func (s *Server) setupRouter() {
 
 		// Output
 		r.Get("/api/v1/outputs", s.handleListOutputs)
+		r.Post("/api/v1/outputs", s.handleCreateOutput)
+		r.Get("/api/v1/outputs/{name}", s.handleGetOutput)
+		r.Put("/api/v1/outputs/{name}", s.handleUpdateOutput)
+		r.Delete("/api/v1/outputs/{name}", s.handleDeleteOutput)
 		r.Post("/api/v1/scan/{jobID}/send", s.handleSendOutput)
+		r.Get("/api/v1/outputs/{name}/paperless/{kind}", s.handleListPaperlessObjects)
+		r.Post("/api/v1/outputs/{name}/test", s.handleTestOutput)
+
+		// Delivery outbox
+		r.Get("/api/v1/outbox", s.handleListOutbox)
+		r.Post("/api/v1/outbox/{id}/retry", s.handleRetryOutbox)
+		r.Delete("/api/v1/outbox/{id}", s.handleDiscardOutbox)
 
 		// Profiles
 		r.Get("/api/v1/profiles", s.handleListProfiles)
@@ -144,6 +165,28 @@ func (s *Server) Start(ctx context.Context) error {
 	// Start job worker
 	go s.jobWorker()
 
+	// Start outbox retries
+	if s.outbox != nil {
+		go s.outbox.Run(ctx)
+	}
+
+	// Start MQTT event publishing
+	if s.mqtt != nil {
+		s.mqtt.Connect(mqttBridge{s})
+	}
+
+	// Start device hotplug monitor
+	s.metrics.SetScannerOnline(s.scanner.IsConnected())
+	if interval := s.cfg.Scanner.MonitorInterval.Duration(); interval > 0 {
+		mon := scanner.NewDeviceMonitor(s.scanner, interval, s.handleDeviceEvent)
+		go mon.Start(ctx)
+	}
+
+	// Start hardware button watcher
+	if s.cfg.Button.Enabled {
+		go s.newButtonWatcher().Start(ctx)
+	}
+
 	slog.Info("API server starting", "addr", addr)
 
 	// ACME / Let's Encrypt automatic certificates.
@@ -216,6 +259,10 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		slog.Warn("timed out waiting for job worker to finish")
 	}
 
+	if s.mqtt != nil {
+		s.mqtt.Close()
+	}
+
 	if s.acmeHTTPSrv != nil {
 		if err := s.acmeHTTPSrv.Shutdown(ctx); err != nil {
 			slog.Warn("ACME HTTP listener shutdown error", "error", err)
@@ -251,18 +298,226 @@ func (s *Server) processJob(job *jobs.Job) {
 		return
 	}
 
-	// Set scanning status
-	job.SetStatus(jobs.StatusScanning)
+	// A paused job requeued via the finish endpoint already holds its pages
+	// and goes straight to processing.
+	if !job.TakeFinish() {
+		if !s.scanPages(ctx, job, profile) {
+			return
+		}
+	}
+
+	// Process pages
+	vars := s.expandPatterns(job)
+	job.SetStatus(jobs.StatusProcessing)
 	s.jobQueue.SaveJob(job.ID)
 	s.broadcastJobUpdate(job)
 
-	// Perform scan
+	doc, err := s.processor.Process(ctx, job, profile)
+	if err != nil {
+		job.SetError(fmt.Errorf("processing failed: %w", err))
+		s.jobQueue.SaveJob(job.ID)
+		s.metrics.JobFailed()
+		s.broadcastJobUpdate(job)
+		return
+	}
+	doc.Device = vars.Device
+	doc.Counter = vars.Counter()
+	if doc.Remove != nil {
+		defer func() {
+			if err := doc.Remove(); err != nil {
+				slog.Warn("failed to remove processed document", "job_id", job.ID, "error", err)
+			}
+		}()
+	}
+
+	// Send to all outputs
+	warnings, queued, err := s.deliver(ctx, job, profile, doc)
+	if err != nil {
+		job.SetError(fmt.Errorf("output failed: %w", err))
+		s.jobQueue.SaveJob(job.ID)
+		s.metrics.JobFailed()
+		s.broadcastJobUpdate(job)
+		return
+	}
+
+	// Required deliveries waiting in the outbox keep the job open until
+	// they succeed or are given up.
+	if job.Settle() == jobs.StatusDelivering {
+		s.jobQueue.SaveJob(job.ID)
+		s.metrics.JobFinished()
+		job.SendProgress(jobs.ProgressUpdate{
+			Type:    "delivering",
+			Message: "Document processed; queued for retry: " + strings.Join(queued, ", "),
+		})
+		s.broadcastJobUpdate(job)
+		slog.Info("job waiting for queued deliveries", "job_id", job.ID, "targets", queued)
+		return
+	}
+
+	// Done
+	s.jobQueue.SaveJob(job.ID)
+	s.metrics.JobCompleted()
+	msg := "Document processed and delivered"
+	if len(warnings) > 0 {
+		msg += "; optional outputs failed: " + strings.Join(warnings, ", ")
+	}
+	if len(queued) > 0 {
+		msg += "; queued for retry: " + strings.Join(queued, ", ")
+	}
+	job.SendProgress(jobs.ProgressUpdate{
+		Type:    "completed",
+		Message: msg,
+	})
+	s.broadcastJobUpdate(job)
+	slog.Info("job completed", "job_id", job.ID, "pages", job.PageCount())
+}
+
+// deliver sends the document to every output target of the job. Targets
+// that keep failing are queued in the outbox when it is enabled and
+// returned as queued. Otherwise deliver returns an error when a required
+// target fails; failed optional targets are returned as warnings.
+func (s *Server) deliver(ctx context.Context, job *jobs.Job, profile *config.Profile, doc *jobs.Document) (warnings, queued []string, err error) {
+	var profileTargets []jobs.OutputTarget
+	for _, t := range profile.Output.Targets {
+		profileTargets = append(profileTargets, jobs.OutputTarget{Name: t.Name, Optional: t.Optional})
+	}
+	targets := job.Output.Destinations(profile.Output.DefaultTarget, profileTargets)
+	if len(targets) == 0 {
+		return nil, nil, errors.New("no output target configured")
+	}
+
+	job.StartDeliveries(targets)
+	s.jobQueue.SaveJob(job.ID)
+
+	update := func(d jobs.Delivery) {
+		job.UpdateDelivery(d)
+		s.broadcast(deliveryUpdate(job.ID, d))
+	}
+	results := s.outputs.SendAll(ctx, doc, targets, update)
+
+	var failed []string
+	for _, d := range results {
+		if d.Status != jobs.DeliveryFailed {
+			continue
+		}
+		if s.queueDelivery(doc, &d) {
+			update(d)
+			queued = append(queued, d.Target)
+			continue
+		}
+		if d.Required {
+			failed = append(failed, d.Error)
+		} else {
+			slog.Warn("optional output failed", "job_id", job.ID, "target", d.Target, "error", d.Error)
+			warnings = append(warnings, d.Target)
+		}
+	}
+	s.jobQueue.SaveJob(job.ID)
+	if len(failed) > 0 {
+		return warnings, queued, errors.New(strings.Join(failed, "; "))
+	}
+	return warnings, queued, nil
+}
+
+// deliveryUpdate is the WebSocket message for a change of d.
+func deliveryUpdate(jobID string, d jobs.Delivery) jobs.ProgressUpdate {
+	u := jobs.ProgressUpdate{
+		Type:    "delivery",
+		JobID:   jobID,
+		Status:  string(d.Status),
+		Message: d.Target,
+		Error:   d.Error,
+	}
+	if d.Result != nil {
+		u.DocumentURL = d.Result.URL
+	}
+	return u
+}
+
+// scanOptions builds the scanner options for a job from its profile, with
+// any per-request overrides applied on top.
+func scanOptions(profile *config.Profile, override *jobs.ScanOptions) scanner.ScanOptions {
 	opts := scanner.ScanOptions{
 		Resolution: profile.Scanner.Resolution,
 		Mode:       profile.Scanner.Mode,
 		Source:     profile.Scanner.Source,
 		PageWidth:  profile.Scanner.PageWidth,
 		PageHeight: profile.Scanner.PageHeight,
+		Brightness: profile.Scanner.Brightness,
+		Contrast:   profile.Scanner.Contrast,
+		PaperSize:  profile.Scanner.PaperSize,
+
+		BatchMode:        scanner.BatchMode(profile.Scanner.BatchMode),
+		PaperWaitTimeout: profile.Scanner.PaperWaitTimeout.Duration(),
+		FeedGracePeriod:  profile.Scanner.FeedGracePeriod.Duration(),
+	}
+	if override == nil {
+		return opts
+	}
+
+	if override.Resolution > 0 {
+		opts.Resolution = override.Resolution
+	}
+	if override.Mode != "" {
+		opts.Mode = override.Mode
+	}
+	if override.Source != "" {
+		opts.Source = override.Source
+	}
+	if override.PageWidth > 0 {
+		opts.PageWidth = override.PageWidth
+	}
+	if override.PageHeight > 0 {
+		opts.PageHeight = override.PageHeight
+	}
+	if override.Brightness != 0 {
+		opts.Brightness = override.Brightness
+	}
+	if override.Contrast != 0 {
+		opts.Contrast = override.Contrast
+	}
+	if override.PaperSize != "" {
+		opts.PaperSize = override.PaperSize
+		// An explicit page size replaces the profile's page dimensions.
+		opts.PageWidth, opts.PageHeight = 0, 0
+	}
+	if override.Area != nil {
+		opts.Area = &scanner.Area{
+			TLX: override.Area.TLX,
+			TLY: override.Area.TLY,
+			BRX: override.Area.BRX,
+			BRY: override.Area.BRY,
+		}
+	}
+	if override.BatchMode != "" {
+		opts.BatchMode = scanner.BatchMode(override.BatchMode)
+	}
+	return opts
+}
+
+// scanPages runs the scan phase of a job. It returns false when the job did
+// not produce pages to process (failed, cancelled or paused for attention).
+func (s *Server) scanPages(ctx context.Context, job *jobs.Job, profile *config.Profile) bool {
+	// Set scanning status
+	job.SetStatus(jobs.StatusScanning)
+	s.jobQueue.SaveJob(job.ID)
+	s.broadcastJobUpdate(job)
+
+	// Perform scan
+	opts := scanOptions(profile, job.Options)
+	opts.OnWaitForPaper = func() {
+		job.SendProgress(jobs.ProgressUpdate{
+			Type:    "waiting_for_paper",
+			Page:    job.PageCount(),
+			Message: "Waiting for paper; insert sheets or press the scanner button to finish",
+		})
+		s.broadcast(jobs.ProgressUpdate{
+			Type:    "waiting_for_paper",
+			JobID:   job.ID,
+			Status:  string(jobs.StatusScanning),
+			Page:    job.PageCount(),
+			Message: "Waiting for paper",
+		})
 	}
 
 	pages, err := s.scanner.ScanBatch(ctx, opts)
@@ -271,14 +526,18 @@ func (s *Server) processJob(job *jobs.Job) {
 		s.jobQueue.SaveJob(job.ID)
 		s.metrics.JobFailed()
 		s.broadcastJobUpdate(job)
-		return
+		return false
 	}
 
+	var scanErr error
 	for page := range pages {
 		if page.Err != nil {
 			slog.Warn("page scan error", "error", page.Err, "job_id", job.ID)
+			scanErr = page.Err
 			continue
 		}
+		// Continue numbering when a paused job is resumed.
+		page.Number = job.PageCount() + 1
 		job.AddPage(page)
 		s.metrics.PageScanned()
 		job.SendProgress(jobs.ProgressUpdate{
@@ -289,56 +548,67 @@ func (s *Server) processJob(job *jobs.Job) {
 		s.broadcastJobUpdate(job)
 	}
 
-	if job.PageCount() == 0 {
-		job.SetError(fmt.Errorf("no pages scanned"))
+	// The job may have been aborted while scanning (device went offline) or
+	// cancelled by the user; keep its terminal state.
+	if status := job.CurrentStatus(); status == jobs.StatusFailed || status == jobs.StatusCancelled {
 		s.jobQueue.SaveJob(job.ID)
-		s.metrics.JobFailed()
+		if status == jobs.StatusFailed {
+			s.metrics.JobFailed()
+		} else {
+			s.metrics.JobCancelled()
+		}
 		s.broadcastJobUpdate(job)
-		return
+		return false
 	}
 
-	// Process pages
-	job.SetStatus(jobs.StatusProcessing)
-	s.jobQueue.SaveJob(job.ID)
-	s.broadcastJobUpdate(job)
-
-	doc, err := s.processor.Process(ctx, job, profile)
-	if err != nil {
-		job.SetError(fmt.Errorf("processing failed: %w", err))
+	// A paper fault (or any error after pages were scanned) pauses the job
+	// so that the pages already scanned are not lost.
+	if scanErr != nil {
+		if scanner.IsRecoverable(scanErr) || job.PageCount() > 0 {
+			s.pauseJob(job, scanErr)
+			return false
+		}
+		job.SetError(fmt.Errorf("scan failed: %w", scanErr))
 		s.jobQueue.SaveJob(job.ID)
 		s.metrics.JobFailed()
 		s.broadcastJobUpdate(job)
-		return
-	}
-
-	// Send to output
-	target := job.Output.Target
-	if target == "" {
-		target = profile.Output.DefaultTarget
+		return false
 	}
 
-	if err := s.outputs.Send(ctx, target, doc); err != nil {
-		job.SetError(fmt.Errorf("output failed: %w", err))
+	if job.PageCount() == 0 {
+		job.SetError(fmt.Errorf("no pages scanned"))
 		s.jobQueue.SaveJob(job.ID)
 		s.metrics.JobFailed()
 		s.broadcastJobUpdate(job)
-		return
+		return false
 	}
 
-	// Done
-	job.SetStatus(jobs.StatusCompleted)
+	return true
+}
+
+// pauseJob puts a job into needs_attention after a scanner fault and notifies
+// clients so that an operator can clear the fault and resume or finish it.
+func (s *Server) pauseJob(job *jobs.Job, err error) {
+	job.SetNeedsAttention(err)
 	s.jobQueue.SaveJob(job.ID)
-	s.metrics.JobCompleted()
-	job.SendProgress(jobs.ProgressUpdate{
-		Type:    "completed",
-		Message: "Document processed and delivered",
-	})
-	s.broadcastJobUpdate(job)
-	slog.Info("job completed", "job_id", job.ID, "pages", job.PageCount())
+	s.metrics.JobFinished()
+
+	update := jobs.ProgressUpdate{
+		Type:    "scanner_fault",
+		Status:  string(jobs.StatusNeedsAttention),
+		Page:    job.PageCount(),
+		Message: fmt.Sprintf("Scanner fault after %d pages; clear it, then continue or finish the job", job.PageCount()),
+		Error:   err.Error(),
+	}
+	job.SendProgress(update)
+	update.JobID = job.ID
+	s.broadcast(update)
+
+	slog.Warn("job needs attention", "job_id", job.ID, "pages", job.PageCount(), "error", err)
 }
 
 func (s *Server) broadcastJobUpdate(job *jobs.Job) {
-	s.wsHub.Broadcast(jobs.ProgressUpdate{
+	s.broadcast(jobs.ProgressUpdate{
 		Type:     "job_update",
 		JobID:    job.ID,
 		Status:   string(job.Status),
@@ -346,3 +616,30 @@ func (s *Server) broadcastJobUpdate(job *jobs.Job) {
 		Message:  string(job.Status),
 	})
 }
+
+// handleDeviceEvent reacts to scanner hotplug events: in-flight jobs are
+// aborted when the device disappears, and clients are notified either way.
+func (s *Server) handleDeviceEvent(ev scanner.DeviceEvent) {
+	msg := "Scanner connected"
+	switch ev.Type {
+	case scanner.DeviceOffline:
+		msg = "Scanner disconnected"
+		s.metrics.DeviceOffline()
+		for _, job := range s.jobQueue.List() {
+			if job.CurrentStatus() != jobs.StatusScanning {
+				continue
+			}
+			job.Abort(fmt.Errorf("scanner %s went offline during scan", ev.Device))
+			s.jobQueue.SaveJob(job.ID)
+			slog.Warn("job aborted, scanner offline", "job_id", job.ID, "device", ev.Device)
+		}
+	case scanner.DeviceOnline:
+		s.metrics.DeviceOnline()
+	}
+
+	s.broadcast(jobs.ProgressUpdate{
+		Type:    string(ev.Type),
+		Device:  ev.Device,
+		Message: msg,
+	})
+}
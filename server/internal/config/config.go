@@ -3,9 +3,12 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/mail"
+	"net/url"
 	"os"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,6 +26,7 @@ type Config struct {
 	Processing ProcessingConfig `toml:"processing"`
 	Storage    StorageConfig    `toml:"storage"`
 	Output     OutputConfig     `toml:"output"`
+	MQTT       MQTTConfig       `toml:"mqtt"`
 	Logging    LoggingConfig    `toml:"logging"`
 }
 
@@ -92,9 +96,10 @@ type ACMEExecConfig struct {
 }
 
 type ScannerConfig struct {
-	Device   string          `toml:"device"`
-	AutoOpen bool            `toml:"auto_open"`
-	Defaults ScannerDefaults `toml:"defaults"`
+	Device          string          `toml:"device"`
+	AutoOpen        bool            `toml:"auto_open"`
+	MonitorInterval duration        `toml:"monitor_interval"` // 0 disables hotplug monitoring
+	Defaults        ScannerDefaults `toml:"defaults"`
 }
 
 type ScannerDefaults struct {
@@ -114,6 +119,103 @@ type ButtonConfig struct {
 	Output            string         `toml:"output"`
 	BeepOnLongPress   bool           `toml:"beep_on_long_press"`
 	Metadata          MetadataConfig `toml:"metadata"`
+
+	VeryLongPressDuration duration                `toml:"very_long_press_duration"`
+	DoublePressWindow     duration                `toml:"double_press_window"`
+	Bindings              []ButtonBinding         `toml:"bindings"`
+	Actions               map[string]ButtonAction `toml:"actions"`
+}
+
+// ButtonBinding maps a gesture on a scanner button to a named action.
+type ButtonBinding struct {
+	Button   string `toml:"button"`   // SANE option: scan, email, file, ... (default scan)
+	Gesture  string `toml:"gesture"`  // short, long, double, very_long
+	Function *int   `toml:"function"` // only when the function display shows this number
+	Action   string `toml:"action"`
+}
+
+// ButtonAction is what a button gesture triggers.
+type ButtonAction struct {
+	Profile  string         `toml:"profile"`
+	Output   string         `toml:"output"` // defaults to button.output
+	Beep     []int          `toml:"beep"`   // tone lengths in ms, e.g. [100, 100]
+	Metadata MetadataConfig `toml:"metadata"`
+}
+
+// Names of the actions generated from the legacy short/long-press keys.
+const (
+	ShortPressAction = "short_press"
+	LongPressAction  = "long_press"
+)
+
+// EffectiveBindings returns the configured bindings and actions, with the
+// legacy short_press_profile and long_press_profile keys mapped onto the
+// scan button unless an explicit binding already covers that gesture.
+func (b ButtonConfig) EffectiveBindings() ([]ButtonBinding, map[string]ButtonAction) {
+	bindings := make([]ButtonBinding, 0, len(b.Bindings)+2)
+	actions := make(map[string]ButtonAction, len(b.Actions)+2)
+	for name, a := range b.Actions {
+		if a.Output == "" {
+			a.Output = b.Output
+		}
+		actions[name] = a
+	}
+
+	covered := map[string]bool{}
+	for _, bind := range b.Bindings {
+		if bind.Button == "" {
+			bind.Button = "scan"
+		}
+		if bind.Function == nil {
+			covered[bind.Button+"/"+bind.Gesture] = true
+		}
+		bindings = append(bindings, bind)
+	}
+
+	legacy := []struct {
+		gesture, action, profile string
+	}{
+		{"short", ShortPressAction, b.ShortPressProfile},
+		{"long", LongPressAction, b.LongPressProfile},
+	}
+	for _, l := range legacy {
+		if l.profile == "" || covered["scan/"+l.gesture] {
+			continue
+		}
+		if _, ok := actions[l.action]; !ok {
+			actions[l.action] = ButtonAction{
+				Profile:  l.profile,
+				Output:   b.Output,
+				Metadata: b.Metadata,
+			}
+		}
+		bindings = append(bindings, ButtonBinding{Button: "scan", Gesture: l.gesture, Action: l.action})
+	}
+
+	return bindings, actions
+}
+
+func (b ButtonConfig) validate() []error {
+	var errs []error
+	for i, bind := range b.Bindings {
+		switch bind.Gesture {
+		case "short", "long", "double", "very_long":
+		default:
+			errs = append(errs, fmt.Errorf("button.bindings[%d].gesture must be one of short, long, double, very_long; got %q", i, bind.Gesture))
+		}
+		if _, ok := b.Actions[bind.Action]; !ok {
+			errs = append(errs, fmt.Errorf("button.bindings[%d].action %q is not defined in button.actions", i, bind.Action))
+		}
+	}
+	for name, a := range b.Actions {
+		for _, ms := range a.Beep {
+			if ms < 10 || ms > 2000 {
+				errs = append(errs, fmt.Errorf("button.actions.%s.beep tones must be between 10 and 2000 ms, got %d", name, ms))
+				break
+			}
+		}
+	}
+	return errs
 }
 
 type MetadataConfig struct {
@@ -121,6 +223,12 @@ type MetadataConfig struct {
 	Correspondent int    `toml:"correspondent"`
 	DocumentType  int    `toml:"document_type"`
 	Tags          []int  `toml:"tags"`
+
+	// Paperless-NGX objects by name
+	CorrespondentName string   `toml:"correspondent_name"`
+	DocumentTypeName  string   `toml:"document_type_name"`
+	TagNames          []string `toml:"tag_names"`
+	StoragePath       string   `toml:"storage_path"`
 }
 
 type ProcessingConfig struct {
@@ -160,13 +268,296 @@ type StorageConfig struct {
 }
 
 type OutputConfig struct {
+	Filesystem       FilesystemConfig       `toml:"filesystem"`
 	Paperless        PaperlessConfig        `toml:"paperless"`
 	SMB              SMBConfig              `toml:"smb"`
 	PaperlessConsume PaperlessConsumeConfig `toml:"paperless_consume"`
 	Email            EmailConfig            `toml:"email"`
+	WebDAV           WebDAVConfig           `toml:"webdav"`
+	S3               S3Config               `toml:"s3"`
+	SFTP             SFTPConfig             `toml:"sftp"`
+	HTTP             HTTPConfig             `toml:"http"`
+	IPP              IPPConfig              `toml:"ipp"`
+	Instances        []OutputInstance       `toml:"instances"`
+	Outbox           OutboxConfig           `toml:"outbox"`
+	Managed          ManagedOutputsConfig   `toml:"managed"`
+}
+
+// OutboxConfig keeps deliveries that failed all immediate retries on disk
+// and retries them on a long backoff schedule that survives restarts.
+// Deliveries still failing after the last step move to the dead-letter list.
+type OutboxConfig struct {
+	Enabled   bool       `toml:"enabled"`
+	Directory string     `toml:"directory"` // default: <storage.local_directory>/outbox
+	Schedule  []duration `toml:"schedule"`  // wait before each retry
+}
+
+// RetrySchedule returns the wait before each outbox retry.
+func (o OutboxConfig) RetrySchedule() []time.Duration {
+	schedule := make([]time.Duration, len(o.Schedule))
+	for i, d := range o.Schedule {
+		schedule[i] = d.Duration()
+	}
+	return schedule
+}
+
+func (o OutboxConfig) validate(storageDir string) []error {
+	if !o.Enabled {
+		return nil
+	}
+	var errs []error
+	if strings.TrimSpace(o.Directory) == "" && strings.TrimSpace(storageDir) == "" {
+		errs = append(errs, fmt.Errorf("output.outbox.directory must be set when storage.local_directory is empty"))
+	}
+	if len(o.Schedule) == 0 {
+		errs = append(errs, fmt.Errorf("output.outbox.schedule must contain at least one retry"))
+	}
+	for i, d := range o.Schedule {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("output.outbox.schedule[%d] must be positive, got %s", i, d.Duration()))
+		}
+	}
+	return errs
+}
+
+// OutputInstance is a named output target. Its settings live in the
+// sub-table named after its type, e.g.
+//
+//	[[output.instances]]
+//	name = "smb-accounting"
+//	type = "smb"
+//	[output.instances.smb]
+//	server = "//nas.local"
+//
+// The enabled flag inside the settings is ignored; listed instances are
+// always active.
+type OutputInstance struct {
+	Name             string                  `toml:"name"`
+	Type             string                  `toml:"type"`
+	Filesystem       *FilesystemTarget       `toml:"filesystem,omitempty"`
+	Paperless        *PaperlessConfig        `toml:"paperless,omitempty"`
+	SMB              *SMBConfig              `toml:"smb,omitempty"`
+	PaperlessConsume *PaperlessConsumeConfig `toml:"paperless_consume,omitempty"`
+	Email            *EmailConfig            `toml:"email,omitempty"`
+	WebDAV           *WebDAVConfig           `toml:"webdav,omitempty"`
+	S3               *S3Config               `toml:"s3,omitempty"`
+	SFTP             *SFTPConfig             `toml:"sftp,omitempty"`
+	HTTP             *HTTPConfig             `toml:"http,omitempty"`
+	IPP              *IPPConfig              `toml:"ipp,omitempty"`
+}
+
+// OutputTypes lists the supported output types. The single-instance
+// [output.<type>] sections are registered under the type name.
+var OutputTypes = []string{"filesystem", "paperless", "smb", "paperless_consume", "email", "webdav", "s3", "sftp", "http", "ipp"}
+
+func isOutputType(name string) bool {
+	for _, t := range OutputTypes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// settingsType returns the type whose settings table is set, or "" when
+// none or more than one is set.
+func (i OutputInstance) settingsType() string {
+	set := map[string]bool{
+		"filesystem":        i.Filesystem != nil,
+		"paperless":         i.Paperless != nil,
+		"smb":               i.SMB != nil,
+		"paperless_consume": i.PaperlessConsume != nil,
+		"email":             i.Email != nil,
+		"webdav":            i.WebDAV != nil,
+		"s3":                i.S3 != nil,
+		"sftp":              i.SFTP != nil,
+		"http":              i.HTTP != nil,
+		"ipp":               i.IPP != nil,
+	}
+	found := ""
+	for t, ok := range set {
+		if ok {
+			if found != "" {
+				return ""
+			}
+			found = t
+		}
+	}
+	return found
+}
+
+// Validate checks a single output instance.
+func (i OutputInstance) Validate() []error {
+	section := fmt.Sprintf("output.instances[%s]", i.Name)
+	var errs []error
+	if strings.TrimSpace(i.Name) == "" {
+		errs = append(errs, fmt.Errorf("%s.name must not be empty", section))
+	}
+	if isOutputType(i.Name) {
+		errs = append(errs, fmt.Errorf("%s: name is reserved for a built-in output", section))
+	}
+	if !isOutputType(i.Type) {
+		return append(errs, fmt.Errorf("%s.type must be one of %s; got %q", section, strings.Join(OutputTypes, ", "), i.Type))
+	}
+	if i.settingsType() != i.Type {
+		return append(errs, fmt.Errorf("%s must have exactly one settings table, [%s]", section, i.Type))
+	}
+
+	switch i.Type {
+	case "filesystem":
+		errs = append(errs, i.Filesystem.validate(section+".filesystem")...)
+	case "paperless":
+		if strings.TrimSpace(i.Paperless.URL) == "" {
+			errs = append(errs, fmt.Errorf("%s.paperless.url must not be empty", section))
+		}
+		errs = append(errs, i.Paperless.NamingConfig.validate(section+".paperless")...)
+	case "smb":
+		if i.SMB.Server == "" || i.SMB.Share == "" {
+			errs = append(errs, fmt.Errorf("%s.smb.server and share must not be empty", section))
+		}
+		errs = append(errs, i.SMB.NamingConfig.validate(section+".smb")...)
+	case "paperless_consume":
+		if strings.TrimSpace(i.PaperlessConsume.Path) == "" {
+			errs = append(errs, fmt.Errorf("%s.paperless_consume.path must not be empty", section))
+		}
+		errs = append(errs, i.PaperlessConsume.NamingConfig.validate(section+".paperless_consume")...)
+	case "email":
+		errs = append(errs, i.Email.validate(section+".email")...)
+	case "webdav":
+		errs = append(errs, i.WebDAV.validate(section+".webdav")...)
+	case "s3":
+		errs = append(errs, i.S3.validate(section+".s3")...)
+	case "sftp":
+		errs = append(errs, i.SFTP.validate(section+".sftp")...)
+	case "http":
+		errs = append(errs, i.HTTP.validate(section+".http")...)
+	case "ipp":
+		errs = append(errs, i.IPP.validate(section+".ipp")...)
+	}
+	return errs
+}
+
+func (o OutputConfig) validateInstances() []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for name := range o.Filesystem.Destinations {
+		seen[name] = true
+	}
+	for _, inst := range o.Instances {
+		if seen[inst.Name] {
+			errs = append(errs, fmt.Errorf("output.instances[%s]: duplicate output name", inst.Name))
+		}
+		seen[inst.Name] = true
+		errs = append(errs, inst.Validate()...)
+	}
+	return errs
+}
+
+// FilesystemConfig configures the local archive output. Additional
+// destinations are registered as output targets under their own name.
+type FilesystemConfig struct {
+	FilesystemTarget
+	Enabled      bool                        `toml:"enabled"`
+	Destinations map[string]FilesystemTarget `toml:"destinations"`
+}
+
+// FilesystemTarget describes one directory documents are archived in.
+type FilesystemTarget struct {
+	NamingConfig
+	Directory string `toml:"directory"`
+	Layout    string `toml:"layout"`    // directory template, e.g. "{year}/{month}"
+	FileMode  string `toml:"file_mode"` // octal, default "0644"
+	DirMode   string `toml:"dir_mode"`  // octal, default "0755"
+	Group     string `toml:"group"`     // group name or GID for new files and directories
+	Sidecar   bool   `toml:"sidecar"`   // write <document>.json with the job metadata
+}
+
+// Modes returns the parsed file and directory permissions.
+func (t FilesystemTarget) Modes() (file, dir os.FileMode, err error) {
+	if file, err = parseMode(t.FileMode, 0o644); err != nil {
+		return 0, 0, fmt.Errorf("invalid file_mode %q", t.FileMode)
+	}
+	if dir, err = parseMode(t.DirMode, 0o755); err != nil {
+		return 0, 0, fmt.Errorf("invalid dir_mode %q", t.DirMode)
+	}
+	return file, dir, nil
+}
+
+// parseMode parses an octal mode like "2770", mapping the setuid, setgid and
+// sticky bits onto their os.FileMode equivalents.
+func parseMode(s string, def os.FileMode) (os.FileMode, error) {
+	if s == "" {
+		return def, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0o7777 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	mode := os.FileMode(m & 0o777)
+	if m&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+func (t FilesystemTarget) validate(section string) []error {
+	var errs []error
+	if strings.TrimSpace(t.Directory) == "" {
+		errs = append(errs, fmt.Errorf("%s.directory must not be empty", section))
+	}
+	if _, _, err := t.Modes(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", section, err))
+	}
+	return append(errs, t.NamingConfig.validate(section)...)
+}
+
+func (f FilesystemConfig) validate() []error {
+	var errs []error
+	if f.Enabled {
+		errs = append(errs, f.FilesystemTarget.validate("output.filesystem")...)
+	}
+	for name, dest := range f.Destinations {
+		section := "output.filesystem.destinations." + name
+		if isOutputType(name) {
+			errs = append(errs, fmt.Errorf("%s: name is reserved for a built-in output", section))
+		}
+		errs = append(errs, dest.validate(section)...)
+	}
+	return errs
+}
+
+// NamingConfig controls how an output names the files it writes. The
+// pattern may contain "/" to create subdirectories, e.g.
+// "{year}/{month}/{title}_{date}".
+type NamingConfig struct {
+	FilenamePattern string `toml:"filename_pattern"`
+	Sanitize        string `toml:"sanitize"`    // posix, windows, strict (default per output)
+	OnConflict      string `toml:"on_conflict"` // suffix (default), overwrite, fail
+}
+
+func (n NamingConfig) validate(section string) []error {
+	var errs []error
+	switch n.Sanitize {
+	case "", "posix", "windows", "strict":
+	default:
+		errs = append(errs, fmt.Errorf("%s.sanitize must be one of posix, windows, strict; got %q", section, n.Sanitize))
+	}
+	switch n.OnConflict {
+	case "", "suffix", "overwrite", "fail":
+	default:
+		errs = append(errs, fmt.Errorf("%s.on_conflict must be one of suffix, overwrite, fail; got %q", section, n.OnConflict))
+	}
+	return errs
 }
 
 type PaperlessConfig struct {
+	NamingConfig
 	Enabled              bool   `toml:"enabled"`
 	URL                  string `toml:"url"`
 	TokenFile            string `toml:"token_file"`
@@ -175,32 +566,410 @@ type PaperlessConfig struct {
 	DefaultCorrespondent int    `toml:"default_correspondent"`
 	DefaultDocumentType  int    `toml:"default_document_type"`
 	DefaultTags          []int  `toml:"default_tags"`
+
+	// Defaults by name, and name resolution against the Paperless API.
+	DefaultCorrespondentName string   `toml:"default_correspondent_name"`
+	DefaultDocumentTypeName  string   `toml:"default_document_type_name"`
+	DefaultTagNames          []string `toml:"default_tag_names"`
+	DefaultStoragePath       string   `toml:"default_storage_path"`
+	CreateMissingTags        bool     `toml:"create_missing_tags"`
+	CacheTTL                 duration `toml:"cache_ttl"` // how long name lists are cached, default 10m
+
+	// Consumption tracking: after the upload ScanFlow polls the Paperless
+	// task until the document is consumed and records its ID and link.
+	TrackConsumption   *bool    `toml:"track_consumption"`   // default true
+	ConsumptionTimeout duration `toml:"consumption_timeout"` // default 5m
+	PublicURL          string   `toml:"public_url"`          // base URL for document links, default url
+}
+
+// ConsumptionTracking reports whether uploads wait for Paperless to consume
+// the document, and for how long.
+func (p PaperlessConfig) ConsumptionTracking() (bool, time.Duration) {
+	timeout := p.ConsumptionTimeout.Duration()
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	return p.TrackConsumption == nil || *p.TrackConsumption, timeout
+}
+
+// NameCacheTTL returns how long lists of Paperless tags, correspondents,
+// document types and storage paths are cached.
+func (p PaperlessConfig) NameCacheTTL() time.Duration {
+	if ttl := p.CacheTTL.Duration(); ttl > 0 {
+		return ttl
+	}
+	return 10 * time.Minute
 }
 
 type SMBConfig struct {
-	Enabled         bool   `toml:"enabled"`
-	Server          string `toml:"server"`
-	Share           string `toml:"share"`
-	Username        string `toml:"username"`
-	PasswordFile    string `toml:"password_file"`
-	Directory       string `toml:"directory"`
-	FilenamePattern string `toml:"filename_pattern"`
+	NamingConfig
+	Enabled      bool   `toml:"enabled"`
+	Server       string `toml:"server"`
+	Share        string `toml:"share"`
+	Username     string `toml:"username"`
+	PasswordFile string `toml:"password_file"`
+	Directory    string `toml:"directory"`
+}
+
+// SFTPConfig configures uploads over SSH. Authentication uses a private key
+// or a password from a file; the host key is checked against known_hosts.
+type SFTPConfig struct {
+	NamingConfig
+	Enabled                  bool   `toml:"enabled"`
+	Host                     string `toml:"host"` // host or host:port, default port 22
+	Username                 string `toml:"username"`
+	PasswordFile             string `toml:"password_file"`
+	PrivateKeyFile           string `toml:"private_key_file"`
+	PrivateKeyPassphraseFile string `toml:"private_key_passphrase_file"`
+	KnownHostsFile           string `toml:"known_hosts_file"`
+	InsecureIgnoreHostKey    bool   `toml:"insecure_ignore_host_key"` // for tests only
+	Directory                string `toml:"directory"`
+}
+
+func (s SFTPConfig) validate(section string) []error {
+	var errs []error
+	if strings.TrimSpace(s.Host) == "" {
+		errs = append(errs, fmt.Errorf("%s.host must not be empty", section))
+	}
+	if s.Username == "" {
+		errs = append(errs, fmt.Errorf("%s.username must not be empty", section))
+	}
+	if s.PasswordFile == "" && s.PrivateKeyFile == "" {
+		errs = append(errs, fmt.Errorf("%s: set password_file or private_key_file", section))
+	}
+	if s.PrivateKeyPassphraseFile != "" && s.PrivateKeyFile == "" {
+		errs = append(errs, fmt.Errorf("%s.private_key_passphrase_file requires private_key_file", section))
+	}
+	if s.KnownHostsFile == "" && !s.InsecureIgnoreHostKey {
+		errs = append(errs, fmt.Errorf("%s.known_hosts_file must not be empty", section))
+	}
+	return append(errs, s.NamingConfig.validate(section)...)
+}
+
+// HTTPConfig configures a generic webhook that receives the document as a
+// multipart form or as the raw request body. URL, headers and fields may
+// contain placeholders such as {title} or {job_id}.
+type HTTPConfig struct {
+	NamingConfig
+	Enabled        bool              `toml:"enabled"`
+	URL            string            `toml:"url"`
+	Method         string            `toml:"method"`     // POST (default) or PUT
+	Body           string            `toml:"body"`       // "multipart" (default) or "raw"
+	FileField      string            `toml:"file_field"` // multipart field of the document, default "document"
+	Headers        map[string]string `toml:"headers"`
+	HeaderFiles    map[string]string `toml:"header_files"` // header values read from files, e.g. Authorization
+	Fields         map[string]string `toml:"fields"`       // multipart form fields
+	HMACSecretFile string            `toml:"hmac_secret_file"`
+	HMACHeader     string            `toml:"hmac_header"`     // default X-Scanflow-Signature
+	SuccessCodes   []int             `toml:"success_codes"`   // default: any 2xx
+	ResponseFields map[string]string `toml:"response_fields"` // result name -> JSON path, e.g. document_id = "data.id"
+	Timeout        duration          `toml:"timeout"`
+}
+
+// RequestTimeout returns the timeout of one request, by default 2 minutes.
+func (h HTTPConfig) RequestTimeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout.Duration()
+	}
+	return 2 * time.Minute
+}
+
+func (h HTTPConfig) validate(section string) []error {
+	var errs []error
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("%s.url must be an http or https URL, got %q", section, h.URL))
+	}
+	switch strings.ToUpper(h.Method) {
+	case "", "POST", "PUT":
+	default:
+		errs = append(errs, fmt.Errorf("%s.method must be POST or PUT; got %q", section, h.Method))
+	}
+	switch h.Body {
+	case "", "multipart", "raw":
+	default:
+		errs = append(errs, fmt.Errorf("%s.body must be multipart or raw; got %q", section, h.Body))
+	}
+	if h.Body == "raw" && len(h.Fields) > 0 {
+		errs = append(errs, fmt.Errorf("%s.fields require body = \"multipart\"", section))
+	}
+	for _, code := range h.SuccessCodes {
+		if code < 100 || code > 599 {
+			errs = append(errs, fmt.Errorf("%s.success_codes: invalid status code %d", section, code))
+		}
+	}
+	if h.HMACHeader != "" && h.HMACSecretFile == "" {
+		errs = append(errs, fmt.Errorf("%s.hmac_header requires hmac_secret_file", section))
+	}
+	if h.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("%s.timeout must not be negative", section))
+	}
+	return append(errs, h.NamingConfig.validate(section)...)
+}
+
+// IPPConfig configures printing on an IPP printer, e.g. a CUPS queue or a
+// driverless printer. Copies, sides, media and color mode are defaults that
+// a profile's [output.print] section overrides.
+type IPPConfig struct {
+	Enabled      bool     `toml:"enabled"`
+	URL          string   `toml:"url"` // ipp://, ipps://, http:// or https://
+	Username     string   `toml:"username"`
+	PasswordFile string   `toml:"password_file"`
+	Copies       int      `toml:"copies"`
+	Sides        string   `toml:"sides"`
+	Media        string   `toml:"media"`
+	ColorMode    string   `toml:"color_mode"`
+	PollInterval duration `toml:"poll_interval"` // job state polling, default 2s
+	Timeout      duration `toml:"timeout"`       // wait for the job to complete, default 10m
+}
+
+// JobPollInterval returns how often the job state is polled.
+func (p IPPConfig) JobPollInterval() time.Duration {
+	if p.PollInterval > 0 {
+		return p.PollInterval.Duration()
+	}
+	return 2 * time.Second
+}
+
+// JobTimeout returns how long to wait for a print job to complete.
+func (p IPPConfig) JobTimeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout.Duration()
+	}
+	return 10 * time.Minute
+}
+
+func (p IPPConfig) validate(section string) []error {
+	var errs []error
+	u, err := url.Parse(p.URL)
+	if err != nil || u.Host == "" {
+		errs = append(errs, fmt.Errorf("%s.url must be an ipp, ipps, http or https URL, got %q", section, p.URL))
+	} else {
+		switch u.Scheme {
+		case "ipp", "ipps", "http", "https":
+		default:
+			errs = append(errs, fmt.Errorf("%s.url must be an ipp, ipps, http or https URL, got %q", section, p.URL))
+		}
+	}
+	errs = append(errs, validatePrintOptions(section, p.Copies, p.Sides, p.ColorMode)...)
+	if p.PollInterval < 0 || p.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("%s.poll_interval and timeout must not be negative", section))
+	}
+	return errs
+}
+
+// validatePrintOptions checks the default print settings of an output.
+func validatePrintOptions(section string, copies int, sides, colorMode string) []error {
+	var errs []error
+	if copies < 0 || copies > 999 {
+		errs = append(errs, fmt.Errorf("%s.copies must be between 1 and 999, got %d", section, copies))
+	}
+	switch sides {
+	case "", "one-sided", "two-sided-long-edge", "two-sided-short-edge":
+	default:
+		errs = append(errs, fmt.Errorf("%s.sides must be one-sided, two-sided-long-edge or two-sided-short-edge; got %q", section, sides))
+	}
+	switch colorMode {
+	case "", "auto", "color", "monochrome":
+	default:
+		errs = append(errs, fmt.Errorf("%s.color_mode must be auto, color or monochrome; got %q", section, colorMode))
+	}
+	return errs
+}
+
+// WebDAVConfig configures uploads to a WebDAV server such as Nextcloud.
+// Authentication is basic auth with username and password_file, or a bearer
+// token from token_file.
+type WebDAVConfig struct {
+	NamingConfig
+	Enabled      bool   `toml:"enabled"`
+	URL          string `toml:"url"` // collection documents are stored below
+	Username     string `toml:"username"`
+	PasswordFile string `toml:"password_file"`
+	TokenFile    string `toml:"token_file"`
+	Checksum     string `toml:"checksum"`      // "md5", "sha1" or "sha256": send an OC-Checksum header
+	ChunkSizeMB  int    `toml:"chunk_size_mb"` // Nextcloud chunked upload above this size, 0 = off
+	ChunkURL     string `toml:"chunk_url"`     // uploads collection, derived from a Nextcloud url by default
+}
+
+// UploadsURL returns the collection chunked uploads are assembled in. For
+// a Nextcloud URL like .../remote.php/dav/files/<user>/Scans it defaults
+// to .../remote.php/dav/uploads/<user>.
+func (w WebDAVConfig) UploadsURL() string {
+	if w.ChunkURL != "" {
+		return w.ChunkURL
+	}
+	const files = "/remote.php/dav/files/"
+	i := strings.Index(w.URL, files)
+	if i < 0 {
+		return ""
+	}
+	user, _, _ := strings.Cut(w.URL[i+len(files):], "/")
+	return w.URL[:i] + "/remote.php/dav/uploads/" + user
+}
+
+func (w WebDAVConfig) validate(section string) []error {
+	var errs []error
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("%s.url must be an http or https URL, got %q", section, w.URL))
+	}
+	if w.PasswordFile != "" && w.TokenFile != "" {
+		errs = append(errs, fmt.Errorf("%s: set either password_file or token_file, not both", section))
+	}
+	switch strings.ToLower(w.Checksum) {
+	case "", "md5", "sha1", "sha256":
+	default:
+		errs = append(errs, fmt.Errorf("%s.checksum must be one of md5, sha1, sha256; got %q", section, w.Checksum))
+	}
+	if w.ChunkSizeMB < 0 {
+		errs = append(errs, fmt.Errorf("%s.chunk_size_mb must not be negative", section))
+	}
+	if w.ChunkSizeMB > 0 && w.UploadsURL() == "" {
+		errs = append(errs, fmt.Errorf("%s.chunk_url must be set for chunked uploads to non-Nextcloud URLs", section))
+	}
+	return append(errs, w.NamingConfig.validate(section)...)
+}
+
+// S3Config configures uploads to Amazon S3 or an S3-compatible object
+// store. Bucket and prefix may contain placeholders such as {year}.
+type S3Config struct {
+	NamingConfig
+	Enabled             bool   `toml:"enabled"`
+	Endpoint            string `toml:"endpoint"` // default https://s3.<region>.amazonaws.com
+	Region              string `toml:"region"`   // default us-east-1
+	Bucket              string `toml:"bucket"`
+	Prefix              string `toml:"prefix"`     // key prefix, e.g. "scans/{year}"
+	PathStyle           bool   `toml:"path_style"` // <endpoint>/<bucket>/<key> instead of <bucket>.<host>
+	AccessKeyID         string `toml:"access_key_id"`
+	AccessKeyIDFile     string `toml:"access_key_id_file"`
+	SecretAccessKeyFile string `toml:"secret_access_key_file"`
+	SessionTokenFile    string `toml:"session_token_file"`
+	StorageClass        string `toml:"storage_class"`
+	SSE                 string `toml:"sse"`            // "AES256" or "aws:kms"
+	SSEKMSKeyID         string `toml:"sse_kms_key_id"` // with sse = "aws:kms"
+	PartSizeMB          int    `toml:"part_size_mb"`   // multipart upload above this size, default 16
+}
+
+// PartSize returns the multipart part size in bytes.
+func (s S3Config) PartSize() int64 {
+	if s.PartSizeMB <= 0 {
+		return 16 << 20
+	}
+	return int64(s.PartSizeMB) << 20
+}
+
+func (s S3Config) validate(section string) []error {
+	var errs []error
+	if strings.TrimSpace(s.Bucket) == "" {
+		errs = append(errs, fmt.Errorf("%s.bucket must not be empty", section))
+	}
+	if s.Endpoint != "" {
+		if u, err := url.Parse(s.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s.endpoint must be an http or https URL, got %q", section, s.Endpoint))
+		}
+	}
+	if s.AccessKeyID != "" && s.AccessKeyIDFile != "" {
+		errs = append(errs, fmt.Errorf("%s: set either access_key_id or access_key_id_file, not both", section))
+	}
+	if s.SecretAccessKeyFile == "" {
+		errs = append(errs, fmt.Errorf("%s.secret_access_key_file must not be empty", section))
+	}
+	switch s.SSE {
+	case "", "AES256", "aws:kms":
+	default:
+		errs = append(errs, fmt.Errorf("%s.sse must be AES256 or aws:kms; got %q", section, s.SSE))
+	}
+	if s.SSEKMSKeyID != "" && s.SSE != "aws:kms" {
+		errs = append(errs, fmt.Errorf("%s.sse_kms_key_id requires sse = \"aws:kms\"", section))
+	}
+	if s.PartSizeMB != 0 && s.PartSizeMB < 5 {
+		errs = append(errs, fmt.Errorf("%s.part_size_mb must be at least 5, got %d", section, s.PartSizeMB))
+	}
+	return append(errs, s.NamingConfig.validate(section)...)
 }
 
 type PaperlessConsumeConfig struct {
+	NamingConfig
 	Enabled   bool   `toml:"enabled"`
 	Path      string `toml:"path"`
 	SMBServer string `toml:"smb_server"`
 }
 
+// EmailConfig configures sending documents as email attachments. Profiles
+// and scan requests may replace the recipients with addresses on the
+// allowed_recipients list.
 type EmailConfig struct {
-	Enabled          bool   `toml:"enabled"`
-	SMTPHost         string `toml:"smtp_host"`
-	SMTPPort         int    `toml:"smtp_port"`
-	SMTPUser         string `toml:"smtp_user"`
-	SMTPPasswordFile string `toml:"smtp_password_file"`
-	FromAddress      string `toml:"from_address"`
-	DefaultRecipient string `toml:"default_recipient"`
+	NamingConfig
+	Enabled           bool     `toml:"enabled"`
+	SMTPHost          string   `toml:"smtp_host"`
+	SMTPPort          int      `toml:"smtp_port"`
+	SMTPUser          string   `toml:"smtp_user"`
+	SMTPPasswordFile  string   `toml:"smtp_password_file"`
+	TLS               string   `toml:"tls"` // starttls (opportunistic, default), starttls_required, implicit
+	FromAddress       string   `toml:"from_address"`
+	DefaultRecipient  string   `toml:"default_recipient"` // used when to is empty
+	To                []string `toml:"to"`
+	Cc                []string `toml:"cc"`
+	Bcc               []string `toml:"bcc"`
+	AllowedRecipients []string `toml:"allowed_recipients"` // addresses or "@domain"
+	Subject           string   `toml:"subject"`            // pattern, default "ScanFlow: {title}"
+	Body              string   `toml:"body"`               // pattern for the text part
+	MaxSizeMB         int      `toml:"max_size_mb"`        // attachment limit, 0 = none
+	Oversize          string   `toml:"oversize"`           // reject (default) or split
+}
+
+// Recipients returns the configured to addresses, falling back to the
+// default recipient.
+func (e EmailConfig) Recipients() []string {
+	if len(e.To) > 0 {
+		return e.To
+	}
+	if e.DefaultRecipient != "" {
+		return []string{e.DefaultRecipient}
+	}
+	return nil
+}
+
+// MaxSize returns the attachment size limit in bytes, or 0 for none.
+func (e EmailConfig) MaxSize() int64 {
+	return int64(e.MaxSizeMB) << 20
+}
+
+func (e EmailConfig) validate(section string) []error {
+	var errs []error
+	if e.SMTPHost == "" {
+		errs = append(errs, fmt.Errorf("%s.smtp_host must not be empty", section))
+	}
+	switch e.TLS {
+	case "", "starttls", "starttls_required", "implicit":
+	default:
+		errs = append(errs, fmt.Errorf("%s.tls must be starttls, starttls_required or implicit; got %q", section, e.TLS))
+	}
+	addrs := []string{e.FromAddress, e.DefaultRecipient}
+	addrs = append(addrs, e.To...)
+	addrs = append(addrs, e.Cc...)
+	addrs = append(addrs, e.Bcc...)
+	for _, addr := range addrs {
+		if addr == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid address %q: %v", section, addr, err))
+		}
+	}
+	for _, allowed := range e.AllowedRecipients {
+		if !strings.Contains(allowed, "@") {
+			errs = append(errs, fmt.Errorf("%s.allowed_recipients: %q must be an address or @domain", section, allowed))
+		}
+	}
+	if e.MaxSizeMB < 0 {
+		errs = append(errs, fmt.Errorf("%s.max_size_mb must not be negative", section))
+	}
+	switch e.Oversize {
+	case "", "reject", "split":
+	default:
+		errs = append(errs, fmt.Errorf("%s.oversize must be reject or split; got %q", section, e.Oversize))
+	}
+	return append(errs, e.NamingConfig.validate(section)...)
 }
 
 type LoggingConfig struct {
@@ -282,6 +1051,41 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Button bindings and actions
+	errs = append(errs, c.Button.validate()...)
+
+	// Output file naming
+	errs = append(errs, c.Output.Filesystem.validate()...)
+	errs = append(errs, c.Output.Paperless.NamingConfig.validate("output.paperless")...)
+	errs = append(errs, c.Output.SMB.NamingConfig.validate("output.smb")...)
+	errs = append(errs, c.Output.PaperlessConsume.NamingConfig.validate("output.paperless_consume")...)
+	if c.Output.Email.Enabled {
+		errs = append(errs, c.Output.Email.validate("output.email")...)
+	} else {
+		errs = append(errs, c.Output.Email.NamingConfig.validate("output.email")...)
+	}
+	if c.Output.WebDAV.Enabled {
+		errs = append(errs, c.Output.WebDAV.validate("output.webdav")...)
+	}
+	if c.Output.S3.Enabled {
+		errs = append(errs, c.Output.S3.validate("output.s3")...)
+	}
+	if c.Output.SFTP.Enabled {
+		errs = append(errs, c.Output.SFTP.validate("output.sftp")...)
+	}
+	if c.Output.HTTP.Enabled {
+		errs = append(errs, c.Output.HTTP.validate("output.http")...)
+	}
+	if c.Output.IPP.Enabled {
+		errs = append(errs, c.Output.IPP.validate("output.ipp")...)
+	}
+	errs = append(errs, c.Output.validateInstances()...)
+	errs = append(errs, c.Output.Outbox.validate(c.Storage.LocalDirectory)...)
+	errs = append(errs, c.Output.Managed.validate(c.Server.Auth, c.Storage.LocalDirectory, c.Output.Filesystem)...)
+
+	// MQTT
+	errs = append(errs, c.MQTT.validate()...)
+
 	// Logging.Level
 	switch c.Logging.Level {
 	case "debug", "info", "warn", "error":
@@ -341,7 +1145,8 @@ func DefaultConfig() *Config {
 			Port: 8080,
 		},
 		Scanner: ScannerConfig{
-			AutoOpen: true,
+			AutoOpen:        true,
+			MonitorInterval: duration(5 * time.Second),
 			Defaults: ScannerDefaults{
 				Resolution: 300,
 				Mode:       "color",
@@ -380,9 +1185,35 @@ func DefaultConfig() *Config {
 			RetentionDays:  30,
 		},
 		Output: OutputConfig{
+			Filesystem: FilesystemConfig{
+				Enabled: true,
+				FilesystemTarget: FilesystemTarget{
+					Directory: localDir,
+				},
+			},
 			Paperless: PaperlessConfig{
 				VerifySSL: true,
 			},
+			Outbox: OutboxConfig{
+				Enabled: true,
+				// About five days in total, enough to ride out a long weekend.
+				Schedule: []duration{
+					duration(time.Minute), duration(5 * time.Minute), duration(15 * time.Minute),
+					duration(30 * time.Minute), duration(time.Hour), duration(2 * time.Hour),
+					duration(4 * time.Hour), duration(8 * time.Hour), duration(12 * time.Hour),
+					duration(24 * time.Hour), duration(24 * time.Hour), duration(24 * time.Hour),
+					duration(24 * time.Hour),
+				},
+			},
+		},
+		MQTT: MQTTConfig{
+			TopicPrefix: "scanflow",
+			QoS:         1,
+			Discovery: MQTTDiscoveryConfig{
+				Enabled: true,
+				Prefix:  "homeassistant",
+				NodeID:  "scanflow",
+			},
 		},
 		Logging: LoggingConfig{
 			Level:  "info",
@@ -400,6 +1231,30 @@ func (c *Config) loadSecrets() error {
 		}
 		c.Output.Paperless.Token = token
 	}
+	if c.MQTT.PasswordFile != "" && c.MQTT.Password == "" {
+		password, err := readSecretFile(c.MQTT.PasswordFile)
+		if err != nil && c.MQTT.Enabled {
+			return fmt.Errorf("mqtt password: %w", err)
+		}
+		c.MQTT.Password = password
+	}
+	for _, inst := range c.Output.Instances {
+		if err := inst.loadSecrets(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSecrets reads the secrets an instance's handler expects in memory.
+func (i OutputInstance) loadSecrets() error {
+	if p := i.Paperless; p != nil && p.TokenFile != "" && p.Token == "" {
+		token, err := readSecretFile(p.TokenFile)
+		if err != nil {
+			return fmt.Errorf("output %s paperless token: %w", i.Name, err)
+		}
+		p.Token = token
+	}
 	return nil
 }
 
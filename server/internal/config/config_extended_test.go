@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -322,3 +323,525 @@ func TestDefaultPhotoProfile(t *testing.T) {
 		t.Fatal("expected OCR disabled for photo")
 	}
 }
+
+func TestProfilePrintSettings(t *testing.T) {
+	dir := t.TempDir()
+	profile := `
+[output]
+default_target = "ipp"
+
+[output.print]
+copies = 1
+sides = "two-sided-long-edge"
+`
+	os.WriteFile(filepath.Join(dir, "copy.toml"), []byte(profile), 0o644)
+
+	store, err := NewProfileStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p, ok := store.Get("copy")
+	if !ok {
+		t.Fatal("copy profile not found")
+	}
+	want := ProfilePrint{Copies: 1, Sides: "two-sided-long-edge"}
+	if p.Output.DefaultTarget != "ipp" || p.Output.Print != want {
+		t.Fatalf("unexpected copy output %+v", p.Output)
+	}
+}
+
+func TestValidateIPP(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.IPP = IPPConfig{Enabled: true, URL: "lpd://printer.local/queue", Copies: -1, Sides: "duplex", ColorMode: "grey"}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"output.ipp.url", "output.ipp.copies", "output.ipp.sides", "output.ipp.color_mode"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+
+	cfg.Output.IPP = IPPConfig{Enabled: true, URL: "ipp://printer.local/ipp/print", Sides: "two-sided-long-edge", ColorMode: "monochrome"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Output.IPP.JobPollInterval() != 2*time.Second || cfg.Output.IPP.JobTimeout() != 10*time.Minute {
+		t.Errorf("unexpected defaults %v, %v", cfg.Output.IPP.JobPollInterval(), cfg.Output.IPP.JobTimeout())
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.Email = EmailConfig{
+		Enabled:           true,
+		TLS:               "ssl",
+		To:                []string{"not an address"},
+		AllowedRecipients: []string{"example.com"},
+		MaxSizeMB:         -1,
+		Oversize:          "truncate",
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"output.email.smtp_host", "output.email.tls", `invalid address "not an address"`,
+		"output.email.allowed_recipients", "output.email.max_size_mb", "output.email.oversize"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+
+	cfg.Output.Email = EmailConfig{
+		Enabled:           true,
+		SMTPHost:          "smtp.example.com",
+		TLS:               "implicit",
+		DefaultRecipient:  "Office <office@example.com>",
+		AllowedRecipients: []string{"@example.com"},
+		MaxSizeMB:         20,
+		Oversize:          "split",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := cfg.Output.Email.Recipients(); len(r) != 1 || r[0] != "Office <office@example.com>" {
+		t.Errorf("expected the default recipient, got %v", r)
+	}
+	if cfg.Output.Email.MaxSize() != 20<<20 {
+		t.Errorf("unexpected size limit %d", cfg.Output.Email.MaxSize())
+	}
+}
+
+func TestLoadConfigButtonBindings(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "server.toml")
+
+	content := `
+[button]
+enabled = true
+short_press_profile = "standard"
+long_press_profile = "oversize"
+output = "paperless"
+double_press_window = "300ms"
+
+[[button.bindings]]
+button = "email"
+gesture = "short"
+action = "mail"
+
+[[button.bindings]]
+gesture = "double"
+function = 2
+action = "photo"
+
+[button.actions.mail]
+profile = "standard"
+output = "email"
+beep = [100, 100]
+
+[button.actions.photo]
+profile = "photo"
+
+[button.actions.photo.metadata]
+tags = [4, 7]
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.Button.DoublePressWindow.Duration() != 300*time.Millisecond {
+		t.Errorf("double_press_window = %v", cfg.Button.DoublePressWindow.Duration())
+	}
+
+	bindings, actions := cfg.Button.EffectiveBindings()
+	if len(bindings) != 4 {
+		t.Fatalf("expected 2 explicit + 2 legacy bindings, got %+v", bindings)
+	}
+	if bindings[1].Button != "scan" || bindings[1].Function == nil || *bindings[1].Function != 2 {
+		t.Errorf("binding without button should default to scan with function 2: %+v", bindings[1])
+	}
+	if actions["mail"].Output != "email" || len(actions["mail"].Beep) != 2 {
+		t.Errorf("mail action = %+v", actions["mail"])
+	}
+	if actions["photo"].Output != "paperless" {
+		t.Errorf("action output should default to button.output, got %q", actions["photo"].Output)
+	}
+	if got := actions[ShortPressAction]; got.Profile != "standard" {
+		t.Errorf("legacy short press action = %+v", got)
+	}
+	if got := actions[LongPressAction]; got.Profile != "oversize" {
+		t.Errorf("legacy long press action = %+v", got)
+	}
+}
+
+func TestEffectiveBindingsExplicitOverridesLegacy(t *testing.T) {
+	btn := ButtonConfig{
+		ShortPressProfile: "standard",
+		LongPressProfile:  "oversize",
+		Bindings: []ButtonBinding{
+			{Button: "scan", Gesture: "short", Action: "custom"},
+		},
+		Actions: map[string]ButtonAction{"custom": {Profile: "photo"}},
+	}
+
+	bindings, _ := btn.EffectiveBindings()
+	for _, b := range bindings {
+		if b.Gesture == "short" && b.Action != "custom" {
+			t.Errorf("legacy short press should be replaced by explicit binding, got %+v", b)
+		}
+	}
+	if len(bindings) != 2 {
+		t.Errorf("expected custom short + legacy long binding, got %+v", bindings)
+	}
+}
+
+func TestValidateButtonBindings(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Button.Bindings = []ButtonBinding{
+		{Gesture: "triple", Action: "missing"},
+	}
+	cfg.Button.Actions = map[string]ButtonAction{"loud": {Beep: []int{5000}}}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"gesture", "not defined", "beep"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigOutputNaming(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.toml")
+	content := `
+[output.smb]
+enabled = true
+filename_pattern = "{year}/{month}/{title}"
+sanitize = "windows"
+on_conflict = "fail"
+`
+	os.WriteFile(path, []byte(content), 0o644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	want := NamingConfig{FilenamePattern: "{year}/{month}/{title}", Sanitize: "windows", OnConflict: "fail"}
+	if cfg.Output.SMB.NamingConfig != want {
+		t.Errorf("expected %+v, got %+v", want, cfg.Output.SMB.NamingConfig)
+	}
+}
+
+func TestValidateOutputNaming(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.PaperlessConsume.Sanitize = "ntfs"
+	cfg.Output.Email.OnConflict = "replace"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"output.paperless_consume.sanitize", "output.email.on_conflict"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+}
+
+func TestValidateFilesystemOutput(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.Filesystem.FileMode = "rw-r--r--"
+	cfg.Output.Filesystem.Destinations = map[string]FilesystemTarget{
+		"smb":     {Directory: "/srv/scans"},
+		"archive": {},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"file_mode", "destinations.smb: name is reserved", "destinations.archive.directory"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+}
+
+func TestFilesystemTargetModes(t *testing.T) {
+	file, dir, err := FilesystemTarget{FileMode: "0660", DirMode: "2770"}.Modes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file != 0o660 || dir != os.ModeSetgid|0o770 {
+		t.Fatalf("expected 0660 and setgid 0770, got %v/%v", file, dir)
+	}
+}
+
+func TestLoadConfigOutputInstances(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	os.WriteFile(tokenFile, []byte("tok\n"), 0o600)
+
+	path := filepath.Join(dir, "server.toml")
+	content := `
+[[output.instances]]
+name = "smb-accounting"
+type = "smb"
+[output.instances.smb]
+server = "//nas.local"
+share = "accounting"
+filename_pattern = "{year}/{title}"
+
+[[output.instances]]
+name = "paperless-office"
+type = "paperless"
+[output.instances.paperless]
+url = "https://office.example.com"
+token_file = "` + filepath.ToSlash(tokenFile) + `"
+`
+	os.WriteFile(path, []byte(content), 0o644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.Output.Instances) != 2 {
+		t.Fatalf("expected 2 instances, got %d", len(cfg.Output.Instances))
+	}
+	smb := cfg.Output.Instances[0]
+	if smb.Name != "smb-accounting" || smb.SMB == nil || smb.SMB.Share != "accounting" || smb.SMB.FilenamePattern != "{year}/{title}" {
+		t.Errorf("unexpected smb instance: %+v", smb)
+	}
+	if p := cfg.Output.Instances[1].Paperless; p == nil || p.Token != "tok" {
+		t.Errorf("expected paperless token loaded from file, got %+v", p)
+	}
+}
+
+func TestValidateOutputInstances(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.Instances = []OutputInstance{
+		{Name: "nas", Type: "smb", SMB: &SMBConfig{Server: "nas", Share: "a"}},
+		{Name: "nas", Type: "smb", SMB: &SMBConfig{Server: "nas", Share: "b"}},
+		{Name: "email", Type: "email", Email: &EmailConfig{SMTPHost: "smtp"}},
+		{Name: "box", Type: "ftp"},
+		{Name: "mismatch", Type: "smb", Email: &EmailConfig{}},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"duplicate output name", "[email]: name is reserved", "type must be one of", "exactly one settings table"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigOutbox(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.toml")
+	content := `
+[output.outbox]
+directory = "/var/spool/scanflow"
+schedule = ["10m", "6h"]
+`
+	os.WriteFile(path, []byte(content), 0o644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Output.Outbox.Enabled || cfg.Output.Outbox.Directory != "/var/spool/scanflow" {
+		t.Fatalf("unexpected outbox config: %+v", cfg.Output.Outbox)
+	}
+	schedule := cfg.Output.Outbox.RetrySchedule()
+	if len(schedule) != 2 || schedule[0] != 10*time.Minute || schedule[1] != 6*time.Hour {
+		t.Fatalf("expected schedule to replace the default, got %v", schedule)
+	}
+}
+
+func TestValidateOutbox(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Storage.LocalDirectory = ""
+	cfg.Output.Outbox.Schedule = []duration{duration(time.Minute), 0}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"output.outbox.directory", "output.outbox.schedule[1]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+
+	cfg.Output.Outbox.Enabled = false
+	cfg.Output.Filesystem.Enabled = false
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("disabled outbox must not be validated: %v", err)
+	}
+}
+
+func TestValidateWebDAV(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.WebDAV = WebDAVConfig{
+		Enabled:      true,
+		URL:          "cloud.example.com/dav",
+		PasswordFile: "/etc/scanflow/dav_password",
+		TokenFile:    "/etc/scanflow/dav_token",
+		Checksum:     "crc32",
+		ChunkSizeMB:  10,
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"output.webdav.url", "password_file or token_file", "output.webdav.checksum", "output.webdav.chunk_url"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+
+	cfg.Output.WebDAV = WebDAVConfig{Enabled: true, URL: "https://cloud.example.com/remote.php/dav/files/scan/Scans", ChunkSizeMB: 10, Checksum: "SHA256"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Output.WebDAV.UploadsURL(); got != "https://cloud.example.com/remote.php/dav/uploads/scan" {
+		t.Errorf("unexpected uploads URL %q", got)
+	}
+}
+
+func TestValidateSFTP(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.SFTP = SFTPConfig{Enabled: true, PrivateKeyPassphraseFile: "/etc/scanflow/sftp_passphrase"}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		"output.sftp.host", "output.sftp.username", "password_file or private_key_file",
+		"output.sftp.private_key_passphrase_file", "output.sftp.known_hosts_file",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+
+	cfg.Output.SFTP = SFTPConfig{
+		Enabled:        true,
+		Host:           "archive.example.com:2222",
+		Username:       "scan",
+		PrivateKeyFile: "/etc/scanflow/sftp_key",
+		KnownHostsFile: "/etc/scanflow/known_hosts",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateHTTP(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.HTTP = HTTPConfig{
+		Enabled:      true,
+		URL:          "dms.local/upload",
+		Method:       "PATCH",
+		Body:         "raw",
+		Fields:       map[string]string{"title": "{title}"},
+		SuccessCodes: []int{42},
+		HMACHeader:   "X-Signature",
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		"output.http.url", "output.http.method", "output.http.fields", "output.http.success_codes", "output.http.hmac_header",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+
+	cfg.Output.HTTP = HTTPConfig{Enabled: true, URL: "https://dms.local/api/{correspondent}", Method: "put", SuccessCodes: []int{201}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Output.HTTP.RequestTimeout(); got != 2*time.Minute {
+		t.Errorf("unexpected default timeout %v", got)
+	}
+}
+
+func TestValidateS3(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Output.S3 = S3Config{
+		Enabled:         true,
+		Endpoint:        "minio:9000",
+		AccessKeyID:     "AKID",
+		AccessKeyIDFile: "/etc/scanflow/s3_key_id",
+		SSE:             "aws:kms:dsse",
+		SSEKMSKeyID:     "key-1",
+		PartSizeMB:      1,
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		"output.s3.bucket", "output.s3.endpoint", "access_key_id or access_key_id_file",
+		"output.s3.secret_access_key_file", "output.s3.sse", "output.s3.sse_kms_key_id", "output.s3.part_size_mb",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+
+	cfg.Output.S3 = S3Config{Enabled: true, Bucket: "scans-{year}", SecretAccessKeyFile: "/etc/scanflow/s3_secret", SSE: "AES256"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Output.S3.PartSize(); got != 16<<20 {
+		t.Errorf("unexpected default part size %d", got)
+	}
+}
+
+func TestValidateMQTT(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MQTT.Enabled = true
+	cfg.MQTT.Broker = "mqtt.local"
+	cfg.MQTT.TopicPrefix = "scanflow/#"
+	cfg.MQTT.QoS = 3
+	cfg.MQTT.Discovery.NodeID = "office/scanner"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"mqtt.broker", "mqtt.topic_prefix", "mqtt.qos", "mqtt.discovery.node_id"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+
+	cfg.MQTT.Broker = "tcp://mqtt.local:1883"
+	cfg.MQTT.TopicPrefix = "home/scanflow"
+	cfg.MQTT.QoS = 1
+	cfg.MQTT.Discovery.NodeID = "office_scanner"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,566 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// ManagedOutputsConfig enables creating, changing and deleting output
+// instances through the API. They are kept in a file of their own, so
+// server.toml is never rewritten.
+type ManagedOutputsConfig struct {
+	Enabled bool   `toml:"enabled"`
+	File    string `toml:"file"` // default: outputs.toml next to storage.local_directory
+}
+
+// Path returns the managed outputs file, or "" when runtime management is
+// disabled or there is no place to keep the file. By default the file lives
+// in the parent of the storage directory, so that neither it nor its
+// secrets end up in the archived documents.
+func (m ManagedOutputsConfig) Path(storageDir string) string {
+	switch {
+	case !m.Enabled:
+		return ""
+	case strings.TrimSpace(m.File) != "":
+		return m.File
+	case strings.TrimSpace(storageDir) != "":
+		return filepath.Join(filepath.Dir(filepath.Clean(storageDir)), "outputs.toml")
+	}
+	return ""
+}
+
+// validate refuses runtime output management without authentication, and
+// secrets that would be written into a filesystem output directory.
+func (m ManagedOutputsConfig) validate(auth AuthConfig, storageDir string, fsCfg FilesystemConfig) []error {
+	path := m.Path(storageDir)
+	if path == "" {
+		return nil
+	}
+	var errs []error
+	if !auth.Enabled {
+		errs = append(errs, errors.New("output.managed requires server.auth to be enabled"))
+	}
+
+	secrets := secretsDir(path)
+	dirs := make([]string, 0, len(fsCfg.Destinations)+1)
+	if fsCfg.Enabled {
+		dirs = append(dirs, fsCfg.Directory)
+	}
+	for _, dest := range fsCfg.Destinations {
+		dirs = append(dirs, dest.Directory)
+	}
+	for _, dir := range dirs {
+		if dir != "" && isWithin(secrets, dir) {
+			errs = append(errs, fmt.Errorf("output.managed: secrets directory %s lies inside the filesystem output directory %s", secrets, dir))
+		}
+	}
+	return errs
+}
+
+// isWithin reports whether path is dir or lies below it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// secretsDir returns the directory the secrets of the managed outputs file
+// at path are written to.
+func secretsDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "secrets")
+}
+
+// ErrInvalidOutput matches errors caused by an invalid managed output
+// instance, as opposed to failures storing it.
+var ErrInvalidOutput = errors.New("invalid output")
+
+func invalidOutput(errs ...error) error {
+	return fmt.Errorf("%w: %w", ErrInvalidOutput, errors.Join(errs...))
+}
+
+// validOutputName restricts managed instance names, which are also used in
+// the file names of their secrets.
+var validOutputName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// outputSecrets maps the secrets of each output type to the setting that
+// holds the path of the file they are read from.
+var outputSecrets = map[string]map[string]string{
+	"paperless": {"token": "token_file"},
+	"smb":       {"password": "password_file"},
+	"email":     {"smtp_password": "smtp_password_file"},
+	"webdav":    {"password": "password_file", "token": "token_file"},
+	"s3": {
+		"access_key_id":     "access_key_id_file",
+		"secret_access_key": "secret_access_key_file",
+		"session_token":     "session_token_file",
+	},
+	"sftp": {
+		"password":               "password_file",
+		"private_key":            "private_key_file",
+		"private_key_passphrase": "private_key_passphrase_file",
+		"known_hosts":            "known_hosts_file",
+	},
+	"http": {"hmac_secret": "hmac_secret_file"},
+	"ipp":  {"password": "password_file"},
+}
+
+// headerSecretPrefix names the secrets of HTTP outputs that are sent as a
+// request header, e.g. "header:Authorization".
+const headerSecretPrefix = "header:"
+
+// secretSettings lists the settings of an output type that the store
+// manages and that cannot be set directly.
+func secretSettings(typ string) []string {
+	var keys []string
+	for _, key := range outputSecrets[typ] {
+		keys = append(keys, key)
+	}
+	switch typ {
+	case "paperless":
+		keys = append(keys, "token")
+	case "http":
+		keys = append(keys, "header_files")
+	}
+	return keys
+}
+
+func isSecret(typ, name string) bool {
+	if _, ok := outputSecrets[typ][name]; ok {
+		return true
+	}
+	return typ == "http" && strings.HasPrefix(name, headerSecretPrefix) && len(name) > len(headerSecretPrefix)
+}
+
+// outputMap returns an instance in its TOML shape.
+func outputMap(inst OutputInstance) (map[string]any, error) {
+	data, err := toml.Marshal(inst)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := toml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// outputFromMap decodes an instance from its TOML shape. Unknown settings
+// are rejected.
+func outputFromMap(m map[string]any) (OutputInstance, error) {
+	var inst OutputInstance
+	data, err := toml.Marshal(m)
+	if err != nil {
+		return inst, invalidOutput(err)
+	}
+	dec := toml.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&inst); err != nil {
+		var strict *toml.StrictMissingError
+		if errors.As(err, &strict) {
+			var errs []error
+			for _, e := range strict.Errors {
+				errs = append(errs, fmt.Errorf("unknown setting %s", strings.Join(e.Key(), ".")))
+			}
+			return inst, invalidOutput(errs...)
+		}
+		return inst, invalidOutput(err)
+	}
+	return inst, nil
+}
+
+// secretFiles returns the files of the instance's secrets by secret name.
+func (i OutputInstance) secretFiles() map[string]string {
+	files := make(map[string]string)
+	m, err := outputMap(i)
+	if err != nil {
+		return files
+	}
+	settings, _ := m[i.Type].(map[string]any)
+	for name, key := range outputSecrets[i.Type] {
+		if f, _ := settings[key].(string); f != "" {
+			files[name] = f
+		}
+	}
+	if i.Type == "http" && i.HTTP != nil {
+		for header, f := range i.HTTP.HeaderFiles {
+			files[headerSecretPrefix+header] = f
+		}
+	}
+	return files
+}
+
+// withSecretFiles returns a copy of the instance that reads its secrets
+// from files, replacing any secret settings it had.
+func (i OutputInstance) withSecretFiles(files map[string]string) (OutputInstance, error) {
+	m, err := outputMap(i)
+	if err != nil {
+		return i, err
+	}
+	settings, ok := m[i.Type].(map[string]any)
+	if !ok {
+		// Validation reports the missing settings table.
+		return i, nil
+	}
+	for _, key := range secretSettings(i.Type) {
+		delete(settings, key)
+	}
+	headers := make(map[string]any)
+	for name, f := range files {
+		if header, ok := strings.CutPrefix(name, headerSecretPrefix); ok {
+			headers[header] = f
+		} else {
+			settings[outputSecrets[i.Type][name]] = f
+		}
+	}
+	if len(headers) > 0 {
+		settings["header_files"] = headers
+	}
+	return outputFromMap(m)
+}
+
+// Secrets returns the names of the secrets set on an instance, sorted.
+func (i OutputInstance) Secrets() []string {
+	names := []string{}
+	for name := range i.secretFiles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DecodeOutputJSON parses an output instance from the JSON shape used by the
+// API: the TOML settings of the instance plus a "secrets" object with the
+// values of its secrets. The file settings of secrets belong to the store and
+// cannot be set directly.
+func DecodeOutputJSON(data []byte) (OutputInstance, map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return OutputInstance{}, nil, invalidOutput(err)
+	}
+
+	secrets := make(map[string]string)
+	if raw, ok := m["secrets"]; ok {
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return OutputInstance{}, nil, invalidOutput(errors.New("secrets must be an object"))
+		}
+		for name, v := range obj {
+			value, ok := v.(string)
+			if !ok {
+				return OutputInstance{}, nil, invalidOutput(fmt.Errorf("secrets.%s must be a string", name))
+			}
+			secrets[name] = value
+		}
+		delete(m, "secrets")
+	}
+
+	typ, _ := m["type"].(string)
+	if settings, ok := m[typ].(map[string]any); ok {
+		for _, key := range secretSettings(typ) {
+			if _, ok := settings[key]; ok {
+				return OutputInstance{}, nil, invalidOutput(fmt.Errorf("%s.%s cannot be set directly; pass the secret in secrets", typ, key))
+			}
+		}
+	}
+	// The server would read any file an API client names and send its
+	// content to the output's endpoint.
+	if keys := fileSettings("", m); len(keys) > 0 {
+		var errs []error
+		for _, key := range keys {
+			errs = append(errs, fmt.Errorf("%s cannot be set through the API", key))
+		}
+		return OutputInstance{}, nil, invalidOutput(errs...)
+	}
+
+	inst, err := outputFromMap(fromJSON(m).(map[string]any))
+	return inst, secrets, err
+}
+
+// fileSettings returns the settings in m and its tables that name files on
+// the server, such as "sftp.known_hosts_file", sorted.
+func fileSettings(prefix string, m map[string]any) []string {
+	var keys []string
+	for key, v := range m {
+		if strings.HasSuffix(key, "_file") || strings.HasSuffix(key, "_files") {
+			keys = append(keys, prefix+key)
+		} else if table, ok := v.(map[string]any); ok {
+			keys = append(keys, fileSettings(prefix+key+".", table)...)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fromJSON converts decoded JSON numbers to the integer and float types TOML
+// distinguishes and drops null values.
+func fromJSON(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, e := range v {
+			if e == nil {
+				delete(v, k)
+			} else {
+				v[k] = fromJSON(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = fromJSON(e)
+		}
+	}
+	return v
+}
+
+// EncodeOutputJSON returns the JSON shape of an output instance. Secrets are
+// listed by name only.
+func EncodeOutputJSON(inst OutputInstance) (map[string]any, error) {
+	m, err := outputMap(inst)
+	if err != nil {
+		return nil, err
+	}
+	if settings, ok := m[inst.Type].(map[string]any); ok {
+		for _, key := range secretSettings(inst.Type) {
+			delete(settings, key)
+		}
+	}
+	m["secrets"] = inst.Secrets()
+	return m, nil
+}
+
+// OutputStore keeps the output instances managed through the API in a TOML
+// file. Their secrets are written to files in the secrets directory next to
+// it, readable by the server only.
+type OutputStore struct {
+	path      string
+	mu        sync.Mutex
+	instances map[string]OutputInstance
+}
+
+type managedOutputsFile struct {
+	Instances []OutputInstance `toml:"instances"`
+}
+
+const managedOutputsHeader = "# Output instances managed through the ScanFlow API.\n# Changes made here are overwritten by the next change through the API.\n\n"
+
+// NewOutputStore opens the managed outputs file at path. A missing file is
+// created on the first change.
+func NewOutputStore(path string) (*OutputStore, error) {
+	s := &OutputStore{path: path, instances: make(map[string]OutputInstance)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read managed outputs: %w", err)
+	}
+
+	var file managedOutputsFile
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse managed outputs: %w", err)
+	}
+	for _, inst := range file.Instances {
+		if errs := inst.Validate(); len(errs) > 0 {
+			return nil, fmt.Errorf("managed output %s: %w", inst.Name, errors.Join(errs...))
+		}
+		if err := inst.loadSecrets(); err != nil {
+			return nil, err
+		}
+		s.instances[inst.Name] = inst
+	}
+	return s, nil
+}
+
+// List returns the managed instances sorted by name.
+func (s *OutputStore) List() []OutputInstance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *OutputStore) list() []OutputInstance {
+	list := make([]OutputInstance, 0, len(s.instances))
+	for _, inst := range s.instances {
+		list = append(list, inst)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get returns a managed instance by name.
+func (s *OutputStore) Get(name string) (OutputInstance, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.instances[name]
+	return inst, ok
+}
+
+// Put validates an instance, writes its secrets and saves it, replacing the
+// instance of the same name. Secrets missing from secrets keep their stored
+// value; an empty value removes the secret. The returned instance has its
+// secrets loaded.
+func (s *OutputStore) Put(inst OutputInstance, secrets map[string]string) (OutputInstance, error) {
+	if !validOutputName.MatchString(inst.Name) {
+		return inst, invalidOutput(fmt.Errorf("output name %q must start with a letter or digit and contain only letters, digits, '.', '_' and '-'", inst.Name))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make(map[string]string)
+	old, exists := s.instances[inst.Name]
+	if exists && old.Type == inst.Type {
+		files = old.secretFiles()
+	}
+	write := make(map[string]string)
+	for name, value := range secrets {
+		if !isSecret(inst.Type, name) {
+			return inst, invalidOutput(fmt.Errorf("unknown secret %q for %s outputs", name, inst.Type))
+		}
+		delete(files, name)
+		if value != "" {
+			f := s.secretPath(inst.Name, name)
+			files[name] = f
+			write[f] = value
+		}
+	}
+
+	inst, err := inst.withSecretFiles(files)
+	if err != nil {
+		return inst, err
+	}
+	if errs := inst.Validate(); len(errs) > 0 {
+		return inst, invalidOutput(errs...)
+	}
+
+	if len(write) > 0 {
+		if err := os.MkdirAll(s.secretsDir(), 0o700); err != nil {
+			return inst, fmt.Errorf("create secrets directory: %w", err)
+		}
+	}
+	for f, value := range write {
+		if err := writeFileAtomic(f, []byte(value), 0o600); err != nil {
+			return inst, fmt.Errorf("write secret: %w", err)
+		}
+	}
+	if err := inst.loadSecrets(); err != nil {
+		return inst, err
+	}
+
+	s.instances[inst.Name] = inst
+	if err := s.save(); err != nil {
+		if exists {
+			s.instances[inst.Name] = old
+		} else {
+			delete(s.instances, inst.Name)
+		}
+		return inst, err
+	}
+	if exists {
+		s.removeUnusedSecrets(old)
+	}
+	return inst, nil
+}
+
+// Delete removes a managed instance and its secrets. It reports false when
+// no such instance exists.
+func (s *OutputStore) Delete(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.instances[name]
+	if !ok {
+		return false, nil
+	}
+	delete(s.instances, name)
+	if err := s.save(); err != nil {
+		s.instances[name] = old
+		return false, err
+	}
+	s.removeUnusedSecrets(old)
+	return true, nil
+}
+
+func (s *OutputStore) secretsDir() string {
+	return secretsDir(s.path)
+}
+
+func (s *OutputStore) secretPath(output, secret string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, secret)
+	return filepath.Join(s.secretsDir(), output+"."+name)
+}
+
+// removeUnusedSecrets deletes the secret files of a replaced or deleted
+// instance that no instance refers to anymore. Files outside the secrets
+// directory were configured by hand and are left alone. The caller holds
+// s.mu.
+func (s *OutputStore) removeUnusedSecrets(old OutputInstance) {
+	used := make(map[string]bool)
+	for _, inst := range s.instances {
+		for _, f := range inst.secretFiles() {
+			used[f] = true
+		}
+	}
+	for _, f := range old.secretFiles() {
+		if !used[f] && filepath.Dir(f) == s.secretsDir() {
+			os.Remove(f)
+		}
+	}
+}
+
+// save writes all instances to the managed file. Secrets loaded into memory
+// are not written. The caller holds s.mu.
+func (s *OutputStore) save() error {
+	file := managedOutputsFile{Instances: s.list()}
+	for i, inst := range file.Instances {
+		if inst.Paperless != nil {
+			p := *inst.Paperless
+			p.Token = ""
+			file.Instances[i].Paperless = &p
+		}
+	}
+	data, err := toml.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("encode managed outputs: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o750); err != nil {
+		return fmt.Errorf("create managed outputs directory: %w", err)
+	}
+	if err := writeFileAtomic(s.path, append([]byte(managedOutputsHeader), data...), 0o600); err != nil {
+		return fmt.Errorf("write managed outputs: %w", err)
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
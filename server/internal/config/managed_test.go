@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputStoreSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outputs.toml")
+	store, err := NewOutputStore(path)
+	if err != nil {
+		t.Fatalf("NewOutputStore: %v", err)
+	}
+
+	inst, secrets, err := DecodeOutputJSON([]byte(`{
+		"name": "smb-tax",
+		"type": "smb",
+		"smb": {"server": "//nas.local", "share": "scans", "username": "scan", "directory": "Steuer"},
+		"secrets": {"password": "s3cret"}
+	}`))
+	if err != nil {
+		t.Fatalf("DecodeOutputJSON: %v", err)
+	}
+	inst, err = store.Put(inst, secrets)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	info, err := os.Stat(inst.SMB.PasswordFile)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected a private secret file, got %v %v", info, err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "s3cret") || !strings.Contains(string(data), "//nas.local") {
+		t.Errorf("unexpected managed file:\n%s", data)
+	}
+
+	out, err := EncodeOutputJSON(inst)
+	if err != nil {
+		t.Fatalf("EncodeOutputJSON: %v", err)
+	}
+	smb := out["smb"].(map[string]any)
+	if _, ok := smb["password_file"]; ok || smb["directory"] != "Steuer" {
+		t.Errorf("unexpected settings %v", smb)
+	}
+	if names := out["secrets"].([]string); len(names) != 1 || names[0] != "password" {
+		t.Errorf("unexpected secrets %v", out["secrets"])
+	}
+
+	// Changes without secrets keep the stored ones.
+	inst.SMB.Directory = "Belege"
+	if inst, err = store.Put(inst, nil); err != nil || inst.SMB.PasswordFile == "" {
+		t.Fatalf("Put without secrets: %+v %v", inst.SMB, err)
+	}
+
+	reloaded, err := NewOutputStore(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got, ok := reloaded.Get("smb-tax"); !ok || got.SMB.Directory != "Belege" || got.SMB.PasswordFile != inst.SMB.PasswordFile {
+		t.Fatalf("unexpected reloaded instance %+v", got.SMB)
+	}
+
+	if ok, err := store.Delete("smb-tax"); !ok || err != nil {
+		t.Fatalf("Delete: %v %v", ok, err)
+	}
+	if _, err := os.Stat(inst.SMB.PasswordFile); !os.IsNotExist(err) {
+		t.Errorf("expected the secret file to be removed, got %v", err)
+	}
+}
+
+func TestOutputStorePaperlessToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outputs.toml")
+	store, _ := NewOutputStore(path)
+
+	inst, secrets, err := DecodeOutputJSON([]byte(`{"name": "archiv", "type": "paperless",
+		"paperless": {"url": "https://paperless.local", "cache_ttl": "5m", "default_tags": [1, 2]},
+		"secrets": {"token": "abc123"}}`))
+	if err != nil {
+		t.Fatalf("DecodeOutputJSON: %v", err)
+	}
+	inst, err = store.Put(inst, secrets)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if inst.Paperless.Token != "abc123" || len(inst.Paperless.DefaultTags) != 2 {
+		t.Errorf("unexpected instance %+v", inst.Paperless)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "abc123") {
+		t.Errorf("token written to the managed file:\n%s", data)
+	}
+	if reloaded, _ := NewOutputStore(path); reloaded == nil {
+		t.Fatal("reload failed")
+	} else if got, _ := reloaded.Get("archiv"); got.Paperless.Token != "abc123" || got.Paperless.NameCacheTTL().Minutes() != 5 {
+		t.Errorf("unexpected reloaded instance %+v", got.Paperless)
+	}
+}
+
+func TestOutputStoreRejectsInvalid(t *testing.T) {
+	store, _ := NewOutputStore(filepath.Join(t.TempDir(), "outputs.toml"))
+
+	for body, want := range map[string]string{
+		`{"name": "a", "type": "smb", "smb": {"server": "//nas", "share": "s", "password_file": "/etc/shadow"}}`: "cannot be set directly",
+		`{"name": "a", "type": "smb", "smb": {"server": "//nas", "share": "s", "passwrd": "x"}}`:                 "unknown setting smb.passwrd",
+		`{"name": "a", "type": "smb", "smb": {"server": "//nas"}}`:                                               "share must not be empty",
+		`{"name": "../a", "type": "smb", "smb": {"server": "//nas", "share": "s"}}`:                              "output name",
+		`{"name": "a", "type": "smb", "smb": {"server": "//nas", "share": "s"}, "secrets": {"token": "x"}}`:      "unknown secret",
+	} {
+		inst, secrets, err := DecodeOutputJSON([]byte(body))
+		if err == nil {
+			_, err = store.Put(inst, secrets)
+		}
+		if !errors.Is(err, ErrInvalidOutput) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", body, want, err)
+		}
+	}
+	if len(store.List()) != 0 {
+		t.Error("invalid outputs must not be stored")
+	}
+}
+
+func TestManagedOutputsPath(t *testing.T) {
+	m := ManagedOutputsConfig{Enabled: true}
+	// The default keeps the file and its secrets out of the documents.
+	if got := m.Path(filepath.Join("/var/lib/scanflow", "documents")); got != filepath.Join("/var/lib/scanflow", "outputs.toml") {
+		t.Errorf("unexpected default path %q", got)
+	}
+	if got := m.Path(""); got != "" {
+		t.Errorf("expected no path without a storage directory, got %q", got)
+	}
+	m.File = "/etc/scanflow/outputs.toml"
+	if got := m.Path(""); got != m.File {
+		t.Errorf("unexpected path %q", got)
+	}
+	m.Enabled = false
+	if got := m.Path("/var/lib/scanflow"); got != "" {
+		t.Errorf("expected no path when disabled, got %q", got)
+	}
+}
+
+func TestManagedOutputsValidate(t *testing.T) {
+	storage := filepath.Join("/var/lib/scanflow", "documents")
+	fsCfg := FilesystemConfig{Enabled: true, FilesystemTarget: FilesystemTarget{Directory: storage}}
+	auth := AuthConfig{Enabled: true, APIKeys: []string{"key"}}
+
+	if errs := (ManagedOutputsConfig{}).validate(AuthConfig{}, storage, fsCfg); len(errs) != 0 {
+		t.Errorf("disabled management must not be validated: %v", errs)
+	}
+
+	m := ManagedOutputsConfig{Enabled: true}
+	if errs := m.validate(auth, storage, fsCfg); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if errs := m.validate(AuthConfig{}, storage, fsCfg); len(errs) != 1 || !strings.Contains(errs[0].Error(), "auth") {
+		t.Errorf("expected management without auth to be refused, got %v", errs)
+	}
+
+	m.File = filepath.Join(storage, "outputs.toml")
+	if errs := m.validate(auth, storage, fsCfg); len(errs) != 1 || !strings.Contains(errs[0].Error(), "secrets") {
+		t.Errorf("expected secrets inside the archive to be refused, got %v", errs)
+	}
+}
+
+func TestDefaultConfigDisablesManagedOutputs(t *testing.T) {
+	if DefaultConfig().Output.Managed.Enabled {
+		t.Error("runtime output management must be opt-in")
+	}
+}
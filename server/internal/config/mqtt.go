@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MQTTConfig publishes job, scanner and button events to an MQTT broker for
+// home automation, and optionally accepts scan commands.
+type MQTTConfig struct {
+	Enabled      bool   `toml:"enabled"`
+	Broker       string `toml:"broker"`    // tcp://, ssl://, ws:// or wss:// URL
+	ClientID     string `toml:"client_id"` // default: scanflow-<hostname>
+	Username     string `toml:"username"`
+	Password     string `toml:"password"`
+	PasswordFile string `toml:"password_file"`
+	TopicPrefix  string `toml:"topic_prefix"`
+	QoS          int    `toml:"qos"`
+
+	// Commands subscribes to <topic_prefix>/command/scan. Anyone allowed to
+	// publish there can start scans.
+	Commands bool `toml:"commands"`
+
+	Discovery MQTTDiscoveryConfig `toml:"discovery"`
+}
+
+// MQTTDiscoveryConfig controls the Home Assistant discovery payloads.
+type MQTTDiscoveryConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Prefix  string `toml:"prefix"`
+	NodeID  string `toml:"node_id"` // identifies this server in Home Assistant
+}
+
+func (m MQTTConfig) validate() []error {
+	if !m.Enabled {
+		return nil
+	}
+	var errs []error
+	if u, err := url.Parse(m.Broker); err != nil || u.Host == "" {
+		errs = append(errs, fmt.Errorf("mqtt.broker must be a URL like tcp://host:1883, got %q", m.Broker))
+	} else {
+		switch u.Scheme {
+		case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+		default:
+			errs = append(errs, fmt.Errorf("mqtt.broker has unsupported scheme %q", u.Scheme))
+		}
+	}
+	if !validTopicLevel(m.TopicPrefix, true) {
+		errs = append(errs, fmt.Errorf("mqtt.topic_prefix must not be empty or contain wildcards, got %q", m.TopicPrefix))
+	}
+	if m.QoS < 0 || m.QoS > 2 {
+		errs = append(errs, fmt.Errorf("mqtt.qos must be 0, 1 or 2, got %d", m.QoS))
+	}
+	if m.Discovery.Enabled {
+		if !validTopicLevel(m.Discovery.Prefix, true) {
+			errs = append(errs, fmt.Errorf("mqtt.discovery.prefix must not be empty or contain wildcards, got %q", m.Discovery.Prefix))
+		}
+		if !validTopicLevel(m.Discovery.NodeID, false) {
+			errs = append(errs, fmt.Errorf("mqtt.discovery.node_id must be a single topic level, got %q", m.Discovery.NodeID))
+		}
+	}
+	return errs
+}
+
+// validTopicLevel reports whether s can be used in a topic name: not empty,
+// without wildcards and, unless multi is set, without level separators.
+func validTopicLevel(s string, multi bool) bool {
+	if s == "" || strings.ContainsAny(s, "+#\x00") {
+		return false
+	}
+	if !multi && strings.Contains(s, "/") {
+		return false
+	}
+	return !strings.HasPrefix(s, "/") && !strings.HasSuffix(s, "/")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/pelletier/go-toml/v2"
@@ -28,6 +29,14 @@ type ProfileScanner struct {
 	Source     string  `toml:"source"`
 	PageWidth  float64 `toml:"page_width"`
 	PageHeight float64 `toml:"page_height"`
+	Brightness int     `toml:"brightness"` // device range, typically -100..100
+	Contrast   int     `toml:"contrast"`
+	PaperSize  string  `toml:"paper_size"` // a4, a5, letter, legal, ...
+
+	// Batch behaviour: "single" (default), "wait_for_paper" or "continuous".
+	BatchMode        string   `toml:"batch_mode"`
+	PaperWaitTimeout duration `toml:"paper_wait_timeout"` // wait_for_paper, 0 = until job timeout
+	FeedGracePeriod  duration `toml:"feed_grace_period"`  // continuous, default 30s
 }
 
 type ProfileProcessing struct {
@@ -56,7 +65,48 @@ type ProfileSplit struct {
 }
 
 type ProfileOutput struct {
-	DefaultTarget string `toml:"default_target"`
+	DefaultTarget string           `toml:"default_target"`
+	Targets       []ProfileTarget  `toml:"targets"` // delivered in addition to the default target
+	Paperless     ProfilePaperless `toml:"paperless"`
+	Print         ProfilePrint     `toml:"print"`
+	Email         ProfileEmail     `toml:"email"`
+}
+
+// ProfileEmail replaces the recipients of email outputs for documents
+// scanned with the profile. The addresses must be on the output's
+// allowed_recipients list.
+type ProfileEmail struct {
+	To  []string `toml:"to"`
+	Cc  []string `toml:"cc"`
+	Bcc []string `toml:"bcc"`
+}
+
+// ProfilePrint sets the print settings for printer outputs, e.g. for a
+// copy profile. Empty values keep the defaults of the output.
+type ProfilePrint struct {
+	Copies    int    `toml:"copies"`
+	Sides     string `toml:"sides"`      // one-sided, two-sided-long-edge, two-sided-short-edge
+	Media     string `toml:"media"`      // e.g. iso_a4_210x297mm
+	ColorMode string `toml:"color_mode"` // auto, color, monochrome
+}
+
+// ProfilePaperless sets Paperless-NGX values for every document scanned
+// with the profile. Values in the scan request take precedence. Custom
+// fields, the owner and permission users and groups are given by name or ID.
+type ProfilePaperless struct {
+	StoragePath  string         `toml:"storage_path"`
+	CustomFields map[string]any `toml:"custom_fields"`
+	Owner        string         `toml:"owner"`
+	ViewUsers    []string       `toml:"view_users"`
+	ViewGroups   []string       `toml:"view_groups"`
+	ChangeUsers  []string       `toml:"change_users"`
+	ChangeGroups []string       `toml:"change_groups"`
+}
+
+// ProfileTarget is an additional output instance a profile delivers to.
+type ProfileTarget struct {
+	Name     string `toml:"name"`
+	Optional bool   `toml:"optional"` // failures only produce a warning
 }
 
 // ProfileStore manages scan profiles loaded from TOML files.
@@ -100,6 +150,16 @@ func (s *ProfileStore) List() []Profile {
 	return result
 }
 
+// Names returns the names of all profiles, sorted.
+func (s *ProfileStore) Names() []string {
+	names := make([]string, 0, len(s.profiles))
+	for name := range s.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Set adds or updates a profile.
 func (s *ProfileStore) Set(name string, p *Profile) {
 	s.profiles[name] = p
@@ -0,0 +1,148 @@
+package jobs
+
+import "time"
+
+// DeliveryStatus is the state of a document delivery to one output target.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySending   DeliveryStatus = "sending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+	// DeliveryQueued means the immediate retries failed and the document
+	// waits in the outbox for a later attempt.
+	DeliveryQueued DeliveryStatus = "queued"
+)
+
+// OutputTarget names an output instance a job is delivered to. Failures of
+// optional targets are reported but do not fail the job.
+type OutputTarget struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// Delivery records the progress of delivering a job's document to one
+// target.
+type Delivery struct {
+	Target    string         `json:"target"`
+	Required  bool           `json:"required"`
+	Status    DeliveryStatus `json:"status"`
+	Attempts  int            `json:"attempts"`
+	Error     string         `json:"error,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	// Permanent is set for failures retrying cannot fix, e.g. a document
+	// the target rejected as a duplicate. They are not queued for retry.
+	Permanent bool            `json:"permanent,omitempty"`
+	Result    *DeliveryResult `json:"result,omitempty"`
+}
+
+// DeliveryResult describes where a target stored a delivered document.
+type DeliveryResult struct {
+	DocumentID string `json:"document_id,omitempty"`
+	URL        string `json:"url,omitempty"`
+	// Fields holds further values extracted from the target's response.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Destinations returns the targets a job is delivered to: the primary
+// Target (or defaultTarget when empty) as a required target, followed by
+// the additional Targets, or defaultExtra when the job names none. Each
+// target appears once; a required entry wins over an optional one.
+func (o OutputConfig) Destinations(defaultTarget string, defaultExtra []OutputTarget) []OutputTarget {
+	primary := o.Target
+	if primary == "" {
+		primary = defaultTarget
+	}
+	extra := o.Targets
+	if len(extra) == 0 {
+		extra = defaultExtra
+	}
+
+	var targets []OutputTarget
+	index := make(map[string]int)
+	add := func(t OutputTarget) {
+		if t.Name == "" {
+			return
+		}
+		if i, ok := index[t.Name]; ok {
+			targets[i].Optional = targets[i].Optional && t.Optional
+			return
+		}
+		index[t.Name] = len(targets)
+		targets = append(targets, t)
+	}
+	add(OutputTarget{Name: primary})
+	for _, t := range extra {
+		add(t)
+	}
+	return targets
+}
+
+// StartDeliveries resets the delivery records for the given targets.
+func (j *Job) StartDeliveries(targets []OutputTarget) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.Deliveries = make([]Delivery, len(targets))
+	for i, t := range targets {
+		j.Deliveries[i] = Delivery{
+			Target:    t.Name,
+			Required:  !t.Optional,
+			Status:    DeliveryPending,
+			UpdatedAt: now,
+		}
+	}
+	j.UpdatedAt = now
+}
+
+// UpdateDelivery replaces the record for d.Target.
+func (j *Job) UpdateDelivery(d Delivery) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range j.Deliveries {
+		if j.Deliveries[i].Target == d.Target {
+			j.Deliveries[i] = d
+			j.UpdatedAt = d.UpdatedAt
+			return
+		}
+	}
+	j.Deliveries = append(j.Deliveries, d)
+	j.UpdatedAt = d.UpdatedAt
+}
+
+// DeliveryStatuses returns a copy of the delivery records.
+func (j *Job) DeliveryStatuses() []Delivery {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return append([]Delivery(nil), j.Deliveries...)
+}
+
+// Settle ends delivery of a processed job: it completes the job when every
+// required delivery succeeded, or moves it to StatusDelivering while required
+// deliveries wait in the outbox. A job with a failed required delivery keeps
+// its status. Settle returns the resulting status.
+func (j *Job) Settle() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := StatusCompleted
+	for _, d := range j.Deliveries {
+		if !d.Required {
+			continue
+		}
+		if d.Status == DeliveryFailed {
+			return j.Status
+		}
+		if d.Status == DeliveryQueued {
+			status = StatusDelivering
+		}
+	}
+	now := time.Now()
+	j.Status = status
+	j.UpdatedAt = now
+	if status == StatusCompleted {
+		j.Error = ""
+		j.CompletedAt = now
+	}
+	return status
+}
@@ -1,9 +1,11 @@
 package jobs
 
 import (
+	"bytes"
 	"context"
 	"image"
 	"io"
+	"os"
 	"sync"
 	"time"
 
@@ -20,6 +22,16 @@ const (
 	StatusCompleted  JobStatus = "completed"
 	StatusFailed     JobStatus = "failed"
 	StatusCancelled  JobStatus = "cancelled"
+
+	// StatusNeedsAttention marks a job paused by a scanner fault (paper jam,
+	// double feed, open cover). Scanned pages are kept and the job can be
+	// resumed or finished via the API.
+	StatusNeedsAttention JobStatus = "needs_attention"
+
+	// StatusDelivering marks a processed job whose required deliveries wait
+	// in the outbox. It completes once they succeed and fails when one is
+	// discarded or moved to the dead-letter list.
+	StatusDelivering JobStatus = "delivering"
 )
 
 // Job represents a scan job with all its data and state.
@@ -31,6 +43,8 @@ type Job struct {
 	Progress   int              `json:"progress"`
 	Error      string           `json:"error,omitempty"`
 	Output     OutputConfig     `json:"output"`
+	Deliveries []Delivery       `json:"deliveries,omitempty"`
+	Options    *ScanOptions     `json:"options,omitempty"`
 	Metadata   *DocumentMetadata `json:"metadata,omitempty"`
 	OcrEnabled *bool            `json:"ocr_enabled,omitempty"`
 	CreatedAt  time.Time        `json:"created_at"`
@@ -40,6 +54,9 @@ type Job struct {
 	mu       sync.RWMutex
 	cancel   context.CancelFunc
 	progress chan ProgressUpdate
+	// finish is set when a paused job is requeued to be processed with the
+	// pages it already holds instead of scanning.
+	finish bool
 }
 
 // Page represents a single scanned page.
@@ -54,10 +71,12 @@ type Page struct {
 	Err       error     `json:"-"`
 }
 
-// OutputConfig defines where to send the finished document.
+// OutputConfig defines where to send the finished document. Target is the
+// primary, required target; Targets adds further ones for fan-out.
 type OutputConfig struct {
-	Target   string `json:"target"`
-	Filename string `json:"filename,omitempty"`
+	Target   string         `json:"target"`
+	Targets  []OutputTarget `json:"targets,omitempty"`
+	Filename string         `json:"filename,omitempty"`
 }
 
 // DocumentMetadata holds metadata for the output document.
@@ -68,17 +87,71 @@ type DocumentMetadata struct {
 	DocumentType       int    `json:"document_type,omitempty"`
 	Tags               []int  `json:"tags,omitempty"`
 	ArchiveSerialNumber string `json:"archive_serial_number,omitempty"`
+
+	// Paperless-NGX objects by name, resolved by the Paperless output.
+	// They are used alongside the numeric IDs above.
+	CorrespondentName string   `json:"correspondent_name,omitempty"`
+	DocumentTypeName  string   `json:"document_type_name,omitempty"`
+	TagNames          []string `json:"tag_names,omitempty"`
+	StoragePath       string   `json:"storage_path,omitempty"`
+
+	// Paperless-NGX values applied after consumption. Custom fields, the
+	// owner and permission users and groups are given by name or ID.
+	CustomFields map[string]any `json:"custom_fields,omitempty"`
+	Owner        string         `json:"owner,omitempty"`
+	Permissions  *Permissions   `json:"permissions,omitempty"`
+
+	// Email recipients replacing those of the profile and the email
+	// output. They must be on the output's allow-list.
+	Recipients *Recipients `json:"recipients,omitempty"`
+}
+
+// Permissions are the view and change permissions of a Paperless-NGX
+// document. Users and groups are given by name or ID.
+type Permissions struct {
+	ViewUsers    []string `json:"view_users,omitempty"`
+	ViewGroups   []string `json:"view_groups,omitempty"`
+	ChangeUsers  []string `json:"change_users,omitempty"`
+	ChangeGroups []string `json:"change_groups,omitempty"`
+}
+
+// Recipients address a document sent by email.
+type Recipients struct {
+	To  []string `json:"to,omitempty"`
+	Cc  []string `json:"cc,omitempty"`
+	Bcc []string `json:"bcc,omitempty"`
+}
+
+// PrintOptions are the print settings of a profile. Empty values keep the
+// printer output's defaults.
+type PrintOptions struct {
+	Copies    int    `json:"copies,omitempty"`
+	Sides     string `json:"sides,omitempty"`      // one-sided, two-sided-long-edge, two-sided-short-edge
+	Media     string `json:"media,omitempty"`      // e.g. iso_a4_210x297mm
+	ColorMode string `json:"color_mode,omitempty"` // auto, color, monochrome
 }
 
 // ScanOptions configures scanner settings for a job.
 type ScanOptions struct {
-	Resolution int     `json:"resolution"`
-	Mode       string  `json:"mode"`
-	Source     string  `json:"source"`
-	PageWidth  float64 `json:"page_width"`
-	PageHeight float64 `json:"page_height"`
-	Brightness int     `json:"brightness"`
-	Contrast   int     `json:"contrast"`
+	Resolution int       `json:"resolution"`
+	Mode       string    `json:"mode"`
+	Source     string    `json:"source"`
+	PageWidth  float64   `json:"page_width"`
+	PageHeight float64   `json:"page_height"`
+	Brightness int       `json:"brightness"`
+	Contrast   int       `json:"contrast"`
+	PaperSize  string    `json:"paper_size,omitempty"`
+	Area       *ScanArea `json:"area,omitempty"`
+	BatchMode  string    `json:"batch_mode,omitempty"`
+}
+
+// ScanArea is a scan region in millimetres from the top-left corner of the
+// scan surface.
+type ScanArea struct {
+	TLX float64 `json:"tl_x"`
+	TLY float64 `json:"tl_y"`
+	BRX float64 `json:"br_x"`
+	BRY float64 `json:"br_y"`
 }
 
 // ScanRequest represents an incoming scan request from the API.
@@ -101,19 +174,65 @@ type ProgressUpdate struct {
 	Message    string `json:"message,omitempty"`
 	PreviewURL string `json:"preview_url,omitempty"`
 	Error      string `json:"error,omitempty"`
+	Device     string `json:"device,omitempty"`
+	// DocumentURL links to the delivered document on the target, e.g. in
+	// Paperless-NGX.
+	DocumentURL string `json:"document_url,omitempty"`
 }
 
 // Document represents a finished document ready for output.
 type Document struct {
-	Filename      string
+	Filename      string // requested filename; outputs generate one when empty
 	Title         string
 	Created       string
 	Correspondent int
 	DocumentType  int
 	Tags          []int
 	ArchiveSerial string
-	Reader        io.Reader
-	Size          int64
+
+	// Names resolved by the Paperless output; see DocumentMetadata.
+	CorrespondentName string
+	DocumentTypeName  string
+	TagNames          []string
+	StoragePath       string
+
+	// Paperless values applied after consumption; see DocumentMetadata.
+	CustomFields map[string]any
+	Owner        string
+	Permissions  *Permissions
+
+	// Print settings of the profile for printer outputs, or nil.
+	Print *PrintOptions
+
+	// Email recipients from the scan request or profile, or nil for the
+	// output's own recipients.
+	Recipients *Recipients
+
+	// Open returns a new reader positioned at the start of the PDF. Each
+	// delivery attempt opens its own reader and must close it, so retries
+	// and concurrent targets always see the whole document.
+	Open func() (io.ReadCloser, error)
+	Size int64
+	// Remove deletes the backing file once delivery is done. It may be nil.
+	Remove func() error
+
+	// Job context used by output filename patterns.
+	JobID     string
+	Profile   string
+	Device    string
+	Counter   int
+	Pages     int
+	ScannedAt time.Time
+}
+
+// FileSource returns an Open function that opens the file at path.
+func FileSource(path string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) { return os.Open(path) }
+}
+
+// BytesSource returns an Open function that reads data from memory.
+func BytesSource(data []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
 }
 
 // NewJob creates a new job with default values.
@@ -155,6 +274,99 @@ func (j *Job) SetError(err error) {
 	j.CompletedAt = now
 }
 
+// SetNeedsAttention pauses the job because of a recoverable scanner fault.
+// Pages scanned so far are kept.
+func (j *Job) SetNeedsAttention(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Status = StatusNeedsAttention
+	j.Error = err.Error()
+	j.UpdatedAt = time.Now()
+}
+
+// ClearError removes a previously recorded error, e.g. when a paused job
+// is resumed.
+func (j *Job) ClearError() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Error = ""
+	j.UpdatedAt = time.Now()
+}
+
+// Resume moves a job paused by SetNeedsAttention to the given status and
+// clears its error. It reports false if the job was not paused, so only one
+// of several concurrent callers resumes it.
+func (j *Job) Resume(status JobStatus) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.Status != StatusNeedsAttention {
+		return false
+	}
+	j.Status = status
+	j.Error = ""
+	j.UpdatedAt = time.Now()
+	return true
+}
+
+// MarkFinish requeues a paused job for processing without scanning more
+// pages. The worker consumes the mark with TakeFinish.
+func (j *Job) MarkFinish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finish = true
+}
+
+// TakeFinish reports and clears the mark set by MarkFinish.
+func (j *Job) TakeFinish() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	finish := j.finish
+	j.finish = false
+	return finish
+}
+
+// Abort cancels a running job and marks it as failed with the given error.
+func (j *Job) Abort(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.Status = StatusFailed
+	j.Error = err.Error()
+	now := time.Now()
+	j.UpdatedAt = now
+	j.CompletedAt = now
+}
+
+// SetTitle replaces the document title, e.g. once its placeholders are
+// expanded.
+func (j *Job) SetTitle(title string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.Metadata == nil {
+		j.Metadata = &DocumentMetadata{}
+	}
+	j.Metadata.Title = title
+	j.UpdatedAt = time.Now()
+}
+
+// SetFilename replaces the output filename, e.g. once its placeholders are
+// expanded.
+func (j *Job) SetFilename(filename string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Output.Filename = filename
+	j.UpdatedAt = time.Now()
+}
+
+// CurrentStatus returns the job status thread-safely.
+func (j *Job) CurrentStatus() JobStatus {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.Status
+}
+
 // AddPage adds a scanned page to the job.
 func (j *Job) AddPage(page *Page) {
 	j.mu.Lock()
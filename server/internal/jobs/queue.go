@@ -76,6 +76,27 @@ func (q *Queue) Submit(job *Job) error {
 	}
 }
 
+// Requeue puts an existing job back on the pending channel, e.g. to resume
+// a job that was paused for operator attention.
+func (q *Queue) Requeue(id string) error {
+	q.mu.RLock()
+	job, ok := q.jobs[id]
+	q.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("job %s not found", id)
+	}
+
+	q.persistSave(job)
+
+	select {
+	case q.pending <- job:
+		slog.Info("job requeued", "job_id", id)
+		return nil
+	default:
+		return fmt.Errorf("job queue is full")
+	}
+}
+
 // Get returns a job by ID.
 func (q *Queue) Get(id string) (*Job, bool) {
 	q.mu.RLock()
@@ -192,3 +192,70 @@ func TestQueueListEmpty(t *testing.T) {
 		t.Fatalf("expected empty list, got %d", len(list))
 	}
 }
+
+func TestQueueRequeue(t *testing.T) {
+	q := NewQueue()
+	job := NewJob("standard", OutputConfig{}, nil, nil)
+	q.Submit(job)
+	<-q.Pending()
+
+	job.SetNeedsAttention(&testError{msg: "jammed"})
+	if job.Status != StatusNeedsAttention || job.Error != "jammed" {
+		t.Fatalf("expected needs_attention with error, got %s (%q)", job.Status, job.Error)
+	}
+
+	if err := q.Requeue(job.ID); err != nil {
+		t.Fatalf("requeue failed: %v", err)
+	}
+	select {
+	case got := <-q.Pending():
+		if got.ID != job.ID {
+			t.Fatalf("expected job %s, got %s", job.ID, got.ID)
+		}
+	default:
+		t.Fatal("expected requeued job on pending channel")
+	}
+
+	if err := q.Requeue("nonexistent"); err == nil {
+		t.Fatal("expected error for unknown job")
+	}
+}
+
+func TestOutputDestinations(t *testing.T) {
+	profileExtra := []OutputTarget{{Name: "nas", Optional: true}}
+
+	got := OutputConfig{}.Destinations("paperless", profileExtra)
+	if len(got) != 2 || got[0] != (OutputTarget{Name: "paperless"}) || got[1] != (OutputTarget{Name: "nas", Optional: true}) {
+		t.Errorf("profile defaults: got %+v", got)
+	}
+
+	// Targets on the job replace the profile's extra targets; duplicates
+	// collapse and stay required if any entry is required.
+	out := OutputConfig{Target: "smb", Targets: []OutputTarget{{Name: "email", Optional: true}, {Name: "smb", Optional: true}}}
+	got = out.Destinations("paperless", profileExtra)
+	if len(got) != 2 || got[0] != (OutputTarget{Name: "smb"}) || got[1] != (OutputTarget{Name: "email", Optional: true}) {
+		t.Errorf("job targets: got %+v", got)
+	}
+
+	if got := (OutputConfig{}).Destinations("", nil); len(got) != 0 {
+		t.Errorf("expected no targets, got %+v", got)
+	}
+}
+
+func TestJobDeliveries(t *testing.T) {
+	job := NewJob("standard", OutputConfig{}, nil, nil)
+	job.StartDeliveries([]OutputTarget{{Name: "paperless"}, {Name: "nas", Optional: true}})
+
+	job.UpdateDelivery(Delivery{Target: "nas", Required: false, Status: DeliveryFailed, Attempts: 4, Error: "offline"})
+
+	got := job.DeliveryStatuses()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(got))
+	}
+	if got[0].Target != "paperless" || !got[0].Required || got[0].Status != DeliveryPending {
+		t.Errorf("unexpected first delivery: %+v", got[0])
+	}
+	if got[1].Status != DeliveryFailed || got[1].Attempts != 4 || got[1].Error != "offline" {
+		t.Errorf("unexpected second delivery: %+v", got[1])
+	}
+}
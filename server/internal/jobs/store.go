@@ -20,6 +20,8 @@ type jobRecord struct {
 	Progress    int               `json:"progress"`
 	Error       string            `json:"error,omitempty"`
 	Output      OutputConfig      `json:"output"`
+	Deliveries  []Delivery        `json:"deliveries,omitempty"`
+	Options     *ScanOptions      `json:"options,omitempty"`
 	Metadata    *DocumentMetadata `json:"metadata,omitempty"`
 	OcrEnabled  *bool             `json:"ocr_enabled,omitempty"`
 	CreatedAt   time.Time         `json:"created_at"`
@@ -38,6 +40,8 @@ func toRecord(job *Job) jobRecord {
 		Progress:    job.Progress,
 		Error:       job.Error,
 		Output:      job.Output,
+		Deliveries:  append([]Delivery(nil), job.Deliveries...),
+		Options:     job.Options,
 		Metadata:    job.Metadata,
 		OcrEnabled:  job.OcrEnabled,
 		CreatedAt:   job.CreatedAt,
@@ -55,6 +59,8 @@ func fromRecord(rec jobRecord) *Job {
 		Progress:    rec.Progress,
 		Error:       rec.Error,
 		Output:      rec.Output,
+		Deliveries:  rec.Deliveries,
+		Options:     rec.Options,
 		Metadata:    rec.Metadata,
 		OcrEnabled:  rec.OcrEnabled,
 		CreatedAt:   rec.CreatedAt,
@@ -0,0 +1,100 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+// objectIDPattern matches the characters Home Assistant does not allow in
+// discovery object IDs.
+var objectIDPattern = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// haDevice groups all entities of a ScanFlow server in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// discovery returns the retained Home Assistant discovery messages by topic:
+// the scanner connectivity, the current job, a trigger per button gesture and,
+// when commands are enabled, a button per scan profile.
+func (p *Publisher) discovery(bridge Bridge) map[string][]byte {
+	node := p.cfg.Discovery.NodeID
+	device := haDevice{
+		Identifiers:  []string{node},
+		Name:         "ScanFlow",
+		Manufacturer: "ScanFlow",
+		Model:        "scanflow-server",
+	}
+	entity := func(component, object string, fields map[string]any) (string, map[string]any) {
+		fields["unique_id"] = node + "_" + object
+		fields["object_id"] = node + "_" + object
+		fields["device"] = device
+		fields["availability_topic"] = p.topic("status")
+		return p.cfg.Discovery.Prefix + "/" + component + "/" + node + "/" + object + "/config", fields
+	}
+
+	configs := map[string]map[string]any{}
+	add := func(topic string, fields map[string]any) { configs[topic] = fields }
+
+	add(entity("binary_sensor", "scanner", map[string]any{
+		"name":         "Scanner",
+		"device_class": "connectivity",
+		"state_topic":  p.topic("scanner"),
+		"payload_on":   stateOnline,
+		"payload_off":  stateOffline,
+	}))
+	add(entity("sensor", "job_status", map[string]any{
+		"name":                  "Job status",
+		"icon":                  "mdi:file-document-outline",
+		"state_topic":           p.topic("job"),
+		"value_template":        "{{ value_json.status }}",
+		"json_attributes_topic": p.topic("job"),
+	}))
+	add(entity("sensor", "job_progress", map[string]any{
+		"name":                "Job progress",
+		"icon":                "mdi:progress-clock",
+		"state_topic":         p.topic("job"),
+		"value_template":      "{{ value_json.progress | default(0) }}",
+		"unit_of_measurement": "%",
+	}))
+
+	for _, t := range bridge.ButtonTriggers() {
+		object := objectID(t.Button + "_" + t.Gesture)
+		add(p.cfg.Discovery.Prefix+"/device_automation/"+node+"/"+object+"/config", map[string]any{
+			"automation_type": "trigger",
+			"topic":           p.topic("button/" + t.Button),
+			"payload":         t.Gesture,
+			"type":            "button_" + t.Gesture + "_press",
+			"subtype":         t.Button,
+			"device":          device,
+		})
+	}
+
+	if p.cfg.Commands {
+		for _, profile := range bridge.Profiles() {
+			add(entity("button", objectID("scan_"+profile), map[string]any{
+				"name":          "Scan " + profile,
+				"icon":          "mdi:scanner",
+				"command_topic": p.topic("command/scan"),
+				"payload_press": profile,
+			}))
+		}
+	}
+
+	messages := make(map[string][]byte, len(configs))
+	for topic, fields := range configs {
+		payload, err := json.Marshal(fields)
+		if err != nil {
+			continue
+		}
+		messages[topic] = payload
+	}
+	return messages
+}
+
+func objectID(s string) string {
+	return objectIDPattern.ReplaceAllString(s, "_")
+}
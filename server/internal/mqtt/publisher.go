@@ -0,0 +1,263 @@
+// Package mqtt mirrors ScanFlow events to an MQTT broker for home automation
+// systems and accepts scan commands from it.
+//
+// Topics below the configured prefix:
+//
+//	status               online/offline (retained, last will)
+//	scanner              online/offline (retained)
+//	job                  latest job update as JSON (retained)
+//	event/<type>         every event as JSON, as sent over the WebSocket
+//	button/<button>      gesture of each button press
+//	command/scan         scan requests (subscribed when commands are enabled)
+//	command/scan/result  outcome of each scan request
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+const (
+	stateOnline  = "online"
+	stateOffline = "offline"
+
+	// closeTimeout bounds how long Close waits for the offline state.
+	closeTimeout = 2 * time.Second
+)
+
+// Bridge gives the publisher access to the server.
+type Bridge interface {
+	// ScannerOnline reports whether the scanner is connected.
+	ScannerOnline() bool
+	// Profiles lists the scan profiles offered as Home Assistant buttons.
+	Profiles() []string
+	// ButtonTriggers lists the configured button gestures.
+	ButtonTriggers() []ButtonTrigger
+	// StartScan validates a scan request and queues its job.
+	StartScan(req jobs.ScanRequest) (*jobs.Job, error)
+}
+
+// ButtonTrigger is a button gesture announced as a Home Assistant trigger.
+type ButtonTrigger struct {
+	Button  string
+	Gesture string
+}
+
+// Publisher keeps an MQTT connection and publishes events to it.
+type Publisher struct {
+	cfg    config.MQTTConfig
+	client paho.Client
+	bridge Bridge
+
+	mu      sync.Mutex
+	scanner string // last scanner state, "" until known
+	job     []byte // last job update
+}
+
+// New creates a publisher for cfg. It does not connect yet.
+func New(cfg config.MQTTConfig) *Publisher {
+	p := &Publisher{cfg: cfg}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		host, _ := os.Hostname()
+		clientID = "scanflow-" + host
+	}
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetWill(p.topic("status"), stateOffline, p.qos(), true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			slog.Warn("MQTT connection lost", "broker", cfg.Broker, "error", err)
+		})
+	p.client = paho.NewClient(opts)
+	return p
+}
+
+// Connect starts connecting to the broker in the background. The connection
+// is retried until it succeeds and re-established when it is lost.
+func (p *Publisher) Connect(bridge Bridge) {
+	p.mu.Lock()
+	p.bridge = bridge
+	p.mu.Unlock()
+	p.client.Connect()
+}
+
+// Close marks ScanFlow offline and disconnects.
+func (p *Publisher) Close() {
+	if p.client.IsConnectionOpen() {
+		p.client.Publish(p.topic("status"), p.qos(), true, stateOffline).WaitTimeout(closeTimeout)
+	}
+	p.client.Disconnect(250)
+}
+
+// Publish forwards an event. Job and scanner events also update the retained
+// state topics.
+func (p *Publisher) Publish(u jobs.ProgressUpdate) {
+	payload, err := json.Marshal(u)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case u.Type == "device_online" || u.Type == "device_offline":
+		state := stateOnline
+		if u.Type == "device_offline" {
+			state = stateOffline
+		}
+		p.mu.Lock()
+		p.scanner = state
+		p.mu.Unlock()
+		p.publish(p.topic("scanner"), true, state)
+	case u.JobID != "" && u.Type != "delivery":
+		p.mu.Lock()
+		p.job = payload
+		p.mu.Unlock()
+		p.publish(p.topic("job"), true, payload)
+	}
+
+	p.publish(p.topic("event/"+u.Type), false, payload)
+}
+
+// ButtonPressed publishes a button press.
+func (p *Publisher) ButtonPressed(button, gesture string) {
+	p.publish(p.topic("button/"+button), false, gesture)
+}
+
+// onConnect announces the current state, which may have been lost while
+// disconnected, and subscribes to commands before reporting online.
+func (p *Publisher) onConnect(c paho.Client) {
+	slog.Info("MQTT connected", "broker", p.cfg.Broker)
+
+	p.mu.Lock()
+	bridge := p.bridge
+	if p.scanner == "" && bridge != nil {
+		p.scanner = stateOffline
+		if bridge.ScannerOnline() {
+			p.scanner = stateOnline
+		}
+	}
+	scanner, job := p.scanner, p.job
+	p.mu.Unlock()
+
+	if p.cfg.Discovery.Enabled && bridge != nil {
+		for topic, payload := range p.discovery(bridge) {
+			p.publish(topic, true, payload)
+		}
+	}
+	if scanner != "" {
+		p.publish(p.topic("scanner"), true, scanner)
+	}
+	if job != nil {
+		p.publish(p.topic("job"), true, job)
+	}
+
+	// paho runs this handler in its own goroutine, so it may block.
+	if p.cfg.Commands && bridge != nil {
+		token := c.Subscribe(p.topic("command/scan"), p.qos(), p.handleScanCommand)
+		if token.Wait(); token.Error() != nil {
+			slog.Error("MQTT subscribe failed", "topic", p.topic("command/scan"), "error", token.Error())
+		}
+	}
+	p.publish(p.topic("status"), true, stateOnline)
+}
+
+// scanCommand is the JSON payload of a scan command. A payload that is not
+// JSON is taken as a profile name.
+type scanCommand struct {
+	Profile    string                 `json:"profile"`
+	Output     json.RawMessage        `json:"output"`
+	Metadata   *jobs.DocumentMetadata `json:"metadata"`
+	OcrEnabled *bool                  `json:"ocr_enabled"`
+}
+
+// scanResult is published to command/scan/result for every command.
+type scanResult struct {
+	JobID   string `json:"job_id,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (p *Publisher) handleScanCommand(_ paho.Client, msg paho.Message) {
+	var result scanResult
+	req, err := parseScanCommand(msg.Payload())
+	if err == nil {
+		result.Profile = req.Profile
+		var job *jobs.Job
+		if job, err = p.bridge.StartScan(req); err == nil {
+			result.JobID = job.ID
+			result.Status = string(job.Status)
+			slog.Info("scan started via MQTT", "job_id", job.ID, "profile", req.Profile)
+		}
+	}
+	if err != nil {
+		slog.Warn("MQTT scan command rejected", "error", err)
+		result.Error = err.Error()
+	}
+	payload, _ := json.Marshal(result)
+	p.publish(p.topic("command/scan/result"), false, payload)
+}
+
+func parseScanCommand(payload []byte) (jobs.ScanRequest, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || payload[0] != '{' {
+		return jobs.ScanRequest{Profile: string(payload)}, nil
+	}
+
+	var cmd scanCommand
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return jobs.ScanRequest{}, fmt.Errorf("invalid scan command: %w", err)
+	}
+	req := jobs.ScanRequest{Profile: cmd.Profile, Metadata: cmd.Metadata, OcrEnabled: cmd.OcrEnabled}
+
+	// The output is either a target name or an output object as in the API.
+	if len(cmd.Output) > 0 && string(cmd.Output) != "null" {
+		var target string
+		if err := json.Unmarshal(cmd.Output, &target); err == nil {
+			req.Output = &jobs.OutputConfig{Target: target}
+		} else {
+			req.Output = &jobs.OutputConfig{}
+			if err := json.Unmarshal(cmd.Output, req.Output); err != nil {
+				return jobs.ScanRequest{}, errors.New("invalid scan command: output must be a target name or an object")
+			}
+		}
+	}
+	return req, nil
+}
+
+// publish sends a message without waiting for the broker; failures are
+// logged once the broker answered.
+func (p *Publisher) publish(topic string, retained bool, payload any) {
+	token := p.client.Publish(topic, p.qos(), retained, payload)
+	go func() {
+		if token.WaitTimeout(time.Minute) && token.Error() != nil {
+			slog.Debug("MQTT publish failed", "topic", topic, "error", token.Error())
+		}
+	}()
+}
+
+func (p *Publisher) topic(name string) string {
+	return p.cfg.TopicPrefix + "/" + name
+}
+
+func (p *Publisher) qos() byte {
+	return byte(p.cfg.QoS)
+}
@@ -0,0 +1,260 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// startBroker runs an in-process MQTT broker and returns its URL.
+func startBroker(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	broker := mochi.New(&mochi.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := broker.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatalf("AddHook: %v", err)
+	}
+	if err := broker.AddListener(listeners.NewNet("test", ln)); err != nil {
+		t.Fatalf("AddListener: %v", err)
+	}
+	if err := broker.Serve(); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return "tcp://" + ln.Addr().String()
+}
+
+var watchers atomic.Int32
+
+// watcher records the messages published below the given filters.
+type watcher struct {
+	t      *testing.T
+	client paho.Client
+	mu     sync.Mutex
+	msgs   map[string][]string
+	notify chan struct{}
+}
+
+func watch(t *testing.T, broker string, filters ...string) *watcher {
+	t.Helper()
+	w := &watcher{t: t, msgs: map[string][]string{}, notify: make(chan struct{}, 1)}
+	w.client = paho.NewClient(paho.NewClientOptions().AddBroker(broker).SetClientID(fmt.Sprintf("watcher-%d", watchers.Add(1))))
+	if token := w.client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatalf("connect watcher: %v", token.Error())
+	}
+	t.Cleanup(func() { w.client.Disconnect(0) })
+	for _, f := range filters {
+		token := w.client.Subscribe(f, 1, func(_ paho.Client, m paho.Message) {
+			w.mu.Lock()
+			w.msgs[m.Topic()] = append(w.msgs[m.Topic()], string(m.Payload()))
+			w.mu.Unlock()
+			select {
+			case w.notify <- struct{}{}:
+			default:
+			}
+		})
+		if token.Wait() && token.Error() != nil {
+			t.Fatalf("subscribe %s: %v", f, token.Error())
+		}
+	}
+	return w
+}
+
+// await waits until topic received want, or any message when want is empty,
+// and returns the latest payload.
+func (w *watcher) await(topic, want string) string {
+	w.t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		w.mu.Lock()
+		msgs := w.msgs[topic]
+		w.mu.Unlock()
+		if n := len(msgs); n > 0 && (want == "" || msgs[n-1] == want) {
+			return msgs[n-1]
+		}
+		select {
+		case <-w.notify:
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			w.t.Fatalf("no message %q on %s, got %v", want, topic, msgs)
+		}
+	}
+}
+
+func (w *watcher) publish(topic, payload string) {
+	w.t.Helper()
+	if token := w.client.Publish(topic, 1, false, payload); token.Wait() && token.Error() != nil {
+		w.t.Fatalf("publish: %v", token.Error())
+	}
+}
+
+type fakeBridge struct {
+	mu       sync.Mutex
+	requests []jobs.ScanRequest
+}
+
+func (b *fakeBridge) ScannerOnline() bool { return true }
+func (b *fakeBridge) Profiles() []string  { return []string{"standard", "photo"} }
+func (b *fakeBridge) ButtonTriggers() []ButtonTrigger {
+	return []ButtonTrigger{{Button: "scan", Gesture: "short"}, {Button: "scan", Gesture: "long"}}
+}
+
+func (b *fakeBridge) StartScan(req jobs.ScanRequest) (*jobs.Job, error) {
+	if req.Profile == "missing" {
+		return nil, errors.New("unknown profile: missing")
+	}
+	b.mu.Lock()
+	b.requests = append(b.requests, req)
+	b.mu.Unlock()
+	return jobs.NewJob(req.Profile, jobs.OutputConfig{}, req.Metadata, nil), nil
+}
+
+func testConfig(broker string) config.MQTTConfig {
+	cfg := config.DefaultConfig().MQTT
+	cfg.Enabled = true
+	cfg.Broker = broker
+	cfg.ClientID = "scanflow-test"
+	return cfg
+}
+
+func TestPublisherStateAndDiscovery(t *testing.T) {
+	broker := startBroker(t)
+	w := watch(t, broker, "scanflow/#", "homeassistant/#")
+
+	p := New(testConfig(broker))
+	p.Connect(&fakeBridge{})
+
+	w.await("scanflow/status", "online")
+	w.await("scanflow/scanner", "online")
+
+	var sensor map[string]any
+	if err := json.Unmarshal([]byte(w.await("homeassistant/binary_sensor/scanflow/scanner/config", "")), &sensor); err != nil {
+		t.Fatalf("discovery payload: %v", err)
+	}
+	if sensor["state_topic"] != "scanflow/scanner" || sensor["device_class"] != "connectivity" || sensor["availability_topic"] != "scanflow/status" {
+		t.Errorf("unexpected scanner discovery %v", sensor)
+	}
+	var trigger map[string]any
+	json.Unmarshal([]byte(w.await("homeassistant/device_automation/scanflow/scan_long/config", "")), &trigger)
+	if trigger["topic"] != "scanflow/button/scan" || trigger["payload"] != "long" || trigger["type"] != "button_long_press" {
+		t.Errorf("unexpected trigger discovery %v", trigger)
+	}
+
+	p.Publish(jobs.ProgressUpdate{Type: "job_update", JobID: "j1", Status: "completed", Progress: 100})
+	var job jobs.ProgressUpdate
+	json.Unmarshal([]byte(w.await("scanflow/job", "")), &job)
+	if job.JobID != "j1" || job.Status != "completed" {
+		t.Errorf("unexpected job state %+v", job)
+	}
+	w.await("scanflow/event/job_update", "")
+
+	p.Publish(jobs.ProgressUpdate{Type: "device_offline", Device: "fujitsu:0"})
+	w.await("scanflow/scanner", "offline")
+
+	p.ButtonPressed("scan", "long")
+	w.await("scanflow/button/scan", "long")
+
+	p.Close()
+	w.await("scanflow/status", "offline")
+
+	// Without commands no scan buttons are announced.
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.msgs["homeassistant/button/scanflow/scan_standard/config"]; ok {
+		t.Error("scan buttons announced with commands disabled")
+	}
+}
+
+func TestPublisherRetainsState(t *testing.T) {
+	broker := startBroker(t)
+	p := New(testConfig(broker))
+	p.Connect(&fakeBridge{})
+	defer p.Close()
+
+	// Let the publisher connect before the job update is sent.
+	live := watch(t, broker, "scanflow/status", "scanflow/job")
+	live.await("scanflow/status", "online")
+	p.Publish(jobs.ProgressUpdate{Type: "scanner_fault", JobID: "j2", Status: "needs_attention"})
+	live.await("scanflow/job", "")
+
+	// A client subscribing later still sees the current state.
+	w := watch(t, broker, "scanflow/job")
+	var job jobs.ProgressUpdate
+	json.Unmarshal([]byte(w.await("scanflow/job", "")), &job)
+	if job.JobID != "j2" || job.Status != "needs_attention" {
+		t.Errorf("unexpected retained job state %+v", job)
+	}
+}
+
+func TestPublisherScanCommand(t *testing.T) {
+	broker := startBroker(t)
+	w := watch(t, broker, "scanflow/#", "homeassistant/button/#")
+
+	cfg := testConfig(broker)
+	cfg.Commands = true
+	bridge := &fakeBridge{}
+	p := New(cfg)
+	p.Connect(bridge)
+	defer p.Close()
+
+	w.await("scanflow/status", "online")
+	var button map[string]any
+	json.Unmarshal([]byte(w.await("homeassistant/button/scanflow/scan_photo/config", "")), &button)
+	if button["command_topic"] != "scanflow/command/scan" || button["payload_press"] != "photo" {
+		t.Errorf("unexpected scan button discovery %v", button)
+	}
+
+	w.publish("scanflow/command/scan", `{"profile": "photo", "output": "nas", "metadata": {"title": "Rechnung"}}`)
+	var result scanResult
+	json.Unmarshal([]byte(w.await("scanflow/command/scan/result", "")), &result)
+	if result.JobID == "" || result.Profile != "photo" || result.Error != "" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	w.publish("scanflow/command/scan", "missing")
+	if got := w.await("scanflow/command/scan/result", `{"profile":"missing","error":"unknown profile: missing"}`); got == "" {
+		t.Error("expected an error result")
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	if len(bridge.requests) != 1 {
+		t.Fatalf("expected one scan request, got %+v", bridge.requests)
+	}
+	req := bridge.requests[0]
+	if req.Output == nil || req.Output.Target != "nas" || req.Metadata == nil || req.Metadata.Title != "Rechnung" {
+		t.Errorf("unexpected scan request %+v", req)
+	}
+}
+
+func TestParseScanCommand(t *testing.T) {
+	req, err := parseScanCommand([]byte(" standard\n"))
+	if err != nil || req.Profile != "standard" || req.Output != nil {
+		t.Errorf("plain profile: %+v %v", req, err)
+	}
+	req, err = parseScanCommand([]byte(`{"profile": "photo", "output": {"target": "paperless"}}`))
+	if err != nil || req.Output == nil || req.Output.Target != "paperless" {
+		t.Errorf("output object: %+v %v", req, err)
+	}
+	if _, err := parseScanCommand([]byte(`{"output": 42}`)); err == nil {
+		t.Error("expected an error for an invalid output")
+	}
+}
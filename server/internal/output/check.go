@@ -0,0 +1,142 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// testTimeout bounds a single connectivity test.
+const testTimeout = 30 * time.Second
+
+// TestResult is the outcome of a connectivity test of an output target.
+type TestResult struct {
+	Target string `json:"target"`
+	Type   string `json:"type"`
+	OK     bool   `json:"ok"`
+	// Supported is false for handlers without a connectivity test; only
+	// their configuration was checked.
+	Supported  bool      `json:"supported"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Test runs the connectivity test of a target and records the result. It
+// reports false when the target does not exist.
+func (m *Manager) Test(ctx context.Context, name string) (TestResult, bool) {
+	h, ok := m.Handler(name)
+	if !ok {
+		return TestResult{}, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, testTimeout)
+	defer cancel()
+
+	start := time.Now()
+	res := TestResult{Target: name, Type: h.Name(), CheckedAt: start}
+	var err error
+	if t, ok := h.(Tester); ok {
+		res.Supported = true
+		err = t.Test(ctx)
+	} else if !h.Available() {
+		err = errors.New("configuration incomplete")
+	}
+	res.DurationMS = time.Since(start).Milliseconds()
+	res.OK = err == nil
+	if err != nil {
+		res.Error = err.Error()
+		slog.Warn("output test failed", "target", name, "error", err)
+	}
+
+	m.mu.Lock()
+	if m.results == nil {
+		m.results = make(map[string]TestResult)
+	}
+	// Skip the result when the target was replaced during the test.
+	if m.handlers[name] == h {
+		m.results[name] = res
+	}
+	m.mu.Unlock()
+	return res, true
+}
+
+// TestResults returns the latest test result of every tested target,
+// sorted by name.
+func (m *Manager) TestResults() []TestResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	results := make([]TestResult, 0, len(m.results))
+	for name, res := range m.results {
+		if _, ok := m.handlers[name]; ok {
+			results = append(results, res)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results
+}
+
+// RefreshTests tests all targets in the background when a target has no
+// result or its result is older than maxAge. Only one refresh runs at a
+// time.
+func (m *Manager) RefreshTests(maxAge time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.testing {
+		return
+	}
+	var stale []string
+	for name := range m.handlers {
+		if res, ok := m.results[name]; !ok || time.Since(res.CheckedAt) > maxAge {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	m.testing = true
+	go func() {
+		for _, name := range stale {
+			m.Test(context.Background(), name)
+		}
+		m.mu.Lock()
+		m.testing = false
+		m.mu.Unlock()
+	}()
+}
+
+// test checks that documents can be written below the directory. It
+// creates and removes a temporary file in the directory, or in its nearest
+// existing parent when the directory is created on the first delivery.
+func (t localTarget) test() error {
+	if t.directory == "" {
+		return errors.New("no directory configured")
+	}
+	dir := t.directory
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, fs.ErrNotExist) || parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	f, err := os.CreateTemp(dir, ".scanflow-test-*")
+	if err != nil {
+		return fmt.Errorf("directory not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
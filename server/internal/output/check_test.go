@@ -0,0 +1,72 @@
+package output
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManagerTestFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	notDir := filepath.Join(dir, "file")
+	os.WriteFile(notDir, []byte("x"), 0o644)
+
+	m := &Manager{handlers: map[string]Handler{
+		"archive": NewFilesystemHandler(dir),
+		"later":   NewFilesystemHandler(filepath.Join(dir, "new", "sub")),
+		"broken":  NewFilesystemHandler(filepath.Join(notDir, "sub")),
+		"mock":    &failNTimesHandler{name: "mock"},
+	}}
+
+	for name, wantOK := range map[string]bool{"archive": true, "later": true, "broken": false, "mock": true} {
+		res, ok := m.Test(context.Background(), name)
+		if !ok || res.OK != wantOK || res.Target != name {
+			t.Errorf("Test(%s) = %+v, want ok=%v", name, res, wantOK)
+		}
+	}
+	if res, _ := m.Test(context.Background(), "broken"); !strings.Contains(res.Error, "not a directory") {
+		t.Errorf("unexpected error %q", res.Error)
+	}
+	if res, _ := m.Test(context.Background(), "mock"); res.Supported {
+		t.Error("handlers without Test should report supported=false")
+	}
+	if _, ok := m.Test(context.Background(), "missing"); ok {
+		t.Error("expected unknown target")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("test left files behind: %v", entries)
+	}
+	if results := m.TestResults(); len(results) != 4 || results[0].Target != "archive" {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestManagerRefreshTests(t *testing.T) {
+	m := &Manager{handlers: map[string]Handler{"archive": NewFilesystemHandler(t.TempDir())}}
+	m.RefreshTests(time.Minute)
+
+	running := func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.testing
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for running() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	results := m.TestResults()
+	if len(results) != 1 || !results[0].OK {
+		t.Fatalf("expected a background test result, got %+v", results)
+	}
+
+	// Fresh results are not tested again.
+	m.RefreshTests(time.Minute)
+	if running() {
+		t.Error("expected no refresh for fresh results")
+	}
+}
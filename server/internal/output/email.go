@@ -3,116 +3,437 @@ package output
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
 	"net/smtp"
-	"os"
+	"net/textproto"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/thoscut/scanflow/server/internal/config"
 	"github.com/thoscut/scanflow/server/internal/jobs"
 )
 
+// Email TLS modes.
+const (
+	emailTLSStartTLS         = "starttls"          // STARTTLS when offered
+	emailTLSStartTLSRequired = "starttls_required" // fail without STARTTLS
+	emailTLSImplicit         = "implicit"          // TLS from the first byte (SMTPS)
+)
+
+// defaultEmailBody is the text part when no body template is configured.
+const defaultEmailBody = "Scanned document: {filename}"
+
 // EmailHandler sends documents via email as attachments.
 type EmailHandler struct {
-	host      string
-	port      int
-	user      string
-	password  string
-	from      string
-	recipient string
+	host     string
+	port     int
+	user     string
+	password string
+	tlsMode  string
+	from     string
+	to       []string
+	cc       []string
+	bcc      []string
+	allowed  []string
+	subject  string
+	body     string
+	maxSize  int64
+	split    bool
+	naming   Naming
+
+	secretErr error // reading the password file failed
+
+	// tlsConfig is the base TLS configuration; tests replace it to trust
+	// their own certificate.
+	tlsConfig *tls.Config
 }
 
 // NewEmailHandler creates a new email output handler.
 func NewEmailHandler(cfg config.EmailConfig) *EmailHandler {
-	password := ""
-	if cfg.SMTPPasswordFile != "" {
-		data, err := os.ReadFile(cfg.SMTPPasswordFile)
-		if err == nil {
-			password = strings.TrimSpace(string(data))
+	password, secretErr := readSecretFile(cfg.SMTPPasswordFile)
+
+	tlsMode := cfg.TLS
+	if tlsMode == "" {
+		tlsMode = emailTLSStartTLS
+	}
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = 587
+		if tlsMode == emailTLSImplicit {
+			port = 465
 		}
 	}
+	body := cfg.Body
+	if body == "" {
+		body = defaultEmailBody
+	}
 
 	return &EmailHandler{
 		host:      cfg.SMTPHost,
-		port:      cfg.SMTPPort,
+		port:      port,
 		user:      cfg.SMTPUser,
 		password:  password,
+		tlsMode:   tlsMode,
 		from:      cfg.FromAddress,
-		recipient: cfg.DefaultRecipient,
+		to:        cfg.Recipients(),
+		cc:        cfg.Cc,
+		bcc:       cfg.Bcc,
+		allowed:   cfg.AllowedRecipients,
+		subject:   cfg.Subject,
+		body:      body,
+		maxSize:   cfg.MaxSize(),
+		split:     cfg.Oversize == "split",
+		naming:    NewNaming(cfg.NamingConfig, SanitizePOSIX),
+		secretErr: secretErr,
+		tlsConfig: &tls.Config{},
 	}
 }
 
 func (h *EmailHandler) Name() string { return "email" }
 
+// Available reports whether the handler can send mail. Without configured
+// recipients it still serves profiles and requests that name allowed ones.
 func (h *EmailHandler) Available() bool {
-	return h.host != "" && h.from != "" && h.recipient != ""
+	return h.host != "" && h.from != "" && len(h.to)+len(h.cc)+len(h.bcc)+len(h.allowed) > 0 && h.secretErr == nil
 }
 
-// Send emails a document as an attachment.
-func (h *EmailHandler) Send(_ context.Context, doc *jobs.Document) error {
-	to := h.recipient
-
-	// Sanitize values used in MIME headers to prevent header injection.
-	safeFilename := sanitizeMIMEValue(doc.Filename)
-	safeTitle := sanitizeMIMEValue(doc.Title)
-
-	subject := "ScanFlow: " + safeFilename
-	if safeTitle != "" {
-		subject = "ScanFlow: " + safeTitle
+// Send emails a document as an attachment. Documents above the size limit
+// are rejected, or split into numbered parts sent as separate messages.
+func (h *EmailHandler) Send(ctx context.Context, doc *jobs.Document) error {
+	if h.secretErr != nil {
+		return Permanent(fmt.Errorf("smtp password: %w", h.secretErr))
+	}
+	rcpt, err := h.recipients(doc)
+	if err != nil {
+		return Permanent(err)
 	}
 
-	// Read document data
 	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, doc.Reader); err != nil {
+	if _, err := copyDocument(&buf, doc); err != nil {
 		return fmt.Errorf("read document: %w", err)
 	}
+	data := buf.Bytes()
 
-	// Build MIME email with attachment
-	boundary := "ScanFlow-Boundary-12345"
-	var msg bytes.Buffer
+	filename := sanitizeMIMEValue(h.naming.Filename(doc))
+	subject := h.subjectFor(doc, filename)
+	body := h.naming.expand(h.body, doc, filename)
 
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", h.from))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", to))
-	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
-	msg.WriteString("MIME-Version: 1.0\r\n")
-	msg.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%s\r\n\r\n", boundary))
+	// The limit applies to the attachment as sent, i.e. base64 encoded.
+	if h.maxSize <= 0 || base64Size(int64(len(data))) <= h.maxSize {
+		msg, err := h.message(rcpt, subject, body, filename, data)
+		if err != nil {
+			return err
+		}
+		return h.deliver(ctx, rcpt.envelope(), msg)
+	}
+	if !h.split {
+		return Permanent(fmt.Errorf("document is %d bytes (%d encoded), email attachments are limited to %d bytes",
+			len(data), base64Size(int64(len(data))), h.maxSize))
+	}
 
-	// Text body
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
-	msg.WriteString(fmt.Sprintf("Scanned document: %s\r\n\r\n", safeFilename))
+	// Whole base64 lines of a part fit in the limit.
+	partSize := max(h.maxSize/(base64LineLen+2), 1) * base64LineBytes
+	parts := (int64(len(data)) + partSize - 1) / partSize
+	for i := int64(0); i < parts; i++ {
+		chunk := data[i*partSize : min((i+1)*partSize, int64(len(data)))]
+		partName := fmt.Sprintf("%s.%03d", filename, i+1)
+		partBody := fmt.Sprintf("%s\r\n\r\nPart %d of %d of %s. Join all parts in order to restore the file,\r\ne.g. cat %s.0* > %s",
+			body, i+1, parts, filename, filename, filename)
+		msg, err := h.message(rcpt, fmt.Sprintf("%s (%d/%d)", subject, i+1, parts), partBody, partName, chunk)
+		if err != nil {
+			return err
+		}
+		if err := h.deliver(ctx, rcpt.envelope(), msg); err != nil {
+			err = fmt.Errorf("part %d of %d: %w", i+1, parts, err)
+			if i > 0 {
+				// A retry would send the earlier parts again.
+				return Permanent(fmt.Errorf("%w (parts 1-%d already sent)", err, i))
+			}
+			return err
+		}
+	}
+	return nil
+}
 
-	// PDF attachment
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString(fmt.Sprintf("Content-Type: application/pdf; name=\"%s\"\r\n", safeFilename))
-	msg.WriteString("Content-Transfer-Encoding: base64\r\n")
-	msg.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n\r\n", safeFilename))
+// Attachments are base64 encoded in lines of base64LineLen characters plus
+// CRLF, each holding base64LineBytes bytes of the document.
+const (
+	base64LineLen   = 76
+	base64LineBytes = 57
+)
+
+// base64Size returns the size of n bytes as an encoded attachment.
+func base64Size(n int64) int64 {
+	lines := (n + base64LineBytes - 1) / base64LineBytes
+	return int64(base64.StdEncoding.EncodedLen(int(n))) + 2*lines
+}
 
-	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+// emailRecipients are the parsed addresses of one message.
+type emailRecipients struct {
+	to, cc, bcc []*mail.Address
+}
+
+func (r emailRecipients) envelope() []string {
+	var addrs []string
+	for _, list := range [][]*mail.Address{r.to, r.cc, r.bcc} {
+		for _, a := range list {
+			addrs = append(addrs, a.Address)
+		}
+	}
+	return addrs
+}
+
+// recipients returns the configured recipients, or those of the scan
+// request or profile after checking them against the allow-list.
+func (h *EmailHandler) recipients(doc *jobs.Document) (emailRecipients, error) {
+	to, cc, bcc := h.to, h.cc, h.bcc
+	override := doc.Recipients != nil
+	if override {
+		to, cc, bcc = doc.Recipients.To, doc.Recipients.Cc, doc.Recipients.Bcc
+	}
+
+	var r emailRecipients
+	for _, list := range []struct {
+		addrs []string
+		dst   *[]*mail.Address
+	}{{to, &r.to}, {cc, &r.cc}, {bcc, &r.bcc}} {
+		for _, s := range list.addrs {
+			a, err := mail.ParseAddress(s)
+			if err != nil {
+				return r, fmt.Errorf("invalid recipient %q: %w", s, err)
+			}
+			if override && !h.allowedRecipient(a.Address) {
+				return r, fmt.Errorf("recipient %s is not on the email allow-list", a.Address)
+			}
+			*list.dst = append(*list.dst, a)
+		}
+	}
+	if len(r.to)+len(r.cc)+len(r.bcc) == 0 {
+		return r, errors.New("no email recipients")
+	}
+	return r, nil
+}
+
+// allowedRecipient reports whether addr is configured on the output or
+// matches an allow-list entry, either an address or "@domain".
+func (h *EmailHandler) allowedRecipient(addr string) bool {
+	addr = strings.ToLower(addr)
+	for _, list := range [][]string{h.allowed, h.to, h.cc, h.bcc} {
+		for _, entry := range list {
+			entry = strings.ToLower(strings.TrimSpace(entry))
+			if a, err := mail.ParseAddress(entry); err == nil {
+				entry = strings.ToLower(a.Address)
+			}
+			if entry == addr || (strings.HasPrefix(entry, "@") && strings.HasSuffix(addr, entry)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (h *EmailHandler) subjectFor(doc *jobs.Document, filename string) string {
+	if h.subject != "" {
+		return sanitizeMIMEValue(h.naming.expand(h.subject, doc, filename))
+	}
+	if title := sanitizeMIMEValue(doc.Title); title != "" {
+		return "ScanFlow: " + title
+	}
+	return "ScanFlow: " + filename
+}
+
+// message builds a MIME message with a text part and the PDF attachment.
+// The multipart writer picks a random boundary for every message.
+func (h *EmailHandler) message(rcpt emailRecipients, subject, body, filename string, data []byte) ([]byte, error) {
+	var msg bytes.Buffer
+	mw := multipart.NewWriter(&msg)
+
+	var head bytes.Buffer
+	head.WriteString("From: " + h.from + "\r\n")
+	head.WriteString("To: " + formatAddressList(rcpt.to) + "\r\n")
+	if len(rcpt.cc) > 0 {
+		head.WriteString("Cc: " + formatAddressList(rcpt.cc) + "\r\n")
+	}
+	head.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	head.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	head.WriteString("MIME-Version: 1.0\r\n")
+	head.WriteString("Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(text)
+	if _, err := qp.Write([]byte(body + "\r\n")); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	contentType := "application/pdf"
+	if !strings.HasSuffix(strings.ToLower(filename), ".pdf") {
+		contentType = "application/octet-stream"
+	}
+	attachment, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": filename})},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filename})},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
 	// Wrap at 76 characters
-	for i := 0; i < len(encoded); i += 76 {
-		end := i + 76
-		if end > len(encoded) {
-			end = len(encoded)
+	for i := 0; i < len(encoded); i += base64LineLen {
+		if _, err := io.WriteString(attachment, encoded[i:min(i+base64LineLen, len(encoded))]+"\r\n"); err != nil {
+			return nil, err
 		}
-		msg.WriteString(encoded[i:end] + "\r\n")
 	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(head.Bytes(), msg.Bytes()...), nil
+}
+
+func formatAddressList(addrs []*mail.Address) string {
+	if len(addrs) == 0 {
+		return "undisclosed-recipients:;"
+	}
+	s := make([]string, len(addrs))
+	for i, a := range addrs {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ", ")
+}
 
-	msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+// Test connects in the configured TLS mode, greets the server and
+// authenticates without sending a message.
+func (h *EmailHandler) Test(ctx context.Context) error {
+	if h.secretErr != nil {
+		return Permanent(fmt.Errorf("smtp password: %w", h.secretErr))
+	}
+	c, err := h.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Quit()
+}
 
-	// Send via SMTP
-	addr := fmt.Sprintf("%s:%d", h.host, h.port)
-	auth := smtp.PlainAuth("", h.user, h.password, h.host)
+// deliver sends one message over SMTP in the configured TLS mode. SMTP
+// 5xx replies are permanent failures.
+func (h *EmailHandler) deliver(ctx context.Context, rcpt []string, msg []byte) error {
+	c, err := h.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
 
-	if err := smtp.SendMail(addr, auth, h.from, []string{to}, msg.Bytes()); err != nil {
+	if err := c.Mail(h.from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", smtpError(err))
+	}
+	for _, r := range rcpt {
+		if err := c.Rcpt(r); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", r, smtpError(err))
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", smtpError(err))
+	}
+	if _, err := w.Write(msg); err != nil {
 		return fmt.Errorf("send email: %w", err)
 	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send email: %w", smtpError(err))
+	}
+	return c.Quit()
+}
+
+// dial connects in the configured TLS mode and returns an authenticated
+// SMTP session.
+func (h *EmailHandler) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(h.host, strconv.Itoa(h.port))
+	tlsConfig := h.tlsConfig.Clone()
+	tlsConfig.ServerName = h.host
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if h.tlsMode == emailTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	deadline := time.Now().Add(5 * time.Minute)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, h.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp greeting: %w", smtpError(err))
+	}
+	if err := h.secure(c, tlsConfig, addr); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// secure upgrades the session with STARTTLS unless TLS is implicit, and
+// authenticates when a user is configured.
+func (h *EmailHandler) secure(c *smtp.Client, tlsConfig *tls.Config, addr string) error {
+	if h.tlsMode != emailTLSImplicit {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("starttls: %w", smtpError(err))
+			}
+		} else if h.tlsMode == emailTLSStartTLSRequired {
+			return Permanent(fmt.Errorf("smtp server %s does not offer STARTTLS", addr))
+		}
+	}
 
+	if h.user != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return Permanent(fmt.Errorf("smtp server %s does not offer authentication", addr))
+		}
+		if err := c.Auth(smtp.PlainAuth("", h.user, h.password, h.host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", smtpError(err))
+		}
+	}
 	return nil
 }
 
+// smtpError marks permanent (5xx) SMTP replies.
+func smtpError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
+
 // sanitizeMIMEValue removes characters that could cause MIME header injection
 // (newlines, carriage returns, null bytes, and double quotes).
 func sanitizeMIMEValue(v string) string {
@@ -0,0 +1,391 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// fakeSMTP is a minimal SMTP server that records the messages it accepts.
+type fakeSMTP struct {
+	mu       sync.Mutex
+	tls      *tls.Config
+	starttls bool // offer STARTTLS
+	failFrom int  // reply 452 from this message on (1-based), 0 = never
+	messages []smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	rcpt []string
+	data []byte
+	tls  bool
+	auth string
+}
+
+// newFakeSMTP starts the server and returns an email handler pointing at
+// it that trusts its certificate.
+func newFakeSMTP(t *testing.T, cfg config.EmailConfig, starttls bool) (*fakeSMTP, *EmailHandler) {
+	t.Helper()
+	// Borrow the certificate of an httptest server; it is valid for 127.0.0.1.
+	certSrv := httptest.NewTLSServer(nil)
+	t.Cleanup(certSrv.Close)
+	s := &fakeSMTP{
+		tls:      &tls.Config{Certificates: certSrv.TLS.Certificates},
+		starttls: starttls,
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLS == "implicit" {
+		ln = tls.NewListener(ln, s.tls)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, cfg.TLS == "implicit")
+		}
+	}()
+
+	cfg.SMTPHost = "127.0.0.1"
+	cfg.SMTPPort = ln.Addr().(*net.TCPAddr).Port
+	cfg.FromAddress = "scanner@example.com"
+	h := NewEmailHandler(cfg)
+	h.tlsConfig = &tls.Config{RootCAs: certSrv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	return s, h
+}
+
+func (s *fakeSMTP) serve(conn net.Conn, secure bool) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	var msg smtpMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-fake")
+			if s.starttls && !secure {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			_, cred, _ := strings.Cut(arg, " ")
+			data, _ := base64.StdEncoding.DecodeString(cred)
+			msg.auth = strings.ReplaceAll(string(data), "\x00", ":")
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			msg.from = arg
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			if strings.Contains(arg, "full@") {
+				tp.PrintfLine("552 mailbox full")
+				continue
+			}
+			msg.rcpt = append(msg.rcpt, strings.TrimSuffix(strings.TrimPrefix(arg, "TO:<"), ">"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			msg.data, _ = tp.ReadDotBytes()
+			msg.tls = secure
+			s.mu.Lock()
+			full := s.failFrom > 0 && len(s.messages)+1 >= s.failFrom
+			if !full {
+				s.messages = append(s.messages, msg)
+			}
+			s.mu.Unlock()
+			msg = smtpMessage{}
+			if full {
+				tp.PrintfLine("452 insufficient system storage")
+				continue
+			}
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTP) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+// parseEmail returns the headers, text part and attachment of a message.
+func parseEmail(t *testing.T, data []byte) (mail.Header, string, string, []byte) {
+	t.Helper()
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("parse content type: %v", err)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	text, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("text part: %v", err)
+	}
+	body, _ := io.ReadAll(text)
+	file, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("attachment: %v", err)
+	}
+	encoded, _ := io.ReadAll(file)
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil {
+		t.Fatalf("decode attachment: %v", err)
+	}
+	return m.Header, strings.TrimSpace(string(body)), file.FileName(), content
+}
+
+func emailDoc(content string) *jobs.Document {
+	return &jobs.Document{
+		Title:             "Rechnung März",
+		CorrespondentName: "ACME",
+		Open:              jobs.BytesSource([]byte(content)),
+		Size:              int64(len(content)),
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	cfg := config.EmailConfig{
+		NamingConfig: config.NamingConfig{FilenamePattern: "{correspondent}_{title}"},
+		TLS:          "starttls_required",
+		SMTPUser:     "scanner",
+		To:           []string{"Office <office@example.com>"},
+		Cc:           []string{"boss@example.com"},
+		Bcc:          []string{"archive@example.com"},
+		Subject:      "Scan von {correspondent}: {title}",
+		Body:         "Anbei {filename} ({size} Bytes)",
+	}
+
+	_, plain := newFakeSMTP(t, cfg, false)
+	if err := plain.Send(context.Background(), emailDoc("%PDF")); !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected permanent STARTTLS error, got %v", err)
+	}
+
+	srv, h := newFakeSMTP(t, cfg, true)
+	for range 2 {
+		if err := h.Send(context.Background(), emailDoc("%PDF-1.7 invoice")); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	msgs := srv.received()
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	msg := msgs[0]
+	if !msg.tls || msg.auth != ":scanner:" {
+		t.Errorf("expected authenticated TLS session, got tls=%v auth=%q", msg.tls, msg.auth)
+	}
+	if strings.Join(msg.rcpt, ",") != "office@example.com,boss@example.com,archive@example.com" {
+		t.Errorf("unexpected envelope recipients %v", msg.rcpt)
+	}
+
+	header, body, filename, content := parseEmail(t, msg.data)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if subject != "Scan von ACME: Rechnung März" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if header.Get("To") != `"Office" <office@example.com>` || header.Get("Cc") != "<boss@example.com>" || header.Get("Bcc") != "" {
+		t.Errorf("unexpected address headers %v", header)
+	}
+	if body != "Anbei ACME_Rechnung März.pdf (16 Bytes)" {
+		t.Errorf("unexpected body %q", body)
+	}
+	if filename != "ACME_Rechnung März.pdf" || string(content) != "%PDF-1.7 invoice" {
+		t.Errorf("unexpected attachment %q: %q", filename, content)
+	}
+
+	boundary := func(m smtpMessage) string {
+		h, _ := mail.ReadMessage(bytes.NewReader(m.data))
+		_, params, _ := mime.ParseMediaType(h.Header.Get("Content-Type"))
+		return params["boundary"]
+	}
+	if boundary(msgs[0]) == boundary(msgs[1]) {
+		t.Error("expected a new random boundary per message")
+	}
+}
+
+func TestEmailImplicitTLS(t *testing.T) {
+	srv, h := newFakeSMTP(t, config.EmailConfig{TLS: "implicit", DefaultRecipient: "office@example.com"}, false)
+	if err := h.Send(context.Background(), emailDoc("%PDF")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if msgs := srv.received(); len(msgs) != 1 || !msgs[0].tls || msgs[0].rcpt[0] != "office@example.com" {
+		t.Fatalf("expected one message over TLS, got %+v", msgs)
+	}
+}
+
+func TestEmailRecipientOverrideAllowList(t *testing.T) {
+	srv, h := newFakeSMTP(t, config.EmailConfig{
+		To:                []string{"office@example.com"},
+		AllowedRecipients: []string{"@example.org", "tax@advisor.test"},
+	}, false)
+
+	doc := emailDoc("%PDF")
+	doc.Recipients = &jobs.Recipients{To: []string{"Max <max@example.org>"}, Cc: []string{"office@example.com"}, Bcc: []string{"tax@advisor.test"}}
+	if err := h.Send(context.Background(), doc); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if msgs := srv.received(); len(msgs) != 1 || strings.Join(msgs[0].rcpt, ",") != "max@example.org,office@example.com,tax@advisor.test" {
+		t.Fatalf("unexpected recipients %+v", msgs)
+	}
+
+	doc = emailDoc("%PDF")
+	doc.Recipients = &jobs.Recipients{To: []string{"someone@evil.test"}}
+	if err := h.Send(context.Background(), doc); !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "someone@evil.test") {
+		t.Fatalf("expected permanent allow-list error, got %v", err)
+	}
+
+	doc = emailDoc("%PDF")
+	doc.Recipients = &jobs.Recipients{To: []string{"full@example.org"}}
+	if err := h.Send(context.Background(), doc); !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "mailbox full") {
+		t.Fatalf("expected permanent 5xx error, got %v", err)
+	}
+}
+
+func TestEmailOversize(t *testing.T) {
+	content := strings.Repeat("x", 5<<19)
+	cfg := config.EmailConfig{To: []string{"office@example.com"}, MaxSizeMB: 1}
+
+	_, h := newFakeSMTP(t, cfg, false)
+	if err := h.Send(context.Background(), emailDoc(content)); !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "limited to") {
+		t.Fatalf("expected permanent size error, got %v", err)
+	}
+
+	cfg.Oversize = "split"
+	srv, h := newFakeSMTP(t, cfg, false)
+	if err := h.Send(context.Background(), emailDoc(content)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	// The base64 encoded parts must fit in 1 MiB, so 2.5 MiB take 4 parts.
+	msgs := srv.received()
+	if len(msgs) != 4 {
+		t.Fatalf("expected 4 parts, got %d", len(msgs))
+	}
+	var joined []byte
+	for i, msg := range msgs {
+		header, _, filename, part := parseEmail(t, msg.data)
+		if !strings.HasSuffix(filename, fmt.Sprintf(".pdf.%03d", i+1)) {
+			t.Errorf("unexpected part filename %q", filename)
+		}
+		subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+		if want := fmt.Sprintf("ScanFlow: Rechnung März (%d/4)", i+1); subject != want {
+			t.Errorf("part subject = %q, want %q", subject, want)
+		}
+		encoded := base64.StdEncoding.EncodedLen(len(part))
+		if size := encoded + 2*((encoded+75)/76); size > 1<<20 {
+			t.Errorf("part %d is %d bytes encoded, over the limit", i+1, size)
+		}
+		joined = append(joined, part...)
+	}
+	if string(joined) != content {
+		t.Error("joined parts differ from the document")
+	}
+
+	// A document just below the limit is rejected once encoded.
+	cfg.Oversize = ""
+	_, h = newFakeSMTP(t, cfg, false)
+	if err := h.Send(context.Background(), emailDoc(strings.Repeat("x", 900<<10))); !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected the encoded size to exceed the limit, got %v", err)
+	}
+}
+
+func TestEmailSplitPartialFailureIsPermanent(t *testing.T) {
+	cfg := config.EmailConfig{To: []string{"office@example.com"}, MaxSizeMB: 1, Oversize: "split"}
+	srv, h := newFakeSMTP(t, cfg, false)
+	srv.failFrom = 2
+
+	err := h.Send(context.Background(), emailDoc(strings.Repeat("x", 5<<19)))
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "part 2 of 4") {
+		t.Fatalf("expected a permanent error for part 2, got %v", err)
+	}
+	if msgs := srv.received(); len(msgs) != 1 {
+		t.Fatalf("expected only the first part to be sent, got %d", len(msgs))
+	}
+
+	// Nothing has been sent when the first part fails, so it can be retried.
+	srv, h = newFakeSMTP(t, cfg, false)
+	srv.failFrom = 1
+	err = h.Send(context.Background(), emailDoc(strings.Repeat("x", 5<<19)))
+	if err == nil || errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected a retryable error for part 1, got %v", err)
+	}
+}
+
+func TestEmailTest(t *testing.T) {
+	srv, h := newFakeSMTP(t, config.EmailConfig{TLS: "starttls_required", SMTPUser: "scanner", To: []string{"office@example.com"}}, true)
+	if err := h.Test(context.Background()); err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+	if msgs := srv.received(); len(msgs) != 0 {
+		t.Fatalf("Test must not send mail, got %d messages", len(msgs))
+	}
+
+	_, h = newFakeSMTP(t, config.EmailConfig{TLS: "starttls_required", To: []string{"office@example.com"}}, false)
+	if err := h.Test(context.Background()); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+}
+
+func TestEmailUnreadablePasswordFile(t *testing.T) {
+	h := NewEmailHandler(config.EmailConfig{
+		SMTPHost:         "smtp.example.com",
+		SMTPUser:         "scanner",
+		SMTPPasswordFile: filepath.Join(t.TempDir(), "missing"),
+		FromAddress:      "scanner@example.com",
+		To:               []string{"office@example.com"},
+	})
+	if h.Available() {
+		t.Error("handler with an unreadable password file must not be available")
+	}
+	if err := h.Test(context.Background()); !errors.Is(err, ErrPermanent) {
+		t.Errorf("Test = %v, want a permanent error", err)
+	}
+	if err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))}); !errors.Is(err, ErrPermanent) {
+		t.Errorf("Send = %v, want a permanent error", err)
+	}
+}
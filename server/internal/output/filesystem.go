@@ -2,52 +2,275 @@ package output
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
+	"log/slog"
 	"os"
+	"os/user"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/thoscut/scanflow/server/internal/config"
 	"github.com/thoscut/scanflow/server/internal/jobs"
 )
 
 // FilesystemHandler saves documents to the local filesystem.
 type FilesystemHandler struct {
-	directory string
+	target    localTarget
+	sidecar   bool
+	configErr error // the configured file or directory mode is invalid
 }
 
 // NewFilesystemHandler creates a new filesystem output handler.
 func NewFilesystemHandler(dir string) *FilesystemHandler {
-	return &FilesystemHandler{directory: dir}
+	return &FilesystemHandler{target: localTarget{
+		directory: dir,
+		naming:    NewNaming(config.NamingConfig{}, SanitizePOSIX),
+		fileMode:  0o644,
+		dirMode:   0o755,
+		gid:       -1,
+	}}
+}
+
+// NewFilesystemHandlerFromConfig creates a filesystem output handler for a
+// configured archive directory. The directory layout template is prepended
+// to the filename pattern.
+func NewFilesystemHandlerFromConfig(cfg config.FilesystemTarget) *FilesystemHandler {
+	h := NewFilesystemHandler(cfg.Directory)
+	h.sidecar = cfg.Sidecar
+
+	naming := cfg.NamingConfig
+	if naming.FilenamePattern == "" {
+		naming.FilenamePattern = DefaultFilenamePattern
+	}
+	if layout := strings.Trim(cfg.Layout, "/"); layout != "" {
+		naming.FilenamePattern = layout + "/" + naming.FilenamePattern
+	}
+	h.target.naming = NewNaming(naming, SanitizePOSIX)
+
+	if fileMode, dirMode, err := cfg.Modes(); err != nil {
+		h.configErr = err
+	} else {
+		h.target.fileMode, h.target.dirMode = fileMode, dirMode
+	}
+	if cfg.Group != "" {
+		gid, err := lookupGroup(cfg.Group)
+		if err != nil {
+			slog.Warn("filesystem output group not found, keeping default group",
+				"directory", cfg.Directory, "group", cfg.Group, "error", err)
+		} else {
+			h.target.gid = gid
+		}
+	}
+	return h
 }
 
 func (h *FilesystemHandler) Name() string { return "filesystem" }
 
 func (h *FilesystemHandler) Available() bool {
-	return h.directory != ""
+	return h.target.directory != "" && h.configErr == nil
 }
 
-// Send saves a document to the local filesystem.
+// Test checks that the directory is writable.
+func (h *FilesystemHandler) Test(context.Context) error {
+	if h.configErr != nil {
+		return Permanent(fmt.Errorf("filesystem config: %w", h.configErr))
+	}
+	return h.target.test()
+}
+
+// Send saves a document to the local filesystem, optionally followed by a
+// JSON sidecar file with the job metadata. If the sidecar cannot be written
+// the document is removed again, so a retry does not archive it twice.
 func (h *FilesystemHandler) Send(_ context.Context, doc *jobs.Document) error {
-	if err := os.MkdirAll(h.directory, 0o755); err != nil {
-		return fmt.Errorf("create directory: %w", err)
+	if h.configErr != nil {
+		return Permanent(fmt.Errorf("filesystem config: %w", h.configErr))
+	}
+	p, n, err := h.target.write(doc)
+	if err != nil {
+		return err
+	}
+	if !h.sidecar {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(newSidecar(doc, filepath.Base(p), n), "", "  ")
+	if err != nil {
+		os.Remove(p)
+		return fmt.Errorf("encode sidecar: %w", err)
+	}
+	sidecarPath := strings.TrimSuffix(p, filepath.Ext(p)) + ".json"
+	if err := h.target.writeFile(sidecarPath, data); err != nil {
+		os.Remove(p)
+		return fmt.Errorf("write sidecar: %w", err)
+	}
+	return nil
+}
+
+// sidecar is the JSON metadata file written next to an archived document.
+type sidecar struct {
+	Filename      string    `json:"filename"`
+	Size          int64     `json:"size"`
+	Title         string    `json:"title,omitempty"`
+	Created       string    `json:"created,omitempty"`
+	Correspondent int       `json:"correspondent,omitempty"`
+	DocumentType  int       `json:"document_type,omitempty"`
+	Tags          []int     `json:"tags,omitempty"`
+	ArchiveSerial string    `json:"archive_serial_number,omitempty"`
+	JobID         string    `json:"job_id,omitempty"`
+	Profile       string    `json:"profile,omitempty"`
+	Pages         int       `json:"pages,omitempty"`
+	ScannedAt     time.Time `json:"scanned_at,omitzero"`
+
+	CorrespondentName string         `json:"correspondent_name,omitempty"`
+	DocumentTypeName  string         `json:"document_type_name,omitempty"`
+	TagNames          []string       `json:"tag_names,omitempty"`
+	StoragePath       string         `json:"storage_path,omitempty"`
+	CustomFields      map[string]any `json:"custom_fields,omitempty"`
+}
+
+func newSidecar(doc *jobs.Document, filename string, size int64) sidecar {
+	return sidecar{
+		Filename:      filename,
+		Size:          size,
+		Title:         doc.Title,
+		Created:       doc.Created,
+		Correspondent: doc.Correspondent,
+		DocumentType:  doc.DocumentType,
+		Tags:          doc.Tags,
+		ArchiveSerial: doc.ArchiveSerial,
+		JobID:         doc.JobID,
+		Profile:       doc.Profile,
+		Pages:         doc.Pages,
+		ScannedAt:     doc.ScannedAt,
+
+		CorrespondentName: doc.CorrespondentName,
+		DocumentTypeName:  doc.DocumentTypeName,
+		TagNames:          doc.TagNames,
+		StoragePath:       doc.StoragePath,
+		CustomFields:      doc.CustomFields,
+	}
+}
+
+// localTarget writes documents below a local directory.
+type localTarget struct {
+	directory string
+	naming    Naming
+	fileMode  os.FileMode
+	dirMode   os.FileMode
+	gid       int // -1 keeps the default group
+}
+
+// write stores doc under the path built by the naming rules and returns the
+// path written and its size. Subdirectories from the pattern are created as
+// needed.
+func (t localTarget) write(doc *jobs.Document) (string, int64, error) {
+	rel, err := t.naming.Resolve(t.naming.Path(doc), func(p string) (bool, error) {
+		_, err := os.Stat(filepath.Join(t.directory, filepath.FromSlash(p)))
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := t.mkdirs(path.Dir(rel)); err != nil {
+		return "", 0, fmt.Errorf("create directory: %w", err)
 	}
 
-	// Prevent path traversal by using only the base name.
-	cleanName := filepath.Base(filepath.Clean(doc.Filename))
-	if cleanName == "." || cleanName == "/" {
-		cleanName = "document.pdf"
+	p := filepath.Join(t.directory, filepath.FromSlash(rel))
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if t.naming.OnConflict != ConflictOverwrite {
+		// Never replace a file created since the name was resolved.
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	f, err := os.OpenFile(p, flags, t.fileMode)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return "", 0, fmt.Errorf("create file %s: %w", rel, ErrFileExists)
+		}
+		return "", 0, fmt.Errorf("create file: %w", err)
 	}
-	path := filepath.Join(h.directory, cleanName)
 
-	f, err := os.Create(path)
+	// Do not leave a truncated document behind for a retry to collide with.
+	n, err := copyDocument(f, doc)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
 	if err != nil {
-		return fmt.Errorf("create file: %w", err)
+		os.Remove(p)
+		return "", 0, fmt.Errorf("write file: %w", err)
+	}
+	t.applyOwnership(p, t.fileMode)
+
+	return p, n, nil
+}
+
+// writeFile writes an auxiliary file with the target's permissions.
+func (t localTarget) writeFile(p string, data []byte) error {
+	if err := os.WriteFile(p, data, t.fileMode); err != nil {
+		return err
 	}
-	defer f.Close()
+	t.applyOwnership(p, t.fileMode)
+	return nil
+}
 
-	if _, err := io.Copy(f, doc.Reader); err != nil {
-		return fmt.Errorf("write file: %w", err)
+// mkdirs creates the base directory and the relative subdirectories below
+// it, applying the configured mode and group to each directory it creates.
+func (t localTarget) mkdirs(rel string) error {
+	if err := os.MkdirAll(t.directory, t.dirMode); err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
 	}
 
+	dir := t.directory
+	for _, seg := range strings.Split(rel, "/") {
+		dir = filepath.Join(dir, seg)
+		err := os.Mkdir(dir, t.dirMode)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		t.applyOwnership(dir, t.dirMode)
+	}
 	return nil
 }
+
+// applyOwnership sets the exact mode (bypassing the umask) and group on a
+// newly created path. Failures are logged because the document itself has
+// been stored.
+func (t localTarget) applyOwnership(p string, mode os.FileMode) {
+	if err := os.Chmod(p, mode); err != nil {
+		slog.Warn("failed to set permissions", "path", p, "error", err)
+	}
+	if t.gid >= 0 {
+		if err := os.Chown(p, -1, t.gid); err != nil {
+			slog.Warn("failed to set group", "path", p, "gid", t.gid, "error", err)
+		}
+	}
+}
+
+// lookupGroup resolves a group name or numeric GID.
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(g.Gid)
+}
@@ -0,0 +1,141 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+func TestFilesystemHandlerFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	h := NewFilesystemHandlerFromConfig(config.FilesystemTarget{
+		NamingConfig: config.NamingConfig{FilenamePattern: "{title}"},
+		Directory:    filepath.Join(dir, "archive"),
+		Layout:       "{year}/{month}/",
+		FileMode:     "0640",
+		DirMode:      "0750",
+		Group:        strconv.Itoa(os.Getgid()),
+		Sidecar:      true,
+	})
+
+	doc := &jobs.Document{
+		Title:     "Invoice",
+		Tags:      []int{3, 4},
+		JobID:     "job-1",
+		Pages:     2,
+		ScannedAt: namingTime,
+		Open:      jobs.BytesSource([]byte("pdf-data")),
+	}
+	if err := h.Send(context.Background(), doc); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	pdfPath := filepath.Join(dir, "archive", "2026", "10", "Invoice.pdf")
+	info, err := os.Stat(pdfPath)
+	if err != nil {
+		t.Fatalf("expected document in layout directory: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if info.Mode().Perm() != 0o640 {
+			t.Errorf("expected file mode 0640, got %o", info.Mode().Perm())
+		}
+		dirInfo, _ := os.Stat(filepath.Dir(pdfPath))
+		if dirInfo.Mode().Perm() != 0o750 {
+			t.Errorf("expected directory mode 0750, got %o", dirInfo.Mode().Perm())
+		}
+	}
+
+	data, err := os.ReadFile(strings.TrimSuffix(pdfPath, ".pdf") + ".json")
+	if err != nil {
+		t.Fatalf("expected sidecar: %v", err)
+	}
+	var meta sidecar
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("decode sidecar: %v", err)
+	}
+	if meta.Filename != "Invoice.pdf" || meta.Size != 8 || meta.JobID != "job-1" || len(meta.Tags) != 2 {
+		t.Errorf("unexpected sidecar: %+v", meta)
+	}
+}
+
+func TestFilesystemHandlerNoSidecarByDefault(t *testing.T) {
+	dir := t.TempDir()
+	h := NewFilesystemHandlerFromConfig(config.FilesystemTarget{Directory: dir})
+
+	if err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("x"))}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), ".pdf") {
+		t.Fatalf("expected a single PDF, got %v", entries)
+	}
+}
+
+// failingReader returns some data and then fails, like a document on a
+// broken spool disk.
+type failingReader struct{ sent bool }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("read error")
+	}
+	r.sent = true
+	return copy(p, "%PDF"), nil
+}
+
+func (r *failingReader) Close() error { return nil }
+
+func TestFilesystemHandlerRemovesPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	h := NewFilesystemHandlerFromConfig(config.FilesystemTarget{Directory: dir})
+
+	doc := &jobs.Document{Filename: "Invoice.pdf", Open: func() (io.ReadCloser, error) {
+		return &failingReader{}, nil
+	}}
+	if err := h.Send(context.Background(), doc); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Fatalf("partial file left behind: %v", entries)
+	}
+}
+
+func TestFilesystemHandlerRemovesDocumentWhenSidecarFails(t *testing.T) {
+	dir := t.TempDir()
+	h := NewFilesystemHandlerFromConfig(config.FilesystemTarget{Directory: dir, Sidecar: true})
+	// A directory in the sidecar's place makes writing it fail.
+	if err := os.Mkdir(filepath.Join(dir, "Invoice.json"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &jobs.Document{Filename: "Invoice.pdf", Open: jobs.BytesSource([]byte("pdf-data"))}
+	if err := h.Send(context.Background(), doc); err == nil {
+		t.Fatal("expected the sidecar write to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Invoice.pdf")); !os.IsNotExist(err) {
+		t.Fatalf("document left behind for a retry to duplicate: %v", err)
+	}
+}
+
+func TestFilesystemHandlerInvalidMode(t *testing.T) {
+	h := NewFilesystemHandlerFromConfig(config.FilesystemTarget{Directory: t.TempDir(), FileMode: "0999"})
+
+	if h.Available() {
+		t.Error("expected handler with an invalid mode to be unavailable")
+	}
+	err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("x"))})
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected permanent error, got %v", err)
+	}
+}
@@ -2,8 +2,14 @@ package output
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/thoscut/scanflow/server/internal/config"
@@ -19,17 +25,54 @@ type Handler interface {
 	Available() bool
 }
 
+// ResultHandler is implemented by handlers that learn where the target
+// stored a document, such as the Paperless document ID.
+type ResultHandler interface {
+	Handler
+	SendWithResult(ctx context.Context, doc *jobs.Document) (*jobs.DeliveryResult, error)
+}
+
+// Tester is implemented by handlers that can check their connection,
+// credentials and write access without leaving anything on the target.
+type Tester interface {
+	Handler
+	Test(ctx context.Context) error
+}
+
+// ErrPermanent matches failures that retrying cannot fix. They are neither
+// retried nor queued in the outbox.
+var ErrPermanent = errors.New("permanent delivery failure")
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string        { return e.err.Error() }
+func (e permanentError) Unwrap() error        { return e.err }
+func (e permanentError) Is(target error) bool { return target == ErrPermanent }
+
+// Permanent marks err as a failure that retrying cannot fix.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
 // Target describes a configured output target.
 type Target struct {
 	Name      string `json:"name"`
 	Type      string `json:"type"`
 	Enabled   bool   `json:"enabled"`
 	Available bool   `json:"available"`
+	Managed   bool   `json:"managed"` // created through the API
 }
 
 // Manager routes documents to the appropriate output handler.
 type Manager struct {
+	mu       sync.Mutex
 	handlers map[string]Handler
+	managed  map[string]bool       // targets added at runtime
+	results  map[string]TestResult // latest connectivity tests
+	testing  bool                  // a background refresh is running
 }
 
 // NewManager creates a new output manager from the server configuration.
@@ -54,18 +97,178 @@ func NewManager(cfg config.OutputConfig) *Manager {
 		m.handlers["email"] = NewEmailHandler(cfg.Email)
 	}
 
-	// Filesystem is always available
-	m.handlers["filesystem"] = NewFilesystemHandler("/var/lib/scanflow/documents")
+	if cfg.WebDAV.Enabled {
+		m.handlers["webdav"] = NewWebDAVHandler(cfg.WebDAV)
+	}
+
+	if cfg.IPP.Enabled {
+		m.handlers["ipp"] = NewIPPHandler(cfg.IPP)
+	}
+
+	if cfg.HTTP.Enabled {
+		m.handlers["http"] = NewHTTPHandler(cfg.HTTP)
+	}
+
+	if cfg.SFTP.Enabled {
+		m.handlers["sftp"] = NewSFTPHandler(cfg.SFTP)
+	}
+
+	if cfg.S3.Enabled {
+		m.handlers["s3"] = NewS3Handler(cfg.S3)
+	}
+
+	if cfg.Filesystem.Enabled {
+		m.handlers["filesystem"] = NewFilesystemHandlerFromConfig(cfg.Filesystem.FilesystemTarget)
+	}
+
+	// Additional archive directories are targets of their own.
+	for name, dest := range cfg.Filesystem.Destinations {
+		m.handlers[name] = NewFilesystemHandlerFromConfig(dest)
+	}
+
+	for _, inst := range cfg.Instances {
+		h, err := NewHandler(inst)
+		if err != nil {
+			slog.Error("skipping output instance", "name", inst.Name, "error", err)
+			continue
+		}
+		m.handlers[inst.Name] = h
+	}
 
 	slog.Info("output handlers initialized", "count", len(m.handlers))
 	return m
 }
 
+// NewHandler creates the handler for a named output instance.
+func NewHandler(inst config.OutputInstance) (Handler, error) {
+	switch {
+	case inst.Type == "filesystem" && inst.Filesystem != nil:
+		return NewFilesystemHandlerFromConfig(*inst.Filesystem), nil
+	case inst.Type == "paperless" && inst.Paperless != nil:
+		return NewPaperlessHandler(*inst.Paperless), nil
+	case inst.Type == "smb" && inst.SMB != nil:
+		return NewSMBHandler(*inst.SMB), nil
+	case inst.Type == "paperless_consume" && inst.PaperlessConsume != nil:
+		return NewPaperlessConsumeHandler(*inst.PaperlessConsume), nil
+	case inst.Type == "email" && inst.Email != nil:
+		return NewEmailHandler(*inst.Email), nil
+	case inst.Type == "webdav" && inst.WebDAV != nil:
+		return NewWebDAVHandler(*inst.WebDAV), nil
+	case inst.Type == "s3" && inst.S3 != nil:
+		return NewS3Handler(*inst.S3), nil
+	case inst.Type == "sftp" && inst.SFTP != nil:
+		return NewSFTPHandler(*inst.SFTP), nil
+	case inst.Type == "http" && inst.HTTP != nil:
+		return NewHTTPHandler(*inst.HTTP), nil
+	case inst.Type == "ipp" && inst.IPP != nil:
+		return NewIPPHandler(*inst.IPP), nil
+	}
+	return nil, fmt.Errorf("output %s: unsupported type %q or missing [%s] settings", inst.Name, inst.Type, inst.Type)
+}
+
+// Has reports whether a target with the given name is configured.
+func (m *Manager) Has(name string) bool {
+	_, ok := m.Handler(name)
+	return ok
+}
+
+// Handler returns the handler of a configured target.
+func (m *Manager) Handler(name string) (Handler, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.handlers[name]
+	return h, ok
+}
+
+// SetManaged adds or replaces a target managed at runtime. Deliveries
+// already in progress finish with the previous handler.
+func (m *Manager) SetManaged(name string, h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.managed == nil {
+		m.managed = make(map[string]bool)
+	}
+	m.handlers[name] = h
+	m.managed[name] = true
+	delete(m.results, name)
+	slog.Info("output target updated", "target", name, "type", h.Name())
+}
+
+// RemoveManaged removes a target managed at runtime. It reports false when
+// no such target exists.
+func (m *Manager) RemoveManaged(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.managed[name] {
+		return false
+	}
+	delete(m.handlers, name)
+	delete(m.managed, name)
+	delete(m.results, name)
+	slog.Info("output target removed", "target", name)
+	return true
+}
+
+// IsManaged reports whether a target was added at runtime.
+func (m *Manager) IsManaged(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.managed[name]
+}
+
 // Send routes a document to the specified output target with retry logic.
 func (m *Manager) Send(ctx context.Context, target string, doc *jobs.Document) error {
-	handler, ok := m.handlers[target]
+	_, err := m.send(ctx, target, doc, nil)
+	return err
+}
+
+// SendAll delivers a document to every target concurrently. Each target
+// retries independently; update is called whenever a delivery changes
+// state. The final delivery records are returned in target order.
+func (m *Manager) SendAll(ctx context.Context, doc *jobs.Document, targets []jobs.OutputTarget, update func(jobs.Delivery)) []jobs.Delivery {
+	results := make([]jobs.Delivery, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := jobs.Delivery{Target: t.Name, Required: !t.Optional}
+			report := func(status jobs.DeliveryStatus, err error) {
+				d.Status = status
+				d.Error = ""
+				if err != nil {
+					d.Error = err.Error()
+				}
+				d.UpdatedAt = time.Now()
+				if update != nil {
+					update(d)
+				}
+			}
+
+			result, err := m.send(ctx, t.Name, doc, func(attempt int, err error) {
+				d.Attempts = attempt
+				report(jobs.DeliverySending, err)
+			})
+			d.Result = result
+			if err != nil {
+				d.Permanent = errors.Is(err, ErrPermanent)
+				report(jobs.DeliveryFailed, err)
+			} else {
+				report(jobs.DeliveryDelivered, nil)
+			}
+			results[i] = d
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// send delivers doc to one target with retries. attempt is called before
+// each attempt with its number and the previous attempt's error.
+func (m *Manager) send(ctx context.Context, target string, doc *jobs.Document, attempt func(n int, lastErr error)) (*jobs.DeliveryResult, error) {
+	handler, ok := m.Handler(target)
 	if !ok {
-		return fmt.Errorf("unknown output target: %s", target)
+		return nil, fmt.Errorf("unknown output target: %s", target)
 	}
 
 	slog.Info("sending document to output",
@@ -74,46 +277,101 @@ func (m *Manager) Send(ctx context.Context, target string, doc *jobs.Document) e
 		"size", doc.Size)
 
 	var lastErr error
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		if attempt > 0 {
-			// Exponential backoff: 2^(attempt-1) seconds → 1s, 2s, 4s
-			delay := time.Duration(1<<(attempt-1)) * time.Second
+	for n := 0; n <= maxRetries; n++ {
+		if n > 0 {
+			// Exponential backoff: 2^(n-1) seconds → 1s, 2s, 4s
+			delay := time.Duration(1<<(n-1)) * time.Second
 			slog.Warn("retrying output send",
 				"target", target,
-				"attempt", attempt,
+				"attempt", n,
 				"delay", delay,
 				"error", lastErr)
 			select {
 			case <-ctx.Done():
-				return fmt.Errorf("output %s: context cancelled during retry: %w", target, ctx.Err())
+				return nil, fmt.Errorf("output %s: context cancelled during retry: %w", target, ctx.Err())
 			case <-time.After(delay):
 			}
 		}
+		if attempt != nil {
+			attempt(n+1, lastErr)
+		}
 
-		if err := handler.Send(ctx, doc); err != nil {
+		result, err := deliverOnce(ctx, handler, doc)
+		if errors.Is(err, ErrPermanent) {
+			return nil, fmt.Errorf("output %s: %w", target, err)
+		}
+		if err != nil {
 			lastErr = err
 			continue
 		}
 
 		slog.Info("document sent successfully",
 			"target", target,
-			"attempts", attempt+1)
-		return nil
+			"attempts", n+1)
+		return result, nil
 	}
 
-	return fmt.Errorf("output %s: all retries exhausted: %w", target, lastErr)
+	return nil, fmt.Errorf("output %s: all retries exhausted: %w", target, lastErr)
+}
+
+// sendOnce makes a single delivery attempt without retries.
+func (m *Manager) sendOnce(ctx context.Context, target string, doc *jobs.Document) (*jobs.DeliveryResult, error) {
+	handler, ok := m.Handler(target)
+	if !ok {
+		return nil, fmt.Errorf("unknown output target: %s", target)
+	}
+	return deliverOnce(ctx, handler, doc)
+}
+
+func deliverOnce(ctx context.Context, h Handler, doc *jobs.Document) (*jobs.DeliveryResult, error) {
+	if rh, ok := h.(ResultHandler); ok {
+		return rh.SendWithResult(ctx, doc)
+	}
+	return nil, h.Send(ctx, doc)
+}
+
+// copyDocument writes the whole document to w from a freshly opened reader,
+// which is closed again before returning.
+func copyDocument(w io.Writer, doc *jobs.Document) (int64, error) {
+	if doc.Open == nil {
+		return 0, errors.New("document has no content")
+	}
+	r, err := doc.Open()
+	if err != nil {
+		return 0, fmt.Errorf("open document: %w", err)
+	}
+	defer r.Close()
+	return io.Copy(w, r)
+}
+
+// readSecretFile reads a password, token or key from a file and trims
+// surrounding whitespace. An empty path yields an empty secret.
+func readSecretFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
 }
 
-// ListTargets returns all configured output targets.
+// ListTargets returns all configured output targets sorted by name. Name is
+// what jobs and profiles refer to; Type is the handler implementation.
 func (m *Manager) ListTargets() []Target {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	targets := make([]Target, 0, len(m.handlers))
 	for name, h := range m.handlers {
 		targets = append(targets, Target{
 			Name:      name,
-			Type:      name,
+			Type:      h.Name(),
 			Enabled:   true,
 			Available: h.Available(),
+			Managed:   m.managed[name],
 		})
 	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
 	return targets
 }
@@ -1,10 +1,14 @@
 package output
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/thoscut/scanflow/server/internal/config"
@@ -36,7 +40,7 @@ func TestFilesystemHandlerSanitizesFilename(t *testing.T) {
 
 	doc := &jobs.Document{
 		Filename: ".",
-		Reader:   strings.NewReader("data"),
+		Open:     jobs.BytesSource([]byte("data")),
 	}
 
 	if err := h.Send(context.Background(), doc); err != nil {
@@ -100,7 +104,7 @@ func TestPaperlessConsumeHandlerSend(t *testing.T) {
 	doc := &jobs.Document{
 		Title:   "Invoice",
 		Created: "2026-01-15",
-		Reader:  strings.NewReader("pdf-data"),
+		Open:    jobs.BytesSource([]byte("pdf-data")),
 	}
 
 	if err := h.Send(context.Background(), doc); err != nil {
@@ -130,8 +134,8 @@ func TestPaperlessConsumeHandlerPathTraversal(t *testing.T) {
 	h := NewPaperlessConsumeHandler(config.PaperlessConsumeConfig{Path: dir})
 
 	doc := &jobs.Document{
-		Title:  "../../etc/passwd",
-		Reader: strings.NewReader("data"),
+		Title: "../../etc/passwd",
+		Open:  jobs.BytesSource([]byte("data")),
 	}
 
 	if err := h.Send(context.Background(), doc); err != nil {
@@ -155,6 +159,15 @@ func TestSMBHandlerName(t *testing.T) {
 	}
 }
 
+func TestSMBHandlerLegacyPattern(t *testing.T) {
+	h := NewSMBHandler(config.SMBConfig{
+		NamingConfig: config.NamingConfig{FilenamePattern: "{date}-{time}_{title}_{date:YYYY}"},
+	})
+	if want := "{date:YYYYMMDD}-{time:HHmmss}_{title}_{date:YYYY}"; h.naming.Pattern != want {
+		t.Fatalf("pattern = %q, want %q", h.naming.Pattern, want)
+	}
+}
+
 func TestSMBHandlerAvailable(t *testing.T) {
 	h := NewSMBHandler(config.SMBConfig{Server: "nas.local", Share: "scans"})
 	if !h.Available() {
@@ -192,6 +205,10 @@ func TestEmailHandlerAvailable(t *testing.T) {
 
 func TestManagerListTargets(t *testing.T) {
 	m := NewManager(config.OutputConfig{
+		Filesystem: config.FilesystemConfig{
+			Enabled:          true,
+			FilesystemTarget: config.FilesystemTarget{Directory: t.TempDir()},
+		},
 		Paperless: config.PaperlessConfig{Enabled: true, URL: "http://localhost", Token: "tok"},
 	})
 
@@ -221,7 +238,7 @@ func TestManagerSendToFilesystem(t *testing.T) {
 
 	doc := &jobs.Document{
 		Filename: "test.pdf",
-		Reader:   strings.NewReader("pdf-content"),
+		Open:     jobs.BytesSource([]byte("pdf-content")),
 	}
 
 	if err := m.Send(context.Background(), "filesystem", doc); err != nil {
@@ -236,3 +253,145 @@ func TestManagerSendToFilesystem(t *testing.T) {
 		t.Fatalf("unexpected content: %s", string(data))
 	}
 }
+
+func TestManagerFilesystemDestinations(t *testing.T) {
+	m := NewManager(config.OutputConfig{
+		Filesystem: config.FilesystemConfig{
+			Destinations: map[string]config.FilesystemTarget{
+				"archive": {Directory: t.TempDir()},
+			},
+		},
+	})
+
+	targets := m.ListTargets()
+	if len(targets) != 1 {
+		t.Fatalf("expected only the archive destination, got %+v", targets)
+	}
+	if targets[0].Name != "archive" || targets[0].Type != "filesystem" {
+		t.Fatalf("expected archive filesystem target, got %+v", targets[0])
+	}
+}
+
+func TestManagerNamedInstances(t *testing.T) {
+	m := NewManager(config.OutputConfig{
+		Instances: []config.OutputInstance{
+			{Name: "smb-accounting", Type: "smb", SMB: &config.SMBConfig{Server: "nas", Share: "accounting"}},
+			{Name: "smb-legal", Type: "smb", SMB: &config.SMBConfig{Server: "nas", Share: "legal"}},
+			{Name: "broken", Type: "smb"},
+		},
+	})
+
+	targets := m.ListTargets()
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets, got %+v", targets)
+	}
+	for i, name := range []string{"smb-accounting", "smb-legal"} {
+		if targets[i].Name != name || targets[i].Type != "smb" {
+			t.Errorf("target %d = %+v, want %s of type smb", i, targets[i], name)
+		}
+	}
+	if !m.Has("smb-legal") || m.Has("smb") {
+		t.Error("expected targets to be looked up by instance name")
+	}
+}
+
+func TestManagerSendAll(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	flaky := &failNTimesHandler{name: "flaky", failures: 1}
+	m := &Manager{handlers: map[string]Handler{
+		"a":     NewFilesystemHandler(dirA),
+		"b":     NewFilesystemHandler(dirB),
+		"flaky": flaky,
+	}}
+
+	src := filepath.Join(t.TempDir(), "doc.pdf")
+	os.WriteFile(src, []byte("pdf-content"), 0o644)
+	doc := &jobs.Document{Filename: "doc.pdf", Open: jobs.FileSource(src), Size: 11}
+
+	var mu sync.Mutex
+	var updates []jobs.Delivery
+	results := m.SendAll(context.Background(), doc, []jobs.OutputTarget{
+		{Name: "a"}, {Name: "b"}, {Name: "flaky"}, {Name: "missing", Optional: true},
+	}, func(d jobs.Delivery) {
+		mu.Lock()
+		updates = append(updates, d)
+		mu.Unlock()
+	})
+
+	for _, dir := range []string{dirA, dirB} {
+		data, err := os.ReadFile(filepath.Join(dir, "doc.pdf"))
+		if err != nil || string(data) != "pdf-content" {
+			t.Errorf("%s: expected full document, got %q (%v)", dir, data, err)
+		}
+	}
+
+	want := map[string]jobs.DeliveryStatus{"a": jobs.DeliveryDelivered, "b": jobs.DeliveryDelivered, "flaky": jobs.DeliveryDelivered, "missing": jobs.DeliveryFailed}
+	for i, r := range results {
+		if want[r.Target] != r.Status {
+			t.Errorf("result %d: %s = %s, want %s", i, r.Target, r.Status, want[r.Target])
+		}
+	}
+	if results[2].Attempts != 2 {
+		t.Errorf("expected 2 attempts for flaky target, got %d", results[2].Attempts)
+	}
+	if results[3].Required || results[3].Error == "" {
+		t.Errorf("expected optional failure with error, got %+v", results[3])
+	}
+	if len(updates) < len(results) {
+		t.Errorf("expected progress updates for every target, got %d", len(updates))
+	}
+}
+
+// rereadHandler reads the document and fails on its first attempt, then
+// records the content it reads on the next one.
+type rereadHandler struct {
+	calls int
+	got   string
+}
+
+func (h *rereadHandler) Name() string    { return "reread" }
+func (h *rereadHandler) Available() bool { return true }
+func (h *rereadHandler) Send(_ context.Context, doc *jobs.Document) error {
+	h.calls++
+	var buf bytes.Buffer
+	if _, err := copyDocument(&buf, doc); err != nil {
+		return err
+	}
+	if h.calls == 1 {
+		return fmt.Errorf("connection reset")
+	}
+	h.got = buf.String()
+	return nil
+}
+
+// trackingCloser counts open readers of a document.
+type trackingCloser struct {
+	io.Reader
+	open *int
+}
+
+func (c trackingCloser) Close() error {
+	*c.open--
+	return nil
+}
+
+func TestManagerSendRetryReadsWholeDocument(t *testing.T) {
+	h := &rereadHandler{}
+	m := &Manager{handlers: map[string]Handler{"reread": h}}
+
+	open := 0
+	doc := &jobs.Document{Filename: "doc.pdf", Open: func() (io.ReadCloser, error) {
+		open++
+		return trackingCloser{strings.NewReader("pdf-content"), &open}, nil
+	}}
+
+	if err := m.Send(context.Background(), "reread", doc); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if h.calls != 2 || h.got != "pdf-content" {
+		t.Fatalf("expected full document on retry, got %q after %d calls", h.got, h.calls)
+	}
+	if open != 0 {
+		t.Fatalf("expected every reader to be closed, %d still open", open)
+	}
+}
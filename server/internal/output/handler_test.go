@@ -1,7 +1,6 @@
 package output
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -44,7 +43,7 @@ func TestFilesystemHandlerSend(t *testing.T) {
 
 	doc := &jobs.Document{
 		Filename: "scan.pdf",
-		Reader:   strings.NewReader("pdf-data"),
+		Open:     jobs.BytesSource([]byte("pdf-data")),
 	}
 
 	if err := handler.Send(context.Background(), doc); err != nil {
@@ -69,6 +68,10 @@ func TestPaperlessHandlerSendIncludesMetadata(t *testing.T) {
 	)
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tasks/" {
+			_, _ = w.Write([]byte(`[{"task_id":"task-123","status":"SUCCESS","related_document":"7"}]`))
+			return
+		}
 		authHeader = r.Header.Get("Authorization")
 		contentType = r.Header.Get("Content-Type")
 
@@ -121,7 +124,7 @@ func TestPaperlessHandlerSendIncludesMetadata(t *testing.T) {
 		DocumentType:  3,
 		Tags:          []int{1, 2},
 		ArchiveSerial: "ARC-42",
-		Reader:        bytes.NewBufferString("document-bytes"),
+		Open:          jobs.BytesSource([]byte("document-bytes")),
 	}
 
 	if err := handler.Send(context.Background(), doc); err != nil {
@@ -163,7 +166,7 @@ func TestFilesystemHandlerPathTraversal(t *testing.T) {
 
 	doc := &jobs.Document{
 		Filename: "../../etc/passwd",
-		Reader:   strings.NewReader("should-not-escape"),
+		Open:     jobs.BytesSource([]byte("should-not-escape")),
 	}
 
 	if err := handler.Send(context.Background(), doc); err != nil {
@@ -228,6 +231,10 @@ func TestManagerSendRetriesExhausted(t *testing.T) {
 func TestPaperlessHandlerSendSuccess(t *testing.T) {
 	// Create a mock Paperless-NGX server that accepts uploads
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tasks/" {
+			json.NewEncoder(w).Encode([]map[string]string{{"status": "SUCCESS"}})
+			return
+		}
 		if r.Method != "POST" {
 			t.Errorf("expected POST, got %s", r.Method)
 		}
@@ -258,7 +265,7 @@ func TestPaperlessHandlerSendSuccess(t *testing.T) {
 	doc := &jobs.Document{
 		Filename: "test.pdf",
 		Title:    "Test Document",
-		Reader:   strings.NewReader("fake pdf content"),
+		Open:     jobs.BytesSource([]byte("fake pdf content")),
 		Size:     16,
 	}
 	err := handler.Send(context.Background(), doc)
@@ -281,7 +288,7 @@ func TestPaperlessHandlerSendServerError(t *testing.T) {
 
 	doc := &jobs.Document{
 		Filename: "test.pdf",
-		Reader:   strings.NewReader("fake pdf"),
+		Open:     jobs.BytesSource([]byte("fake pdf")),
 		Size:     8,
 	}
 	err := handler.Send(context.Background(), doc)
@@ -345,7 +352,7 @@ func TestFilesystemHandlerConcurrentWrites(t *testing.T) {
 			defer wg.Done()
 			doc := &jobs.Document{
 				Filename: fmt.Sprintf("doc_%d.pdf", n),
-				Reader:   strings.NewReader(fmt.Sprintf("content %d", n)),
+				Open:     jobs.BytesSource([]byte(fmt.Sprintf("content %d", n))),
 				Size:     9,
 			}
 			if err := handler.Send(context.Background(), doc); err != nil {
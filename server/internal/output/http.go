@@ -0,0 +1,283 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// Names of response fields that fill the dedicated DeliveryResult fields.
+const (
+	resultDocumentID = "document_id"
+	resultURL        = "url"
+)
+
+// HTTPHandler sends documents to a webhook, e.g. a document management
+// system without a dedicated handler.
+type HTTPHandler struct {
+	url            string
+	method         string
+	raw            bool
+	fileField      string
+	headers        map[string]string
+	secretHeaders  map[string]string
+	fields         map[string]string
+	hmacSecret     []byte
+	hmacHeader     string
+	successCodes   []int
+	responseFields map[string]string
+	client         *http.Client
+	naming         Naming
+	now            func() time.Time
+	secretErr      error // reading a header or HMAC secret file failed
+}
+
+// NewHTTPHandler creates a new webhook output handler.
+func NewHTTPHandler(cfg config.HTTPConfig) *HTTPHandler {
+	var secretErr error
+	secretHeaders := make(map[string]string, len(cfg.HeaderFiles))
+	for name, file := range cfg.HeaderFiles {
+		value, err := readSecretFile(file)
+		if err != nil {
+			secretErr = errors.Join(secretErr, fmt.Errorf("header %s: %w", name, err))
+			continue
+		}
+		secretHeaders[name] = value
+	}
+	secret, err := readSecretFile(cfg.HMACSecretFile)
+	if err != nil {
+		secretErr = errors.Join(secretErr, fmt.Errorf("hmac secret: %w", err))
+	}
+
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	fileField := cfg.FileField
+	if fileField == "" {
+		fileField = "document"
+	}
+	hmacHeader := cfg.HMACHeader
+	if hmacHeader == "" {
+		hmacHeader = "X-Scanflow-Signature"
+	}
+
+	return &HTTPHandler{
+		url:            cfg.URL,
+		method:         method,
+		raw:            cfg.Body == "raw",
+		fileField:      fileField,
+		headers:        cfg.Headers,
+		secretHeaders:  secretHeaders,
+		fields:         cfg.Fields,
+		hmacSecret:     []byte(secret),
+		hmacHeader:     hmacHeader,
+		successCodes:   cfg.SuccessCodes,
+		responseFields: cfg.ResponseFields,
+		client:         &http.Client{Timeout: cfg.RequestTimeout()},
+		naming:         NewNaming(cfg.NamingConfig, SanitizePOSIX),
+		now:            time.Now,
+		secretErr:      secretErr,
+	}
+}
+
+func (h *HTTPHandler) Name() string { return "http" }
+
+func (h *HTTPHandler) Available() bool {
+	return h.url != "" && h.secretErr == nil
+}
+
+func (h *HTTPHandler) Send(ctx context.Context, doc *jobs.Document) error {
+	_, err := h.SendWithResult(ctx, doc)
+	return err
+}
+
+// SendWithResult sends the document and extracts the configured response
+// fields. A missing field is logged; the document has been delivered.
+func (h *HTTPHandler) SendWithResult(ctx context.Context, doc *jobs.Document) (*jobs.DeliveryResult, error) {
+	// Never send a request without its credentials or signature.
+	if h.secretErr != nil {
+		return nil, Permanent(fmt.Errorf("http secrets: %w", h.secretErr))
+	}
+	filename := h.naming.Filename(doc)
+	body, contentType, err := h.buildBody(doc, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, h.method, h.naming.expandURL(h.url, doc, filename), bytes.NewReader(body))
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("create request: %w", err))
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range h.headers {
+		req.Header.Set(name, h.naming.expand(value, doc, filename))
+	}
+	for name, value := range h.secretHeaders {
+		req.Header.Set(name, value)
+	}
+	if len(h.hmacSecret) > 0 {
+		ts := strconv.FormatInt(h.now().Unix(), 10)
+		req.Header.Set("X-Scanflow-Timestamp", ts)
+		req.Header.Set(h.hmacHeader, "sha256="+signHMAC(h.hmacSecret, ts, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http %s: %w", h.method, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if !h.success(resp.StatusCode) {
+		err := fmt.Errorf("http %s %s: %s: %s", h.method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(data)))
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, Permanent(err)
+		}
+		return nil, err
+	}
+	return h.result(data), nil
+}
+
+// buildBody returns the request body: the document itself, or a multipart
+// form with the configured fields followed by the document.
+func (h *HTTPHandler) buildBody(doc *jobs.Document, filename string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if h.raw {
+		if _, err := copyDocument(&buf, doc); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/pdf", nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	names := make([]string, 0, len(h.fields))
+	for name := range h.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := mw.WriteField(name, h.naming.expand(h.fields[name], doc, filename)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", multipart.FileContentDisposition(h.fileField, filename))
+	header.Set("Content-Type", "application/pdf")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := copyDocument(part, doc); err != nil {
+		return nil, "", err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mw.FormDataContentType(), nil
+}
+
+func (h *HTTPHandler) success(code int) bool {
+	if len(h.successCodes) == 0 {
+		return code >= 200 && code <= 299
+	}
+	return slices.Contains(h.successCodes, code)
+}
+
+// result extracts the configured fields from a JSON response.
+func (h *HTTPHandler) result(data []byte) *jobs.DeliveryResult {
+	if len(h.responseFields) == 0 {
+		return nil
+	}
+	var body any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		slog.Warn("webhook response is not JSON", "url", h.url, "error", err)
+		return nil
+	}
+
+	result := &jobs.DeliveryResult{}
+	for name, path := range h.responseFields {
+		value, ok := jsonPath(body, path)
+		if !ok {
+			slog.Warn("webhook response field missing", "url", h.url, "field", name, "path", path)
+			continue
+		}
+		switch name {
+		case resultDocumentID:
+			result.DocumentID = value
+		case resultURL:
+			result.URL = value
+		default:
+			if result.Fields == nil {
+				result.Fields = make(map[string]string)
+			}
+			result.Fields[name] = value
+		}
+	}
+	return result
+}
+
+// jsonPath looks up a dot-separated path such as "data.items.0.id" in a
+// decoded JSON value and returns it as a string.
+func jsonPath(v any, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	case nil:
+		return "", false
+	default:
+		data, _ := json.Marshal(value)
+		return string(data), true
+	}
+}
+
+// signHMAC returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func signHMAC(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
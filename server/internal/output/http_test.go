@@ -0,0 +1,205 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+func webhookDoc() *jobs.Document {
+	content := []byte("%PDF-1.7 invoice")
+	return &jobs.Document{
+		JobID:             "job-1",
+		Title:             "Invoice 42",
+		CorrespondentName: "ACME",
+		Tags:              []int{3},
+		TagNames:          []string{"Steuer"},
+		Open:              jobs.BytesSource(content),
+		Size:              int64(len(content)),
+		ScannedAt:         time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestHTTPMultipartWithSignature(t *testing.T) {
+	var got *http.Request
+	var form map[string]string
+	var file string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		form = map[string]string{}
+		for k, v := range r.MultipartForm.Value {
+			form[k] = v[0]
+		}
+		f, hdr, err := r.FormFile("upload")
+		if err == nil {
+			data, _ := io.ReadAll(f)
+			file = hdr.Filename + ":" + string(data)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"data": {"id": 1234, "links": {"self": "https://dms.local/doc/1234"}, "versions": [{"rev": "a1"}]}}`)
+	}))
+	defer srv.Close()
+
+	h := NewHTTPHandler(config.HTTPConfig{
+		NamingConfig:   config.NamingConfig{FilenamePattern: "{title}"},
+		URL:            srv.URL + "/api/{correspondent}/documents",
+		FileField:      "upload",
+		Headers:        map[string]string{"X-Job": "{job_id}"},
+		HeaderFiles:    map[string]string{"Authorization": writeSecret(t, "Bearer tok")},
+		Fields:         map[string]string{"title": "{title}", "tags": "{tags}"},
+		HMACSecretFile: writeSecret(t, "hook-secret"),
+		ResponseFields: map[string]string{"document_id": "data.id", "url": "data.links.self", "revision": "data.versions.0.rev"},
+	})
+	h.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	result, err := h.SendWithResult(context.Background(), webhookDoc())
+	if err != nil {
+		t.Fatalf("SendWithResult: %v", err)
+	}
+
+	if got.Method != http.MethodPost || got.URL.Path != "/api/ACME/documents" {
+		t.Errorf("unexpected request %s %s", got.Method, got.URL.Path)
+	}
+	if got.Header.Get("X-Job") != "job-1" || got.Header.Get("Authorization") != "Bearer tok" {
+		t.Errorf("unexpected headers %v", got.Header)
+	}
+	if form["title"] != "Invoice 42" || form["tags"] != "3,Steuer" {
+		t.Errorf("unexpected form fields %v", form)
+	}
+	if file != "Invoice 42.pdf:%PDF-1.7 invoice" {
+		t.Errorf("unexpected file part %q", file)
+	}
+
+	if ts := got.Header.Get("X-Scanflow-Timestamp"); ts != "1700000000" {
+		t.Errorf("unexpected timestamp %q", ts)
+	}
+	if sig := got.Header.Get("X-Scanflow-Signature"); sig != "sha256="+signHMAC([]byte("hook-secret"), "1700000000", body) {
+		t.Errorf("signature does not match body: %q", sig)
+	}
+
+	if result.DocumentID != "1234" || result.URL != "https://dms.local/doc/1234" || result.Fields["revision"] != "a1" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestHTTPRawPutSuccessCodes(t *testing.T) {
+	status := http.StatusOK
+	var contentType, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		contentType = r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	h := NewHTTPHandler(config.HTTPConfig{
+		URL:          srv.URL + "/inbox/{filename}",
+		Method:       "put",
+		Body:         "raw",
+		SuccessCodes: []int{201},
+	})
+
+	if err := h.Send(context.Background(), webhookDoc()); err == nil || errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected a retryable error for 200, got %v", err)
+	}
+	status = http.StatusCreated
+	if err := h.Send(context.Background(), webhookDoc()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if contentType != "application/pdf" || body != "%PDF-1.7 invoice" {
+		t.Errorf("unexpected raw body %q (%s)", body, contentType)
+	}
+}
+
+func TestHTTPUnauthorizedIsPermanent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	h := NewHTTPHandler(config.HTTPConfig{URL: srv.URL})
+	err := h.Send(context.Background(), webhookDoc())
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "bad token") {
+		t.Fatalf("expected permanent 401 error, got %v", err)
+	}
+}
+
+func TestHTTPEscapesURLValues(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer srv.Close()
+
+	h := NewHTTPHandler(config.HTTPConfig{
+		NamingConfig: config.NamingConfig{FilenamePattern: "{title}"},
+		URL:          srv.URL + "/docs/{title}?name={filename}&who={correspondent}",
+	})
+	doc := webhookDoc()
+	doc.Title = "Q1 ?draft#2"
+	doc.CorrespondentName = "A&B=C"
+	if err := h.Send(context.Background(), doc); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got.URL.Path != "/docs/Q1 ?draft#2" {
+		t.Errorf("path = %q", got.URL.Path)
+	}
+	q := got.URL.Query()
+	if q.Get("name") != "Q1 ?draft#2.pdf" || q.Get("who") != "A&B=C" || len(q) != 2 {
+		t.Errorf("query = %v", q)
+	}
+}
+
+func TestHTTPUnreadableSecretFile(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	for name, cfg := range map[string]config.HTTPConfig{
+		"hmac":   {URL: srv.URL, HMACSecretFile: filepath.Join(t.TempDir(), "missing")},
+		"header": {URL: srv.URL, HeaderFiles: map[string]string{"Authorization": filepath.Join(t.TempDir(), "missing")}},
+	} {
+		h := NewHTTPHandler(cfg)
+		if h.Available() {
+			t.Errorf("%s: handler with an unreadable secret file must not be available", name)
+		}
+		if err := h.Send(context.Background(), webhookDoc()); !errors.Is(err, ErrPermanent) {
+			t.Errorf("%s: Send = %v, want a permanent error", name, err)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("sent %d requests without their secrets", requests)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	var v any = map[string]any{"a": []any{map[string]any{"b": true}}, "n": nil}
+	for path, want := range map[string]string{"a.0.b": "true", "a.1.b": "", "n": "", "x": ""} {
+		got, ok := jsonPath(v, path)
+		if got != want || ok != (want != "") {
+			t.Errorf("jsonPath(%q) = %q, %v", path, got, ok)
+		}
+	}
+}
@@ -0,0 +1,539 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// IPP operations, attribute group tags and value tags (RFC 8010, 8011).
+const (
+	ippPrintJob             = 0x0002
+	ippGetJobAttributes     = 0x0009
+	ippGetPrinterAttributes = 0x000b
+	ippOperationGroup       = 0x01
+	ippJobGroup             = 0x02
+	ippEndOfAttributes      = 0x03
+	ippPrinterGroup         = 0x04
+	ippTagInteger           = 0x21
+	ippTagBoolean           = 0x22
+	ippTagEnum              = 0x23
+	ippTagName              = 0x42
+	ippTagKeyword           = 0x44
+	ippTagURI               = 0x45
+	ippTagCharset           = 0x47
+	ippTagLanguage          = 0x48
+	ippTagMimeMediaType     = 0x49
+	ippStatusClientError    = 0x0400
+	ippStatusServerError    = 0x0500
+)
+
+// Terminal job states; other states mean the job is pending or printing.
+const (
+	ippJobCanceled  = 7
+	ippJobAborted   = 8
+	ippJobCompleted = 9
+)
+
+// IPPHandler prints documents on an IPP printer and waits until the print
+// job has completed.
+type IPPHandler struct {
+	printerURI   string // ipp:// or ipps:// URI sent as printer-uri
+	endpoint     string // http:// or https:// URL the requests are posted to
+	username     string
+	password     string
+	defaults     jobs.PrintOptions
+	pollInterval time.Duration
+	timeout      time.Duration
+	client       *http.Client
+	naming       Naming
+	requestID    atomic.Uint32
+}
+
+// NewIPPHandler creates a new IPP printer output handler.
+func NewIPPHandler(cfg config.IPPConfig) *IPPHandler {
+	password := ""
+	if cfg.PasswordFile != "" {
+		data, err := os.ReadFile(cfg.PasswordFile)
+		if err == nil {
+			password = strings.TrimSpace(string(data))
+		}
+	}
+	printerURI, endpoint := ippURLs(cfg.URL)
+
+	return &IPPHandler{
+		printerURI: printerURI,
+		endpoint:   endpoint,
+		username:   cfg.Username,
+		password:   password,
+		defaults: jobs.PrintOptions{
+			Copies:    cfg.Copies,
+			Sides:     cfg.Sides,
+			Media:     cfg.Media,
+			ColorMode: cfg.ColorMode,
+		},
+		pollInterval: cfg.JobPollInterval(),
+		timeout:      cfg.JobTimeout(),
+		client:       &http.Client{Timeout: 5 * time.Minute},
+		naming:       NewNaming(config.NamingConfig{}, SanitizePOSIX),
+	}
+}
+
+// ippURLs returns the printer URI and the HTTP URL of a printer given as
+// ipp://, ipps://, http:// or https:// URL. IPP URLs default to port 631.
+func ippURLs(raw string) (printerURI, endpoint string) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", ""
+	}
+	p, h := *u, *u
+	switch u.Scheme {
+	case "ipp", "ipps":
+		if u.Port() == "" {
+			p.Host = net.JoinHostPort(u.Hostname(), "631")
+			h.Host = p.Host
+		}
+		h.Scheme = "http"
+		if u.Scheme == "ipps" {
+			h.Scheme = "https"
+		}
+	case "http":
+		p.Scheme = "ipp"
+	case "https":
+		p.Scheme = "ipps"
+	default:
+		return "", ""
+	}
+	return p.String(), h.String()
+}
+
+func (h *IPPHandler) Name() string { return "ipp" }
+
+func (h *IPPHandler) Available() bool {
+	return h.endpoint != ""
+}
+
+func (h *IPPHandler) Send(ctx context.Context, doc *jobs.Document) error {
+	_, err := h.SendWithResult(ctx, doc)
+	return err
+}
+
+// SendWithResult submits a print job and polls its state until it has
+// completed. Once the document has been sent, failures are permanent so
+// that a retry does not print it twice.
+func (h *IPPHandler) SendWithResult(ctx context.Context, doc *jobs.Document) (*jobs.DeliveryResult, error) {
+	if doc.Open == nil {
+		return nil, fmt.Errorf("document has no content")
+	}
+	opts := h.printOptions(doc)
+
+	req := h.newRequest(ippPrintJob)
+	op := req.group(ippOperationGroup)
+	jobName := doc.Title
+	if jobName == "" {
+		jobName = strings.TrimSuffix(h.naming.Filename(doc), ".pdf")
+	}
+	op.add(ippTagName, "job-name", jobName)
+	op.add(ippTagMimeMediaType, "document-format", "application/pdf")
+	job := req.group(ippJobGroup)
+	if opts.Copies > 0 {
+		job.add(ippTagInteger, "copies", opts.Copies)
+	}
+	if opts.Sides != "" {
+		job.add(ippTagKeyword, "sides", opts.Sides)
+	}
+	if opts.Media != "" {
+		job.add(ippTagKeyword, "media", opts.Media)
+	}
+	if opts.ColorMode != "" {
+		job.add(ippTagKeyword, "print-color-mode", opts.ColorMode)
+	}
+
+	r, err := doc.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open document: %w", err)
+	}
+	defer r.Close()
+
+	body := &sentReader{r: r}
+	resp, err := h.do(ctx, req, body)
+	if err != nil {
+		err = fmt.Errorf("IPP print job: %w", err)
+		if body.sent.Load() {
+			// The printer may have accepted the job; a retry could print
+			// the document twice.
+			return nil, Permanent(err)
+		}
+		return nil, err
+	}
+	id, ok := resp.intValue(ippJobGroup, "job-id")
+	if !ok {
+		// Without a job ID the state cannot be followed.
+		return &jobs.DeliveryResult{}, nil
+	}
+	slog.Info("print job submitted", "printer", h.printerURI, "ipp_job_id", id, "job_id", doc.JobID)
+
+	if err := h.waitForJob(ctx, id); err != nil {
+		return nil, Permanent(fmt.Errorf("IPP job %d: %w", id, err))
+	}
+	return &jobs.DeliveryResult{DocumentID: strconv.Itoa(id)}, nil
+}
+
+// sentReader records whether the document has been read to the end into
+// the request body.
+type sentReader struct {
+	r    io.Reader
+	sent atomic.Bool
+}
+
+func (s *sentReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err == io.EOF {
+		s.sent.Store(true)
+	}
+	return n, err
+}
+
+// printOptions returns the output's defaults overridden by the profile.
+func (h *IPPHandler) printOptions(doc *jobs.Document) jobs.PrintOptions {
+	opts := h.defaults
+	if p := doc.Print; p != nil {
+		if p.Copies > 0 {
+			opts.Copies = p.Copies
+		}
+		if p.Sides != "" {
+			opts.Sides = p.Sides
+		}
+		if p.Media != "" {
+			opts.Media = p.Media
+		}
+		if p.ColorMode != "" {
+			opts.ColorMode = p.ColorMode
+		}
+	}
+	return opts
+}
+
+// waitForJob polls the job state until the job has completed, failed or
+// the timeout has passed. Errors while polling are retried.
+func (h *IPPHandler) waitForJob(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	ticker := time.NewTicker(h.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		req := h.newRequest(ippGetJobAttributes)
+		op := req.group(ippOperationGroup)
+		op.add(ippTagInteger, "job-id", id)
+		op.add(ippTagKeyword, "requested-attributes", "job-state", "job-state-reasons", "job-state-message")
+
+		resp, err := h.do(ctx, req, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("not completed within %s", h.timeout)
+			}
+			slog.Warn("IPP job state unavailable", "ipp_job_id", id, "error", err)
+		} else {
+			state, _ := resp.intValue(ippJobGroup, "job-state")
+			switch state {
+			case ippJobCompleted:
+				return nil
+			case ippJobCanceled, ippJobAborted:
+				reasons := resp.stringValues(ippJobGroup, "job-state-reasons")
+				if msg := resp.stringValues(ippJobGroup, "job-state-message"); len(msg) > 0 {
+					reasons = append(reasons, msg...)
+				}
+				what := "canceled"
+				if state == ippJobAborted {
+					what = "aborted"
+				}
+				return fmt.Errorf("%s by the printer: %s", what, strings.Join(reasons, ", "))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not completed within %s", h.timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// ippPrinterStopped is the printer-state of a printer that cannot print.
+const ippPrinterStopped = 5
+
+// Test queries the printer state and fails when the printer is stopped or
+// does not accept jobs.
+func (h *IPPHandler) Test(ctx context.Context) error {
+	req := h.newRequest(ippGetPrinterAttributes)
+	req.group(ippOperationGroup).add(ippTagKeyword, "requested-attributes",
+		"printer-state", "printer-state-reasons", "printer-is-accepting-jobs")
+	resp, err := h.do(ctx, req, nil)
+	if err != nil {
+		return fmt.Errorf("IPP Get-Printer-Attributes: %w", err)
+	}
+	reasons := strings.Join(resp.stringValues(ippPrinterGroup, "printer-state-reasons"), ", ")
+	if state, _ := resp.intValue(ippPrinterGroup, "printer-state"); state == ippPrinterStopped {
+		return fmt.Errorf("printer is stopped (%s)", reasons)
+	}
+	if attr, ok := resp.attr(ippPrinterGroup, "printer-is-accepting-jobs"); ok && len(attr.Values) > 0 && attr.Values[0] == false {
+		return fmt.Errorf("printer is not accepting jobs (%s)", reasons)
+	}
+	return nil
+}
+
+// newRequest creates a request with the operation attributes every
+// request carries.
+func (h *IPPHandler) newRequest(operation uint16) *ippMessage {
+	req := &ippMessage{Code: operation, RequestID: h.requestID.Add(1)}
+	op := req.group(ippOperationGroup)
+	op.add(ippTagCharset, "attributes-charset", "utf-8")
+	op.add(ippTagLanguage, "attributes-natural-language", "en")
+	op.add(ippTagURI, "printer-uri", h.printerURI)
+	user := h.username
+	if user == "" {
+		user = "scanflow"
+	}
+	op.add(ippTagName, "requesting-user-name", user)
+	return req
+}
+
+// do posts an IPP request followed by data, if any, and decodes the
+// response. Client errors are permanent.
+func (h *IPPHandler) do(ctx context.Context, req *ippMessage, data io.Reader) (*ippMessage, error) {
+	var body io.Reader = bytes.NewReader(req.encode())
+	if data != nil {
+		body = io.MultiReader(body, data)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/ipp")
+	if h.username != "" && h.password != "" {
+		httpReq.SetBasicAuth(h.username, h.password)
+	}
+
+	httpResp, err := h.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("HTTP %s", httpResp.Status)
+		if httpResp.StatusCode == http.StatusUnauthorized || httpResp.StatusCode == http.StatusForbidden {
+			return nil, Permanent(err)
+		}
+		return nil, err
+	}
+
+	resp, err := decodeIPP(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if resp.Code >= ippStatusClientError {
+		err := fmt.Errorf("status 0x%04x", resp.Code)
+		if msg := resp.stringValues(ippOperationGroup, "status-message"); len(msg) > 0 {
+			err = fmt.Errorf("status 0x%04x: %s", resp.Code, msg[0])
+		}
+		if resp.Code < ippStatusServerError {
+			return nil, Permanent(err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ippMessage is an IPP request or response. Code is the operation ID of a
+// request or the status code of a response.
+type ippMessage struct {
+	Code      uint16
+	RequestID uint32
+	Groups    []*ippGroup
+}
+
+type ippGroup struct {
+	Tag   byte
+	Attrs []ippAttribute
+}
+
+// ippAttribute holds int values for integer and enum tags, bool for
+// boolean and string for all other tags.
+type ippAttribute struct {
+	Tag    byte
+	Name   string
+	Values []any
+}
+
+// group returns the first group with tag, adding it if necessary.
+func (m *ippMessage) group(tag byte) *ippGroup {
+	for _, g := range m.Groups {
+		if g.Tag == tag {
+			return g
+		}
+	}
+	g := &ippGroup{Tag: tag}
+	m.Groups = append(m.Groups, g)
+	return g
+}
+
+func (g *ippGroup) add(tag byte, name string, values ...any) {
+	g.Attrs = append(g.Attrs, ippAttribute{Tag: tag, Name: name, Values: values})
+}
+
+func (m *ippMessage) attr(group byte, name string) (ippAttribute, bool) {
+	for _, g := range m.Groups {
+		if g.Tag != group {
+			continue
+		}
+		for _, a := range g.Attrs {
+			if a.Name == name {
+				return a, true
+			}
+		}
+	}
+	return ippAttribute{}, false
+}
+
+func (m *ippMessage) intValue(group byte, name string) (int, bool) {
+	a, ok := m.attr(group, name)
+	if !ok || len(a.Values) == 0 {
+		return 0, false
+	}
+	v, ok := a.Values[0].(int)
+	return v, ok
+}
+
+func (m *ippMessage) stringValues(group byte, name string) []string {
+	a, _ := m.attr(group, name)
+	var values []string
+	for _, v := range a.Values {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// encode returns the message in IPP/2.0 wire format.
+func (m *ippMessage) encode() []byte {
+	var b bytes.Buffer
+	b.Write([]byte{2, 0})
+	binary.Write(&b, binary.BigEndian, m.Code)
+	binary.Write(&b, binary.BigEndian, m.RequestID)
+	for _, g := range m.Groups {
+		b.WriteByte(g.Tag)
+		for _, a := range g.Attrs {
+			for i, v := range a.Values {
+				name := a.Name
+				if i > 0 {
+					name = "" // additional value
+				}
+				b.WriteByte(a.Tag)
+				binary.Write(&b, binary.BigEndian, uint16(len(name)))
+				b.WriteString(name)
+				var value []byte
+				switch v := v.(type) {
+				case int:
+					value = binary.BigEndian.AppendUint32(nil, uint32(int32(v)))
+				case bool:
+					value = []byte{0}
+					if v {
+						value[0] = 1
+					}
+				case string:
+					value = []byte(v)
+				}
+				binary.Write(&b, binary.BigEndian, uint16(len(value)))
+				b.Write(value)
+			}
+		}
+	}
+	b.WriteByte(ippEndOfAttributes)
+	return b.Bytes()
+}
+
+var errIPPTruncated = errors.New("truncated IPP message")
+
+// decodeIPP reads an IPP message up to the end of its attributes.
+func decodeIPP(r io.Reader) (*ippMessage, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, errIPPTruncated
+	}
+	m := &ippMessage{
+		Code:      binary.BigEndian.Uint16(header[2:4]),
+		RequestID: binary.BigEndian.Uint32(header[4:8]),
+	}
+
+	var group *ippGroup
+	tag := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, tag); err != nil {
+			return nil, errIPPTruncated
+		}
+		switch {
+		case tag[0] == ippEndOfAttributes:
+			return m, nil
+		case tag[0] < 0x10:
+			group = &ippGroup{Tag: tag[0]}
+			m.Groups = append(m.Groups, group)
+			continue
+		case group == nil:
+			return nil, fmt.Errorf("attribute outside of a group")
+		}
+
+		name, err := readIPPString(r)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := readIPPString(r)
+		if err != nil {
+			return nil, err
+		}
+		var value any = raw
+		switch tag[0] {
+		case ippTagInteger, ippTagEnum:
+			if len(raw) == 4 {
+				value = int(int32(binary.BigEndian.Uint32([]byte(raw))))
+			}
+		case ippTagBoolean:
+			value = raw == "\x01"
+		}
+
+		if name == "" && len(group.Attrs) > 0 {
+			last := &group.Attrs[len(group.Attrs)-1]
+			last.Values = append(last.Values, value)
+			continue
+		}
+		group.Attrs = append(group.Attrs, ippAttribute{Tag: tag[0], Name: name, Values: []any{value}})
+	}
+}
+
+func readIPPString(r io.Reader) (string, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return "", errIPPTruncated
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", errIPPTruncated
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,211 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// fakePrinter is an IPP stand-in that accepts Print-Job and reports the
+// job states in states, one per Get-Job-Attributes request.
+type fakePrinter struct {
+	mu       sync.Mutex
+	status   uint16
+	states   []int
+	printJob *ippMessage
+	document string
+	polls    int
+	stopped  bool // printer-state reported by Get-Printer-Attributes
+}
+
+func newFakePrinter(t *testing.T, states ...int) (*fakePrinter, string) {
+	t.Helper()
+	p := &fakePrinter{states: states}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	return p, srv.URL
+}
+
+func (p *fakePrinter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeIPP(r.Body)
+	if err != nil || r.Header.Get("Content-Type") != "application/ipp" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	resp := &ippMessage{Code: p.status, RequestID: req.RequestID}
+	op := resp.group(ippOperationGroup)
+	op.add(ippTagCharset, "attributes-charset", "utf-8")
+	op.add(ippTagLanguage, "attributes-natural-language", "en")
+	if p.status >= ippStatusClientError {
+		op.add(0x41, "status-message", "document-format not supported")
+	} else {
+		switch req.Code {
+		case ippPrintJob:
+			data, _ := io.ReadAll(r.Body)
+			p.printJob, p.document = req, string(data)
+			resp.group(ippJobGroup).add(ippTagInteger, "job-id", 17)
+		case ippGetPrinterAttributes:
+			printer := resp.group(ippPrinterGroup)
+			if p.stopped {
+				printer.add(ippTagEnum, "printer-state", 5)
+				printer.add(ippTagKeyword, "printer-state-reasons", "media-jam-error")
+			} else {
+				printer.add(ippTagEnum, "printer-state", 3)
+				printer.add(ippTagKeyword, "printer-state-reasons", "none")
+			}
+			printer.add(ippTagBoolean, "printer-is-accepting-jobs", !p.stopped)
+		case ippGetJobAttributes:
+			state := p.states[min(p.polls, len(p.states)-1)]
+			p.polls++
+			job := resp.group(ippJobGroup)
+			job.add(ippTagEnum, "job-state", state)
+			job.add(ippTagKeyword, "job-state-reasons", "job-printing", "media-empty")
+		}
+	}
+	w.Header().Set("Content-Type", "application/ipp")
+	w.Write(resp.encode())
+}
+
+func TestIPPPrintWaitsForCompletion(t *testing.T) {
+	printer, base := newFakePrinter(t, 3, 5, 9)
+	h := NewIPPHandler(config.IPPConfig{
+		URL:       base + "/ipp/print",
+		Copies:    1,
+		Media:     "iso_a4_210x297mm",
+		ColorMode: "monochrome",
+	})
+	h.pollInterval = 5 * time.Millisecond
+
+	doc := &jobs.Document{
+		Title: "Kopie",
+		Open:  jobs.BytesSource([]byte("%PDF-1.7 copy")),
+		Size:  13,
+		Print: &jobs.PrintOptions{Copies: 2, Sides: "two-sided-long-edge"},
+	}
+	result, err := h.SendWithResult(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("SendWithResult: %v", err)
+	}
+	if result.DocumentID != "17" {
+		t.Errorf("expected IPP job ID 17, got %+v", result)
+	}
+	if printer.polls != 3 {
+		t.Errorf("expected 3 polls, got %d", printer.polls)
+	}
+	if printer.document != "%PDF-1.7 copy" {
+		t.Errorf("unexpected document %q", printer.document)
+	}
+
+	req := printer.printJob
+	if uri := req.stringValues(ippOperationGroup, "printer-uri"); len(uri) != 1 || !strings.HasPrefix(uri[0], "ipp://127.0.0.1:") {
+		t.Errorf("unexpected printer-uri %v", uri)
+	}
+	if name := req.stringValues(ippOperationGroup, "job-name"); len(name) != 1 || name[0] != "Kopie" {
+		t.Errorf("unexpected job-name %v", name)
+	}
+	if copies, _ := req.intValue(ippJobGroup, "copies"); copies != 2 {
+		t.Errorf("profile copies should override the default, got %d", copies)
+	}
+	for attr, want := range map[string]string{
+		"sides":            "two-sided-long-edge",
+		"media":            "iso_a4_210x297mm",
+		"print-color-mode": "monochrome",
+	} {
+		if got := req.stringValues(ippJobGroup, attr); len(got) != 1 || got[0] != want {
+			t.Errorf("%s = %v, want %q", attr, got, want)
+		}
+	}
+}
+
+func TestIPPAbortedJobIsPermanent(t *testing.T) {
+	_, base := newFakePrinter(t, 5, 8)
+	h := NewIPPHandler(config.IPPConfig{URL: base})
+	h.pollInterval = 5 * time.Millisecond
+
+	err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf")), Size: 3})
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "aborted") || !strings.Contains(err.Error(), "media-empty") {
+		t.Fatalf("expected permanent aborted error, got %v", err)
+	}
+}
+
+func TestIPPClientErrorIsPermanent(t *testing.T) {
+	printer, base := newFakePrinter(t, 9)
+	printer.status = 0x040a // client-error-document-format-not-supported
+	h := NewIPPHandler(config.IPPConfig{URL: base})
+
+	err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf")), Size: 3})
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected permanent client error, got %v", err)
+	}
+}
+
+func TestIPPFailureAfterDocumentSentIsPermanent(t *testing.T) {
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received <- string(data)
+		// Drop the connection as if the response timed out.
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer srv.Close()
+	h := NewIPPHandler(config.IPPConfig{URL: srv.URL})
+
+	err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("%PDF")), Size: 4})
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected a permanent error once the document was sent, got %v", err)
+	}
+	if data := <-received; !strings.HasSuffix(data, "%PDF") {
+		t.Errorf("printer did not receive the document: %q", data)
+	}
+
+	// Failures before the document was sent can be retried.
+	srv.Close()
+	err = h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("%PDF")), Size: 4})
+	if err == nil || errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected a retryable connection error, got %v", err)
+	}
+}
+
+func TestIPPURLs(t *testing.T) {
+	tests := []struct{ in, printer, endpoint string }{
+		{"ipp://printer.local/ipp/print", "ipp://printer.local:631/ipp/print", "http://printer.local:631/ipp/print"},
+		{"ipps://cups.local:8631/printers/office", "ipps://cups.local:8631/printers/office", "https://cups.local:8631/printers/office"},
+		{"http://cups.local:631/printers/office", "ipp://cups.local:631/printers/office", "http://cups.local:631/printers/office"},
+		{"lpd://printer.local/queue", "", ""},
+	}
+	for _, tt := range tests {
+		printer, endpoint := ippURLs(tt.in)
+		if printer != tt.printer || endpoint != tt.endpoint {
+			t.Errorf("ippURLs(%q) = %q, %q; want %q, %q", tt.in, printer, endpoint, tt.printer, tt.endpoint)
+		}
+	}
+}
+
+func TestIPPTestPrinterState(t *testing.T) {
+	printer, base := newFakePrinter(t, 9)
+	h := NewIPPHandler(config.IPPConfig{URL: base})
+	if err := h.Test(context.Background()); err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+	if printer.printJob != nil {
+		t.Fatal("Test must not print")
+	}
+
+	printer.stopped = true
+	if err := h.Test(context.Background()); err == nil || !strings.Contains(err.Error(), "media-jam-error") {
+		t.Fatalf("expected stopped printer error, got %v", err)
+	}
+}
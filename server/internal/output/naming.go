@@ -0,0 +1,329 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/pattern"
+)
+
+// DefaultFilenamePattern names documents like "Invoice_20261018_143000.pdf".
+const DefaultFilenamePattern = "{title}_{date:YYYYMMDD}_{time:HHmmss}"
+
+// SanitizeMode selects the character rules of the target filesystem.
+type SanitizeMode string
+
+const (
+	// SanitizePOSIX only removes path separators and control characters.
+	SanitizePOSIX SanitizeMode = "posix"
+	// SanitizeWindows also removes characters SMB/NTFS reject (<>:"\|?*),
+	// trailing dots and spaces, and reserved device names.
+	SanitizeWindows SanitizeMode = "windows"
+	// SanitizeStrict keeps only ASCII letters, digits, '-', '_' and '.'.
+	SanitizeStrict SanitizeMode = "strict"
+)
+
+// ConflictPolicy decides what happens when the target file already exists.
+type ConflictPolicy string
+
+const (
+	ConflictSuffix    ConflictPolicy = "suffix" // append _1, _2, ...
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictFail      ConflictPolicy = "fail"
+)
+
+// ErrFileExists is returned under the "fail" conflict policy.
+var ErrFileExists = errors.New("file already exists")
+
+// maxSuffix bounds the search for a free name under the suffix policy.
+const maxSuffix = 9999
+
+// Naming builds the relative path a document is stored under. Patterns may
+// contain "/" to file documents into subdirectories, e.g.
+// "{year}/{month}/{correspondent}/{title}_{date}".
+type Naming struct {
+	Pattern    string
+	Sanitize   SanitizeMode
+	OnConflict ConflictPolicy
+}
+
+// NewNaming creates the naming rules for an output, falling back to the
+// handler's default sanitize mode.
+func NewNaming(cfg config.NamingConfig, defaultSanitize SanitizeMode) Naming {
+	n := Naming{
+		Pattern:    cfg.FilenamePattern,
+		Sanitize:   SanitizeMode(cfg.Sanitize),
+		OnConflict: ConflictPolicy(cfg.OnConflict),
+	}
+	if n.Pattern == "" {
+		n.Pattern = DefaultFilenamePattern
+	}
+	if n.Sanitize == "" {
+		n.Sanitize = defaultSanitize
+	}
+	if n.OnConflict == "" {
+		n.OnConflict = ConflictSuffix
+	}
+	return n
+}
+
+// Path returns the slash-separated relative path for doc, ending in ".pdf".
+// A filename requested for the job replaces the file part of the pattern
+// but keeps its directories.
+func (n Naming) Path(doc *jobs.Document) string {
+	p := n.Pattern
+	if p == "" {
+		p = DefaultFilenamePattern
+	}
+	expanded := pattern.Expand(p, n.vars(doc))
+
+	var segments []string
+	for _, seg := range strings.Split(expanded, "/") {
+		if seg = n.sanitize(seg); seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+
+	var file string
+	if doc.Filename != "" {
+		// Only the base name of a requested filename is used so that it
+		// cannot escape the output directory.
+		file = n.sanitize(path.Base(strings.ReplaceAll(doc.Filename, `\`, "/")))
+		if len(segments) > 0 {
+			segments = segments[:len(segments)-1]
+		}
+		if file == "" {
+			file = "document.pdf"
+		}
+	} else {
+		if len(segments) > 0 {
+			file = segments[len(segments)-1]
+			segments = segments[:len(segments)-1]
+		}
+		if file == "" {
+			file = "document"
+		}
+		if !strings.HasSuffix(strings.ToLower(file), ".pdf") {
+			file = truncateSegment(file+".pdf", 255)
+		}
+	}
+
+	return path.Join(append(segments, file)...)
+}
+
+// Filename returns only the file part of Path, for targets without
+// directories such as e-mail attachments and uploads.
+func (n Naming) Filename(doc *jobs.Document) string {
+	return path.Base(n.Path(doc))
+}
+
+// Resolve applies the conflict policy to p. exists reports whether a path is
+// already taken on the target.
+func (n Naming) Resolve(p string, exists func(string) (bool, error)) (string, error) {
+	if n.OnConflict == ConflictOverwrite {
+		return p, nil
+	}
+
+	taken, err := exists(p)
+	if err != nil {
+		return "", fmt.Errorf("check %s: %w", p, err)
+	}
+	if !taken {
+		return p, nil
+	}
+	if n.OnConflict == ConflictFail {
+		return "", fmt.Errorf("%s: %w", p, ErrFileExists)
+	}
+
+	ext := path.Ext(p)
+	stem := strings.TrimSuffix(p, ext)
+	for i := 1; i <= maxSuffix; i++ {
+		candidate := stem + "_" + strconv.Itoa(i) + ext
+		taken, err := exists(candidate)
+		if err != nil {
+			return "", fmt.Errorf("check %s: %w", candidate, err)
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s: no free name after %d attempts: %w", p, maxSuffix, ErrFileExists)
+}
+
+func (n Naming) vars(doc *jobs.Document) pattern.Vars {
+	title := doc.Title
+	if title == "" {
+		title = "scan"
+	}
+	v := pattern.Vars{
+		Time:    doc.ScannedAt,
+		Profile: doc.Profile,
+		JobID:   doc.JobID,
+		Pages:   doc.Pages,
+		Counter: func() int { return doc.Counter },
+		// Separators inside values must not create extra directories.
+		Title:  flattenSeparators(title),
+		Device: flattenSeparators(doc.Device),
+	}
+	switch {
+	case doc.CorrespondentName != "":
+		v.Correspondent = flattenSeparators(doc.CorrespondentName)
+	case doc.Correspondent > 0:
+		v.Correspondent = strconv.Itoa(doc.Correspondent)
+	}
+	switch {
+	case doc.DocumentTypeName != "":
+		v.DocumentType = flattenSeparators(doc.DocumentTypeName)
+	case doc.DocumentType > 0:
+		v.DocumentType = strconv.Itoa(doc.DocumentType)
+	}
+	return v
+}
+
+// expand replaces placeholders in templates such as webhook fields and
+// email subjects. Besides the filename pattern placeholders it knows
+// {filename}, {tags} and {size}.
+func (n Naming) expand(s string, doc *jobs.Document, filename string) string {
+	return n.expandEscaped(s, doc, filename, nil)
+}
+
+// expandURL expands a URL template. Values are path-escaped before the
+// query and query-escaped after it, so they cannot change the URL's
+// structure.
+func (n Naming) expandURL(u string, doc *jobs.Document, filename string) string {
+	base, query, ok := strings.Cut(u, "?")
+	base = n.expandEscaped(base, doc, filename, url.PathEscape)
+	if !ok {
+		return base
+	}
+	return base + "?" + n.expandEscaped(query, doc, filename, url.QueryEscape)
+}
+
+// expandEscaped is expand with every substituted value passed through
+// escape, unless it is nil.
+func (n Naming) expandEscaped(s string, doc *jobs.Document, filename string, escape func(string) string) string {
+	v := n.vars(doc)
+	tags := make([]string, 0, len(doc.Tags)+len(doc.TagNames))
+	for _, id := range doc.Tags {
+		tags = append(tags, strconv.Itoa(id))
+	}
+	tags = append(tags, doc.TagNames...)
+	values := []string{filename, strings.Join(tags, ","), strconv.FormatInt(doc.Size, 10)}
+	if escape != nil {
+		for _, f := range []*string{&v.Profile, &v.Device, &v.JobID, &v.Title, &v.Correspondent, &v.DocumentType} {
+			*f = escape(*f)
+		}
+		for i := range values {
+			values[i] = escape(values[i])
+		}
+	}
+	s = pattern.Expand(s, v)
+	return strings.NewReplacer(
+		"{filename}", values[0],
+		"{tags}", values[1],
+		"{size}", values[2],
+	).Replace(s)
+}
+
+func flattenSeparators(s string) string {
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(s)
+}
+
+// sanitize cleans a single path segment for the target filesystem. It
+// returns "" for segments that must be dropped.
+func (n Naming) sanitize(seg string) string {
+	switch n.Sanitize {
+	case SanitizeStrict:
+		seg = sanitizeStrict(seg)
+	case SanitizeWindows:
+		seg = sanitizeWindows(seg)
+	default:
+		seg = sanitizePOSIX(seg)
+	}
+	if seg == "." || seg == ".." {
+		return ""
+	}
+	return truncateSegment(seg, 255)
+}
+
+func sanitizePOSIX(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// windowsReserved are device names NTFS and SMB refuse as file names.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func sanitizeWindows(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+	if s != "." && s != ".." {
+		s = strings.TrimRight(s, ". ")
+	}
+	stem, _, _ := strings.Cut(s, ".")
+	if windowsReserved[strings.ToUpper(stem)] {
+		s = "_" + s
+	}
+	return s
+}
+
+// sanitizeStrict keeps only portable ASCII characters; spaces become '_'.
+func sanitizeStrict(s string) string {
+	result := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' {
+			result = append(result, c)
+		} else if c == ' ' {
+			result = append(result, '_')
+		}
+	}
+	return string(result)
+}
+
+// truncateSegment shortens a segment to max bytes, keeping its extension and
+// valid UTF-8.
+func truncateSegment(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	ext := path.Ext(s)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(s, ext)
+	limit := max - len(ext)
+	for limit > 0 && limit < len(stem) && !utf8RuneStart(stem[limit]) {
+		limit--
+	}
+	return stem[:limit] + ext
+}
+
+func utf8RuneStart(b byte) bool { return b&0xC0 != 0x80 }
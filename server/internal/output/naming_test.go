@@ -0,0 +1,180 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+var namingTime = time.Date(2026, 10, 18, 14, 30, 5, 0, time.UTC)
+
+func TestNamingPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		mode    SanitizeMode
+		doc     jobs.Document
+		want    string
+	}{
+		{
+			name: "default pattern",
+			doc:  jobs.Document{Title: "Invoice", ScannedAt: namingTime},
+			want: "Invoice_20261018_143005.pdf",
+		},
+		{
+			name: "default title",
+			doc:  jobs.Document{ScannedAt: namingTime},
+			want: "scan_20261018_143005.pdf",
+		},
+		{
+			name:    "date and title directories",
+			pattern: "{year}/{month}/{title}/{date}_{job_id:8}",
+			doc:     jobs.Document{Title: "Invoices", JobID: "0123456789abcdef", ScannedAt: namingTime},
+			want:    "2026/10/Invoices/2026-10-18_01234567.pdf",
+		},
+		{
+			name:    "correspondent and profile",
+			pattern: "{profile}/{correspondent}/{document_type}/{title}",
+			doc:     jobs.Document{Title: "Bill", Profile: "standard", Correspondent: 7, ScannedAt: namingTime},
+			want:    "standard/7/Bill.pdf",
+		},
+		{
+			name:    "separators in title stay in one segment",
+			pattern: "{title}/{pages}",
+			doc:     jobs.Document{Title: "a/b\\c", Pages: 3, ScannedAt: namingTime},
+			want:    "a_b_c/3.pdf",
+		},
+		{
+			name:    "device and counter",
+			pattern: "{device}/{counter:4}_{title}",
+			doc:     jobs.Document{Title: "Invoice", Device: "fujitsu/fi-7160", Counter: 7, ScannedAt: namingTime},
+			want:    "fujitsu_fi-7160/0007_Invoice.pdf",
+		},
+		{
+			name:    "traversal is dropped",
+			pattern: "../{title}/../x",
+			doc:     jobs.Document{Title: "..", ScannedAt: namingTime},
+			want:    "x.pdf",
+		},
+		{
+			name:    "requested filename keeps directories",
+			pattern: "{year}/{title}",
+			doc:     jobs.Document{Filename: "standard_001.pdf", Title: "x", ScannedAt: namingTime},
+			want:    "2026/standard_001.pdf",
+		},
+		{
+			name: "requested filename uses base name only",
+			doc:  jobs.Document{Filename: "../../etc/passwd"},
+			want: "passwd",
+		},
+		{
+			name:    "windows characters",
+			pattern: "{title}",
+			mode:    SanitizeWindows,
+			doc:     jobs.Document{Title: `Re: "offer" <v2>?`},
+			want:    "Re_ _offer_ _v2__.pdf",
+		},
+		{
+			name:    "windows reserved name",
+			pattern: "con/{title}",
+			mode:    SanitizeWindows,
+			doc:     jobs.Document{Title: "aux"},
+			want:    "_con/_aux.pdf",
+		},
+		{
+			name:    "strict",
+			pattern: "{title}",
+			mode:    SanitizeStrict,
+			doc:     jobs.Document{Title: "über Hello World!"},
+			want:    "ber_Hello_World.pdf",
+		},
+		{
+			name:    "strict empty",
+			pattern: "{title}",
+			mode:    SanitizeStrict,
+			doc:     jobs.Document{Title: "日本語"},
+			want:    "document.pdf",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := tt.mode
+			if mode == "" {
+				mode = SanitizePOSIX
+			}
+			n := NewNaming(config.NamingConfig{FilenamePattern: tt.pattern}, mode)
+			if got := n.Path(&tt.doc); got != tt.want {
+				t.Fatalf("Path() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamingTruncatesLongSegments(t *testing.T) {
+	n := NewNaming(config.NamingConfig{FilenamePattern: "{title}"}, SanitizePOSIX)
+	got := n.Path(&jobs.Document{Title: strings.Repeat("ä", 200)})
+	if len(got) > 255 || !strings.HasSuffix(got, ".pdf") {
+		t.Fatalf("expected at most 255 bytes ending in .pdf, got %d bytes", len(got))
+	}
+}
+
+func TestNamingResolve(t *testing.T) {
+	taken := map[string]bool{"a/doc.pdf": true, "a/doc_1.pdf": true}
+	exists := func(p string) (bool, error) { return taken[p], nil }
+
+	n := NewNaming(config.NamingConfig{}, SanitizePOSIX)
+	got, err := n.Resolve("a/doc.pdf", exists)
+	if err != nil || got != "a/doc_2.pdf" {
+		t.Fatalf("suffix: got %q, %v", got, err)
+	}
+	if got, _ := n.Resolve("a/new.pdf", exists); got != "a/new.pdf" {
+		t.Fatalf("free name changed to %q", got)
+	}
+
+	n.OnConflict = ConflictOverwrite
+	if got, _ := n.Resolve("a/doc.pdf", exists); got != "a/doc.pdf" {
+		t.Fatalf("overwrite: got %q", got)
+	}
+
+	n.OnConflict = ConflictFail
+	if _, err := n.Resolve("a/doc.pdf", exists); !errors.Is(err, ErrFileExists) {
+		t.Fatalf("fail: expected ErrFileExists, got %v", err)
+	}
+}
+
+func TestFilesystemHandlerSubdirectoriesAndConflicts(t *testing.T) {
+	dir := t.TempDir()
+	send := func(h *FilesystemHandler) error {
+		return h.Send(context.Background(), &jobs.Document{
+			Title:     "Invoices",
+			ScannedAt: namingTime,
+			Open:      jobs.BytesSource([]byte("pdf")),
+		})
+	}
+
+	h := NewFilesystemHandler(dir)
+	h.target.naming = NewNaming(config.NamingConfig{FilenamePattern: "{year}/{month}/{title}/scan"}, SanitizePOSIX)
+	for i := 0; i < 2; i++ {
+		if err := send(h); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	for _, name := range []string{"scan.pdf", "scan_1.pdf"} {
+		if _, err := os.Stat(filepath.Join(dir, "2026", "10", "Invoices", name)); err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+	}
+
+	h.target.naming.OnConflict = ConflictFail
+	if err := send(h); !errors.Is(err, ErrFileExists) {
+		t.Fatalf("expected ErrFileExists, got %v", err)
+	}
+}
@@ -0,0 +1,475 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// OutboxState is the state of an outbox item.
+type OutboxState string
+
+const (
+	// OutboxPending items are retried when NextAttempt is reached.
+	OutboxPending OutboxState = "pending"
+	// OutboxDead items exhausted the retry schedule and wait for an
+	// operator to retry or discard them.
+	OutboxDead OutboxState = "dead"
+)
+
+// ErrOutboxItemNotFound is returned for unknown outbox item IDs.
+var ErrOutboxItemNotFound = errors.New("outbox item not found")
+
+// OutboxItem is a delivery of one document to one target that is waiting
+// for a later attempt.
+type OutboxItem struct {
+	ID          string         `json:"id"`
+	JobID       string         `json:"job_id,omitempty"`
+	Target      string         `json:"target"`
+	Required    bool           `json:"required"`
+	State       OutboxState    `json:"state"`
+	Attempts    int            `json:"attempts"`
+	LastError   string         `json:"last_error,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	NextAttempt time.Time      `json:"next_attempt,omitzero"`
+	Document    OutboxDocument `json:"document"`
+	// Result is set on the final notification of a delivered item.
+	Result *jobs.DeliveryResult `json:"result,omitempty"`
+}
+
+// OutboxDocument is the persisted metadata of a queued document. The PDF
+// itself is stored next to the item.
+type OutboxDocument struct {
+	Filename      string    `json:"filename,omitempty"`
+	Title         string    `json:"title,omitempty"`
+	Created       string    `json:"created,omitempty"`
+	Correspondent int       `json:"correspondent,omitempty"`
+	DocumentType  int       `json:"document_type,omitempty"`
+	Tags          []int     `json:"tags,omitempty"`
+	ArchiveSerial string    `json:"archive_serial_number,omitempty"`
+	Size          int64     `json:"size"`
+	Profile       string    `json:"profile,omitempty"`
+	Device        string    `json:"device,omitempty"`
+	Counter       int       `json:"counter,omitempty"`
+	Pages         int       `json:"pages,omitempty"`
+	ScannedAt     time.Time `json:"scanned_at,omitzero"`
+
+	CorrespondentName string   `json:"correspondent_name,omitempty"`
+	DocumentTypeName  string   `json:"document_type_name,omitempty"`
+	TagNames          []string `json:"tag_names,omitempty"`
+	StoragePath       string   `json:"storage_path,omitempty"`
+
+	CustomFields map[string]any     `json:"custom_fields,omitempty"`
+	Owner        string             `json:"owner,omitempty"`
+	Permissions  *jobs.Permissions  `json:"permissions,omitempty"`
+	Print        *jobs.PrintOptions `json:"print,omitempty"`
+	Recipients   *jobs.Recipients   `json:"recipients,omitempty"`
+}
+
+// Outbox stores deliveries that failed their immediate retries in a
+// directory and retries them on a long backoff schedule. Items survive
+// restarts; after the last step of the schedule they move to the
+// dead-letter list.
+type Outbox struct {
+	dir      string
+	schedule []time.Duration
+	manager  *Manager
+
+	mu     sync.Mutex
+	items  map[string]*OutboxItem
+	notify func(OutboxItem)
+	wake   chan struct{}
+	now    func() time.Time
+}
+
+// NewOutbox opens the outbox in dir and loads the items persisted there.
+func NewOutbox(dir string, schedule []time.Duration, m *Manager) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create outbox directory: %w", err)
+	}
+	o := &Outbox{
+		dir:      dir,
+		schedule: schedule,
+		manager:  m,
+		items:    make(map[string]*OutboxItem),
+		wake:     make(chan struct{}, 1),
+		now:      time.Now,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read outbox directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			slog.Warn("skipping unreadable outbox item", "path", p, "error", err)
+			continue
+		}
+		var item OutboxItem
+		if err := json.Unmarshal(data, &item); err != nil || item.ID != strings.TrimSuffix(name, ".json") {
+			slog.Warn("skipping corrupted outbox item", "path", p, "error", err)
+			continue
+		}
+		o.items[item.ID] = &item
+	}
+	if len(o.items) > 0 {
+		slog.Info("outbox loaded", "items", len(o.items))
+	}
+	return o, nil
+}
+
+// Notify registers a function called whenever an item is delivered, fails
+// an attempt or moves to the dead-letter list.
+func (o *Outbox) Notify(fn func(OutboxItem)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.notify = fn
+}
+
+// Enqueue stores a copy of doc for a later delivery to target. lastErr is
+// the error of the failed immediate attempts.
+func (o *Outbox) Enqueue(doc *jobs.Document, target string, required bool, lastErr error) (OutboxItem, error) {
+	now := o.now()
+	item := &OutboxItem{
+		ID:        uuid.New().String(),
+		JobID:     doc.JobID,
+		Target:    target,
+		Required:  required,
+		State:     OutboxPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Document: OutboxDocument{
+			Filename:      doc.Filename,
+			Title:         doc.Title,
+			Created:       doc.Created,
+			Correspondent: doc.Correspondent,
+			DocumentType:  doc.DocumentType,
+			Tags:          doc.Tags,
+			ArchiveSerial: doc.ArchiveSerial,
+			Size:          doc.Size,
+			Profile:       doc.Profile,
+			Device:        doc.Device,
+			Counter:       doc.Counter,
+			Pages:         doc.Pages,
+			ScannedAt:     doc.ScannedAt,
+
+			CorrespondentName: doc.CorrespondentName,
+			DocumentTypeName:  doc.DocumentTypeName,
+			TagNames:          doc.TagNames,
+			StoragePath:       doc.StoragePath,
+			CustomFields:      doc.CustomFields,
+			Owner:             doc.Owner,
+			Permissions:       doc.Permissions,
+			Print:             doc.Print,
+			Recipients:        doc.Recipients,
+		},
+	}
+	if lastErr != nil {
+		item.LastError = lastErr.Error()
+	}
+	o.reschedule(item)
+
+	if err := o.copyDocument(item.ID, doc); err != nil {
+		return OutboxItem{}, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.save(item); err != nil {
+		os.Remove(o.pdfPath(item.ID))
+		return OutboxItem{}, err
+	}
+	o.items[item.ID] = item
+	o.signal()
+
+	slog.Info("delivery queued in outbox",
+		"id", item.ID, "job_id", item.JobID, "target", target, "next_attempt", item.NextAttempt)
+	return *item, nil
+}
+
+// List returns all items, oldest first.
+func (o *Outbox) List() []OutboxItem {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	items := make([]OutboxItem, 0, len(o.items))
+	for _, item := range o.items {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].ID < items[j].ID
+		}
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items
+}
+
+// Get returns a single item.
+func (o *Outbox) Get(id string) (OutboxItem, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	item, ok := o.items[id]
+	if !ok {
+		return OutboxItem{}, false
+	}
+	return *item, true
+}
+
+// Retry schedules an item for an immediate attempt. Dead items are
+// revived; if the attempt fails they return to the dead-letter list.
+func (o *Outbox) Retry(id string) (OutboxItem, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	item, ok := o.items[id]
+	if !ok {
+		return OutboxItem{}, ErrOutboxItemNotFound
+	}
+	item.State = OutboxPending
+	item.NextAttempt = o.now()
+	item.UpdatedAt = item.NextAttempt
+	if err := o.save(item); err != nil {
+		return OutboxItem{}, err
+	}
+	o.signal()
+	return *item, nil
+}
+
+// Discard deletes an item and its document.
+func (o *Outbox) Discard(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.items[id]; !ok {
+		return ErrOutboxItemNotFound
+	}
+	delete(o.items, id)
+	return o.remove(id)
+}
+
+// Run retries due items until ctx is cancelled.
+func (o *Outbox) Run(ctx context.Context) {
+	for {
+		wait := o.processDue(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// maxIdle bounds how long Run sleeps when nothing is due.
+const maxIdle = time.Hour
+
+// processDue attempts every due item once and returns the time until the
+// next item is due.
+func (o *Outbox) processDue(ctx context.Context) time.Duration {
+	for _, item := range o.due() {
+		if ctx.Err() != nil {
+			return maxIdle
+		}
+		o.attempt(ctx, item)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	wait := maxIdle
+	now := o.now()
+	for _, item := range o.items {
+		if item.State != OutboxPending {
+			continue
+		}
+		if d := item.NextAttempt.Sub(now); d < wait {
+			wait = max(d, 0)
+		}
+	}
+	return wait
+}
+
+func (o *Outbox) due() []OutboxItem {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := o.now()
+	var due []OutboxItem
+	for _, item := range o.items {
+		if item.State == OutboxPending && !item.NextAttempt.After(now) {
+			due = append(due, *item)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttempt.Before(due[j].NextAttempt) })
+	return due
+}
+
+// attempt delivers one item and records the outcome.
+func (o *Outbox) attempt(ctx context.Context, snapshot OutboxItem) {
+	result, err := o.manager.sendOnce(ctx, snapshot.Target, o.document(snapshot))
+
+	o.mu.Lock()
+	item, ok := o.items[snapshot.ID]
+	if !ok {
+		// Discarded while the attempt was running.
+		o.mu.Unlock()
+		return
+	}
+	item.Attempts++
+	item.UpdatedAt = o.now()
+	if err == nil {
+		delete(o.items, item.ID)
+		if rmErr := o.remove(item.ID); rmErr != nil {
+			slog.Warn("failed to remove delivered outbox item", "id", item.ID, "error", rmErr)
+		}
+		item.LastError = ""
+		item.Result = result
+		slog.Info("outbox delivery succeeded", "id", item.ID, "target", item.Target, "attempts", item.Attempts)
+	} else {
+		item.LastError = err.Error()
+		o.reschedule(item)
+		if errors.Is(err, ErrPermanent) {
+			item.State, item.NextAttempt = OutboxDead, time.Time{}
+		}
+		if item.State == OutboxDead {
+			slog.Error("outbox delivery moved to dead-letter list",
+				"id", item.ID, "target", item.Target, "attempts", item.Attempts, "error", err)
+		} else {
+			slog.Warn("outbox delivery failed",
+				"id", item.ID, "target", item.Target, "attempts", item.Attempts,
+				"next_attempt", item.NextAttempt, "error", err)
+		}
+		if saveErr := o.save(item); saveErr != nil {
+			slog.Error("failed to persist outbox item", "id", item.ID, "error", saveErr)
+		}
+	}
+	updated, notify := *item, o.notify
+	o.mu.Unlock()
+
+	if notify != nil {
+		notify(updated)
+	}
+}
+
+// reschedule sets the next attempt from the number of attempts made so far,
+// or moves the item to the dead-letter list once the schedule is used up.
+func (o *Outbox) reschedule(item *OutboxItem) {
+	if item.Attempts >= len(o.schedule) {
+		item.State = OutboxDead
+		item.NextAttempt = time.Time{}
+		return
+	}
+	item.State = OutboxPending
+	item.NextAttempt = o.now().Add(o.schedule[item.Attempts])
+}
+
+// document rebuilds the document of an item, reading the stored PDF.
+func (o *Outbox) document(item OutboxItem) *jobs.Document {
+	d := item.Document
+	return &jobs.Document{
+		Filename:      d.Filename,
+		Title:         d.Title,
+		Created:       d.Created,
+		Correspondent: d.Correspondent,
+		DocumentType:  d.DocumentType,
+		Tags:          d.Tags,
+		ArchiveSerial: d.ArchiveSerial,
+		Open:          jobs.FileSource(o.pdfPath(item.ID)),
+		Size:          d.Size,
+		JobID:         item.JobID,
+		Profile:       d.Profile,
+		Device:        d.Device,
+		Counter:       d.Counter,
+		Pages:         d.Pages,
+		ScannedAt:     d.ScannedAt,
+
+		CorrespondentName: d.CorrespondentName,
+		DocumentTypeName:  d.DocumentTypeName,
+		TagNames:          d.TagNames,
+		StoragePath:       d.StoragePath,
+		CustomFields:      d.CustomFields,
+		Owner:             d.Owner,
+		Permissions:       d.Permissions,
+		Print:             d.Print,
+		Recipients:        d.Recipients,
+	}
+}
+
+func (o *Outbox) copyDocument(id string, doc *jobs.Document) error {
+	f, err := os.OpenFile(o.pdfPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return fmt.Errorf("create outbox document: %w", err)
+	}
+	if _, err := copyDocument(f, doc); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("copy outbox document: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("write outbox document: %w", err)
+	}
+	return nil
+}
+
+// save persists an item atomically. The caller holds o.mu.
+func (o *Outbox) save(item *OutboxItem) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal outbox item %s: %w", item.ID, err)
+	}
+	p := o.itemPath(item.ID)
+	if err := os.WriteFile(p+".tmp", data, 0o640); err != nil {
+		return fmt.Errorf("write outbox item %s: %w", item.ID, err)
+	}
+	if err := os.Rename(p+".tmp", p); err != nil {
+		os.Remove(p + ".tmp")
+		return fmt.Errorf("rename outbox item %s: %w", item.ID, err)
+	}
+	return nil
+}
+
+// remove deletes the files of an item. The caller holds o.mu.
+func (o *Outbox) remove(id string) error {
+	var errs []error
+	for _, p := range []string{o.itemPath(id), o.pdfPath(id)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// signal wakes Run without blocking.
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) itemPath(id string) string {
+	return filepath.Join(o.dir, filepath.Base(id)+".json")
+}
+
+func (o *Outbox) pdfPath(id string) string {
+	return filepath.Join(o.dir, filepath.Base(id)+".pdf")
+}
@@ -0,0 +1,129 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// newTestOutbox returns an outbox in a temporary directory with a
+// controllable clock.
+func newTestOutbox(t *testing.T, dir string, m *Manager, schedule ...time.Duration) (*Outbox, *time.Time) {
+	t.Helper()
+	o, err := NewOutbox(dir, schedule, m)
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	o.now = func() time.Time { return now }
+	return o, &now
+}
+
+func TestOutboxScheduleAndDeadLetter(t *testing.T) {
+	nas := &failNTimesHandler{name: "nas", failures: 2}
+	m := &Manager{handlers: map[string]Handler{"nas": nas}}
+	o, now := newTestOutbox(t, t.TempDir(), m, time.Minute, time.Hour)
+
+	var updates []OutboxItem
+	o.Notify(func(item OutboxItem) { updates = append(updates, item) })
+
+	doc := &jobs.Document{JobID: "job-1", Title: "Invoice", Open: jobs.BytesSource([]byte("pdf")), Size: 3}
+	item, err := o.Enqueue(doc, "nas", true, errors.New("connection refused"))
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if item.State != OutboxPending || !item.NextAttempt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected queued item: %+v", item)
+	}
+
+	// Nothing is due before the first step of the schedule.
+	if wait := o.processDue(context.Background()); wait != time.Minute || nas.calls != 0 {
+		t.Fatalf("expected to wait 1m without attempts, got %s after %d calls", wait, nas.calls)
+	}
+
+	*now = now.Add(time.Minute)
+	o.processDue(context.Background())
+	item, _ = o.Get(item.ID)
+	if item.Attempts != 1 || item.State != OutboxPending || !item.NextAttempt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("after first retry: %+v", item)
+	}
+
+	*now = now.Add(time.Hour)
+	o.processDue(context.Background())
+	item, _ = o.Get(item.ID)
+	if item.Attempts != 2 || item.State != OutboxDead || item.LastError == "" {
+		t.Fatalf("expected dead item after schedule, got %+v", item)
+	}
+	if wait := o.processDue(context.Background()); wait != maxIdle || nas.calls != 2 {
+		t.Fatalf("dead items must not be retried, got wait %s after %d calls", wait, nas.calls)
+	}
+
+	if _, err := o.Retry(item.ID); err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	o.processDue(context.Background())
+	if _, ok := o.Get(item.ID); ok {
+		t.Fatal("expected delivered item to leave the outbox")
+	}
+	if entries, _ := os.ReadDir(o.dir); len(entries) != 0 {
+		t.Fatalf("expected outbox files to be removed, found %d", len(entries))
+	}
+
+	if len(updates) != 3 || updates[1].State != OutboxDead || updates[2].LastError != "" {
+		t.Fatalf("unexpected notifications: %+v", updates)
+	}
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	dir, archive := t.TempDir(), t.TempDir()
+	m := &Manager{handlers: map[string]Handler{"archive": NewFilesystemHandler(archive)}}
+
+	o, _ := newTestOutbox(t, dir, m, time.Minute)
+	doc := &jobs.Document{Filename: "doc.pdf", Open: jobs.BytesSource([]byte("pdf-content")), Size: 11}
+	item, err := o.Enqueue(doc, "archive", false, errors.New("disk full"))
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	restarted, now := newTestOutbox(t, dir, m, time.Minute)
+	items := restarted.List()
+	if len(items) != 1 || items[0].ID != item.ID || items[0].Document.Filename != "doc.pdf" {
+		t.Fatalf("expected queued item after restart, got %+v", items)
+	}
+
+	*now = now.Add(time.Minute)
+	restarted.processDue(context.Background())
+	data, err := os.ReadFile(filepath.Join(archive, "doc.pdf"))
+	if err != nil || string(data) != "pdf-content" {
+		t.Fatalf("expected delivered document, got %q (%v)", data, err)
+	}
+}
+
+func TestOutboxDiscard(t *testing.T) {
+	o, _ := newTestOutbox(t, t.TempDir(), &Manager{handlers: map[string]Handler{}}, time.Minute)
+	item, err := o.Enqueue(&jobs.Document{Open: jobs.BytesSource([]byte("pdf"))}, "nas", true, nil)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	if err := o.Discard(item.ID); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	if len(o.List()) != 0 {
+		t.Fatal("expected empty outbox")
+	}
+	if entries, _ := os.ReadDir(o.dir); len(entries) != 0 {
+		t.Fatalf("expected outbox files to be removed, found %d", len(entries))
+	}
+	if err := o.Discard(item.ID); !errors.Is(err, ErrOutboxItemNotFound) {
+		t.Fatalf("expected ErrOutboxItemNotFound, got %v", err)
+	}
+	if _, err := o.Retry("missing"); !errors.Is(err, ErrOutboxItemNotFound) {
+		t.Fatalf("expected ErrOutboxItemNotFound, got %v", err)
+	}
+}
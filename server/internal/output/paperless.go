@@ -4,21 +4,44 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/thoscut/scanflow/server/internal/config"
 	"github.com/thoscut/scanflow/server/internal/jobs"
 )
 
+// maxTaskStatusErrors is the number of consecutive failed task status
+// queries after which consumption tracking gives up.
+const maxTaskStatusErrors = 5
+
 // PaperlessHandler uploads documents to Paperless-NGX via its REST API.
 type PaperlessHandler struct {
-	baseURL string
-	token   string
-	client  *http.Client
+	baseURL   string
+	publicURL string
+	token     string
+	client    *http.Client
+	naming    Naming
+
+	// Metadata defaults and name resolution
+	defaults   jobs.DocumentMetadata
+	createTags bool
+	names      *paperlessNames
+
+	// Consumption tracking
+	track        bool
+	timeout      time.Duration
+	pollInterval time.Duration
 }
 
 // UploadResult contains the response from a Paperless upload.
@@ -26,12 +49,61 @@ type UploadResult struct {
 	TaskID string `json:"task_id"`
 }
 
+// PaperlessTask is the state of a Paperless background task.
+type PaperlessTask struct {
+	TaskID          string          `json:"task_id"`
+	Status          string          `json:"status"` // PENDING, STARTED, SUCCESS, FAILURE, ...
+	Result          string          `json:"result"`
+	RelatedDocument json.RawMessage `json:"related_document"`
+}
+
+// DocumentID returns the ID of the document created by the task. Paperless
+// reports it as a string or number, older versions only in the result text.
+func (t PaperlessTask) DocumentID() string {
+	var id any
+	if err := json.Unmarshal(t.RelatedDocument, &id); err == nil {
+		switch v := id.(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatInt(int64(v), 10)
+		}
+	}
+	if m := newDocumentIDPattern.FindStringSubmatch(t.Result); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+var newDocumentIDPattern = regexp.MustCompile(`(?i)new document id (\d+)`)
+
 // NewPaperlessHandler creates a new Paperless-NGX output handler.
 func NewPaperlessHandler(cfg config.PaperlessConfig) *PaperlessHandler {
+	track, timeout := cfg.ConsumptionTracking()
+	publicURL := cfg.PublicURL
+	if publicURL == "" {
+		publicURL = cfg.URL
+	}
 	return &PaperlessHandler{
-		baseURL: cfg.URL,
-		token:   cfg.Token,
-		client:  &http.Client{},
+		baseURL:   cfg.URL,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		token:     cfg.Token,
+		client:    &http.Client{},
+		naming:    NewNaming(cfg.NamingConfig, SanitizePOSIX),
+		defaults: jobs.DocumentMetadata{
+			Correspondent:     cfg.DefaultCorrespondent,
+			DocumentType:      cfg.DefaultDocumentType,
+			Tags:              cfg.DefaultTags,
+			CorrespondentName: cfg.DefaultCorrespondentName,
+			DocumentTypeName:  cfg.DefaultDocumentTypeName,
+			TagNames:          cfg.DefaultTagNames,
+			StoragePath:       cfg.DefaultStoragePath,
+		},
+		createTags:   cfg.CreateMissingTags,
+		names:        newPaperlessNames(cfg.NameCacheTTL()),
+		track:        track,
+		timeout:      timeout,
+		pollInterval: 2 * time.Second,
 	}
 }
 
@@ -41,31 +113,82 @@ func (h *PaperlessHandler) Available() bool {
 	return h.baseURL != "" && h.token != ""
 }
 
-// Send uploads a document to Paperless-NGX.
+// Send uploads a document to Paperless-NGX and waits for it to be consumed.
 func (h *PaperlessHandler) Send(ctx context.Context, doc *jobs.Document) error {
+	_, err := h.SendWithResult(ctx, doc)
+	return err
+}
+
+// SendWithResult uploads a document and, with consumption tracking enabled,
+// polls the Paperless task until the document is consumed. It returns the
+// new document's ID and link. A failed consumption, e.g. a duplicate, is a
+// permanent failure carrying the Paperless message.
+//
+// Custom fields, the owner and permissions cannot be set on upload. They
+// are applied with a PATCH after consumption, which waits for the task even
+// when tracking is disabled.
+func (h *PaperlessHandler) SendWithResult(ctx context.Context, doc *jobs.Document) (*jobs.DeliveryResult, error) {
+	fields, err := h.resolveFields(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	taskID, err := h.upload(ctx, doc, fields)
+	if err != nil {
+		return nil, err
+	}
+	if fields.update == nil {
+		if !h.track || taskID == "" {
+			return nil, nil
+		}
+		return h.waitForConsumption(ctx, taskID)
+	}
+
+	// The document is uploaded from here on; failures are permanent, as
+	// another upload would create a duplicate.
+	if taskID == "" {
+		return nil, Permanent(errors.New("document uploaded, but paperless returned no task ID to apply custom fields, owner and permissions"))
+	}
+	result, err := h.waitForConsumption(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if result.DocumentID == "" {
+		return result, Permanent(errors.New("document uploaded, but not consumed in time to apply custom fields, owner and permissions"))
+	}
+	if err := h.updateDocument(ctx, result.DocumentID, fields.update); err != nil {
+		return result, Permanent(fmt.Errorf("document %s uploaded, but applying custom fields, owner and permissions failed: %w", result.DocumentID, err))
+	}
+	return result, nil
+}
+
+// upload posts the document and returns the consumption task ID.
+func (h *PaperlessHandler) upload(ctx context.Context, doc *jobs.Document, fields paperlessFields) (string, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
 	// Document file
-	part, err := writer.CreateFormFile("document", doc.Filename)
+	part, err := writer.CreateFormFile("document", h.naming.Filename(doc))
 	if err != nil {
-		return fmt.Errorf("create form file: %w", err)
+		return "", fmt.Errorf("create form file: %w", err)
 	}
-	if _, err := io.Copy(part, doc.Reader); err != nil {
-		return fmt.Errorf("copy document data: %w", err)
+	if _, err := copyDocument(part, doc); err != nil {
+		return "", fmt.Errorf("copy document data: %w", err)
 	}
 
 	// Metadata fields
 	if doc.Title != "" {
 		writer.WriteField("title", doc.Title)
 	}
-	if doc.Correspondent > 0 {
-		writer.WriteField("correspondent", strconv.Itoa(doc.Correspondent))
+	if fields.correspondent > 0 {
+		writer.WriteField("correspondent", strconv.Itoa(fields.correspondent))
 	}
-	if doc.DocumentType > 0 {
-		writer.WriteField("document_type", strconv.Itoa(doc.DocumentType))
+	if fields.documentType > 0 {
+		writer.WriteField("document_type", strconv.Itoa(fields.documentType))
 	}
-	for _, tag := range doc.Tags {
+	if fields.storagePath > 0 {
+		writer.WriteField("storage_path", strconv.Itoa(fields.storagePath))
+	}
+	for _, tag := range fields.tags {
 		writer.WriteField("tags", strconv.Itoa(tag))
 	}
 	if doc.Created != "" {
@@ -80,34 +203,189 @@ func (h *PaperlessHandler) Send(ctx context.Context, doc *jobs.Document) error {
 	req, err := http.NewRequestWithContext(ctx, "POST",
 		h.baseURL+"/api/documents/post_document/", body)
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return "", fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Token "+h.token)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	resp, err := h.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("paperless upload: %w", err)
+		return "", fmt.Errorf("paperless upload: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("paperless error %d: %s", resp.StatusCode, string(respBody))
+		return "", fmt.Errorf("paperless error %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	// Paperless answers with the task UUID as a JSON string; some proxies
+	// and older versions wrap it in an object.
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read upload response: %w", err)
 	}
+	var taskID string
+	if err := json.Unmarshal(data, &taskID); err != nil {
+		var result UploadResult
+		json.Unmarshal(data, &result)
+		taskID = result.TaskID
+	}
+	return taskID, nil
+}
 
-	var result UploadResult
-	json.NewDecoder(resp.Body).Decode(&result)
+// waitForConsumption polls the task until Paperless has consumed the
+// document. When consumption takes longer than the timeout the upload is
+// still counted as delivered, without a document ID, because uploading it
+// again would create a duplicate. It fails when the caller's context ends or
+// the task status cannot be read repeatedly.
+func (h *PaperlessHandler) waitForConsumption(parent context.Context, taskID string) (*jobs.DeliveryResult, error) {
+	ctx, cancel := context.WithTimeout(parent, h.timeout)
+	defer cancel()
 
+	ticker := time.NewTicker(h.pollInterval)
+	defer ticker.Stop()
+	var statusErr error
+	statusErrors := 0
+	for {
+		task, err := h.GetTask(ctx, taskID)
+		switch {
+		case err == nil:
+			statusErr, statusErrors = nil, 0
+		case ctx.Err() == nil:
+			slog.Warn("paperless task status unavailable", "task_id", taskID, "error", err)
+			statusErr = err
+			statusErrors++
+			if statusErrors >= maxTaskStatusErrors {
+				return nil, fmt.Errorf("paperless task status unavailable after %d attempts: %w", statusErrors, err)
+			}
+		}
+		if task != nil {
+			switch task.Status {
+			case "SUCCESS":
+				id := task.DocumentID()
+				result := &jobs.DeliveryResult{DocumentID: id}
+				if id != "" {
+					result.URL = h.publicURL + "/documents/" + url.PathEscape(id) + "/details"
+				}
+				return result, nil
+			case "FAILURE", "REVOKED":
+				msg := task.Result
+				if msg == "" {
+					msg = strings.ToLower(task.Status)
+				}
+				return nil, Permanent(fmt.Errorf("paperless consumption failed: %s", msg))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := parent.Err(); err != nil {
+				return nil, err
+			}
+			if statusErr != nil {
+				return nil, fmt.Errorf("paperless task status unavailable: %w", statusErr)
+			}
+			slog.Warn("paperless consumption still running, not waiting any longer",
+				"task_id", taskID, "timeout", h.timeout)
+			return &jobs.DeliveryResult{}, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateDocument patches a consumed document. Connection errors and server
+// errors are retried a few times.
+func (h *PaperlessHandler) updateDocument(ctx context.Context, id string, update *paperlessUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	u := h.baseURL + "/api/documents/" + url.PathEscape(id) + "/"
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "PATCH", u, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Token "+h.token)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := h.client.Do(req)
+		if err == nil {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("paperless error %d: %s", resp.StatusCode, string(respBody))
+			if resp.StatusCode < 500 {
+				return err
+			}
+		}
+		if attempt == maxRetries {
+			return err
+		}
+		slog.Warn("paperless document update failed, retrying", "document_id", id, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(h.pollInterval):
+		}
+	}
+}
+
+// Test checks the token and that its user may add documents. The UI
+// settings list the permissions of the token's user.
+func (h *PaperlessHandler) Test(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.baseURL+"/api/ui_settings/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+h.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("paperless: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("paperless token check: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var settings struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
+		return fmt.Errorf("decode paperless UI settings: %w", err)
+	}
+	if settings.Permissions != nil && !slices.Contains(settings.Permissions, "add_document") {
+		return errors.New("paperless user lacks the add_document permission")
+	}
 	return nil
 }
 
 // GetTaskStatus queries the status of a Paperless background task.
 func (h *PaperlessHandler) GetTaskStatus(ctx context.Context, taskID string) (string, error) {
+	task, err := h.GetTask(ctx, taskID)
+	if err != nil {
+		return "", err
+	}
+	if task == nil {
+		return "unknown", nil
+	}
+	return task.Status, nil
+}
+
+// GetTask queries a Paperless background task. It returns nil when
+// Paperless does not know the task (yet).
+func (h *PaperlessHandler) GetTask(ctx context.Context, taskID string) (*PaperlessTask, error) {
 	u := h.baseURL + "/api/tasks/"
 	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	// Use query parameter encoding to prevent URL injection.
 	q := req.URL.Query()
@@ -117,17 +395,20 @@ func (h *PaperlessHandler) GetTaskStatus(ctx context.Context, taskID string) (st
 
 	resp, err := h.client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var tasks []struct {
-		Status string `json:"status"`
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("paperless task status %d", resp.StatusCode)
 	}
-	json.NewDecoder(resp.Body).Decode(&tasks)
 
-	if len(tasks) > 0 {
-		return tasks[0].Status, nil
+	var tasks []PaperlessTask
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		return nil, fmt.Errorf("decode task status: %w", err)
+	}
+	if len(tasks) == 0 {
+		return nil, nil
 	}
-	return "unknown", nil
+	return &tasks[0], nil
 }
@@ -0,0 +1,416 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// Kinds of Paperless objects that documents can reference by name.
+const (
+	PaperlessTags           = "tags"
+	PaperlessCorrespondents = "correspondents"
+	PaperlessDocumentTypes  = "document_types"
+	PaperlessStoragePaths   = "storage_paths"
+	PaperlessCustomFields   = "custom_fields"
+	PaperlessUsers          = "users"
+	PaperlessGroups         = "groups"
+)
+
+// ErrUnknownPaperlessKind is returned for object kinds other than the ones
+// above.
+var ErrUnknownPaperlessKind = errors.New("unknown paperless object kind")
+
+// PaperlessObject is a named Paperless object such as a tag.
+type PaperlessObject struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// paperlessNames caches the object lists used to resolve names to IDs.
+type paperlessNames struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	lists map[string]paperlessList
+}
+
+type paperlessList struct {
+	objects []PaperlessObject
+	fetched time.Time
+}
+
+func newPaperlessNames(ttl time.Duration) *paperlessNames {
+	return &paperlessNames{ttl: ttl, now: time.Now, lists: make(map[string]paperlessList)}
+}
+
+func (c *paperlessNames) get(kind string) ([]PaperlessObject, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list, ok := c.lists[kind]
+	if !ok || c.now().Sub(list.fetched) >= c.ttl {
+		return nil, false
+	}
+	return list.objects, true
+}
+
+func (c *paperlessNames) put(kind string, objects []PaperlessObject) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lists[kind] = paperlessList{objects: objects, fetched: c.now()}
+}
+
+// add appends a created object to a cached list.
+func (c *paperlessNames) add(kind string, obj PaperlessObject) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if list, ok := c.lists[kind]; ok {
+		list.objects = append(slices.Clip(list.objects), obj)
+		c.lists[kind] = list
+	}
+}
+
+func (c *paperlessNames) invalidate(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.lists, kind)
+}
+
+func validPaperlessKind(kind string) bool {
+	switch kind {
+	case PaperlessTags, PaperlessCorrespondents, PaperlessDocumentTypes, PaperlessStoragePaths,
+		PaperlessCustomFields, PaperlessUsers, PaperlessGroups:
+		return true
+	}
+	return false
+}
+
+// ListObjects returns the Paperless objects of a kind, served from the
+// cache while it is fresh.
+func (h *PaperlessHandler) ListObjects(ctx context.Context, kind string) ([]PaperlessObject, error) {
+	objects, _, err := h.listObjects(ctx, kind)
+	return objects, err
+}
+
+// listObjects is ListObjects that also reports whether the list came from
+// the cache.
+func (h *PaperlessHandler) listObjects(ctx context.Context, kind string) ([]PaperlessObject, bool, error) {
+	if !validPaperlessKind(kind) {
+		return nil, false, fmt.Errorf("%w: %s", ErrUnknownPaperlessKind, kind)
+	}
+	if objects, ok := h.names.get(kind); ok {
+		return objects, true, nil
+	}
+	objects, err := h.fetchObjects(ctx, kind)
+	if err != nil {
+		return nil, false, err
+	}
+	h.names.put(kind, objects)
+	return objects, false, nil
+}
+
+// fetchObjects reads every page of a Paperless object list.
+func (h *PaperlessHandler) fetchObjects(ctx context.Context, kind string) ([]PaperlessObject, error) {
+	objects := []PaperlessObject{}
+	next := h.baseURL + "/api/" + kind + "/?page_size=1000"
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", next, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Token "+h.token)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := h.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("list paperless %s: %w", kind, err)
+		}
+		var page struct {
+			Next    string `json:"next"`
+			Results []struct {
+				PaperlessObject
+				Username string `json:"username"` // users have no name
+			} `json:"results"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("list paperless %s: status %d: %s", kind, resp.StatusCode, string(body))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode paperless %s: %w", kind, err)
+		}
+		for _, r := range page.Results {
+			if r.Name == "" {
+				r.Name = r.Username
+			}
+			objects = append(objects, r.PaperlessObject)
+		}
+		next = h.nextPage(page.Next)
+	}
+	return objects, nil
+}
+
+// nextPage keeps pagination on the configured base URL. Paperless builds
+// the next link from the request host, which differs behind proxies.
+func (h *PaperlessHandler) nextPage(next string) string {
+	if next == "" {
+		return ""
+	}
+	u, err := url.Parse(next)
+	if err != nil {
+		return ""
+	}
+	base, err := url.Parse(h.baseURL)
+	if err != nil {
+		return next
+	}
+	u.Scheme, u.Host = base.Scheme, base.Host
+	return u.String()
+}
+
+// resolveName returns the ID of the object with the given name, compared
+// case-insensitively. A miss in a cached list refetches it once, so objects
+// created in Paperless after the list was cached are found.
+func (h *PaperlessHandler) resolveName(ctx context.Context, kind, name string) (int, bool, error) {
+	for {
+		objects, cached, err := h.listObjects(ctx, kind)
+		if err != nil {
+			return 0, false, err
+		}
+		for _, obj := range objects {
+			if strings.EqualFold(obj.Name, name) {
+				return obj.ID, true, nil
+			}
+		}
+		if !cached {
+			return 0, false, nil
+		}
+		h.names.invalidate(kind)
+	}
+}
+
+// resolveID resolves a name that must exist in Paperless. Unknown names are
+// permanent failures; uploading again will not make them appear.
+func (h *PaperlessHandler) resolveID(ctx context.Context, kind, name string) (int, error) {
+	id, ok, err := h.resolveName(ctx, kind, name)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, Permanent(fmt.Errorf("paperless %s %q not found", strings.TrimSuffix(kind, "s"), name))
+	}
+	return id, nil
+}
+
+// resolveRef resolves an object given by ID or name.
+func (h *PaperlessHandler) resolveRef(ctx context.Context, kind, ref string) (int, error) {
+	if id, err := strconv.Atoi(ref); err == nil && id > 0 {
+		return id, nil
+	}
+	return h.resolveID(ctx, kind, ref)
+}
+
+func (h *PaperlessHandler) resolveRefs(ctx context.Context, kind string, refs []string) ([]int, error) {
+	ids := []int{}
+	for _, ref := range refs {
+		id, err := h.resolveRef(ctx, kind, ref)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// resolveTag resolves a tag name, creating the tag when it is missing and
+// creating tags is enabled.
+func (h *PaperlessHandler) resolveTag(ctx context.Context, name string) (int, error) {
+	id, ok, err := h.resolveName(ctx, PaperlessTags, name)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return id, nil
+	}
+	if !h.createTags {
+		return 0, Permanent(fmt.Errorf("paperless tag %q not found", name))
+	}
+	return h.createTag(ctx, name)
+}
+
+func (h *PaperlessHandler) createTag(ctx context.Context, name string) (int, error) {
+	body, _ := json.Marshal(map[string]string{"name": name})
+	req, err := http.NewRequestWithContext(ctx, "POST", h.baseURL+"/api/tags/", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Token "+h.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("create paperless tag %q: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("create paperless tag %q: status %d: %s", name, resp.StatusCode, string(respBody))
+	}
+	var tag PaperlessObject
+	if err := json.NewDecoder(resp.Body).Decode(&tag); err != nil {
+		return 0, fmt.Errorf("decode created tag: %w", err)
+	}
+	h.names.add(PaperlessTags, tag)
+	return tag.ID, nil
+}
+
+// paperlessFields are the metadata IDs sent with an upload.
+type paperlessFields struct {
+	correspondent int
+	documentType  int
+	storagePath   int
+	tags          []int
+
+	// Applied with a PATCH once the document is consumed.
+	update *paperlessUpdate
+}
+
+// paperlessUpdate is the body of the follow-up PATCH. The upload endpoint
+// takes neither custom field values, nor the owner, nor permissions.
+type paperlessUpdate struct {
+	CustomFields   []paperlessCustomField `json:"custom_fields,omitempty"`
+	Owner          *int                   `json:"owner,omitempty"`
+	SetPermissions *paperlessPermissions  `json:"set_permissions,omitempty"`
+}
+
+type paperlessCustomField struct {
+	Field int `json:"field"`
+	Value any `json:"value"`
+}
+
+type paperlessPermissions struct {
+	View   paperlessPrincipals `json:"view"`
+	Change paperlessPrincipals `json:"change"`
+}
+
+type paperlessPrincipals struct {
+	Users  []int `json:"users"`
+	Groups []int `json:"groups"`
+}
+
+// resolveFields merges the document's IDs and names, falling back to the
+// configured defaults, and resolves the names against Paperless.
+func (h *PaperlessHandler) resolveFields(ctx context.Context, doc *jobs.Document) (paperlessFields, error) {
+	f := paperlessFields{correspondent: doc.Correspondent, documentType: doc.DocumentType}
+	var err error
+
+	correspondentName := doc.CorrespondentName
+	if f.correspondent == 0 && correspondentName == "" {
+		f.correspondent, correspondentName = h.defaults.Correspondent, h.defaults.CorrespondentName
+	}
+	if f.correspondent == 0 && correspondentName != "" {
+		if f.correspondent, err = h.resolveID(ctx, PaperlessCorrespondents, correspondentName); err != nil {
+			return f, err
+		}
+	}
+
+	documentTypeName := doc.DocumentTypeName
+	if f.documentType == 0 && documentTypeName == "" {
+		f.documentType, documentTypeName = h.defaults.DocumentType, h.defaults.DocumentTypeName
+	}
+	if f.documentType == 0 && documentTypeName != "" {
+		if f.documentType, err = h.resolveID(ctx, PaperlessDocumentTypes, documentTypeName); err != nil {
+			return f, err
+		}
+	}
+
+	storagePath := doc.StoragePath
+	if storagePath == "" {
+		storagePath = h.defaults.StoragePath
+	}
+	if storagePath != "" {
+		if f.storagePath, err = h.resolveID(ctx, PaperlessStoragePaths, storagePath); err != nil {
+			return f, err
+		}
+	}
+
+	tags, tagNames := doc.Tags, doc.TagNames
+	if len(tags) == 0 && len(tagNames) == 0 {
+		tags, tagNames = h.defaults.Tags, h.defaults.TagNames
+	}
+	f.tags = append(f.tags, tags...)
+	for _, name := range tagNames {
+		id, err := h.resolveTag(ctx, name)
+		if err != nil {
+			return f, err
+		}
+		if !slices.Contains(f.tags, id) {
+			f.tags = append(f.tags, id)
+		}
+	}
+
+	f.update, err = h.resolveUpdate(ctx, doc)
+	return f, err
+}
+
+// resolveUpdate resolves the custom fields, owner and permissions of a
+// document. It returns nil when there is nothing to apply after upload.
+func (h *PaperlessHandler) resolveUpdate(ctx context.Context, doc *jobs.Document) (*paperlessUpdate, error) {
+	if len(doc.CustomFields) == 0 && doc.Owner == "" && doc.Permissions == nil {
+		return nil, nil
+	}
+	u := &paperlessUpdate{}
+
+	// Sorted, so the request is the same for every attempt.
+	for _, name := range slices.Sorted(maps.Keys(doc.CustomFields)) {
+		id, err := h.resolveRef(ctx, PaperlessCustomFields, name)
+		if err != nil {
+			return nil, err
+		}
+		u.CustomFields = append(u.CustomFields, paperlessCustomField{Field: id, Value: doc.CustomFields[name]})
+	}
+
+	if doc.Owner != "" {
+		id, err := h.resolveRef(ctx, PaperlessUsers, doc.Owner)
+		if err != nil {
+			return nil, err
+		}
+		u.Owner = &id
+	}
+
+	if p := doc.Permissions; p != nil {
+		perms := &paperlessPermissions{}
+		var err error
+		if perms.View.Users, err = h.resolveRefs(ctx, PaperlessUsers, p.ViewUsers); err != nil {
+			return nil, err
+		}
+		if perms.View.Groups, err = h.resolveRefs(ctx, PaperlessGroups, p.ViewGroups); err != nil {
+			return nil, err
+		}
+		if perms.Change.Users, err = h.resolveRefs(ctx, PaperlessUsers, p.ChangeUsers); err != nil {
+			return nil, err
+		}
+		if perms.Change.Groups, err = h.resolveRefs(ctx, PaperlessGroups, p.ChangeGroups); err != nil {
+			return nil, err
+		}
+		u.SetPermissions = perms
+	}
+	return u, nil
+}
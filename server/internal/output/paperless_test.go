@@ -0,0 +1,421 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// fakePaperless answers uploads with a task ID and reports the given task
+// states in turn, repeating the last one. An empty state fails the query.
+type fakePaperless struct {
+	mu      sync.Mutex
+	uploads int
+	polls   int
+	states  []string // JSON task objects
+}
+
+func (f *fakePaperless) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/api/documents/post_document/":
+		f.uploads++
+		w.Write([]byte(`"4e0f1f2a-task"`))
+	case "/api/tasks/":
+		if r.URL.Query().Get("task_id") != "4e0f1f2a-task" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		state := f.states[min(f.polls, len(f.states)-1)]
+		f.polls++
+		if state == "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("[" + state + "]"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTrackingPaperless(t *testing.T, fake *fakePaperless, cfg config.PaperlessConfig) *PaperlessHandler {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	cfg.URL, cfg.Token = srv.URL, "tok"
+	h := NewPaperlessHandler(cfg)
+	h.pollInterval = 5 * time.Millisecond
+	return h
+}
+
+func TestPaperlessConsumptionSuccess(t *testing.T) {
+	fake := &fakePaperless{states: []string{
+		`{"status":"PENDING"}`,
+		`{"status":"STARTED"}`,
+		`{"status":"SUCCESS","result":"Success. New document id 42 created","related_document":"42"}`,
+	}}
+	h := newTrackingPaperless(t, fake, config.PaperlessConfig{PublicURL: "https://paperless.example.com/"})
+
+	result, err := h.SendWithResult(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))})
+	if err != nil {
+		t.Fatalf("SendWithResult: %v", err)
+	}
+	if result.DocumentID != "42" || result.URL != "https://paperless.example.com/documents/42/details" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if fake.polls != 3 {
+		t.Fatalf("expected 3 polls, got %d", fake.polls)
+	}
+}
+
+func TestPaperlessConsumptionFailureIsPermanent(t *testing.T) {
+	fake := &fakePaperless{states: []string{
+		`{"status":"FAILURE","result":"scan.pdf: Not consuming scan.pdf: It is a duplicate of Invoice (#12)."}`,
+	}}
+	h := newTrackingPaperless(t, fake, config.PaperlessConfig{})
+	m := &Manager{handlers: map[string]Handler{"paperless": h}}
+
+	results := m.SendAll(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))},
+		[]jobs.OutputTarget{{Name: "paperless"}}, nil)
+
+	d := results[0]
+	if d.Status != jobs.DeliveryFailed || !d.Permanent || !strings.Contains(d.Error, "duplicate of Invoice") {
+		t.Fatalf("expected permanent failure with the Paperless message, got %+v", d)
+	}
+	if fake.uploads != 1 {
+		t.Fatalf("consumption failures must not be retried, got %d uploads", fake.uploads)
+	}
+}
+
+func TestPaperlessConsumptionTimeout(t *testing.T) {
+	fake := &fakePaperless{states: []string{`{"status":"STARTED"}`}}
+	h := newTrackingPaperless(t, fake, config.PaperlessConfig{})
+	h.timeout = 30 * time.Millisecond
+
+	result, err := h.SendWithResult(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))})
+	if err != nil {
+		t.Fatalf("a slow consumption must not fail the delivery: %v", err)
+	}
+	if result == nil || result.DocumentID != "" {
+		t.Fatalf("expected empty result, got %+v", result)
+	}
+}
+
+func TestPaperlessConsumptionStatusErrors(t *testing.T) {
+	fake := &fakePaperless{states: []string{""}}
+	h := newTrackingPaperless(t, fake, config.PaperlessConfig{})
+
+	_, err := h.SendWithResult(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))})
+	if err == nil || errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected a retryable error when the task status is unavailable, got %v", err)
+	}
+	if fake.polls != maxTaskStatusErrors {
+		t.Fatalf("expected %d polls, got %d", maxTaskStatusErrors, fake.polls)
+	}
+}
+
+func TestPaperlessConsumptionCancelled(t *testing.T) {
+	fake := &fakePaperless{states: []string{`{"status":"STARTED"}`}}
+	h := newTrackingPaperless(t, fake, config.PaperlessConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err := h.SendWithResult(ctx, &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the caller's context error, got %v", err)
+	}
+}
+
+func TestPaperlessTrackingDisabled(t *testing.T) {
+	fake := &fakePaperless{states: []string{`{"status":"FAILURE"}`}}
+	off := false
+	h := newTrackingPaperless(t, fake, config.PaperlessConfig{TrackConsumption: &off})
+
+	if err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if fake.polls != 0 {
+		t.Fatalf("expected no task polling, got %d polls", fake.polls)
+	}
+}
+
+func TestPaperlessTaskDocumentID(t *testing.T) {
+	tests := []struct {
+		task string
+		want string
+	}{
+		{`{"related_document":"17"}`, "17"},
+		{`{"related_document":17}`, "17"},
+		{`{"related_document":null,"result":"Success. New document id 23 created"}`, "23"},
+		{`{"result":"done"}`, ""},
+	}
+	for _, tt := range tests {
+		var task PaperlessTask
+		if err := json.Unmarshal([]byte(tt.task), &task); err != nil {
+			t.Fatal(err)
+		}
+		if got := task.DocumentID(); got != tt.want {
+			t.Errorf("DocumentID(%s) = %q, want %q", tt.task, got, tt.want)
+		}
+	}
+
+	if !errors.Is(Permanent(errors.New("x")), ErrPermanent) || Permanent(nil) != nil {
+		t.Error("Permanent must wrap errors and keep nil")
+	}
+}
+
+// fakePaperlessObjects serves object lists in pages of two and records the
+// upload form.
+type fakePaperlessObjects struct {
+	mu      sync.Mutex
+	objects map[string][]PaperlessObject
+	lists   map[string]int
+	created []string
+	form    map[string][]string
+	patch   map[string]any
+}
+
+func (f *fakePaperlessObjects) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/api/documents/post_document/" {
+		r.ParseMultipartForm(1 << 20)
+		f.form = r.MultipartForm.Value
+		w.Write([]byte(`"task"`))
+		return
+	}
+	if r.URL.Path == "/api/tasks/" {
+		w.Write([]byte(`[{"status":"SUCCESS","related_document":"55"}]`))
+		return
+	}
+	if r.Method == http.MethodPatch && r.URL.Path == "/api/documents/55/" {
+		json.NewDecoder(r.Body).Decode(&f.patch)
+		w.Write([]byte(`{"id":55}`))
+		return
+	}
+	kind := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+	if r.Method == http.MethodPost && kind == PaperlessTags {
+		var tag PaperlessObject
+		json.NewDecoder(r.Body).Decode(&tag)
+		tag.ID = 100 + len(f.created)
+		f.created = append(f.created, tag.Name)
+		f.objects[kind] = append(f.objects[kind], tag)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(tag)
+		return
+	}
+	objects, ok := f.objects[kind]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f.lists[kind]++
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+	start, end := min((page-1)*2, len(objects)), min(page*2, len(objects))
+	resp := map[string]any{"results": objects[start:end], "next": nil}
+	if end < len(objects) {
+		// Paperless links the next page with its own host name.
+		resp["next"] = fmt.Sprintf("http://paperless.internal:8000/api/%s/?page=%d&page_size=1000", kind, page+1)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newNamedPaperless(t *testing.T, cfg config.PaperlessConfig) (*PaperlessHandler, *fakePaperlessObjects) {
+	t.Helper()
+	fake := &fakePaperlessObjects{
+		objects: map[string][]PaperlessObject{
+			PaperlessTags:           {{1, "Inbox"}, {2, "Tax"}, {3, "Insurance"}},
+			PaperlessCorrespondents: {{7, "ACME Corp"}},
+			PaperlessDocumentTypes:  {{4, "Invoice"}},
+			PaperlessStoragePaths:   {{9, "Archive/{created_year}"}},
+			PaperlessCustomFields:   {{11, "Amount"}, {12, "Checked"}},
+			PaperlessUsers:          {{21, "alice"}, {22, "bob"}},
+			PaperlessGroups:         {{31, "Accounting"}},
+		},
+		lists: map[string]int{},
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	off := false
+	cfg.URL, cfg.Token, cfg.TrackConsumption = srv.URL, "tok", &off
+	return NewPaperlessHandler(cfg), fake
+}
+
+func TestPaperlessResolvesNames(t *testing.T) {
+	h, fake := newNamedPaperless(t, config.PaperlessConfig{CreateMissingTags: true})
+
+	doc := &jobs.Document{
+		Open:              jobs.BytesSource([]byte("pdf")),
+		CorrespondentName: "acme corp",
+		DocumentTypeName:  "Invoice",
+		StoragePath:       "Archive/{created_year}",
+		Tags:              []int{1},
+		TagNames:          []string{"insurance", "Scanned"},
+	}
+	if err := h.Send(context.Background(), doc); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	want := map[string][]string{
+		"correspondent": {"7"},
+		"document_type": {"4"},
+		"storage_path":  {"9"},
+		"tags":          {"1", "3", "100"},
+	}
+	for field, values := range want {
+		if got := fake.form[field]; strings.Join(got, ",") != strings.Join(values, ",") {
+			t.Errorf("%s = %v, want %v", field, got, values)
+		}
+	}
+	if len(fake.created) != 1 || fake.created[0] != "Scanned" {
+		t.Fatalf("expected the missing tag to be created, got %v", fake.created)
+	}
+
+	// Lists are cached; a second upload does not fetch them again.
+	if err := h.Send(context.Background(), doc); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if fake.lists[PaperlessCorrespondents] != 1 || fake.lists[PaperlessTags] != 4 {
+		t.Fatalf("unexpected list requests: %v", fake.lists)
+	}
+}
+
+func TestPaperlessUnknownNameIsPermanent(t *testing.T) {
+	h, fake := newNamedPaperless(t, config.PaperlessConfig{})
+
+	err := h.Send(context.Background(), &jobs.Document{
+		Open:     jobs.BytesSource([]byte("pdf")),
+		TagNames: []string{"Unknown"},
+	})
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), `tag "Unknown" not found`) {
+		t.Fatalf("expected permanent unknown tag error, got %v", err)
+	}
+	if len(fake.created) != 0 || fake.form != nil {
+		t.Fatal("expected neither tag creation nor upload")
+	}
+
+	err = h.Send(context.Background(), &jobs.Document{
+		Open:              jobs.BytesSource([]byte("pdf")),
+		CorrespondentName: "Nobody",
+	})
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected permanent unknown correspondent error, got %v", err)
+	}
+}
+
+func TestPaperlessDefaultMetadata(t *testing.T) {
+	h, fake := newNamedPaperless(t, config.PaperlessConfig{
+		DefaultDocumentType: 5,
+		DefaultTagNames:     []string{"Inbox"},
+	})
+
+	if err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := fake.form["document_type"]; len(got) != 1 || got[0] != "5" {
+		t.Errorf("document_type = %v, want [5]", got)
+	}
+	if got := fake.form["tags"]; len(got) != 1 || got[0] != "1" {
+		t.Errorf("tags = %v, want [1]", got)
+	}
+}
+
+func TestPaperlessListObjectsPaginates(t *testing.T) {
+	h, fake := newNamedPaperless(t, config.PaperlessConfig{})
+
+	tags, err := h.ListObjects(context.Background(), PaperlessTags)
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if len(tags) != 3 || tags[2].Name != "Insurance" || fake.lists[PaperlessTags] != 2 {
+		t.Fatalf("expected 3 tags from 2 pages, got %+v after %d requests", tags, fake.lists[PaperlessTags])
+	}
+
+	// A name added after the list was cached is found by refetching once.
+	fake.objects[PaperlessTags] = append(fake.objects[PaperlessTags], PaperlessObject{ID: 8, Name: "New"})
+	if id, err := h.resolveTag(context.Background(), "new"); err != nil || id != 8 {
+		t.Fatalf("resolveTag = %d, %v", id, err)
+	}
+
+	if _, err := h.ListObjects(context.Background(), "mail_accounts"); !errors.Is(err, ErrUnknownPaperlessKind) {
+		t.Fatalf("expected ErrUnknownPaperlessKind, got %v", err)
+	}
+}
+
+func TestPaperlessAppliesCustomFieldsAndPermissions(t *testing.T) {
+	h, fake := newNamedPaperless(t, config.PaperlessConfig{})
+	h.pollInterval = time.Millisecond
+
+	// Tracking is disabled, but the update needs the document ID.
+	result, err := h.SendWithResult(context.Background(), &jobs.Document{
+		Open:         jobs.BytesSource([]byte("pdf")),
+		CustomFields: map[string]any{"checked": true, "Amount": "EUR12.50", "13": 7},
+		Owner:        "alice",
+		Permissions:  &jobs.Permissions{ViewGroups: []string{"accounting"}, ChangeUsers: []string{"bob", "23"}},
+	})
+	if err != nil {
+		t.Fatalf("SendWithResult: %v", err)
+	}
+	if result.DocumentID != "55" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	got, _ := json.Marshal(fake.patch)
+	want := `{"custom_fields":[{"field":13,"value":7},{"field":11,"value":"EUR12.50"},{"field":12,"value":true}],` +
+		`"owner":21,"set_permissions":{"change":{"groups":[],"users":[22,23]},"view":{"groups":[31],"users":[]}}}`
+	if string(got) != want {
+		t.Fatalf("unexpected update:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestPaperlessUnknownOwnerFailsBeforeUpload(t *testing.T) {
+	h, fake := newNamedPaperless(t, config.PaperlessConfig{})
+
+	err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf")), Owner: "mallory"})
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), `user "mallory" not found`) {
+		t.Fatalf("expected permanent unknown user error, got %v", err)
+	}
+	if fake.form != nil {
+		t.Fatal("document must not be uploaded")
+	}
+}
+
+func TestPaperlessTestChecksPermissions(t *testing.T) {
+	var permissions string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/ui_settings/" || r.Header.Get("Authorization") != "Token tok" {
+			http.Error(w, `{"detail": "Invalid token."}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"user": {"id": 3}, "permissions": [%s]}`, permissions)
+	}))
+	defer srv.Close()
+
+	h := NewPaperlessHandler(config.PaperlessConfig{URL: srv.URL, Token: "tok"})
+	permissions = `"view_document", "add_document"`
+	if err := h.Test(context.Background()); err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+	permissions = `"view_document"`
+	if err := h.Test(context.Background()); err == nil || !strings.Contains(err.Error(), "add_document") {
+		t.Fatalf("expected missing permission error, got %v", err)
+	}
+
+	h = NewPaperlessHandler(config.PaperlessConfig{URL: srv.URL, Token: "wrong"})
+	if err := h.Test(context.Background()); err == nil || !strings.Contains(err.Error(), "Invalid token") {
+		t.Fatalf("expected token error, got %v", err)
+	}
+}
@@ -0,0 +1,485 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+	"github.com/thoscut/scanflow/server/internal/pattern"
+)
+
+// S3Handler uploads documents to Amazon S3 or an S3-compatible store.
+type S3Handler struct {
+	endpoint     *url.URL
+	region       string
+	bucket       string // may contain placeholders
+	pathStyle    bool
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	storageClass string
+	sse          string
+	kmsKeyID     string
+	partSize     int64
+	client       *http.Client
+	naming       Naming
+	now          func() time.Time
+	secretErr    error // reading a credential file failed
+}
+
+// NewS3Handler creates a new S3 output handler.
+func NewS3Handler(cfg config.S3Config) *S3Handler {
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		u = &url.URL{}
+	}
+
+	accessKey := cfg.AccessKeyID
+	var accessKeyErr error
+	if cfg.AccessKeyIDFile != "" {
+		accessKey, accessKeyErr = readSecretFile(cfg.AccessKeyIDFile)
+	}
+	secretKey, secretKeyErr := readSecretFile(cfg.SecretAccessKeyFile)
+	sessionToken, sessionTokenErr := readSecretFile(cfg.SessionTokenFile)
+
+	// The prefix is a directory template in front of the file name.
+	naming := cfg.NamingConfig
+	if naming.FilenamePattern == "" {
+		naming.FilenamePattern = DefaultFilenamePattern
+	}
+	if prefix := strings.Trim(cfg.Prefix, "/"); prefix != "" {
+		naming.FilenamePattern = prefix + "/" + naming.FilenamePattern
+	}
+
+	return &S3Handler{
+		endpoint:     u,
+		region:       region,
+		bucket:       cfg.Bucket,
+		pathStyle:    cfg.PathStyle,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		storageClass: cfg.StorageClass,
+		sse:          cfg.SSE,
+		kmsKeyID:     cfg.SSEKMSKeyID,
+		partSize:     cfg.PartSize(),
+		client:       &http.Client{Timeout: 10 * time.Minute},
+		naming:       NewNaming(naming, SanitizePOSIX),
+		now:          time.Now,
+		secretErr:    errors.Join(accessKeyErr, secretKeyErr, sessionTokenErr),
+	}
+}
+
+func (h *S3Handler) Name() string { return "s3" }
+
+func (h *S3Handler) Available() bool {
+	return h.endpoint.Host != "" && h.bucket != "" && h.accessKey != "" && h.secretKey != "" && h.secretErr == nil
+}
+
+// Send uploads a document. Documents larger than the part size use a
+// multipart upload.
+func (h *S3Handler) Send(ctx context.Context, doc *jobs.Document) error {
+	if h.secretErr != nil {
+		return Permanent(fmt.Errorf("s3 credentials: %w", h.secretErr))
+	}
+	if doc.Open == nil {
+		return fmt.Errorf("document has no content")
+	}
+	bucket := strings.TrimSpace(pattern.Expand(h.bucket, h.naming.vars(doc)))
+	key, err := h.naming.Resolve(h.naming.Path(doc), func(key string) (bool, error) {
+		return h.exists(ctx, bucket, key)
+	})
+	if err != nil {
+		return err
+	}
+
+	r, err := doc.Open()
+	if err != nil {
+		return fmt.Errorf("open document: %w", err)
+	}
+	defer r.Close()
+
+	if doc.Size > h.partSize {
+		return h.multipartUpload(ctx, bucket, key, doc, r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read document: %w", err)
+	}
+	resp, err := h.do(ctx, http.MethodPut, bucket, key, nil, data, h.objectHeaders(doc))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Test checks the credentials and the bucket with a HEAD request. Buckets
+// named by a pattern are expanded for a document scanned now.
+func (h *S3Handler) Test(ctx context.Context) error {
+	if h.secretErr != nil {
+		return Permanent(fmt.Errorf("s3 credentials: %w", h.secretErr))
+	}
+	bucket := strings.TrimSpace(pattern.Expand(h.bucket, h.naming.vars(&jobs.Document{ScannedAt: time.Now()})))
+	resp, err := h.send(ctx, http.MethodHead, bucket, "", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return Permanent(fmt.Errorf("s3 bucket %s does not exist", bucket))
+	}
+	return s3Error(http.MethodHead, resp)
+}
+
+func (h *S3Handler) exists(ctx context.Context, bucket, key string) (bool, error) {
+	resp, err := h.send(ctx, http.MethodHead, bucket, key, nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, s3Error(http.MethodHead, resp)
+}
+
+// objectHeaders returns the content type, encryption, storage class and
+// metadata headers of a new object.
+func (h *S3Handler) objectHeaders(doc *jobs.Document) http.Header {
+	header := http.Header{}
+	header.Set("Content-Type", "application/pdf")
+	if h.storageClass != "" {
+		header.Set("X-Amz-Storage-Class", h.storageClass)
+	}
+	if h.sse != "" {
+		header.Set("X-Amz-Server-Side-Encryption", h.sse)
+	}
+	if h.kmsKeyID != "" {
+		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", h.kmsKeyID)
+	}
+
+	meta := func(name, value string) {
+		if value != "" {
+			// Header values must be ASCII; others are RFC 2047 encoded.
+			header.Set("X-Amz-Meta-"+name, mime.QEncoding.Encode("utf-8", value))
+		}
+	}
+	meta("Title", doc.Title)
+	meta("Job-Id", doc.JobID)
+	meta("Profile", doc.Profile)
+	if doc.Pages > 0 {
+		meta("Pages", strconv.Itoa(doc.Pages))
+	}
+	var tags []string
+	for _, id := range doc.Tags {
+		tags = append(tags, strconv.Itoa(id))
+	}
+	meta("Tags", strings.Join(append(tags, doc.TagNames...), ","))
+	if doc.CorrespondentName != "" {
+		meta("Correspondent", doc.CorrespondentName)
+	} else if doc.Correspondent > 0 {
+		meta("Correspondent", strconv.Itoa(doc.Correspondent))
+	}
+	if doc.DocumentTypeName != "" {
+		meta("Document-Type", doc.DocumentTypeName)
+	} else if doc.DocumentType > 0 {
+		meta("Document-Type", strconv.Itoa(doc.DocumentType))
+	}
+	return header
+}
+
+type s3InitiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompleteUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []s3Part `xml:"Part"`
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// multipartUpload uploads a document in parts of the configured size. A
+// failed upload is aborted so that no parts are left behind.
+func (h *S3Handler) multipartUpload(ctx context.Context, bucket, key string, doc *jobs.Document, r io.Reader) error {
+	resp, err := h.do(ctx, http.MethodPost, bucket, key, url.Values{"uploads": {""}}, nil, h.objectHeaders(doc))
+	if err != nil {
+		return fmt.Errorf("start multipart upload: %w", err)
+	}
+	var initiate s3InitiateResult
+	err = xml.NewDecoder(resp.Body).Decode(&initiate)
+	resp.Body.Close()
+	if err != nil || initiate.UploadID == "" {
+		return fmt.Errorf("start multipart upload: no upload ID (%v)", err)
+	}
+	uploadID := initiate.UploadID
+
+	if err := h.uploadParts(ctx, bucket, key, uploadID, r); err != nil {
+		abort, aerr := h.send(context.WithoutCancel(ctx), http.MethodDelete, bucket, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+		if aerr == nil {
+			abort.Body.Close()
+		}
+		return fmt.Errorf("multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (h *S3Handler) uploadParts(ctx context.Context, bucket, key, uploadID string, r io.Reader) error {
+	complete := s3CompleteUpload{}
+	buf := make([]byte, h.partSize)
+	for n := 1; ; n++ {
+		size, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("read document: %w", err)
+		}
+
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		resp, err := h.do(ctx, http.MethodPut, bucket, key, query, buf[:size], nil)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", n, err)
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, s3Part{PartNumber: n, ETag: resp.Header.Get("ETag")})
+		if size < len(buf) {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	resp, err := h.do(ctx, http.MethodPost, bucket, key, url.Values{"uploadId": {uploadID}}, body, nil)
+	if err != nil {
+		return fmt.Errorf("complete: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// CompleteMultipartUpload can fail after answering 200.
+	data, _ := io.ReadAll(resp.Body)
+	if bytes.Contains(data, []byte("<Error>")) {
+		return fmt.Errorf("complete: %w", parseS3Error(resp.StatusCode, data))
+	}
+	return nil
+}
+
+// do sends a signed request and returns an error for non-2xx responses.
+func (h *S3Handler) do(ctx context.Context, method, bucket, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	resp, err := h.send(ctx, method, bucket, key, query, body, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, s3Error(method, resp)
+	}
+	return resp, nil
+}
+
+// send builds, signs and sends a request for an object.
+func (h *S3Handler) send(ctx context.Context, method, bucket, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, h.objectURL(bucket, key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if len(body) > 0 {
+		sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	if h.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", h.sessionToken)
+	}
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	signV4(req, h.accessKey, h.secretKey, h.region, "s3", h.now())
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s: %w", method, err)
+	}
+	return resp, nil
+}
+
+// objectURL returns the path-style or virtual-hosted-style object URL.
+func (h *S3Handler) objectURL(bucket, key string, query url.Values) *url.URL {
+	u := *h.endpoint
+	p := strings.TrimRight(u.Path, "/")
+	if h.pathStyle {
+		p += "/" + bucket
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	p += "/" + key
+	u.Path = p
+	u.RawPath = awsEscapePath(p)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// s3ErrorBody is the XML error document of S3.
+type s3ErrorBody struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func s3Error(method string, resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	return fmt.Errorf("s3 %s: %w", method, parseS3Error(resp.StatusCode, data))
+}
+
+// parseS3Error turns an S3 error response into an error. Authentication
+// failures and missing buckets are permanent; HEAD responses carry no error
+// document, so 401 and 403 are checked as well.
+func parseS3Error(status int, data []byte) error {
+	var e s3ErrorBody
+	xml.Unmarshal(data, &e)
+	err := fmt.Errorf("HTTP %d", status)
+	if e.Code != "" {
+		err = fmt.Errorf("HTTP %d: %s: %s", status, e.Code, e.Message)
+	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return Permanent(err)
+	}
+	switch e.Code {
+	case "NoSuchBucket", "InvalidBucketName":
+		return Permanent(err)
+	}
+	return err
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header. Every header
+// set on the request is signed. The caller sets X-Amz-Content-Sha256.
+func signV4(req *http.Request, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := dateStamp + "/" + region + "/" + service + "/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but unreserved characters, as
+// SigV4 requires.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func awsEscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes a query sorted by key, as SigV4 requires.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,260 @@
+package output
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// SFTPHandler uploads documents to a server over SSH.
+type SFTPHandler struct {
+	addr      string
+	username  string
+	auth      []ssh.AuthMethod
+	hostKey   ssh.HostKeyCallback
+	directory string
+	naming    Naming
+	err       error // configuration problem found while reading key and secret files
+}
+
+// NewSFTPHandler creates a new SFTP output handler.
+func NewSFTPHandler(cfg config.SFTPConfig) *SFTPHandler {
+	addr := strings.TrimPrefix(cfg.Host, "sftp://")
+	if _, _, err := net.SplitHostPort(addr); err != nil && addr != "" {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	naming := cfg.NamingConfig
+	if naming.FilenamePattern == "" {
+		naming.FilenamePattern = smbDefaultPattern
+	}
+
+	h := &SFTPHandler{
+		addr:      addr,
+		username:  cfg.Username,
+		directory: cfg.Directory,
+		naming:    NewNaming(naming, SanitizePOSIX),
+	}
+
+	if cfg.PrivateKeyFile != "" {
+		signer, err := loadSigner(cfg.PrivateKeyFile, cfg.PrivateKeyPassphraseFile)
+		if err != nil {
+			h.err = errors.Join(h.err, err)
+		} else {
+			h.auth = append(h.auth, ssh.PublicKeys(signer))
+		}
+	}
+	if cfg.PasswordFile != "" {
+		password, err := readSecretFile(cfg.PasswordFile)
+		if err != nil {
+			h.err = errors.Join(h.err, fmt.Errorf("read password: %w", err))
+		} else {
+			h.auth = append(h.auth, ssh.Password(password))
+		}
+	}
+
+	switch {
+	case cfg.InsecureIgnoreHostKey:
+		h.hostKey = ssh.InsecureIgnoreHostKey()
+	case cfg.KnownHostsFile != "":
+		callback, err := knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			h.err = errors.Join(h.err, fmt.Errorf("read known_hosts: %w", err))
+		}
+		h.hostKey = callback
+	}
+	return h
+}
+
+// loadSigner reads a private key, decrypting it with the passphrase from
+// passphraseFile if set.
+func loadSigner(keyFile, passphraseFile string) (ssh.Signer, error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+	if passphraseFile == "" {
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key: %w", err)
+		}
+		return signer, nil
+	}
+	passphrase, err := readSecretFile(passphraseFile)
+	if err != nil {
+		return nil, fmt.Errorf("read private key passphrase: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	return signer, nil
+}
+
+func (h *SFTPHandler) Name() string { return "sftp" }
+
+func (h *SFTPHandler) Available() bool {
+	return h.addr != "" && h.username != "" && len(h.auth) > 0 && h.hostKey != nil && h.err == nil
+}
+
+// Send uploads a document to a temporary name and renames it into place,
+// so that readers never see a partial file.
+func (h *SFTPHandler) Send(ctx context.Context, doc *jobs.Document) error {
+	if h.err != nil {
+		return Permanent(fmt.Errorf("SFTP configuration: %w", h.err))
+	}
+	if h.hostKey == nil {
+		return Permanent(fmt.Errorf("SFTP: no known_hosts file configured"))
+	}
+
+	sshClient, client, err := h.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+	defer client.Close()
+
+	// Build the target path and create its directories
+	target, err := h.naming.Resolve(h.naming.Path(doc), func(p string) (bool, error) {
+		_, err := client.Stat(h.remotePath(p))
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return err
+	}
+	target = h.remotePath(target)
+	if dir := path.Dir(target); dir != "." && dir != "/" {
+		if err := client.MkdirAll(dir); err != nil {
+			return fmt.Errorf("SFTP create directory: %w", err)
+		}
+	}
+
+	var id [6]byte
+	rand.Read(id[:])
+	tmp := path.Join(path.Dir(target), "."+path.Base(target)+"."+hex.EncodeToString(id[:])+".part")
+
+	if err := h.write(client, tmp, doc); err != nil {
+		client.Remove(tmp)
+		return err
+	}
+
+	// SFTP rename fails when the target exists; posix-rename replaces it.
+	if h.naming.OnConflict == ConflictOverwrite {
+		err = client.PosixRename(tmp, target)
+	} else {
+		err = client.Rename(tmp, target)
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return fmt.Errorf("SFTP rename: %w", err)
+	}
+	return nil
+}
+
+// Test logs in and checks the configured directory. A directory that does
+// not exist yet is created by the first delivery.
+func (h *SFTPHandler) Test(ctx context.Context) error {
+	if h.err != nil {
+		return fmt.Errorf("SFTP configuration: %w", h.err)
+	}
+	if h.hostKey == nil {
+		return fmt.Errorf("SFTP: no known_hosts file configured")
+	}
+	sshClient, client, err := h.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+	defer client.Close()
+
+	dir := h.remotePath(".")
+	info, err := client.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("SFTP stat %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("SFTP %s is not a directory", dir)
+	}
+	return nil
+}
+
+func (h *SFTPHandler) write(client *sftp.Client, name string, doc *jobs.Document) error {
+	f, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return fmt.Errorf("SFTP create file: %w", err)
+	}
+	if _, err := copyDocument(f, doc); err != nil {
+		f.Close()
+		return fmt.Errorf("SFTP write: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("SFTP write: %w", err)
+	}
+	return nil
+}
+
+// connect opens an SSH connection and starts the SFTP subsystem.
+// Authentication and host key failures are permanent.
+func (h *SFTPHandler) connect(ctx context.Context) (*ssh.Client, *sftp.Client, error) {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", h.addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("SFTP connect: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, h.addr, &ssh.ClientConfig{
+		User:            h.username,
+		Auth:            h.auth,
+		HostKeyCallback: h.hostKey,
+		Timeout:         10 * time.Second,
+	})
+	if err != nil {
+		conn.Close()
+		err = fmt.Errorf("SFTP handshake: %w", err)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) || strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, nil, Permanent(err)
+		}
+		return nil, nil, err
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, nil, fmt.Errorf("SFTP subsystem: %w", err)
+	}
+	return sshClient, client, nil
+}
+
+// remotePath places a relative document path below the configured directory.
+func (h *SFTPHandler) remotePath(p string) string {
+	if h.directory == "" {
+		return p
+	}
+	return path.Join(h.directory, p)
+}
@@ -0,0 +1,276 @@
+package output
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// sshServer is an in-process SSH server offering the SFTP subsystem on the
+// local file system.
+type sshServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+}
+
+func newSSHServer(t *testing.T, password string, authorized ssh.PublicKey) *sshServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "scan" && password != "" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authorized != nil && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, cfg)
+		}
+	}()
+	return &sshServer{addr: ln.Addr().String(), hostKey: signer.PublicKey()}
+}
+
+func serveSSH(conn net.Conn, cfg *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(ch)
+					if err == nil {
+						server.Serve()
+						server.Close()
+					}
+					return
+				}
+			}
+		}()
+	}
+}
+
+// knownHosts writes a known_hosts file with the server's host key.
+func (s *sshServer) knownHosts(t *testing.T, key ssh.PublicKey) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, key)
+	if err := os.WriteFile(p, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func sftpTestDoc(content string) *jobs.Document {
+	return &jobs.Document{
+		Title:             "Invoice 42",
+		CorrespondentName: "ACME",
+		Open:              jobs.BytesSource([]byte(content)),
+		Size:              int64(len(content)),
+		ScannedAt:         time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestSFTPPasswordUpload(t *testing.T) {
+	srv := newSSHServer(t, "s3cret", nil)
+	dir := t.TempDir()
+	h := NewSFTPHandler(config.SFTPConfig{
+		NamingConfig:   config.NamingConfig{FilenamePattern: "{year}/{correspondent}/{title}"},
+		Host:           srv.addr,
+		Username:       "scan",
+		PasswordFile:   writeSecret(t, "s3cret"),
+		KnownHostsFile: srv.knownHosts(t, srv.hostKey),
+		Directory:      filepath.Join(dir, "archive"),
+	})
+	if !h.Available() {
+		t.Fatal("expected handler to be available")
+	}
+
+	for _, content := range []string{"first", "second"} {
+		if err := h.Send(context.Background(), sftpTestDoc(content)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	target := filepath.Join(dir, "archive", "2026", "ACME")
+	for name, want := range map[string]string{"Invoice 42.pdf": "first", "Invoice 42_1.pdf": "second"} {
+		data, err := os.ReadFile(filepath.Join(target, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q (%v), want %q", name, data, err, want)
+		}
+	}
+	entries, _ := os.ReadDir(target)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".part") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestSFTPKeyUploadOverwrites(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, _ := ssh.NewPublicKey(pub)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writeSecret(t, string(pem.EncodeToMemory(block)))
+
+	srv := newSSHServer(t, "", sshPub)
+	dir := t.TempDir()
+	h := NewSFTPHandler(config.SFTPConfig{
+		NamingConfig:   config.NamingConfig{FilenamePattern: "scan", OnConflict: "overwrite"},
+		Host:           srv.addr,
+		Username:       "scan",
+		PrivateKeyFile: keyFile,
+		KnownHostsFile: srv.knownHosts(t, srv.hostKey),
+		Directory:      dir,
+	})
+
+	for _, content := range []string{"old", "new"} {
+		if err := h.Send(context.Background(), sftpTestDoc(content)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "scan.pdf"))
+	if err != nil || string(data) != "new" {
+		t.Fatalf("scan.pdf = %q (%v), want %q", data, err, "new")
+	}
+}
+
+func TestSFTPUnknownHostKeyIsPermanent(t *testing.T) {
+	srv := newSSHServer(t, "s3cret", nil)
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ssh.NewPublicKey(other)
+
+	h := NewSFTPHandler(config.SFTPConfig{
+		Host:           srv.addr,
+		Username:       "scan",
+		PasswordFile:   writeSecret(t, "s3cret"),
+		KnownHostsFile: srv.knownHosts(t, otherKey),
+		Directory:      t.TempDir(),
+	})
+	err := h.Send(context.Background(), sftpTestDoc("pdf"))
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("expected permanent host key error, got %v", err)
+	}
+}
+
+func TestSFTPWrongPasswordIsPermanent(t *testing.T) {
+	srv := newSSHServer(t, "s3cret", nil)
+	h := NewSFTPHandler(config.SFTPConfig{
+		Host:           srv.addr,
+		Username:       "scan",
+		PasswordFile:   writeSecret(t, "wrong"),
+		KnownHostsFile: srv.knownHosts(t, srv.hostKey),
+		Directory:      t.TempDir(),
+	})
+	err := h.Send(context.Background(), sftpTestDoc("pdf"))
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("expected permanent authentication error, got %v", err)
+	}
+}
+
+func TestSFTPUnreadablePasswordFile(t *testing.T) {
+	srv := newSSHServer(t, "s3cret", nil)
+	h := NewSFTPHandler(config.SFTPConfig{
+		Host:           srv.addr,
+		Username:       "scan",
+		PasswordFile:   filepath.Join(t.TempDir(), "missing"),
+		KnownHostsFile: srv.knownHosts(t, srv.hostKey),
+		Directory:      t.TempDir(),
+	})
+	if h.Available() {
+		t.Error("handler with an unreadable password file must not be available")
+	}
+	if err := h.Test(context.Background()); err == nil || !strings.Contains(err.Error(), "read password") {
+		t.Errorf("Test = %v, want the password file error", err)
+	}
+	if err := h.Send(context.Background(), sftpTestDoc("pdf")); !errors.Is(err, ErrPermanent) {
+		t.Errorf("Send = %v, want a permanent error", err)
+	}
+}
+
+func TestSFTPTest(t *testing.T) {
+	srv := newSSHServer(t, "s3cret", nil)
+	dir := t.TempDir()
+	cfg := config.SFTPConfig{
+		Host:           srv.addr,
+		Username:       "scan",
+		PasswordFile:   writeSecret(t, "s3cret"),
+		KnownHostsFile: srv.knownHosts(t, srv.hostKey),
+		Directory:      filepath.Join(dir, "created-later"),
+	}
+	if err := NewSFTPHandler(cfg).Test(context.Background()); err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "file"), []byte("x"), 0o644)
+	cfg.Directory = filepath.Join(dir, "file")
+	if err := NewSFTPHandler(cfg).Test(context.Background()); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected not a directory error, got %v", err)
+	}
+
+	cfg.PasswordFile = writeSecret(t, "wrong")
+	if err := NewSFTPHandler(cfg).Test(context.Background()); err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+}
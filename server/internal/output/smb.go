@@ -2,10 +2,12 @@ package output
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"net"
 	"os"
+	"path"
 	"strings"
 	"time"
 
@@ -14,14 +16,21 @@ import (
 	"github.com/thoscut/scanflow/server/internal/jobs"
 )
 
+// smbDefaultPattern keeps the date-first names SMB uploads have always used.
+const smbDefaultPattern = "{date:YYYYMMDD}_{time:HHmmss}_{title}"
+
+// smbLegacyTokens keeps the compact meaning {date} and {time} had in SMB
+// filename patterns before the shared pattern syntax.
+var smbLegacyTokens = strings.NewReplacer("{date}", "{date:YYYYMMDD}", "{time}", "{time:HHmmss}")
+
 // SMBHandler uploads documents to a SMB/CIFS network share.
 type SMBHandler struct {
-	server          string
-	share           string
-	username        string
-	password        string
-	directory       string
-	filenamePattern string
+	server    string
+	share     string
+	username  string
+	password  string
+	directory string
+	naming    Naming
 }
 
 // NewSMBHandler creates a new SMB output handler.
@@ -34,13 +43,20 @@ func NewSMBHandler(cfg config.SMBConfig) *SMBHandler {
 		}
 	}
 
+	naming := cfg.NamingConfig
+	if naming.FilenamePattern == "" {
+		naming.FilenamePattern = smbDefaultPattern
+	}
+	naming.FilenamePattern = smbLegacyTokens.Replace(naming.FilenamePattern)
+
 	return &SMBHandler{
-		server:          cfg.Server,
-		share:           cfg.Share,
-		username:        cfg.Username,
-		password:        password,
-		directory:       cfg.Directory,
-		filenamePattern: cfg.FilenamePattern,
+		server:    cfg.Server,
+		share:     cfg.Share,
+		username:  cfg.Username,
+		password:  password,
+		directory: cfg.Directory,
+		// SMB shares are usually backed by NTFS or accessed from Windows.
+		naming: NewNaming(naming, SanitizeWindows),
 	}
 }
 
@@ -52,92 +68,122 @@ func (h *SMBHandler) Available() bool {
 
 // Send uploads a document to the SMB share.
 func (h *SMBHandler) Send(ctx context.Context, doc *jobs.Document) error {
-	// Connect to SMB server
-	server := h.server
-	if !strings.Contains(server, ":") {
-		server = server + ":445"
-	}
-	// Strip any leading "//" from the server address
-	server = strings.TrimPrefix(server, "//")
-	if !strings.Contains(server, ":") {
-		server = server + ":445"
+	share, unmount, err := h.mount(ctx)
+	if err != nil {
+		return err
 	}
+	defer unmount()
 
-	conn, err := net.DialTimeout("tcp", server, 10*time.Second)
+	// Build the target path and create its directories
+	target, err := h.naming.Resolve(h.naming.Path(doc), func(p string) (bool, error) {
+		_, err := share.Stat(h.sharePath(p))
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	})
 	if err != nil {
-		return fmt.Errorf("SMB connect: %w", err)
+		return err
 	}
-	defer conn.Close()
-
-	d := &smb2.Dialer{
-		Initiator: &smb2.NTLMInitiator{
-			User:     h.username,
-			Password: h.password,
-		},
+	target = h.sharePath(target)
+	if dir := path.Dir(target); dir != "." {
+		if err := share.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("SMB create directory: %w", err)
+		}
 	}
 
-	session, err := d.Dial(conn)
-	if err != nil {
-		return fmt.Errorf("SMB authenticate: %w", err)
+	// Write file
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if h.naming.OnConflict != ConflictOverwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
 	}
-	defer session.Logoff()
-
-	share, err := session.Mount(h.share)
+	f, err := share.OpenFile(target, flags, 0o644)
 	if err != nil {
-		return fmt.Errorf("SMB mount share: %w", err)
+		return fmt.Errorf("SMB create file: %w", err)
 	}
-	defer share.Umount()
 
-	// Ensure directory exists
-	if h.directory != "" {
-		share.MkdirAll(h.directory, 0o755)
+	// Do not leave a truncated document behind for a retry to collide with.
+	if _, err := copyDocument(f, doc); err != nil {
+		f.Close()
+		share.Remove(target)
+		return fmt.Errorf("SMB write: %w", err)
 	}
-
-	// Build filename
-	filename := h.buildFilename(doc)
-	path := filename
-	if h.directory != "" {
-		path = h.directory + "/" + filename
+	if err := f.Close(); err != nil {
+		share.Remove(target)
+		return fmt.Errorf("SMB write: %w", err)
 	}
 
-	// Write file
-	f, err := share.Create(path)
+	return nil
+}
+
+// Test logs in, mounts the share and checks the configured directory. A
+// directory that does not exist yet is created by the first delivery.
+func (h *SMBHandler) Test(ctx context.Context) error {
+	share, unmount, err := h.mount(ctx)
 	if err != nil {
-		return fmt.Errorf("SMB create file: %w", err)
+		return err
 	}
-	defer f.Close()
+	defer unmount()
 
-	if _, err := io.Copy(f, doc.Reader); err != nil {
-		return fmt.Errorf("SMB write: %w", err)
+	dir := h.sharePath(".")
+	info, err := share.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("SMB stat %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("SMB %s is not a directory", dir)
 	}
-
 	return nil
 }
 
-func (h *SMBHandler) buildFilename(doc *jobs.Document) string {
-	if doc.Filename != "" {
-		return doc.Filename
+// mount connects to the server, authenticates and mounts the share. The
+// returned function unmounts and disconnects again.
+func (h *SMBHandler) mount(ctx context.Context) (*smb2.Share, func(), error) {
+	// Strip any leading "//" from the server address
+	server := strings.TrimPrefix(h.server, "//")
+	if !strings.Contains(server, ":") {
+		server = server + ":445"
 	}
 
-	pattern := h.filenamePattern
-	if pattern == "" {
-		pattern = "{date}_{time}_{title}"
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, nil, fmt.Errorf("SMB connect: %w", err)
 	}
 
-	now := time.Now()
-	filename := pattern
-	filename = strings.ReplaceAll(filename, "{date}", now.Format("20060102"))
-	filename = strings.ReplaceAll(filename, "{time}", now.Format("150405"))
-
-	title := "scan"
-	if doc.Title != "" {
-		title = doc.Title
+	d := &smb2.Dialer{
+		Initiator: &smb2.NTLMInitiator{
+			User:     h.username,
+			Password: h.password,
+		},
 	}
-	filename = strings.ReplaceAll(filename, "{title}", title)
 
-	if !strings.HasSuffix(filename, ".pdf") {
-		filename += ".pdf"
+	session, err := d.DialContext(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("SMB authenticate: %w", err)
 	}
 
-	return filename
+	share, err := session.Mount(h.share)
+	if err != nil {
+		session.Logoff()
+		conn.Close()
+		return nil, nil, fmt.Errorf("SMB mount share: %w", err)
+	}
+	return share, func() {
+		share.Umount()
+		session.Logoff()
+		conn.Close()
+	}, nil
+}
+
+// sharePath places a relative document path below the configured directory.
+func (h *SMBHandler) sharePath(p string) string {
+	if h.directory == "" {
+		return p
+	}
+	return path.Join(strings.Trim(h.directory, "/"), p)
 }
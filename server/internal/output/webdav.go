@@ -0,0 +1,305 @@
+package output
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// WebDAVHandler uploads documents to a WebDAV server such as Nextcloud.
+type WebDAVHandler struct {
+	baseURL   string
+	username  string
+	password  string
+	token     string
+	checksum  string
+	chunkSize int64
+	chunkURL  string
+	client    *http.Client
+	naming    Naming
+	secretErr error // reading the password or token file failed
+}
+
+// NewWebDAVHandler creates a new WebDAV output handler.
+func NewWebDAVHandler(cfg config.WebDAVConfig) *WebDAVHandler {
+	password, passwordErr := readSecretFile(cfg.PasswordFile)
+	token, tokenErr := readSecretFile(cfg.TokenFile)
+
+	return &WebDAVHandler{
+		baseURL:   strings.TrimRight(cfg.URL, "/"),
+		username:  cfg.Username,
+		password:  password,
+		token:     token,
+		checksum:  strings.ToLower(cfg.Checksum),
+		chunkSize: int64(cfg.ChunkSizeMB) << 20,
+		chunkURL:  strings.TrimRight(cfg.UploadsURL(), "/"),
+		client:    &http.Client{Timeout: 10 * time.Minute},
+		naming:    NewNaming(cfg.NamingConfig, SanitizePOSIX),
+		secretErr: errors.Join(passwordErr, tokenErr),
+	}
+}
+
+func (h *WebDAVHandler) Name() string { return "webdav" }
+
+func (h *WebDAVHandler) Available() bool {
+	return h.baseURL != "" && h.secretErr == nil
+}
+
+// Send creates missing collections and uploads the document. Documents
+// larger than the chunk size use Nextcloud's chunked upload.
+func (h *WebDAVHandler) Send(ctx context.Context, doc *jobs.Document) error {
+	if h.secretErr != nil {
+		return Permanent(fmt.Errorf("webdav credentials: %w", h.secretErr))
+	}
+	target, err := h.naming.Resolve(h.naming.Path(doc), func(p string) (bool, error) {
+		return h.exists(ctx, h.fileURL(p))
+	})
+	if err != nil {
+		return err
+	}
+	if err := h.mkcolAll(ctx, path.Dir(target)); err != nil {
+		return err
+	}
+
+	checksum, err := h.documentChecksum(doc)
+	if err != nil {
+		return err
+	}
+
+	if h.chunkSize > 0 && doc.Size > h.chunkSize {
+		return h.uploadChunked(ctx, doc, h.fileURL(target), checksum)
+	}
+	return h.put(ctx, doc, h.fileURL(target), checksum)
+}
+
+// Test authenticates with a PROPFIND of the configured collection. A
+// collection that does not exist yet is created by the first delivery.
+func (h *WebDAVHandler) Test(ctx context.Context) error {
+	if h.secretErr != nil {
+		return Permanent(fmt.Errorf("webdav credentials: %w", h.secretErr))
+	}
+	req, err := h.newRequest(ctx, "PROPFIND", h.baseURL+"/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Depth", "0")
+	_, err = h.do(req, http.StatusMultiStatus, http.StatusNotFound)
+	return err
+}
+
+// fileURL returns the URL of a path below the configured collection.
+func (h *WebDAVHandler) fileURL(p string) string {
+	return h.baseURL + escapePath(p)
+}
+
+// escapePath escapes each segment of a slash-separated path.
+func escapePath(p string) string {
+	var b strings.Builder
+	for _, seg := range strings.Split(strings.Trim(p, "/"), "/") {
+		if seg == "" || seg == "." {
+			continue
+		}
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(seg))
+	}
+	return b.String()
+}
+
+func (h *WebDAVHandler) newRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	switch {
+	case h.token != "":
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	case h.username != "":
+		req.SetBasicAuth(h.username, h.password)
+	}
+	return req, nil
+}
+
+// do sends a request and returns an error unless the status is one of ok.
+func (h *WebDAVHandler) do(req *http.Request, ok ...int) (int, error) {
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webdav %s: %w", req.Method, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp.StatusCode, nil
+		}
+	}
+	err = fmt.Errorf("webdav %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return resp.StatusCode, Permanent(err)
+	}
+	return resp.StatusCode, err
+}
+
+func (h *WebDAVHandler) exists(ctx context.Context, u string) (bool, error) {
+	req, err := h.newRequest(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return false, err
+	}
+	code, err := h.do(req, http.StatusOK, http.StatusNotFound)
+	return code == http.StatusOK, err
+}
+
+// mkcolAll creates the configured collection and every collection of dir
+// below it. Existing collections answer 405 Method Not Allowed.
+func (h *WebDAVHandler) mkcolAll(ctx context.Context, dir string) error {
+	u := h.baseURL
+	segments := []string{""}
+	if dir != "." && dir != "/" {
+		segments = append(segments, strings.Split(strings.Trim(dir, "/"), "/")...)
+	}
+	for i, seg := range segments {
+		if i > 0 {
+			u += "/" + url.PathEscape(seg)
+		}
+		req, err := h.newRequest(ctx, "MKCOL", u+"/", nil)
+		if err != nil {
+			return err
+		}
+		if _, err := h.do(req, http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+			return fmt.Errorf("create collection: %w", err)
+		}
+	}
+	return nil
+}
+
+func (h *WebDAVHandler) put(ctx context.Context, doc *jobs.Document, u, checksum string) error {
+	if doc.Open == nil {
+		return fmt.Errorf("document has no content")
+	}
+	r, err := doc.Open()
+	if err != nil {
+		return fmt.Errorf("open document: %w", err)
+	}
+	defer r.Close()
+
+	req, err := h.newRequest(ctx, http.MethodPut, u, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = doc.Size
+	if doc.Size <= 0 {
+		req.ContentLength = -1 // unknown, sent chunked
+	}
+	req.Header.Set("Content-Type", "application/pdf")
+	if checksum != "" {
+		req.Header.Set("OC-Checksum", checksum)
+	}
+	_, err = h.do(req, http.StatusCreated, http.StatusNoContent, http.StatusOK)
+	return err
+}
+
+// uploadChunked uploads a document with Nextcloud's chunked upload: the
+// chunks go into a temporary upload collection, which is then moved to the
+// target, where the server assembles them.
+func (h *WebDAVHandler) uploadChunked(ctx context.Context, doc *jobs.Document, dest, checksum string) error {
+	if doc.Open == nil {
+		return fmt.Errorf("document has no content")
+	}
+	var id [16]byte
+	rand.Read(id[:])
+	upload := h.chunkURL + "/scanflow-" + hex.EncodeToString(id[:])
+	total := strconv.FormatInt(doc.Size, 10)
+
+	req, err := h.newRequest(ctx, "MKCOL", upload+"/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Destination", dest)
+	if _, err := h.do(req, http.StatusCreated); err != nil {
+		return fmt.Errorf("create upload: %w", err)
+	}
+
+	err = h.putChunks(ctx, doc, upload, dest, total)
+	if err == nil {
+		req, err = h.newRequest(ctx, "MOVE", upload+"/.file", nil)
+		if err == nil {
+			req.Header.Set("Destination", dest)
+			req.Header.Set("OC-Total-Length", total)
+			req.Header.Set("Overwrite", "T")
+			if checksum != "" {
+				req.Header.Set("OC-Checksum", checksum)
+			}
+			_, err = h.do(req, http.StatusCreated, http.StatusNoContent)
+		}
+	}
+	if err != nil {
+		// Remove the chunks; Nextcloud also expires abandoned uploads.
+		if del, derr := h.newRequest(context.WithoutCancel(ctx), http.MethodDelete, upload+"/", nil); derr == nil {
+			h.do(del, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+		}
+		return fmt.Errorf("chunked upload: %w", err)
+	}
+	return nil
+}
+
+func (h *WebDAVHandler) putChunks(ctx context.Context, doc *jobs.Document, upload, dest, total string) error {
+	r, err := doc.Open()
+	if err != nil {
+		return fmt.Errorf("open document: %w", err)
+	}
+	defer r.Close()
+
+	for n, offset := 1, int64(0); offset < doc.Size; n++ {
+		size := min(h.chunkSize, doc.Size-offset)
+		req, err := h.newRequest(ctx, http.MethodPut, fmt.Sprintf("%s/%05d", upload, n), io.NopCloser(io.LimitReader(r, size)))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = size
+		req.Header.Set("Destination", dest)
+		req.Header.Set("OC-Total-Length", total)
+		if _, err := h.do(req, http.StatusCreated, http.StatusNoContent); err != nil {
+			return fmt.Errorf("chunk %d: %w", n, err)
+		}
+		offset += size
+	}
+	return nil
+}
+
+// documentChecksum returns the OC-Checksum header value, e.g.
+// "SHA256:<hex>", or "" when checksums are disabled.
+func (h *WebDAVHandler) documentChecksum(doc *jobs.Document) (string, error) {
+	var sum hash.Hash
+	switch h.checksum {
+	case "":
+		return "", nil
+	case "md5":
+		sum = md5.New()
+	case "sha1":
+		sum = sha1.New()
+	case "sha256":
+		sum = sha256.New()
+	default:
+		return "", Permanent(fmt.Errorf("unsupported checksum %q", h.checksum))
+	}
+	if _, err := copyDocument(sum, doc); err != nil {
+		return "", fmt.Errorf("checksum document: %w", err)
+	}
+	return strings.ToUpper(h.checksum) + ":" + hex.EncodeToString(sum.Sum(nil)), nil
+}
@@ -0,0 +1,241 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/thoscut/scanflow/server/internal/config"
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// davServer serves /remote.php/dav/files/scan/ from an in-memory WebDAV
+// file system. Chunked uploads under /remote.php/dav/uploads/scan/ are
+// assembled on MOVE of .file the way Nextcloud does.
+type davServer struct {
+	files, uploads webdav.FileSystem
+	auth           func(*http.Request) bool
+
+	mu       sync.Mutex
+	requests []string // method and path
+	headers  map[string]http.Header
+}
+
+func newDAVServer(t *testing.T, auth func(*http.Request) bool) (*davServer, string) {
+	t.Helper()
+	d := &davServer{
+		files:   webdav.NewMemFS(),
+		uploads: webdav.NewMemFS(),
+		auth:    auth,
+		headers: make(map[string]http.Header),
+	}
+	d.files.Mkdir(context.Background(), "/Scans", 0o755)
+
+	mux := http.NewServeMux()
+	mux.Handle("/remote.php/dav/files/scan/", &webdav.Handler{
+		Prefix: "/remote.php/dav/files/scan", FileSystem: d.files, LockSystem: webdav.NewMemLS(),
+	})
+	uploads := &webdav.Handler{
+		Prefix: "/remote.php/dav/uploads/scan", FileSystem: d.uploads, LockSystem: webdav.NewMemLS(),
+	}
+	mux.Handle("/remote.php/dav/uploads/scan/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "MOVE" && strings.HasSuffix(r.URL.Path, "/.file") {
+			d.assemble(w, r)
+			return
+		}
+		uploads.ServeHTTP(w, r)
+	}))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		d.requests = append(d.requests, r.Method+" "+r.URL.Path)
+		d.headers[r.Method] = r.Header.Clone()
+		d.mu.Unlock()
+		if !d.auth(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return d, srv.URL
+}
+
+// assemble concatenates the chunks of an upload into its destination.
+func (d *davServer) assemble(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	dir := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/.file"), "/remote.php/dav/uploads/scan")
+	dest := strings.TrimPrefix(r.Header.Get("Destination"), "http://"+r.Host+"/remote.php/dav/files/scan")
+
+	f, err := d.uploads.OpenFile(ctx, dir, os.O_RDONLY, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	chunks, _ := f.Readdir(-1)
+	f.Close()
+
+	var data bytes.Buffer
+	for i := range chunks {
+		c, err := d.uploads.OpenFile(ctx, fmt.Sprintf("%s/%05d", dir, i+1), os.O_RDONLY, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		io.Copy(&data, c)
+		c.Close()
+	}
+
+	out, err := d.files.OpenFile(ctx, dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	out.Write(data.Bytes())
+	out.Close()
+	d.uploads.RemoveAll(ctx, dir)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (d *davServer) read(t *testing.T, name string) string {
+	t.Helper()
+	f, err := d.files.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	return string(data)
+}
+
+func (d *davServer) count(method string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, r := range d.requests {
+		if strings.HasPrefix(r, method+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+func writeSecret(t *testing.T, secret string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(p, []byte(secret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWebDAVUploadCreatesCollections(t *testing.T) {
+	dav, base := newDAVServer(t, func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return ok && user == "scan" && pass == "s3cret"
+	})
+	h := NewWebDAVHandler(config.WebDAVConfig{
+		NamingConfig: config.NamingConfig{FilenamePattern: "{year}/{correspondent}/{title}"},
+		URL:          base + "/remote.php/dav/files/scan/Scans/",
+		Username:     "scan",
+		PasswordFile: writeSecret(t, "s3cret"),
+		Checksum:     "sha256",
+	})
+
+	content := []byte("%PDF-1.7 invoice")
+	doc := &jobs.Document{
+		Title:             "Invoice 42",
+		CorrespondentName: "ACME Corp",
+		Open:              jobs.BytesSource(content),
+		Size:              int64(len(content)),
+		ScannedAt:         time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC),
+	}
+	for range 2 {
+		if err := h.Send(context.Background(), doc); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	dir := "/Scans/2026/ACME Corp"
+	if got := dav.read(t, dir+"/Invoice 42.pdf"); got != string(content) {
+		t.Fatalf("unexpected content %q", got)
+	}
+	if got := dav.read(t, dir+"/Invoice 42_1.pdf"); got != string(content) {
+		t.Fatalf("expected a suffixed second upload, got %q", got)
+	}
+
+	sum := sha256.Sum256(content)
+	if got := dav.headers["PUT"].Get("OC-Checksum"); got != "SHA256:"+hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected checksum header %q", got)
+	}
+}
+
+func TestWebDAVChunkedUpload(t *testing.T) {
+	dav, base := newDAVServer(t, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer tok"
+	})
+	h := NewWebDAVHandler(config.WebDAVConfig{
+		URL:         base + "/remote.php/dav/files/scan/Scans",
+		TokenFile:   writeSecret(t, "tok"),
+		ChunkSizeMB: 1,
+		Checksum:    "md5",
+	})
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 160*1024) // 2.5 MiB
+	doc := &jobs.Document{Filename: "large.pdf", Open: jobs.BytesSource(content), Size: int64(len(content))}
+	if err := h.Send(context.Background(), doc); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := dav.read(t, "/Scans/large.pdf"); got != string(content) {
+		t.Fatalf("assembled document differs: %d bytes, want %d", len(got), len(content))
+	}
+	if n := dav.count("PUT"); n != 3 {
+		t.Errorf("expected 3 chunks, got %d", n)
+	}
+	move := dav.headers["MOVE"]
+	if move.Get("OC-Total-Length") != fmt.Sprint(len(content)) || !strings.HasPrefix(move.Get("OC-Checksum"), "MD5:") {
+		t.Errorf("unexpected MOVE headers: %v", move)
+	}
+}
+
+func TestWebDAVUnauthorizedIsPermanent(t *testing.T) {
+	_, base := newDAVServer(t, func(r *http.Request) bool { return false })
+	h := NewWebDAVHandler(config.WebDAVConfig{URL: base + "/remote.php/dav/files/scan/Scans", Username: "scan"})
+
+	err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf")), Size: 3})
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected permanent 401 error, got %v", err)
+	}
+}
+
+func TestWebDAVUnreadablePasswordFile(t *testing.T) {
+	h := NewWebDAVHandler(config.WebDAVConfig{
+		URL:          "https://cloud.example.com/remote.php/dav/files/scanner",
+		Username:     "scanner",
+		PasswordFile: filepath.Join(t.TempDir(), "missing"),
+	})
+	if h.Available() {
+		t.Error("handler with an unreadable password file must not be available")
+	}
+	if err := h.Test(context.Background()); !errors.Is(err, ErrPermanent) {
+		t.Errorf("Test = %v, want a permanent error", err)
+	}
+	if err := h.Send(context.Background(), &jobs.Document{Open: jobs.BytesSource([]byte("pdf"))}); !errors.Is(err, ErrPermanent) {
+		t.Errorf("Send = %v, want a permanent error", err)
+	}
+}
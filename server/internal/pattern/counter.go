@@ -0,0 +1,56 @@
+package pattern
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Counter is a running number for the {counter} placeholder. When created
+// with a path, its value survives restarts.
+type Counter struct {
+	mu    sync.Mutex
+	path  string
+	value int
+}
+
+// NewCounter creates a counter persisted to path. An empty path keeps the
+// counter in memory only.
+func NewCounter(path string) *Counter {
+	c := &Counter{path: path}
+	if path == "" {
+		return c
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read counter", "path", path, "error", err)
+		}
+		return c
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+		c.value = n
+	}
+	return c
+}
+
+// Next increments the counter and returns the new value.
+func (c *Counter) Next() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.value++
+	if c.path != "" {
+		err := os.MkdirAll(filepath.Dir(c.path), 0755)
+		if err == nil {
+			err = os.WriteFile(c.path, []byte(strconv.Itoa(c.value)+"\n"), 0644)
+		}
+		if err != nil {
+			slog.Warn("failed to persist counter", "path", c.path, "error", err)
+		}
+	}
+	return c.value
+}
@@ -0,0 +1,168 @@
+// Package pattern expands placeholders in document titles and filenames,
+// e.g. "Scan_{date}_{time}" or "{profile}/{date:YYYY}/{counter:4}".
+package pattern
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Vars holds the values placeholders are expanded from.
+type Vars struct {
+	Time    time.Time
+	Profile string
+	Device  string
+	JobID   string
+	Pages   int
+	Title   string
+	// Paperless IDs (or names) for filing documents into subdirectories.
+	Correspondent string
+	DocumentType  string
+	// Counter returns the next value of a running counter. It is only
+	// called when the pattern contains {counter}.
+	Counter func() int
+}
+
+// Expand replaces the placeholders in pattern with values from v:
+//
+//	{date}           2006-01-02       {date:DD.MM.YYYY}  custom format
+//	{time}           15-04-05         {time:HHmm}        custom format
+//	{datetime}       2006-01-02_15-04-05
+//	{year} {month} {day} {hour} {minute} {second}
+//	{profile} {device} {pages} {title} {correspondent} {document_type}
+//	{job_id}         full job ID      {job_id:8}         first 8 characters
+//	{counter}        running counter  {counter:4}        zero-padded to 4 digits
+//
+// Custom formats use the tokens YYYY, YY, MM, DD, HH, mm and ss. Unknown
+// placeholders are left unchanged.
+func Expand(pattern string, v Vars) string {
+	if !strings.Contains(pattern, "{") {
+		return pattern
+	}
+	if v.Time.IsZero() {
+		v.Time = time.Now()
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(pattern[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		b.WriteString(pattern[:start])
+		name, arg, _ := strings.Cut(pattern[start+1:end], ":")
+		if val, ok := v.lookup(name, arg); ok {
+			b.WriteString(val)
+		} else {
+			b.WriteString(pattern[start : end+1])
+		}
+		pattern = pattern[end+1:]
+	}
+	b.WriteString(pattern)
+	return b.String()
+}
+
+// Contains reports whether pattern uses the named placeholder.
+func Contains(pattern, name string) bool {
+	return strings.Contains(pattern, "{"+name+"}") || strings.Contains(pattern, "{"+name+":")
+}
+
+func (v Vars) lookup(name, arg string) (string, bool) {
+	t := v.Time
+	switch name {
+	case "date":
+		if arg != "" {
+			return formatTime(t, arg), true
+		}
+		return t.Format("2006-01-02"), true
+	case "time":
+		if arg != "" {
+			return formatTime(t, arg), true
+		}
+		return t.Format("15-04-05"), true
+	case "datetime":
+		return t.Format("2006-01-02_15-04-05"), true
+	case "year":
+		return t.Format("2006"), true
+	case "month":
+		return t.Format("01"), true
+	case "day":
+		return t.Format("02"), true
+	case "hour":
+		return t.Format("15"), true
+	case "minute":
+		return t.Format("04"), true
+	case "second":
+		return t.Format("05"), true
+	case "profile":
+		return v.Profile, true
+	case "device":
+		return v.Device, true
+	case "pages":
+		return strconv.Itoa(v.Pages), true
+	case "title":
+		return v.Title, true
+	case "correspondent":
+		return v.Correspondent, true
+	case "document_type":
+		return v.DocumentType, true
+	case "job_id":
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 && n < len(v.JobID) {
+			return v.JobID[:n], true
+		}
+		return v.JobID, true
+	case "counter":
+		n := 0
+		if v.Counter != nil {
+			n = v.Counter()
+		}
+		if width, err := strconv.Atoi(arg); err == nil && width > 0 {
+			s := strconv.Itoa(n)
+			if len(s) < width {
+				s = strings.Repeat("0", width-len(s)) + s
+			}
+			return s, true
+		}
+		return strconv.Itoa(n), true
+	}
+	return "", false
+}
+
+// layoutTokens maps the supported format tokens to Go layout elements,
+// longest token first.
+var layoutTokens = []struct{ token, layout string }{
+	{"YYYY", "2006"},
+	{"YY", "06"},
+	{"MM", "01"},
+	{"DD", "02"},
+	{"HH", "15"},
+	{"mm", "04"},
+	{"ss", "05"},
+}
+
+// formatTime formats t with a YYYY-MM-DD style format. Everything except the
+// tokens is copied literally, so digits or words like "Jan" in the format are
+// not read as Go layout elements.
+func formatTime(t time.Time, format string) string {
+	var b strings.Builder
+next:
+	for format != "" {
+		for _, tok := range layoutTokens {
+			if strings.HasPrefix(format, tok.token) {
+				b.WriteString(t.Format(tok.layout))
+				format = format[len(tok.token):]
+				continue next
+			}
+		}
+		b.WriteByte(format[0])
+		format = format[1:]
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package pattern
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	ts := time.Date(2024, 3, 7, 9, 5, 2, 0, time.UTC)
+	counter := 0
+	vars := Vars{
+		Time:    ts,
+		Profile: "standard",
+		Device:  "fujitsu:fi-7160",
+		JobID:   "0123456789abcdef",
+		Pages:   3,
+		Counter: func() int { counter++; return 41 + counter },
+	}
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"plain title", "plain title"},
+		{"Scan_{date}_{time}", "Scan_2024-03-07_09-05-02"},
+		{"{datetime}", "2024-03-07_09-05-02"},
+		{"{date:DD.MM.YYYY} {time:HH:mm}", "07.03.2024 09:05"},
+		{"{date:YY}{month}{day}", "240307"},
+		{"{date:YYYY_v1} {time:HH.mm Jan}", "2024_v1 09.05 Jan"},
+		{"{year}/{month}/{day} {hour}{minute}{second}", "2024/03/07 090502"},
+		{"{profile} on {device}", "standard on fujitsu:fi-7160"},
+		{"{pages} pages", "3 pages"},
+		{"{job_id}", "0123456789abcdef"},
+		{"{job_id:8}", "01234567"},
+		{"#{counter}", "#42"},
+		{"#{counter:5}", "#00043"},
+		{"{unknown} {date", "{unknown} {date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := Expand(tt.pattern, vars); got != tt.want {
+				t.Errorf("Expand(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandCounterOnlyWhenUsed(t *testing.T) {
+	called := false
+	Expand("Scan_{date}", Vars{Counter: func() int { called = true; return 1 }})
+	if called {
+		t.Error("counter must not advance for patterns without {counter}")
+	}
+}
+
+func TestContains(t *testing.T) {
+	if !Contains("a_{counter:4}", "counter") || !Contains("{counter}", "counter") {
+		t.Error("expected counter placeholder to be found")
+	}
+	if Contains("{date}", "counter") {
+		t.Error("unexpected counter placeholder")
+	}
+}
+
+func TestCounterPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "counter")
+
+	c := NewCounter(path)
+	if n := c.Next(); n != 1 {
+		t.Fatalf("first value = %d, want 1", n)
+	}
+	c.Next()
+
+	if n := NewCounter(path).Next(); n != 3 {
+		t.Fatalf("value after reload = %d, want 3", n)
+	}
+}
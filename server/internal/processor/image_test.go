@@ -52,26 +52,6 @@ func TestIsBlankPage(t *testing.T) {
 	}
 }
 
-func TestSanitizeFilename(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		{"Normal Name", "Normal_Name"},
-		{"file.pdf", "file.pdf"},
-		{"Hello World!", "Hello_World"},
-		{"", "document"},
-		{"test-file_123", "test-file_123"},
-	}
-
-	for _, tt := range tests {
-		result := sanitizeFilename(tt.input)
-		if result != tt.expected {
-			t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.input, result, tt.expected)
-		}
-	}
-}
-
 func TestValidOCRLang(t *testing.T) {
 	valid := []string{"eng", "deu", "deu+eng", "chi_sim", "chi_sim+eng"}
 	for _, lang := range valid {
@@ -4,9 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
-	"time"
+	"strings"
 
 	"github.com/thoscut/scanflow/server/internal/config"
 	"github.com/thoscut/scanflow/server/internal/jobs"
@@ -147,24 +148,37 @@ func (p *Pipeline) Process(ctx context.Context, job *jobs.Job, profile *config.P
 		Message:  "Finalizing document...",
 	})
 
-	pdfFile, err := os.Open(pdfPath)
-	if err != nil {
-		return nil, fmt.Errorf("open PDF: %w", err)
+	// The job directory is removed when processing returns, so the final
+	// PDF moves next to it and lives until the caller's delivery is done.
+	docPath := filepath.Join(p.tempDir, job.ID+".pdf")
+	if err := os.Rename(pdfPath, docPath); err != nil {
+		return nil, fmt.Errorf("keep PDF: %w", err)
 	}
 
-	stat, err := pdfFile.Stat()
+	stat, err := os.Stat(docPath)
 	if err != nil {
-		pdfFile.Close()
+		os.Remove(docPath)
 		return nil, fmt.Errorf("stat PDF: %w", err)
 	}
 
 	doc := &jobs.Document{
-		Reader: pdfFile,
-		Size:   stat.Size(),
+		Open:      jobs.FileSource(docPath),
+		Size:      stat.Size(),
+		Remove:    func() error { return os.Remove(docPath) },
+		JobID:     job.ID,
+		Profile:   job.Profile,
+		Pages:     len(imagePaths),
+		ScannedAt: job.CreatedAt,
 	}
 
-	// Set filename
-	doc.Filename = generateFilename(job)
+	// Output handlers name the file from their filename pattern unless the
+	// request asked for a specific name.
+	if name := job.Output.Filename; name != "" {
+		if !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+			name += ".pdf"
+		}
+		doc.Filename = name
+	}
 
 	// Set metadata from job
 	if job.Metadata != nil {
@@ -174,6 +188,19 @@ func (p *Pipeline) Process(ctx context.Context, job *jobs.Job, profile *config.P
 		doc.DocumentType = job.Metadata.DocumentType
 		doc.Tags = job.Metadata.Tags
 		doc.ArchiveSerial = job.Metadata.ArchiveSerialNumber
+		doc.CorrespondentName = job.Metadata.CorrespondentName
+		doc.DocumentTypeName = job.Metadata.DocumentTypeName
+		doc.TagNames = job.Metadata.TagNames
+	}
+	applyPaperless(doc, profile.Output.Paperless, job.Metadata)
+	applyRecipients(doc, profile.Output.Email, job.Metadata)
+	if pp := profile.Output.Print; pp != (config.ProfilePrint{}) {
+		doc.Print = &jobs.PrintOptions{
+			Copies:    pp.Copies,
+			Sides:     pp.Sides,
+			Media:     pp.Media,
+			ColorMode: pp.ColorMode,
+		}
 	}
 
 	job.SendProgress(jobs.ProgressUpdate{
@@ -191,28 +218,48 @@ func (p *Pipeline) Process(ctx context.Context, job *jobs.Job, profile *config.P
 	return doc, nil
 }
 
-func generateFilename(job *jobs.Job) string {
-	timestamp := time.Now().Format("20060102_150405")
-	title := "scan"
-	if job.Metadata != nil && job.Metadata.Title != "" {
-		title = sanitizeFilename(job.Metadata.Title)
+// applyRecipients sets the email recipients of a document. Recipients in
+// the scan request replace those of the profile.
+func applyRecipients(doc *jobs.Document, pe config.ProfileEmail, md *jobs.DocumentMetadata) {
+	if md != nil && md.Recipients != nil {
+		doc.Recipients = md.Recipients
+	} else if len(pe.To)+len(pe.Cc)+len(pe.Bcc) > 0 {
+		doc.Recipients = &jobs.Recipients{To: pe.To, Cc: pe.Cc, Bcc: pe.Bcc}
 	}
-	return fmt.Sprintf("%s_%s.pdf", title, timestamp)
 }
 
-func sanitizeFilename(name string) string {
-	result := make([]byte, 0, len(name))
-	for i := 0; i < len(name); i++ {
-		c := name[i]
-		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
-			c == '-' || c == '_' || c == '.' {
-			result = append(result, c)
-		} else if c == ' ' {
-			result = append(result, '_')
+// applyPaperless sets the storage path, custom fields, owner and
+// permissions of a document from the profile and the scan request. Request
+// values take precedence; custom fields are merged by name.
+func applyPaperless(doc *jobs.Document, pp config.ProfilePaperless, md *jobs.DocumentMetadata) {
+	doc.StoragePath = pp.StoragePath
+	doc.CustomFields = maps.Clone(pp.CustomFields)
+	doc.Owner = pp.Owner
+	if len(pp.ViewUsers)+len(pp.ViewGroups)+len(pp.ChangeUsers)+len(pp.ChangeGroups) > 0 {
+		doc.Permissions = &jobs.Permissions{
+			ViewUsers:    pp.ViewUsers,
+			ViewGroups:   pp.ViewGroups,
+			ChangeUsers:  pp.ChangeUsers,
+			ChangeGroups: pp.ChangeGroups,
 		}
 	}
-	if len(result) == 0 {
-		return "document"
+	if md == nil {
+		return
+	}
+
+	if md.StoragePath != "" {
+		doc.StoragePath = md.StoragePath
+	}
+	if len(md.CustomFields) > 0 {
+		if doc.CustomFields == nil {
+			doc.CustomFields = make(map[string]any, len(md.CustomFields))
+		}
+		maps.Copy(doc.CustomFields, md.CustomFields)
+	}
+	if md.Owner != "" {
+		doc.Owner = md.Owner
+	}
+	if md.Permissions != nil {
+		doc.Permissions = md.Permissions
 	}
-	return string(result)
 }
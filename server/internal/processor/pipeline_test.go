@@ -287,67 +287,6 @@ func TestCreatePDFDefaultQuality(t *testing.T) {
 	}
 }
 
-func TestGenerateFilename(t *testing.T) {
-	tests := []struct {
-		name     string
-		job      *jobs.Job
-		contains string
-	}{
-		{
-			name:     "with title",
-			job:      &jobs.Job{Metadata: &jobs.DocumentMetadata{Title: "Invoice"}},
-			contains: "Invoice_",
-		},
-		{
-			name:     "without metadata",
-			job:      &jobs.Job{},
-			contains: "scan_",
-		},
-		{
-			name:     "with empty title",
-			job:      &jobs.Job{Metadata: &jobs.DocumentMetadata{Title: ""}},
-			contains: "scan_",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			filename := generateFilename(tt.job)
-			if !strings.Contains(filename, tt.contains) {
-				t.Fatalf("expected filename containing %q, got %q", tt.contains, filename)
-			}
-			if !strings.HasSuffix(filename, ".pdf") {
-				t.Fatalf("expected .pdf suffix, got %q", filename)
-			}
-		})
-	}
-}
-
-func TestSanitizeFilenameSpecialChars(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		{"Normal Name", "Normal_Name"},
-		{"file.pdf", "file.pdf"},
-		{"Hello World!", "Hello_World"},
-		{"", "document"},
-		{"test-file_123", "test-file_123"},
-		{"über/scharf", "berscharf"},
-		{"path/../traversal", "path..traversal"},
-		{"a\tb\nc", "abc"},
-		{"日本語", "document"}, // non-ASCII only
-		{"mixed_日本語_test", "mixed__test"},
-	}
-
-	for _, tt := range tests {
-		result := sanitizeFilename(tt.input)
-		if result != tt.expected {
-			t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.input, result, tt.expected)
-		}
-	}
-}
-
 func TestRunOCRInvalidLanguage(t *testing.T) {
 	err := runOCR(context.Background(), "in.pdf", "out.pdf", "eng; rm -rf /", "")
 	if err == nil {
@@ -407,3 +346,58 @@ func TestPipelineSetOCR(t *testing.T) {
 		t.Fatalf("expected language to remain 'deu', got %s", p.ocrLanguage)
 	}
 }
+
+func TestApplyPaperlessRequestOverridesProfile(t *testing.T) {
+	profile := config.ProfilePaperless{
+		StoragePath:  "Finance",
+		CustomFields: map[string]any{"Department": "Accounting", "Checked": false},
+		Owner:        "alice",
+		ViewGroups:   []string{"Accounting"},
+	}
+
+	doc := &jobs.Document{}
+	applyPaperless(doc, profile, &jobs.DocumentMetadata{
+		CustomFields: map[string]any{"Checked": true},
+		Owner:        "bob",
+	})
+	if doc.StoragePath != "Finance" || doc.Owner != "bob" {
+		t.Errorf("unexpected storage path or owner: %q, %q", doc.StoragePath, doc.Owner)
+	}
+	if doc.CustomFields["Department"] != "Accounting" || doc.CustomFields["Checked"] != true {
+		t.Errorf("expected merged custom fields, got %v", doc.CustomFields)
+	}
+	if doc.Permissions == nil || len(doc.Permissions.ViewGroups) != 1 {
+		t.Errorf("expected profile permissions, got %+v", doc.Permissions)
+	}
+	if profile.CustomFields["Checked"] != false {
+		t.Error("the profile's custom fields must not be modified")
+	}
+
+	doc = &jobs.Document{}
+	applyPaperless(doc, config.ProfilePaperless{}, nil)
+	if doc.CustomFields != nil || doc.Permissions != nil || doc.Owner != "" {
+		t.Errorf("expected no Paperless values, got %+v", doc)
+	}
+}
+
+func TestApplyRecipientsRequestOverridesProfile(t *testing.T) {
+	profile := config.ProfileEmail{To: []string{"office@example.com"}, Bcc: []string{"archive@example.com"}}
+
+	doc := &jobs.Document{}
+	applyRecipients(doc, profile, &jobs.DocumentMetadata{Title: "Invoice"})
+	if doc.Recipients == nil || doc.Recipients.To[0] != "office@example.com" || doc.Recipients.Bcc[0] != "archive@example.com" {
+		t.Errorf("expected profile recipients, got %+v", doc.Recipients)
+	}
+
+	doc = &jobs.Document{}
+	applyRecipients(doc, profile, &jobs.DocumentMetadata{Recipients: &jobs.Recipients{To: []string{"tax@example.com"}}})
+	if doc.Recipients == nil || doc.Recipients.To[0] != "tax@example.com" || len(doc.Recipients.Bcc) != 0 {
+		t.Errorf("expected request recipients, got %+v", doc.Recipients)
+	}
+
+	doc = &jobs.Document{}
+	applyRecipients(doc, config.ProfileEmail{}, nil)
+	if doc.Recipients != nil {
+		t.Errorf("expected the output's recipients, got %+v", doc.Recipients)
+	}
+}
@@ -0,0 +1,230 @@
+package scanner
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thoscut/scanflow/server/internal/jobs"
+)
+
+// paperBackend simulates an ADF with a page-loaded sensor whose stack can be
+// refilled while a batch is running.
+type paperBackend struct {
+	stubBackend
+	mu    sync.Mutex
+	pages int
+}
+
+func (p *paperBackend) addPages(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pages += n
+}
+
+func (p *paperBackend) GetOption(name string) (any, error) {
+	if name == paperSensorOption {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.pages > 0, nil
+	}
+	return p.stubBackend.GetOption(name)
+}
+
+func (p *paperBackend) ReadImage() (image.Image, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pages <= 0 {
+		return nil, ErrNoDocs
+	}
+	p.pages--
+	return image.NewGray(image.Rect(0, 0, 10, 10)), nil
+}
+
+func newPaperScanner(t *testing.T, pages int) (*Scanner, *paperBackend) {
+	t.Helper()
+	backend := &paperBackend{pages: pages}
+	sc := New("", true, ScanOptions{})
+	sc.SetBackend(backend)
+	if err := sc.Init(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	return sc, backend
+}
+
+func collectPages(t *testing.T, pages <-chan *jobs.Page, timeout time.Duration) int {
+	t.Helper()
+	count := 0
+	deadline := time.After(timeout)
+	for {
+		select {
+		case page, ok := <-pages:
+			if !ok {
+				return count
+			}
+			if page.Err != nil {
+				t.Fatalf("page error: %v", page.Err)
+			}
+			count++
+		case <-deadline:
+			t.Fatalf("batch did not finish within %s (%d pages)", timeout, count)
+		}
+	}
+}
+
+func TestScanBatchWaitForPaper(t *testing.T) {
+	sc, backend := newPaperScanner(t, 0)
+
+	waiting := make(chan struct{}, 1)
+	pages, err := sc.ScanBatch(context.Background(), ScanOptions{
+		BatchMode:      BatchWaitForPaper,
+		OnWaitForPaper: func() { waiting <- struct{}{} },
+	})
+	if err != nil {
+		t.Fatalf("scan batch failed: %v", err)
+	}
+
+	<-waiting
+	time.Sleep(300 * time.Millisecond)
+	backend.addPages(2)
+
+	if got := collectPages(t, pages, 5*time.Second); got != 2 {
+		t.Fatalf("expected 2 pages, got %d", got)
+	}
+}
+
+func TestScanBatchWaitForPaperTimeout(t *testing.T) {
+	sc, _ := newPaperScanner(t, 0)
+
+	pages, err := sc.ScanBatch(context.Background(), ScanOptions{
+		BatchMode:        BatchWaitForPaper,
+		PaperWaitTimeout: 300 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("scan batch failed: %v", err)
+	}
+
+	if got := collectPages(t, pages, 5*time.Second); got != 0 {
+		t.Fatalf("expected no pages, got %d", got)
+	}
+}
+
+// sensorlessBackend is an ADF without a page-loaded sensor.
+type sensorlessBackend struct {
+	paperBackend
+}
+
+func (b *sensorlessBackend) GetOption(name string) (any, error) {
+	return b.stubBackend.GetOption(name)
+}
+
+func TestScanBatchWaitForPaperWithoutSensor(t *testing.T) {
+	backend := &sensorlessBackend{}
+	sc := New("", true, ScanOptions{})
+	sc.SetBackend(backend)
+	if err := sc.Init(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	pages, err := sc.ScanBatch(context.Background(), ScanOptions{
+		BatchMode:        BatchWaitForPaper,
+		PaperWaitTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("scan batch failed: %v", err)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	backend.addPages(2)
+
+	if got := collectPages(t, pages, 5*time.Second); got != 2 {
+		t.Fatalf("expected 2 pages, got %d", got)
+	}
+}
+
+func TestScanBatchContinuousFeed(t *testing.T) {
+	sc, backend := newPaperScanner(t, 1)
+
+	pages, err := sc.ScanBatch(context.Background(), ScanOptions{
+		BatchMode:       BatchContinuous,
+		FeedGracePeriod: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("scan batch failed: %v", err)
+	}
+
+	<-pages
+	time.Sleep(300 * time.Millisecond)
+	backend.addPages(2)
+
+	if got := collectPages(t, pages, 5*time.Second); got != 2 {
+		t.Fatalf("expected 2 more pages in the same batch, got %d", got)
+	}
+}
+
+func TestFinishBatchEndsContinuousSession(t *testing.T) {
+	sc, _ := newPaperScanner(t, 1)
+
+	if sc.FinishBatch() {
+		t.Fatal("expected FinishBatch to report no active session")
+	}
+
+	pages, err := sc.ScanBatch(context.Background(), ScanOptions{
+		BatchMode:       BatchContinuous,
+		FeedGracePeriod: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("scan batch failed: %v", err)
+	}
+	<-pages
+
+	if !sc.FinishBatch() {
+		t.Fatal("expected FinishBatch to end the active session")
+	}
+	if got := collectPages(t, pages, 2*time.Second); got != 0 {
+		t.Fatalf("expected no further pages, got %d", got)
+	}
+}
+
+func TestScanBatchUnknownMode(t *testing.T) {
+	sc, _ := newPaperScanner(t, 1)
+
+	if _, err := sc.ScanBatch(context.Background(), ScanOptions{BatchMode: "forever"}); err == nil {
+		t.Fatal("expected error for unknown batch mode")
+	}
+	// The scanner must not stay marked as busy.
+	pages, err := sc.ScanBatch(context.Background(), ScanOptions{})
+	if err != nil {
+		t.Fatalf("expected scanner to be usable again, got %v", err)
+	}
+	collectPages(t, pages, 2*time.Second)
+}
+
+func TestCloseDoesNotBlockOnUnreadPage(t *testing.T) {
+	backend := &readingBackend{started: make(chan struct{}, 1), proceed: make(chan struct{})}
+	sc := New("test:0", true, ScanOptions{})
+	sc.SetBackend(backend)
+	if err := sc.Init(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	if _, err := sc.ScanBatch(context.Background(), ScanOptions{}); err != nil {
+		t.Fatalf("ScanBatch: %v", err)
+	}
+	// Nobody reads the pages, so the scanned page can never be delivered.
+	<-backend.started
+	close(backend.proceed)
+
+	closed := make(chan struct{})
+	go func() {
+		sc.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on a page nobody reads")
+	}
+}
@@ -2,9 +2,13 @@
 
 package scanner
 
-import "os/exec"
+import (
+	"os/exec"
+	"strconv"
+	"time"
+)
 
-func (w *ButtonWatcher) playBeep() {
+func beep(d time.Duration) {
 	// Try system beep command (available on most Linux systems).
-	exec.Command("beep", "-f", "1000", "-l", "100").Run()
+	exec.Command("beep", "-f", "1000", "-l", strconv.FormatInt(d.Milliseconds(), 10)).Run()
 }
@@ -2,6 +2,8 @@
 
 package scanner
 
-func (w *ButtonWatcher) playBeep() {
+import "time"
+
+func beep(d time.Duration) {
 	// No system beep available on this platform.
 }
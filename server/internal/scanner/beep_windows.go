@@ -2,9 +2,13 @@
 
 package scanner
 
-import "os/exec"
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
 
-func (w *ButtonWatcher) playBeep() {
+func beep(d time.Duration) {
 	// Use PowerShell to emit a short beep on Windows.
-	exec.Command("powershell", "-c", "[console]::Beep(1000,100)").Run()
+	exec.Command("powershell", "-c", fmt.Sprintf("[console]::Beep(1000,%d)", d.Milliseconds())).Run()
 }
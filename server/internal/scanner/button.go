@@ -6,54 +6,115 @@ import (
 	"time"
 )
 
-// ButtonWatcher monitors the scanner hardware button via SANE polling
-// and distinguishes between short press (< threshold) and long press (>= threshold).
-type ButtonWatcher struct {
-	scanner       *Scanner
-	pollInterval  time.Duration
-	longPressDur  time.Duration
-	onShortPress  func()
-	onLongPress   func()
-	beepEnabled   bool
+// Gesture is a press pattern recognised on a scanner button.
+type Gesture string
+
+const (
+	GestureShort    Gesture = "short"
+	GestureLong     Gesture = "long"
+	GestureDouble   Gesture = "double"
+	GestureVeryLong Gesture = "very_long"
+)
+
+// functionOption is the SANE option fi-series and ScanSnap backends use to
+// report the number shown on the function display.
+const functionOption = "function"
+
+// ButtonBinding maps a gesture on a SANE button option (scan, email, file,
+// ...) to a named action.
+type ButtonBinding struct {
+	Button   string
+	Gesture  Gesture
+	Function int // only match this function number; -1 matches any
+	Action   string
+	Beep     []time.Duration // tones played when the gesture is recognised
+}
+
+// ButtonEvent is emitted when a gesture matches a binding.
+type ButtonEvent struct {
+	Button   string
+	Gesture  Gesture
+	Function int // -1 when the device has no function display
+	Action   string
+	Duration time.Duration
+}
 
+// buttonState tracks press timing for a single button option.
+type buttonState struct {
 	pressStart    time.Time
 	isPressed     bool
 	longPressBeep bool
+	secondPress   bool      // current press follows a short press within the double-press window
+	pendingShort  time.Time // release of a short press that may become a double press
+	pendingDur    time.Duration
+}
+
+// ButtonWatcher monitors the scanner hardware buttons via SANE polling and
+// recognises short, long, very long and double presses.
+type ButtonWatcher struct {
+	scanner        *Scanner
+	pollInterval   time.Duration
+	longPressDur   time.Duration
+	veryLongDur    time.Duration
+	doublePressWin time.Duration
+	beepEnabled    bool
+	bindings       []ButtonBinding
+	onEvent        func(ButtonEvent)
+
+	buttonNames []string
+	buttons     map[string]*buttonState
 }
 
 // ButtonConfig holds configuration for the button watcher.
 type ButtonConfig struct {
-	Enabled           bool
-	PollInterval      time.Duration
-	LongPressDuration time.Duration
-	ShortPressProfile string
-	LongPressProfile  string
-	Output            string
-	BeepOnLongPress   bool
+	PollInterval          time.Duration
+	LongPressDuration     time.Duration
+	VeryLongPressDuration time.Duration
+	DoublePressWindow     time.Duration
+	BeepOnLongPress       bool
+	Bindings              []ButtonBinding
 }
 
-// NewButtonWatcher creates a new button watcher with the given callbacks.
-func NewButtonWatcher(scanner *Scanner, cfg ButtonConfig, onShort, onLong func()) *ButtonWatcher {
+// NewGestureWatcher creates a button watcher that polls every button named
+// in cfg.Bindings and calls onEvent for each gesture that matches a binding.
+func NewGestureWatcher(scanner *Scanner, cfg ButtonConfig, onEvent func(ButtonEvent)) *ButtonWatcher {
 	if cfg.PollInterval == 0 {
 		cfg.PollInterval = 50 * time.Millisecond
 	}
 	if cfg.LongPressDuration == 0 {
 		cfg.LongPressDuration = 1 * time.Second
 	}
+	if cfg.VeryLongPressDuration == 0 {
+		cfg.VeryLongPressDuration = 3 * time.Second
+	}
+	if cfg.DoublePressWindow == 0 {
+		cfg.DoublePressWindow = 400 * time.Millisecond
+	}
 
-	return &ButtonWatcher{
-		scanner:      scanner,
-		pollInterval: cfg.PollInterval,
-		longPressDur: cfg.LongPressDuration,
-		onShortPress: onShort,
-		onLongPress:  onLong,
-		beepEnabled:  cfg.BeepOnLongPress,
+	w := &ButtonWatcher{
+		scanner:        scanner,
+		pollInterval:   cfg.PollInterval,
+		longPressDur:   cfg.LongPressDuration,
+		veryLongDur:    cfg.VeryLongPressDuration,
+		doublePressWin: cfg.DoublePressWindow,
+		beepEnabled:    cfg.BeepOnLongPress,
+		bindings:       cfg.Bindings,
+		onEvent:        onEvent,
+		buttons:        make(map[string]*buttonState),
+	}
+	for _, b := range cfg.Bindings {
+		if _, ok := w.buttons[b.Button]; !ok {
+			w.buttons[b.Button] = &buttonState{}
+			w.buttonNames = append(w.buttonNames, b.Button)
+		}
 	}
+	return w
 }
 
-// Start begins polling the scanner button. Blocks until context is cancelled.
+// Start begins polling the scanner buttons. Blocks until context is cancelled.
 func (w *ButtonWatcher) Start(ctx context.Context) {
 	slog.Info("button watcher started",
+		"buttons", w.buttonNames,
 		"poll_interval", w.pollInterval,
 		"long_press_threshold", w.longPressDur)
 
@@ -72,46 +133,156 @@ func (w *ButtonWatcher) Start(ctx context.Context) {
 }
 
 func (w *ButtonWatcher) poll() {
-	pressed, err := w.scanner.GetButtonState("scan")
-	if err != nil {
-		return // Scanner busy during scan
+	for _, name := range w.buttonNames {
+		pressed, err := w.scanner.GetButtonState(name)
+		if err != nil {
+			continue // Scanner busy during scan
+		}
+		w.update(name, w.buttons[name], pressed, time.Now())
 	}
+}
 
-	now := time.Now()
-
-	if pressed && !w.isPressed {
+func (w *ButtonWatcher) update(name string, st *buttonState, pressed bool, now time.Time) {
+	switch {
+	case pressed && !st.isPressed:
 		// Button just pressed - start timing
-		w.pressStart = now
-		w.isPressed = true
-		w.longPressBeep = false
-		slog.Debug("button pressed, measuring duration...")
+		st.pressStart = now
+		st.isPressed = true
+		st.longPressBeep = false
+		if !st.pendingShort.IsZero() {
+			st.pendingShort = time.Time{}
+			st.secondPress = true
+		}
+		slog.Debug("button pressed, measuring duration...", "button", name)
 
-	} else if pressed && w.isPressed {
+	case pressed && st.isPressed:
 		// Button held - check if long press threshold reached
-		if w.beepEnabled && !w.longPressBeep &&
-			now.Sub(w.pressStart) >= w.longPressDur {
+		if w.beepEnabled && !st.longPressBeep &&
+			now.Sub(st.pressStart) >= w.longPressDur {
 			w.playBeep()
-			w.longPressBeep = true
-			slog.Debug("long press threshold reached")
+			st.longPressBeep = true
+			slog.Debug("long press threshold reached", "button", name)
 		}
 
-	} else if !pressed && w.isPressed {
-		// Button released - determine action
-		w.isPressed = false
-		duration := now.Sub(w.pressStart)
-
-		if duration >= w.longPressDur {
-			slog.Info("long press detected", "duration", duration)
-			if w.onLongPress != nil {
-				go w.onLongPress()
-			}
-		} else {
-			slog.Info("short press detected", "duration", duration)
-			if w.onShortPress != nil {
-				go w.onShortPress()
-			}
+	case !pressed && st.isPressed:
+		// Button released - determine gesture
+		st.isPressed = false
+		duration := now.Sub(st.pressStart)
+
+		if st.secondPress {
+			st.secondPress = false
+			w.emit(name, GestureDouble, duration)
+			return
+		}
+
+		gesture := GestureShort
+		switch {
+		case duration >= w.veryLongDur && w.bound(name, GestureVeryLong):
+			gesture = GestureVeryLong
+		case duration >= w.longPressDur:
+			gesture = GestureLong
+		}
+
+		// Hold back a short press while a second press could still turn
+		// it into a double press.
+		if gesture == GestureShort && w.bound(name, GestureDouble) {
+			st.pendingShort = now
+			st.pendingDur = duration
+			return
+		}
+		w.emit(name, gesture, duration)
+
+	case !pressed && !st.pendingShort.IsZero():
+		if now.Sub(st.pendingShort) >= w.doublePressWin {
+			st.pendingShort = time.Time{}
+			w.emit(name, GestureShort, st.pendingDur)
+		}
+	}
+}
+
+// bound reports whether any binding uses gesture on the button.
+func (w *ButtonWatcher) bound(button string, gesture Gesture) bool {
+	for _, b := range w.bindings {
+		if b.Button == button && b.Gesture == gesture {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *ButtonWatcher) emit(button string, gesture Gesture, duration time.Duration) {
+	function := -1
+	if w.usesFunction(button) {
+		function = w.scanner.functionNumber()
+	}
+
+	binding, ok := w.match(button, gesture, function)
+	if !ok {
+		slog.Debug("no action bound to button gesture",
+			"button", button, "gesture", gesture, "function", function)
+		return
+	}
+
+	slog.Info("button gesture detected", "button", button, "gesture", gesture,
+		"function", function, "action", binding.Action, "duration", duration)
+
+	if len(binding.Beep) > 0 {
+		go w.playPattern(binding.Beep)
+	}
+	if w.onEvent != nil {
+		go w.onEvent(ButtonEvent{
+			Button:   button,
+			Gesture:  gesture,
+			Function: function,
+			Action:   binding.Action,
+			Duration: duration,
+		})
+	}
+}
+
+func (w *ButtonWatcher) usesFunction(button string) bool {
+	for _, b := range w.bindings {
+		if b.Button == button && b.Function >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the binding for a gesture, preferring one that names the
+// current function number over a catch-all binding.
+func (w *ButtonWatcher) match(button string, gesture Gesture, function int) (ButtonBinding, bool) {
+	var fallback *ButtonBinding
+	for i, b := range w.bindings {
+		if b.Button != button || b.Gesture != gesture {
+			continue
+		}
+		if b.Function >= 0 && b.Function == function {
+			return b, true
+		}
+		if b.Function < 0 && fallback == nil {
+			fallback = &w.bindings[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return ButtonBinding{}, false
+}
+
+// playBeep sounds the long-press threshold tone.
+func (w *ButtonWatcher) playBeep() {
+	beep(100 * time.Millisecond)
+}
+
+// playPattern sounds a sequence of tones separated by short pauses.
+func (w *ButtonWatcher) playPattern(tones []time.Duration) {
+	for i, d := range tones {
+		if i > 0 {
+			time.Sleep(100 * time.Millisecond)
 		}
+		beep(d)
 	}
 }
 
-// playBeep is implemented per-platform in beep_*.go files.
+// beep is implemented per-platform in beep_*.go files.
@@ -11,10 +11,10 @@ func TestButtonWatcherShortPress(t *testing.T) {
 		t.Fatalf("init failed: %v", err)
 	}
 
-	shortPressed := make(chan struct{}, 1)
-	bw := NewButtonWatcher(sc, ButtonConfig{LongPressDuration: time.Second}, func() {
-		shortPressed <- struct{}{}
-	}, nil)
+	bw, events := collectEvents(t, sc, ButtonConfig{
+		LongPressDuration: time.Second,
+		Bindings:          scanBindings,
+	})
 
 	backend := sc.backend.(*stubBackend)
 	if err := backend.SetOption("scan", true); err != nil {
@@ -22,17 +22,13 @@ func TestButtonWatcherShortPress(t *testing.T) {
 	}
 	bw.poll()
 
-	bw.pressStart = time.Now().Add(-500 * time.Millisecond)
+	bw.buttons["scan"].pressStart = time.Now().Add(-500 * time.Millisecond)
 	if err := backend.SetOption("scan", false); err != nil {
 		t.Fatalf("set released state failed: %v", err)
 	}
 	bw.poll()
 
-	select {
-	case <-shortPressed:
-	case <-time.After(time.Second):
-		t.Fatal("expected short press callback")
-	}
+	expectEvent(t, events, "scan", GestureShort, "short")
 }
 
 func TestButtonWatcherLongPressThresholdBeep(t *testing.T) {
@@ -41,12 +37,10 @@ func TestButtonWatcherLongPressThresholdBeep(t *testing.T) {
 		t.Fatalf("init failed: %v", err)
 	}
 
-	longPressed := make(chan struct{}, 1)
-	bw := NewButtonWatcher(sc, ButtonConfig{
+	bw, events := collectEvents(t, sc, ButtonConfig{
 		LongPressDuration: 100 * time.Millisecond,
 		BeepOnLongPress:   true,
-	}, nil, func() {
-		longPressed <- struct{}{}
+		Bindings:          scanBindings,
 	})
 
 	backend := sc.backend.(*stubBackend)
@@ -55,9 +49,9 @@ func TestButtonWatcherLongPressThresholdBeep(t *testing.T) {
 	}
 	bw.poll()
 
-	bw.pressStart = time.Now().Add(-200 * time.Millisecond)
+	bw.buttons["scan"].pressStart = time.Now().Add(-200 * time.Millisecond)
 	bw.poll()
-	if !bw.longPressBeep {
+	if !bw.buttons["scan"].longPressBeep {
 		t.Fatal("expected long press beep marker to be set")
 	}
 
@@ -66,9 +60,160 @@ func TestButtonWatcherLongPressThresholdBeep(t *testing.T) {
 	}
 	bw.poll()
 
+	expectEvent(t, events, "scan", GestureLong, "long")
+}
+
+// scanBindings binds short and long presses of the scan button.
+var scanBindings = []ButtonBinding{
+	{Button: "scan", Gesture: GestureShort, Function: -1, Action: "short"},
+	{Button: "scan", Gesture: GestureLong, Function: -1, Action: "long"},
+}
+
+// pressFor simulates pressing and releasing a button for the given duration
+// ending at now.
+func pressFor(w *ButtonWatcher, button string, d time.Duration, now time.Time) {
+	st := w.buttons[button]
+	w.update(button, st, true, now.Add(-d))
+	w.update(button, st, false, now)
+}
+
+func collectEvents(t *testing.T, sc *Scanner, cfg ButtonConfig) (*ButtonWatcher, chan ButtonEvent) {
+	t.Helper()
+	events := make(chan ButtonEvent, 4)
+	return NewGestureWatcher(sc, cfg, func(ev ButtonEvent) { events <- ev }), events
+}
+
+func expectEvent(t *testing.T, events chan ButtonEvent, button string, gesture Gesture, action string) {
+	t.Helper()
 	select {
-	case <-longPressed:
+	case ev := <-events:
+		if ev.Button != button || ev.Gesture != gesture || ev.Action != action {
+			t.Fatalf("got %s/%s -> %q, want %s/%s -> %q",
+				ev.Button, ev.Gesture, ev.Action, button, gesture, action)
+		}
 	case <-time.After(time.Second):
-		t.Fatal("expected long press callback")
+		t.Fatalf("expected %s/%s event", button, gesture)
 	}
 }
+
+func expectNoEvent(t *testing.T, events chan ButtonEvent) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestButtonWatcherMultipleButtons(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	bw, events := collectEvents(t, sc, ButtonConfig{Bindings: []ButtonBinding{
+		{Button: "scan", Gesture: GestureShort, Function: -1, Action: "document"},
+		{Button: "email", Gesture: GestureShort, Function: -1, Action: "mail"},
+	}})
+	if len(bw.buttonNames) != 2 {
+		t.Fatalf("expected 2 polled buttons, got %v", bw.buttonNames)
+	}
+
+	backend := sc.backend.(*stubBackend)
+	backend.SetOption("email", true)
+	bw.poll()
+	backend.SetOption("email", false)
+	bw.poll()
+
+	expectEvent(t, events, "email", GestureShort, "mail")
+}
+
+func TestButtonWatcherDoublePress(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	bw, events := collectEvents(t, sc, ButtonConfig{
+		DoublePressWindow: 300 * time.Millisecond,
+		Bindings: []ButtonBinding{
+			{Button: "scan", Gesture: GestureShort, Function: -1, Action: "single"},
+			{Button: "scan", Gesture: GestureDouble, Function: -1, Action: "twice"},
+		},
+	})
+
+	now := time.Now()
+	pressFor(bw, "scan", 100*time.Millisecond, now)
+	expectNoEvent(t, events) // short press is held back
+
+	pressFor(bw, "scan", 100*time.Millisecond, now.Add(250*time.Millisecond))
+	expectEvent(t, events, "scan", GestureDouble, "twice")
+
+	// A lone short press fires once the double-press window has passed.
+	later := now.Add(time.Second)
+	pressFor(bw, "scan", 100*time.Millisecond, later)
+	bw.update("scan", bw.buttons["scan"], false, later.Add(100*time.Millisecond))
+	expectNoEvent(t, events)
+	bw.update("scan", bw.buttons["scan"], false, later.Add(350*time.Millisecond))
+	expectEvent(t, events, "scan", GestureShort, "single")
+}
+
+func TestButtonWatcherVeryLongPress(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	bw, events := collectEvents(t, sc, ButtonConfig{
+		LongPressDuration:     time.Second,
+		VeryLongPressDuration: 3 * time.Second,
+		Bindings: []ButtonBinding{
+			{Button: "scan", Gesture: GestureLong, Function: -1, Action: "long"},
+			{Button: "scan", Gesture: GestureVeryLong, Function: -1, Action: "very-long"},
+		},
+	})
+
+	now := time.Now()
+	pressFor(bw, "scan", 1500*time.Millisecond, now)
+	expectEvent(t, events, "scan", GestureLong, "long")
+
+	pressFor(bw, "scan", 4*time.Second, now.Add(10*time.Second))
+	expectEvent(t, events, "scan", GestureVeryLong, "very-long")
+}
+
+func TestButtonWatcherVeryLongFallsBackToLong(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	bw, events := collectEvents(t, sc, ButtonConfig{Bindings: []ButtonBinding{
+		{Button: "scan", Gesture: GestureLong, Function: -1, Action: "long"},
+	}})
+
+	pressFor(bw, "scan", 5*time.Second, time.Now())
+	expectEvent(t, events, "scan", GestureLong, "long")
+}
+
+func TestButtonWatcherFunctionNumber(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	bw, events := collectEvents(t, sc, ButtonConfig{Bindings: []ButtonBinding{
+		{Button: "scan", Gesture: GestureShort, Function: -1, Action: "default"},
+		{Button: "scan", Gesture: GestureShort, Function: 2, Action: "photo"},
+	}})
+
+	backend := sc.backend.(*stubBackend)
+	backend.SetOption("function", 2)
+	pressFor(bw, "scan", 100*time.Millisecond, time.Now())
+	expectEvent(t, events, "scan", GestureShort, "photo")
+
+	backend.SetOption("function", 5)
+	pressFor(bw, "scan", 100*time.Millisecond, time.Now())
+	expectEvent(t, events, "scan", GestureShort, "default")
+}
+
+func TestButtonWatcherUnboundGesture(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	bw, events := collectEvents(t, sc, ButtonConfig{Bindings: []ButtonBinding{
+		{Button: "scan", Gesture: GestureShort, Function: -1, Action: "document"},
+	}})
+
+	pressFor(bw, "scan", 2*time.Second, time.Now())
+	expectNoEvent(t, events)
+}
@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Status mirrors the SANE_Status codes reported by scanner backends.
+type Status int
+
+const (
+	StatusGood         Status = 0
+	StatusUnsupported  Status = 1
+	StatusCancelled    Status = 2
+	StatusDeviceBusy   Status = 3
+	StatusInvalid      Status = 4
+	StatusEOF          Status = 5
+	StatusJammed       Status = 6
+	StatusNoDocs       Status = 7
+	StatusCoverOpen    Status = 8
+	StatusIOError      Status = 9
+	StatusNoMem        Status = 10
+	StatusAccessDenied Status = 11
+
+	// StatusDoubleFeed has no SANE equivalent; backends with ultrasonic
+	// double-feed detection report it as a jam with a dedicated message.
+	StatusDoubleFeed Status = 100
+)
+
+// String returns the SANE status message (as returned by sane_strstatus).
+func (s Status) String() string {
+	switch s {
+	case StatusGood:
+		return "Success"
+	case StatusUnsupported:
+		return "Operation not supported"
+	case StatusCancelled:
+		return "Operation was cancelled"
+	case StatusDeviceBusy:
+		return "Device busy"
+	case StatusInvalid:
+		return "Invalid argument"
+	case StatusEOF:
+		return "End of file reached"
+	case StatusJammed:
+		return "Document feeder jammed"
+	case StatusNoDocs:
+		return "Document feeder out of documents"
+	case StatusCoverOpen:
+		return "Scanner cover is open"
+	case StatusIOError:
+		return "Error during device I/O"
+	case StatusNoMem:
+		return "Out of memory"
+	case StatusAccessDenied:
+		return "Access to resource has been denied"
+	case StatusDoubleFeed:
+		return "Double feed detected"
+	}
+	return fmt.Sprintf("Unknown SANE status %d", int(s))
+}
+
+// StatusError is a scanner error carrying a SANE status. Two StatusErrors
+// match with errors.Is when their statuses are equal, so the sentinel errors
+// below can be used regardless of the backend's message.
+type StatusError struct {
+	Status Status
+	Msg    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Msg != "" {
+		return e.Msg
+	}
+	return strings.ToLower(e.Status.String())
+}
+
+func (e *StatusError) Is(target error) bool {
+	t, ok := target.(*StatusError)
+	return ok && t.Status == e.Status
+}
+
+var (
+	ErrNoDocs     = &StatusError{Status: StatusNoDocs}
+	ErrEOF        = &StatusError{Status: StatusEOF}
+	ErrJammed     = &StatusError{Status: StatusJammed}
+	ErrCoverOpen  = &StatusError{Status: StatusCoverOpen}
+	ErrDoubleFeed = &StatusError{Status: StatusDoubleFeed}
+	ErrDeviceBusy = &StatusError{Status: StatusDeviceBusy}
+	ErrIOError    = &StatusError{Status: StatusIOError}
+)
+
+// FromStatus converts a raw SANE status code into an error. It returns nil
+// for StatusGood.
+func FromStatus(code int) error {
+	if Status(code) == StatusGood {
+		return nil
+	}
+	return &StatusError{Status: Status(code)}
+}
+
+// Classify maps an arbitrary backend error onto a StatusError. Errors that
+// already carry a status are returned unchanged; plain errors are matched by
+// their sane_strstatus message. Unrecognised errors are returned as-is.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return err
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "double feed"), strings.Contains(msg, "multifeed"),
+		strings.Contains(msg, "multi-feed"):
+		return &StatusError{Status: StatusDoubleFeed, Msg: err.Error()}
+	case strings.Contains(msg, "out of documents"):
+		return &StatusError{Status: StatusNoDocs, Msg: err.Error()}
+	case strings.Contains(msg, "jammed"):
+		return &StatusError{Status: StatusJammed, Msg: err.Error()}
+	case strings.Contains(msg, "cover is open"):
+		return &StatusError{Status: StatusCoverOpen, Msg: err.Error()}
+	case strings.Contains(msg, "device busy"):
+		return &StatusError{Status: StatusDeviceBusy, Msg: err.Error()}
+	case strings.Contains(msg, "end of file"), strings.Contains(msg, "no more data available"):
+		return &StatusError{Status: StatusEOF, Msg: err.Error()}
+	case strings.Contains(msg, "device i/o"):
+		return &StatusError{Status: StatusIOError, Msg: err.Error()}
+	}
+	return err
+}
+
+// IsRecoverable reports whether err is a paper-handling fault that an
+// operator can clear at the device (jam, double feed, open cover, busy),
+// after which the batch can be resumed.
+func IsRecoverable(err error) bool {
+	return errors.Is(err, ErrJammed) ||
+		errors.Is(err, ErrDoubleFeed) ||
+		errors.Is(err, ErrCoverOpen) ||
+		errors.Is(err, ErrDeviceBusy)
+}
+
+func isEndOfFeed(err error) bool {
+	err = Classify(err)
+	return errors.Is(err, ErrNoDocs) || errors.Is(err, ErrEOF)
+}
@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClassifySANEMessages(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want error
+	}{
+		{"document feeder out of documents", ErrNoDocs},
+		{"Document feeder jammed", ErrJammed},
+		{"Scanner cover is open", ErrCoverOpen},
+		{"double feed detected", ErrDoubleFeed},
+		{"Device busy", ErrDeviceBusy},
+		{"Error during device I/O", ErrIOError},
+		{"end of file", ErrEOF},
+		{"no more data available", ErrEOF},
+	}
+
+	for _, tt := range tests {
+		got := Classify(errors.New(tt.msg))
+		if !errors.Is(got, tt.want) {
+			t.Errorf("Classify(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+		if got.Error() != tt.msg {
+			t.Errorf("Classify(%q) changed message to %q", tt.msg, got.Error())
+		}
+	}
+}
+
+func TestClassifyUnknownError(t *testing.T) {
+	orig := errors.New("something else")
+	if got := Classify(orig); got != orig {
+		t.Fatalf("expected unknown error to be returned unchanged, got %v", got)
+	}
+	if Classify(nil) != nil {
+		t.Fatal("expected nil for nil error")
+	}
+}
+
+func TestFromStatus(t *testing.T) {
+	if FromStatus(0) != nil {
+		t.Fatal("expected nil for SANE_STATUS_GOOD")
+	}
+	if err := FromStatus(6); !errors.Is(err, ErrJammed) {
+		t.Fatalf("expected ErrJammed for status 6, got %v", err)
+	}
+	if err := FromStatus(7); !errors.Is(err, ErrNoDocs) {
+		t.Fatalf("expected ErrNoDocs for status 7, got %v", err)
+	}
+}
+
+func TestIsRecoverable(t *testing.T) {
+	for _, err := range []error{ErrJammed, ErrDoubleFeed, ErrCoverOpen, ErrDeviceBusy} {
+		if !IsRecoverable(err) {
+			t.Errorf("expected %v to be recoverable", err)
+		}
+	}
+	for _, err := range []error{ErrIOError, ErrNoDocs, errors.New("other")} {
+		if IsRecoverable(err) {
+			t.Errorf("expected %v not to be recoverable", err)
+		}
+	}
+}
+
+func TestScanBatchReportsTypedFault(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.SetBackend(NewFaultBackend(2, errors.New("Document feeder jammed")))
+	sc.Init()
+
+	pages, err := sc.ScanBatch(context.Background(), ScanOptions{})
+	if err != nil {
+		t.Fatalf("scan batch failed: %v", err)
+	}
+
+	count := 0
+	var fault error
+	for page := range pages {
+		if page.Err != nil {
+			fault = page.Err
+			continue
+		}
+		count++
+	}
+
+	if count != 2 {
+		t.Fatalf("expected 2 pages before the jam, got %d", count)
+	}
+	if !errors.Is(fault, ErrJammed) {
+		t.Fatalf("expected ErrJammed, got %v", fault)
+	}
+}
@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DeviceEventType identifies a change in scanner device availability.
+type DeviceEventType string
+
+const (
+	DeviceOnline  DeviceEventType = "device_online"
+	DeviceOffline DeviceEventType = "device_offline"
+)
+
+// DeviceEvent is emitted by the DeviceMonitor when the configured scanner
+// disappears or reappears.
+type DeviceEvent struct {
+	Type   DeviceEventType
+	Device string
+	Time   time.Time
+}
+
+// DeviceMonitor periodically rediscovers scanner devices to detect unplugged,
+// power-cycled or sleeping scanners and re-opens the device once it returns.
+type DeviceMonitor struct {
+	scanner  *Scanner
+	interval time.Duration
+	onEvent  func(DeviceEvent)
+
+	// lost is set when the monitor is waiting for the device to reappear.
+	lost bool
+}
+
+// NewDeviceMonitor creates a device monitor that calls onEvent for every
+// online/offline transition.
+func NewDeviceMonitor(scanner *Scanner, interval time.Duration, onEvent func(DeviceEvent)) *DeviceMonitor {
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	return &DeviceMonitor{
+		scanner:  scanner,
+		interval: interval,
+		onEvent:  onEvent,
+	}
+}
+
+// Start begins monitoring the scanner device. Blocks until context is cancelled.
+func (m *DeviceMonitor) Start(ctx context.Context) {
+	// A device that should have been opened at startup but was not present
+	// (e.g. switched off) is treated as lost so it is opened once it appears.
+	m.lost = m.scanner.autoOpen && !m.scanner.IsConnected()
+
+	slog.Info("device monitor started", "interval", m.interval)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("device monitor stopped")
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+func (m *DeviceMonitor) check() {
+	devices, err := m.scanner.Discover()
+	if err != nil {
+		slog.Warn("device discovery failed", "error", err)
+		return
+	}
+
+	name := m.scanner.DeviceName()
+	present := false
+	if name == "" {
+		// Auto-detect: any device will do.
+		if len(devices) > 0 {
+			name = devices[0].Name
+			present = true
+		}
+	} else {
+		for _, d := range devices {
+			if d.Name == name {
+				present = true
+				break
+			}
+		}
+	}
+
+	connected := m.scanner.IsConnected()
+
+	switch {
+	case connected && !present:
+		slog.Warn("scanner device disappeared", "device", name)
+		m.lost = true
+		m.emit(DeviceEvent{Type: DeviceOffline, Device: name})
+		// Drop the dead handle so that IsConnected reflects reality. Close
+		// waits for an active batch to stop reading before it does so.
+		m.scanner.Close()
+
+	case !connected && present && m.lost:
+		if err := m.scanner.Open(name); err != nil {
+			slog.Warn("failed to re-open scanner", "device", name, "error", err)
+			return
+		}
+		slog.Info("scanner device reconnected", "device", name)
+		m.lost = false
+		m.emit(DeviceEvent{Type: DeviceOnline, Device: name})
+	}
+}
+
+func (m *DeviceMonitor) emit(ev DeviceEvent) {
+	ev.Time = time.Now()
+	if m.onEvent != nil {
+		m.onEvent(ev)
+	}
+}
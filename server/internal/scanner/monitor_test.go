@@ -0,0 +1,158 @@
+package scanner
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hotplugBackend is a stub backend whose device can be unplugged.
+type hotplugBackend struct {
+	stubBackend
+	unplugged bool
+}
+
+func (h *hotplugBackend) ListDevices() ([]Device, error) {
+	if h.unplugged {
+		return nil, nil
+	}
+	return h.stubBackend.ListDevices()
+}
+
+func TestDeviceMonitorDetectsOfflineAndReconnects(t *testing.T) {
+	backend := &hotplugBackend{}
+	sc := New("test:0", true, ScanOptions{})
+	sc.SetBackend(backend)
+	if err := sc.Init(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if !sc.IsConnected() {
+		t.Fatal("expected connected after init")
+	}
+
+	var events []DeviceEvent
+	m := NewDeviceMonitor(sc, 0, func(ev DeviceEvent) {
+		events = append(events, ev)
+	})
+
+	// Device still present: nothing happens.
+	m.check()
+	if len(events) != 0 {
+		t.Fatalf("expected no events, got %d", len(events))
+	}
+
+	backend.unplugged = true
+	m.check()
+	if sc.IsConnected() {
+		t.Fatal("expected disconnected after device disappeared")
+	}
+	if len(events) != 1 || events[0].Type != DeviceOffline || events[0].Device != "test:0" {
+		t.Fatalf("expected device_offline event for test:0, got %+v", events)
+	}
+
+	// Still gone: no duplicate event.
+	m.check()
+	if len(events) != 1 {
+		t.Fatalf("expected a single offline event, got %d", len(events))
+	}
+
+	backend.unplugged = false
+	m.check()
+	if !sc.IsConnected() {
+		t.Fatal("expected scanner to be re-opened")
+	}
+	if len(events) != 2 || events[1].Type != DeviceOnline {
+		t.Fatalf("expected device_online event, got %+v", events)
+	}
+}
+
+func TestDeviceMonitorDoesNotReopenManuallyClosedDevice(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	if err := sc.Init(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	sc.Close()
+
+	m := NewDeviceMonitor(sc, 0, nil)
+	m.check()
+
+	if sc.IsConnected() {
+		t.Fatal("monitor should not re-open a device that was closed on purpose")
+	}
+}
+
+// readingBackend blocks in ReadImage until released and records whether the
+// device was closed while a read was in progress.
+type readingBackend struct {
+	stubBackend
+	mu               sync.Mutex
+	reading          bool
+	closedMidRead    bool
+	started, proceed chan struct{}
+}
+
+func (r *readingBackend) ReadImage() (image.Image, error) {
+	r.mu.Lock()
+	r.reading = true
+	r.mu.Unlock()
+	r.started <- struct{}{}
+	<-r.proceed
+	r.mu.Lock()
+	r.reading = false
+	r.mu.Unlock()
+	return image.NewGray(image.Rect(0, 0, 10, 10)), nil
+}
+
+func (r *readingBackend) CloseDevice() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reading {
+		r.closedMidRead = true
+	}
+	r.stubBackend.CloseDevice()
+}
+
+func TestCloseWaitsForActiveRead(t *testing.T) {
+	backend := &readingBackend{started: make(chan struct{}, 1), proceed: make(chan struct{})}
+	sc := New("test:0", true, ScanOptions{})
+	sc.SetBackend(backend)
+	if err := sc.Init(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	pages, err := sc.ScanBatch(context.Background(), ScanOptions{})
+	if err != nil {
+		t.Fatalf("ScanBatch: %v", err)
+	}
+	go func() {
+		for range pages {
+		}
+	}()
+	<-backend.started
+
+	closed := make(chan struct{})
+	go func() {
+		sc.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a read was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(backend.proceed)
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return after the read finished")
+	}
+	if backend.closedMidRead {
+		t.Error("device closed during an active read")
+	}
+	if sc.IsConnected() {
+		t.Error("expected disconnected after Close")
+	}
+}
@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Area is a scan region in millimetres, measured from the top-left corner of
+// the scan surface (SANE options tl-x, tl-y, br-x, br-y).
+type Area struct {
+	TLX float64
+	TLY float64
+	BRX float64
+	BRY float64
+}
+
+// paperSizes maps paper size presets to width and height in millimetres.
+var paperSizes = map[string][2]float64{
+	"a3":          {297, 420},
+	"a4":          {210, 297},
+	"a5":          {148, 210},
+	"a6":          {105, 148},
+	"b5":          {176, 250},
+	"letter":      {215.9, 279.4},
+	"legal":       {215.9, 355.6},
+	"id_card":     {85.6, 53.98},
+	"photo_9x13":  {89, 127},
+	"photo_10x15": {102, 152},
+	"photo_13x18": {127, 178},
+}
+
+// PaperSize returns the dimensions of a paper size preset in millimetres.
+func PaperSize(name string) (width, height float64, ok bool) {
+	size, ok := paperSizes[strings.ToLower(name)]
+	return size[0], size[1], ok
+}
+
+// PaperSizeNames returns the names of all paper size presets, sorted.
+func PaperSizeNames() []string {
+	names := make([]string, 0, len(paperSizes))
+	for name := range paperSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OptionRange is the numeric range a backend accepts for an option
+// (SANE_CONSTRAINT_RANGE).
+type OptionRange struct {
+	Min float64
+	Max float64
+}
+
+// OptionDescriber is implemented by backends that can report option
+// constraints. Backends without it are validated against GetCapabilities
+// only.
+type OptionDescriber interface {
+	OptionRange(name string) (OptionRange, bool)
+}
+
+// area returns the effective scan region: an explicit area wins over a paper
+// size preset. It returns nil when the whole surface should be scanned.
+func (o ScanOptions) area() *Area {
+	if o.Area != nil {
+		return o.Area
+	}
+	if o.PaperSize != "" {
+		if w, h, ok := PaperSize(o.PaperSize); ok {
+			return &Area{BRX: w, BRY: h}
+		}
+	}
+	return nil
+}
+
+// pageSize returns the ADF page dimensions, taking a paper size preset into
+// account.
+func (o ScanOptions) pageSize() (width, height float64) {
+	if o.PaperSize != "" {
+		if w, h, ok := PaperSize(o.PaperSize); ok {
+			return w, h
+		}
+	}
+	return o.PageWidth, o.PageHeight
+}
+
+// validateOptions checks options against the device constraints reported by
+// the backend, falling back to the scanner capabilities.
+func validateOptions(backend ScannerBackend, caps Capabilities, opts ScanOptions) error {
+	describer, _ := backend.(OptionDescriber)
+	rangeOf := func(name string) (OptionRange, bool) {
+		if describer == nil {
+			return OptionRange{}, false
+		}
+		return describer.OptionRange(name)
+	}
+
+	switch opts.BatchMode {
+	case "", BatchSingle, BatchWaitForPaper, BatchContinuous:
+	default:
+		return fmt.Errorf("unknown batch mode %q", opts.BatchMode)
+	}
+
+	if opts.PaperSize != "" {
+		if _, _, ok := PaperSize(opts.PaperSize); !ok {
+			return fmt.Errorf("unknown paper size %q (supported: %s)",
+				opts.PaperSize, strings.Join(PaperSizeNames(), ", "))
+		}
+	}
+
+	if area := opts.area(); area != nil {
+		if area.TLX < 0 || area.TLY < 0 {
+			return fmt.Errorf("scan area must not start at negative coordinates")
+		}
+		if area.BRX <= area.TLX || area.BRY <= area.TLY {
+			return fmt.Errorf("scan area must have a positive width and height")
+		}
+		maxX, maxY := caps.MaxWidth, caps.MaxHeight
+		if r, ok := rangeOf("br-x"); ok {
+			maxX = r.Max
+		}
+		if r, ok := rangeOf("br-y"); ok {
+			maxY = r.Max
+		}
+		if maxX > 0 && area.BRX > maxX {
+			return fmt.Errorf("scan area width %.1fmm exceeds device maximum %.1fmm", area.BRX, maxX)
+		}
+		if maxY > 0 && area.BRY > maxY {
+			return fmt.Errorf("scan area height %.1fmm exceeds device maximum %.1fmm", area.BRY, maxY)
+		}
+	}
+
+	for _, opt := range []struct {
+		name  string
+		value int
+	}{
+		{"brightness", opts.Brightness},
+		{"contrast", opts.Contrast},
+	} {
+		if opt.value == 0 {
+			continue
+		}
+		if r, ok := rangeOf(opt.name); ok {
+			if float64(opt.value) < r.Min || float64(opt.value) > r.Max {
+				return fmt.Errorf("%s %d outside device range %g..%g", opt.name, opt.value, r.Min, r.Max)
+			}
+		}
+	}
+
+	return nil
+}
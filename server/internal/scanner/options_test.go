@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetOptionsBrightnessContrastArea(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	opts := ScanOptions{
+		Brightness: 20,
+		Contrast:   -10,
+		Area:       &Area{TLX: 10, TLY: 20, BRX: 110, BRY: 170},
+	}
+	if err := sc.SetOptions(opts); err != nil {
+		t.Fatalf("set options failed: %v", err)
+	}
+
+	got := sc.backend.(*stubBackend).options
+	want := map[string]any{
+		"brightness": 20,
+		"contrast":   -10,
+		"tl-x":       10.0,
+		"tl-y":       20.0,
+		"br-x":       110.0,
+		"br-y":       170.0,
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("option %s = %v, want %v", name, got[name], v)
+		}
+	}
+}
+
+func TestSetOptionsPaperSize(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	if err := sc.SetOptions(ScanOptions{PaperSize: "A5"}); err != nil {
+		t.Fatalf("set options failed: %v", err)
+	}
+
+	got := sc.backend.(*stubBackend).options
+	if got["page-width"] != 148.0 || got["page-height"] != 210.0 {
+		t.Errorf("page size = %v x %v, want 148 x 210", got["page-width"], got["page-height"])
+	}
+	if got["br-x"] != 148.0 || got["br-y"] != 210.0 {
+		t.Errorf("scan area = %v x %v, want 148 x 210", got["br-x"], got["br-y"])
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	tests := []struct {
+		name string
+		opts ScanOptions
+		err  string
+	}{
+		{"defaults", ScanOptions{}, ""},
+		{"brightness in range", ScanOptions{Brightness: 100}, ""},
+		{"brightness out of range", ScanOptions{Brightness: 150}, "brightness 150 outside device range"},
+		{"contrast out of range", ScanOptions{Contrast: -101}, "contrast -101 outside device range"},
+		{"unknown paper size", ScanOptions{PaperSize: "tabloid"}, "unknown paper size"},
+		{"paper size too large", ScanOptions{PaperSize: "a3"}, "exceeds device maximum"},
+		{"legal fits", ScanOptions{PaperSize: "legal"}, ""},
+		{"inverted area", ScanOptions{Area: &Area{TLX: 100, BRX: 50, BRY: 100}}, "positive width and height"},
+		{"negative area", ScanOptions{Area: &Area{TLX: -1, BRX: 50, BRY: 100}}, "negative"},
+		{"area too wide", ScanOptions{Area: &Area{BRX: 300, BRY: 100}}, "width 300.0mm exceeds"},
+		{"unknown batch mode", ScanOptions{BatchMode: "forever"}, "unknown batch mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sc.ValidateOptions(tt.opts)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSetOptionsRejectsInvalid(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+
+	if err := sc.SetOptions(ScanOptions{Resolution: 300, Brightness: 500}); err == nil {
+		t.Fatal("expected error for out-of-range brightness")
+	}
+	if _, ok := sc.backend.(*stubBackend).options["resolution"]; ok {
+		t.Error("no option should be applied when validation fails")
+	}
+}
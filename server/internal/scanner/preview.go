@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+// DefaultPreviewResolution is used for preview scans when no resolution is
+// requested. It is low enough for a quick pass over the whole bed.
+const DefaultPreviewResolution = 75
+
+// Flatbed size assumed when the backend does not report the scan area: an
+// A4/Letter glass. The ADF limits in Capabilities allow longer pages.
+const (
+	flatbedMaxWidth  = 215.9
+	flatbedMaxHeight = 297.0
+)
+
+// Preview is the result of a quick preview scan of the full flatbed.
+type Preview struct {
+	Image      image.Image
+	Resolution int
+	// Physical size of the scanned area in millimetres. Regions picked from
+	// the preview map onto the bed by scaling pixels with these dimensions.
+	WidthMM  float64
+	HeightMM float64
+}
+
+// Preview performs a fast, low-resolution scan of the whole flatbed without
+// creating a job. resolution and mode fall back to 75 dpi color.
+func (s *Scanner) Preview(ctx context.Context, resolution int, mode string) (*Preview, error) {
+	s.mu.Lock()
+	if !s.connected {
+		s.mu.Unlock()
+		return nil, ErrNotConnected
+	}
+	if s.scanning {
+		s.mu.Unlock()
+		return nil, ErrBusy
+	}
+	s.scanning = true
+	backend := s.backend
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.scanning = false
+		s.mu.Unlock()
+	}()
+
+	if resolution <= 0 {
+		resolution = DefaultPreviewResolution
+	}
+	if mode == "" {
+		mode = "color"
+	}
+
+	// Select the flatbed first: backends report the area limits of the
+	// current source.
+	if err := backend.SetOption("source", "flatbed"); err != nil {
+		return nil, fmt.Errorf("configure preview: %w", err)
+	}
+	bedWidth, bedHeight := s.bedSize(backend)
+	opts := ScanOptions{
+		Resolution: resolution,
+		Mode:       mode,
+		Source:     "flatbed",
+		Area:       &Area{BRX: bedWidth, BRY: bedHeight},
+	}
+	if err := s.SetOptions(opts); err != nil {
+		return nil, fmt.Errorf("configure preview: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	img, err := backend.ReadImage()
+	if err != nil {
+		return nil, fmt.Errorf("preview scan: %w", Classify(err))
+	}
+
+	// Derive the physical size from the image so that backends which scan
+	// less than the requested area still map correctly.
+	bounds := img.Bounds()
+	return &Preview{
+		Image:      img,
+		Resolution: resolution,
+		WidthMM:    float64(bounds.Dx()) * 25.4 / float64(resolution),
+		HeightMM:   float64(bounds.Dy()) * 25.4 / float64(resolution),
+	}, nil
+}
+
+// bedSize returns the flatbed scan area in millimetres, preferring the
+// backend's reported constraints over the assumed glass size.
+func (s *Scanner) bedSize(backend ScannerBackend) (width, height float64) {
+	width, height = flatbedMaxWidth, flatbedMaxHeight
+	if d, ok := backend.(OptionDescriber); ok {
+		if r, ok := d.OptionRange("br-x"); ok {
+			width = r.Max
+		}
+		if r, ok := d.OptionRange("br-y"); ok {
+			height = r.Max
+		}
+	}
+	return width, height
+}
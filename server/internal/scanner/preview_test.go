@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestPreviewScansFullBed(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.SetBackend(NewTestBackend(1))
+	sc.Init()
+
+	preview, err := sc.Preview(context.Background(), 0, "")
+	if err != nil {
+		t.Fatalf("preview failed: %v", err)
+	}
+	if preview.Resolution != DefaultPreviewResolution {
+		t.Errorf("resolution = %d, want %d", preview.Resolution, DefaultPreviewResolution)
+	}
+
+	bounds := preview.Image.Bounds()
+	wantWidth := float64(bounds.Dx()) * 25.4 / DefaultPreviewResolution
+	if math.Abs(preview.WidthMM-wantWidth) > 0.01 {
+		t.Errorf("width = %.2fmm, want %.2fmm", preview.WidthMM, wantWidth)
+	}
+
+	opts := sc.backend.(*testBackend).options
+	if opts["source"] != "flatbed" {
+		t.Errorf("source = %v, want flatbed", opts["source"])
+	}
+	if opts["tl-x"] != 0.0 || opts["br-x"] != 215.9 || opts["br-y"] != 297.0 {
+		t.Errorf("preview should cover the full bed, got tl-x=%v br-x=%v br-y=%v",
+			opts["tl-x"], opts["br-x"], opts["br-y"])
+	}
+
+	if sc.scanning {
+		t.Error("scanner should not be busy after preview")
+	}
+}
+
+func TestPreviewNotConnected(t *testing.T) {
+	sc := New("", false, ScanOptions{})
+	sc.Init()
+
+	if _, err := sc.Preview(context.Background(), 0, ""); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestPreviewBusy(t *testing.T) {
+	sc := New("", true, ScanOptions{})
+	sc.Init()
+	sc.scanning = true
+
+	if _, err := sc.Preview(context.Background(), 0, ""); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected ErrBusy, got %v", err)
+	}
+}
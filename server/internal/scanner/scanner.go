@@ -3,9 +3,11 @@ package scanner
 import (
 	"context"
 	"errors"
+	"fmt"
 	"image"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/thoscut/scanflow/server/internal/jobs"
 )
@@ -24,6 +26,19 @@ type Device struct {
 	Type   string `json:"type"`
 }
 
+// BatchMode selects how a batch scan starts and ends.
+type BatchMode string
+
+const (
+	// BatchSingle scans until the ADF reports empty (default).
+	BatchSingle BatchMode = "single"
+	// BatchWaitForPaper polls the paper sensor and starts once paper is loaded.
+	BatchWaitForPaper BatchMode = "wait_for_paper"
+	// BatchContinuous keeps the session open for a grace period after the
+	// feeder empties so more sheets can be added to the same document.
+	BatchContinuous BatchMode = "continuous"
+)
+
 // ScanOptions configures scanner settings.
 type ScanOptions struct {
 	Resolution int
@@ -33,8 +48,25 @@ type ScanOptions struct {
 	PageHeight float64
 	Brightness int
 	Contrast   int
+	PaperSize  string // preset (a4, letter, ...) setting page size and area
+	Area       *Area  // explicit scan region; overrides PaperSize
+
+	BatchMode        BatchMode
+	PaperWaitTimeout time.Duration // wait_for_paper: 0 waits until the context ends
+	FeedGracePeriod  time.Duration // continuous: defaults to 30s
+	// OnWaitForPaper is called whenever the batch starts waiting for paper.
+	OnWaitForPaper func()
 }
 
+const (
+	// paperSensorOption is the SANE option most backends (fujitsu, epjitsu,
+	// avision, ...) use to report whether paper is loaded in the ADF.
+	paperSensorOption = "page-loaded"
+
+	paperPollInterval      = 250 * time.Millisecond
+	defaultFeedGracePeriod = 30 * time.Second
+)
+
 // Capabilities describes what a scanner device supports.
 type Capabilities struct {
 	Resolutions []int    `json:"resolutions"`
@@ -59,6 +91,15 @@ type Scanner struct {
 	scanning  bool
 	mu        sync.RWMutex
 
+	// finishBatch is closed by FinishBatch to end a wait_for_paper or
+	// continuous session; nil when no such session is active.
+	finishBatch chan struct{}
+
+	// cancelBatch stops the active batch and batchDone is closed once its
+	// goroutine no longer uses the backend; both are nil when idle.
+	cancelBatch context.CancelFunc
+	batchDone   chan struct{}
+
 	// SANE backend interface for testability
 	backend ScannerBackend
 }
@@ -170,8 +211,18 @@ func (s *Scanner) Open(deviceName string) error {
 	return nil
 }
 
-// Close disconnects from the scanner.
+// Close disconnects from the scanner. An active batch is cancelled first and
+// the handle is only closed once the batch has stopped reading from it.
 func (s *Scanner) Close() error {
+	s.mu.Lock()
+	s.connected = false
+	cancel, done := s.cancelBatch, s.batchDone
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -181,6 +232,14 @@ func (s *Scanner) Close() error {
 	return nil
 }
 
+// DeviceName returns the configured or most recently opened device name.
+// An empty name means the first discovered device is used.
+func (s *Scanner) DeviceName() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.deviceName
+}
+
 // IsConnected returns whether a scanner is currently connected.
 func (s *Scanner) IsConnected() bool {
 	s.mu.RLock()
@@ -196,6 +255,9 @@ func (s *Scanner) SetOptions(opts ScanOptions) error {
 	if !s.connected {
 		return ErrNotConnected
 	}
+	if err := validateOptions(s.backend, s.GetCapabilities(), opts); err != nil {
+		return err
+	}
 
 	if opts.Resolution > 0 {
 		if err := s.backend.SetOption("resolution", opts.Resolution); err != nil {
@@ -212,18 +274,51 @@ func (s *Scanner) SetOptions(opts ScanOptions) error {
 			return err
 		}
 	}
-	if opts.PageHeight == 0 {
+	pageWidth, pageHeight := opts.pageSize()
+	if pageHeight == 0 {
 		s.backend.SetOption("page-height", 0) // Unlimited
-	} else if opts.PageHeight > 0 {
-		s.backend.SetOption("page-height", opts.PageHeight)
+	} else if pageHeight > 0 {
+		s.backend.SetOption("page-height", pageHeight)
 	}
-	if opts.PageWidth > 0 {
-		s.backend.SetOption("page-width", opts.PageWidth)
+	if pageWidth > 0 {
+		s.backend.SetOption("page-width", pageWidth)
+	}
+	if opts.Brightness != 0 {
+		if err := s.backend.SetOption("brightness", opts.Brightness); err != nil {
+			return fmt.Errorf("set brightness: %w", err)
+		}
+	}
+	if opts.Contrast != 0 {
+		if err := s.backend.SetOption("contrast", opts.Contrast); err != nil {
+			return fmt.Errorf("set contrast: %w", err)
+		}
+	}
+	if area := opts.area(); area != nil {
+		for _, o := range []struct {
+			name  string
+			value float64
+		}{
+			{"tl-x", area.TLX}, {"tl-y", area.TLY},
+			{"br-x", area.BRX}, {"br-y", area.BRY},
+		} {
+			if err := s.backend.SetOption(o.name, o.value); err != nil {
+				return fmt.Errorf("set scan area: %w", err)
+			}
+		}
 	}
 
 	return nil
 }
 
+// ValidateOptions checks scan options against the device constraints without
+// applying them, so invalid requests can be rejected before a job is queued.
+func (s *Scanner) ValidateOptions(opts ScanOptions) error {
+	s.mu.RLock()
+	backend := s.backend
+	s.mu.RUnlock()
+	return validateOptions(backend, s.GetCapabilities(), opts)
+}
+
 // ScanBatch performs a batch scan, returning pages over a channel.
 func (s *Scanner) ScanBatch(ctx context.Context, opts ScanOptions) (<-chan *jobs.Page, error) {
 	s.mu.Lock()
@@ -245,40 +340,117 @@ func (s *Scanner) ScanBatch(ctx context.Context, opts ScanOptions) (<-chan *jobs
 		return nil, err
 	}
 
+	var finish chan struct{}
+	if opts.BatchMode == BatchWaitForPaper || opts.BatchMode == BatchContinuous {
+		finish = make(chan struct{})
+		s.mu.Lock()
+		s.finishBatch = finish
+		s.mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.cancelBatch, s.batchDone = cancel, done
+	s.mu.Unlock()
+
 	pages := make(chan *jobs.Page)
+	// send delivers a page unless the consumer cancelled and stopped reading.
+	send := func(p *jobs.Page) bool {
+		select {
+		case pages <- p:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
 
 	go func() {
 		defer close(pages)
 		defer func() {
 			s.mu.Lock()
 			s.scanning = false
+			s.finishBatch = nil
+			s.cancelBatch, s.batchDone = nil, nil
 			s.mu.Unlock()
+			cancel()
+			close(done)
 		}()
 
+		var paperDeadline time.Time
+		if opts.BatchMode == BatchWaitForPaper {
+			if opts.PaperWaitTimeout > 0 {
+				paperDeadline = time.Now().Add(opts.PaperWaitTimeout)
+			}
+			if opts.OnWaitForPaper != nil {
+				opts.OnWaitForPaper()
+			}
+			if !s.waitForPaper(ctx, finish, paperDeadline) {
+				slog.Info("no paper inserted, batch scan ended")
+				return
+			}
+		}
+
 		pageNum := 0
+		var graceDeadline time.Time
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-finish:
+				slog.Info("batch scan finished on request", "pages", pageNum)
+				return
 			default:
 				img, err := s.backend.ReadImage()
 				if err != nil {
+					err = Classify(err)
 					// Check for ADF empty / end of batch
 					if isEndOfFeed(err) {
+						// Without a paper sensor the wait above ends after one
+						// poll; keep trying until the first page is fed.
+						if opts.BatchMode == BatchWaitForPaper && pageNum == 0 {
+							if s.waitForPaper(ctx, finish, paperDeadline) {
+								continue
+							}
+							slog.Info("no paper inserted, batch scan ended")
+							return
+						}
+						if opts.BatchMode == BatchContinuous {
+							// The grace period runs from the moment the feeder
+							// first empties until the next page is scanned.
+							if graceDeadline.IsZero() {
+								grace := opts.FeedGracePeriod
+								if grace <= 0 {
+									grace = defaultFeedGracePeriod
+								}
+								graceDeadline = time.Now().Add(grace)
+								slog.Info("ADF empty, waiting for more paper", "pages", pageNum, "grace_period", grace)
+								if opts.OnWaitForPaper != nil {
+									opts.OnWaitForPaper()
+								}
+							}
+							if s.waitForPaper(ctx, finish, graceDeadline) {
+								continue
+							}
+						}
 						slog.Info("ADF empty, batch scan complete", "pages", pageNum)
 						return
 					}
-					pages <- &jobs.Page{Err: err}
+					slog.Warn("scan error", "pages", pageNum, "error", err)
+					send(&jobs.Page{Err: err})
 					return
 				}
 
 				pageNum++
+				graceDeadline = time.Time{}
 				bounds := img.Bounds()
-				pages <- &jobs.Page{
+				if !send(&jobs.Page{
 					Number: pageNum,
 					Width:  bounds.Dx(),
 					Height: bounds.Dy(),
 					Image:  img,
+				}) {
+					return
 				}
 				slog.Debug("page scanned", "page", pageNum,
 					"width", bounds.Dx(), "height", bounds.Dy())
@@ -289,6 +461,54 @@ func (s *Scanner) ScanBatch(ctx context.Context, opts ScanOptions) (<-chan *jobs
 	return pages, nil
 }
 
+// waitForPaper polls the paper sensor until paper is loaded (true) or the
+// deadline passes, the session is finished or ctx ends (false). A zero
+// deadline waits indefinitely. Backends without a paper sensor are probed by
+// simply attempting the next read after each poll interval.
+func (s *Scanner) waitForPaper(ctx context.Context, finish <-chan struct{}, deadline time.Time) bool {
+	ticker := time.NewTicker(paperPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-finish:
+			return false
+		case <-ticker.C:
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return false
+		}
+
+		val, err := s.backend.GetOption(paperSensorOption)
+		loaded, ok := val.(bool)
+		if err != nil || !ok {
+			// No usable sensor: let ReadImage find out.
+			return true
+		}
+		if loaded {
+			slog.Debug("paper detected")
+			return true
+		}
+	}
+}
+
+// FinishBatch ends an active wait_for_paper or continuous batch session,
+// e.g. on a hardware button press. It returns false when no such session is
+// active.
+func (s *Scanner) FinishBatch() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finishBatch == nil {
+		return false
+	}
+	close(s.finishBatch)
+	s.finishBatch = nil
+	return true
+}
+
 // GetButtonState reads the current state of a scanner button.
 func (s *Scanner) GetButtonState(buttonName string) (bool, error) {
 	s.mu.RLock()
@@ -309,6 +529,32 @@ func (s *Scanner) GetButtonState(buttonName string) (bool, error) {
 	return false, nil
 }
 
+// functionNumber reads the number shown on the function display, or -1 if
+// the device has none.
+func (s *Scanner) functionNumber() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.connected {
+		return -1
+	}
+	val, err := s.backend.GetOption(functionOption)
+	if err != nil {
+		return -1
+	}
+	switch v := val.(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return -1
+}
+
 // GetCapabilities returns the capabilities of the scanner hardware.
 // Currently returns sensible defaults; a real implementation would query the SANE backend.
 func (s *Scanner) GetCapabilities() Capabilities {
@@ -330,10 +576,3 @@ func (s *Scanner) Shutdown() {
 	s.Close()
 	s.backend.Close()
 }
-
-func isEndOfFeed(err error) bool {
-	// SANE returns specific error codes for empty ADF
-	return err.Error() == "document feeder out of documents" ||
-		err.Error() == "no more data available" ||
-		err.Error() == "end of file"
-}
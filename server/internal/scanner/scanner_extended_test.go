@@ -164,11 +164,11 @@ type testErr struct {
 
 func (e *testErr) Error() string { return e.msg }
 
-func TestNewButtonWatcherDefaults(t *testing.T) {
+func TestNewGestureWatcherDefaults(t *testing.T) {
 	sc := New("", true, ScanOptions{})
 	sc.Init()
 
-	bw := NewButtonWatcher(sc, ButtonConfig{}, nil, nil)
+	bw := NewGestureWatcher(sc, ButtonConfig{Bindings: scanBindings}, nil)
 
 	if bw.pollInterval != 50*time.Millisecond {
 		t.Fatalf("expected default poll interval 50ms, got %v", bw.pollInterval)
@@ -182,7 +182,7 @@ func TestButtonWatcherStartCancel(t *testing.T) {
 	sc := New("", true, ScanOptions{})
 	sc.Init()
 
-	bw := NewButtonWatcher(sc, ButtonConfig{PollInterval: 10 * time.Millisecond}, nil, nil)
+	bw := NewGestureWatcher(sc, ButtonConfig{PollInterval: 10 * time.Millisecond, Bindings: scanBindings}, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
@@ -203,19 +203,19 @@ func TestButtonWatcherStartCancel(t *testing.T) {
 	}
 }
 
-func TestButtonWatcherNilCallbacks(t *testing.T) {
+func TestButtonWatcherNilCallback(t *testing.T) {
 	sc := New("", true, ScanOptions{})
 	sc.Init()
 
-	// Both callbacks are nil - should not panic
-	bw := NewButtonWatcher(sc, ButtonConfig{LongPressDuration: time.Second}, nil, nil)
+	// The callback is nil - should not panic
+	bw := NewGestureWatcher(sc, ButtonConfig{LongPressDuration: time.Second, Bindings: scanBindings}, nil)
 
 	backend := sc.backend.(*stubBackend)
 
 	// Simulate short press
 	backend.SetOption("scan", true)
 	bw.poll()
-	bw.pressStart = time.Now().Add(-500 * time.Millisecond)
+	bw.buttons["scan"].pressStart = time.Now().Add(-500 * time.Millisecond)
 	backend.SetOption("scan", false)
 	bw.poll() // Should not panic with nil callback
 }
@@ -71,12 +71,29 @@ func (s *stubBackend) GetOption(name string) (any, error) {
 	return nil, nil
 }
 
+// OptionRange reports the constraints of a typical SANE flatbed/ADF device.
+// Like real devices, the length limit depends on the selected source.
+func (s *stubBackend) OptionRange(name string) (OptionRange, bool) {
+	switch name {
+	case "brightness", "contrast":
+		return OptionRange{Min: -100, Max: 100}, true
+	case "tl-x", "br-x":
+		return OptionRange{Min: 0, Max: 215.9}, true
+	case "tl-y", "br-y":
+		if s.options["source"] == "flatbed" {
+			return OptionRange{Min: 0, Max: 297}, true
+		}
+		return OptionRange{Min: 0, Max: 355.6}, true
+	}
+	return OptionRange{}, false
+}
+
 func (s *stubBackend) ReadImage() (image.Image, error) {
 	if !s.open {
 		return nil, errors.New("device not open")
 	}
 	// Return end of feed after first call to simulate single page
-	return nil, errors.New("document feeder out of documents")
+	return nil, ErrNoDocs
 }
 
 func (s *stubBackend) IsOpen() bool {
@@ -101,7 +118,7 @@ func (t *testBackend) ReadImage() (image.Image, error) {
 		return nil, errors.New("device not open")
 	}
 	if t.pagesRemaining <= 0 {
-		return nil, errors.New("document feeder out of documents")
+		return nil, ErrNoDocs
 	}
 	t.pagesRemaining--
 
@@ -126,3 +143,25 @@ func (t *testBackend) ReadImage() (image.Image, error) {
 
 	return img, nil
 }
+
+// faultBackend generates test pages and then reports a scanner fault.
+type faultBackend struct {
+	testBackend
+	fault error
+}
+
+// NewFaultBackend creates a backend that generates N test pages and then
+// fails with the given error, e.g. ErrJammed to simulate a paper jam.
+func NewFaultBackend(pages int, fault error) ScannerBackend {
+	return &faultBackend{
+		testBackend: testBackend{pagesRemaining: pages},
+		fault:       fault,
+	}
+}
+
+func (f *faultBackend) ReadImage() (image.Image, error) {
+	if f.open && f.pagesRemaining <= 0 && f.fault != nil {
+		return nil, f.fault
+	}
+	return f.testBackend.ReadImage()
+}
@@ -47,9 +47,11 @@ document.addEventListener('DOMContentLoaded', () => {
     checkStatus();
     loadDevices();
     loadProfiles();
+    loadOutputs();
     loadSettings();
     loadJobs();
     connectWebSocket();
+    setupRegionSelection();
 
     // Refresh status periodically
     setInterval(checkStatus, 10000);
@@ -128,6 +130,186 @@ async function loadProfiles() {
     }
 }
 
+async function loadOutputs() {
+    try {
+        const data = await apiRequest('GET', '/api/v1/outputs');
+        const select = document.getElementById('output-select');
+        const options = ['<option value="">Profile default</option>'];
+        (data.outputs || []).forEach(o => {
+            options.push(`<option value="${escapeHTML(o.name)}">${escapeHTML(o.name)} (${escapeHTML(o.type)})</option>`);
+        });
+        select.innerHTML = options.join('');
+        renderOutputs(data.outputs || []);
+    } catch (err) {
+        console.error('Failed to load outputs:', err);
+        document.getElementById('outputs-list').innerHTML = '<div class="empty-state">Failed to load outputs</div>';
+    }
+}
+
+// Output management. The form covers the common settings of each type;
+// other settings of an edited output are kept as they are. Secrets are
+// write-only: an empty field keeps the stored secret.
+const OUTPUT_FIELDS = {
+    smb: { settings: ['server', 'share', 'username', 'directory'], secrets: ['password'] },
+    filesystem: { settings: ['directory'], secrets: [] },
+    paperless: { settings: ['url'], secrets: ['token'] },
+    paperless_consume: { settings: ['path'], secrets: [] },
+    webdav: { settings: ['url', 'username'], secrets: ['password', 'token'] },
+    sftp: { settings: ['host', 'username', 'directory', 'known_hosts_file'], secrets: ['password', 'private_key'] },
+    s3: { settings: ['endpoint', 'region', 'bucket', 'prefix', 'access_key_id'], secrets: ['secret_access_key'] },
+    ipp: { settings: ['url', 'username'], secrets: ['password'] },
+};
+
+let editingOutput = null; // output being edited, as returned by the API
+
+function renderOutputs(outputs) {
+    const container = document.getElementById('outputs-list');
+    if (outputs.length === 0) {
+        container.innerHTML = '<div class="empty-state">No outputs configured</div>';
+        return;
+    }
+    container.innerHTML = outputs.map(o => {
+        const name = escapeHTML(o.name);
+        const actions = o.managed
+            ? `<button class="btn btn-small" data-name="${name}" onclick="editOutput(this.dataset.name)">Edit</button>
+               <button class="btn btn-cancel" data-name="${name}" onclick="deleteOutput(this.dataset.name)">Delete</button>`
+            : '';
+        return `
+            <div class="device-card">
+                <div>
+                    <div class="device-name">${name}</div>
+                    <div class="device-model">${escapeHTML(o.type)}${o.managed ? '' : ' (server.toml)'}</div>
+                </div>
+                <div class="job-header-right">
+                    <button class="btn btn-small" data-name="${name}" onclick="testOutput(this.dataset.name)">Test</button>
+                    ${actions}
+                </div>
+            </div>
+        `;
+    }).join('');
+}
+
+function showOutputForm(output) {
+    editingOutput = output || null;
+    const typeSelect = document.getElementById('output-type');
+    typeSelect.innerHTML = Object.keys(OUTPUT_FIELDS).map(t =>
+        `<option value="${t}">${t}</option>`).join('');
+    typeSelect.value = output ? output.type : 'smb';
+    typeSelect.disabled = !!output;
+
+    const nameInput = document.getElementById('output-name');
+    nameInput.value = output ? output.name : '';
+    nameInput.disabled = !!output;
+
+    renderOutputFields();
+    document.getElementById('output-form').hidden = false;
+    document.getElementById('add-output-btn').hidden = true;
+}
+
+function hideOutputForm() {
+    editingOutput = null;
+    document.getElementById('output-form').hidden = true;
+    document.getElementById('add-output-btn').hidden = false;
+}
+
+function renderOutputFields() {
+    const type = document.getElementById('output-type').value;
+    const fields = OUTPUT_FIELDS[type];
+    const settings = editingOutput ? (editingOutput[type] || {}) : {};
+    const stored = editingOutput ? (editingOutput.secrets || []) : [];
+
+    const inputs = fields.settings.map(key => `
+        <div class="form-group">
+            <label for="output-setting-${key}">${escapeHTML(key)}:</label>
+            <input type="text" id="output-setting-${key}" value="${escapeHTML(settings[key] || '')}">
+        </div>
+    `);
+    fields.secrets.forEach(key => {
+        const placeholder = stored.includes(key) ? 'Stored - leave empty to keep' : '';
+        const input = key === 'private_key'
+            ? `<textarea id="output-secret-${key}" rows="4" placeholder="${placeholder}"></textarea>`
+            : `<input type="password" id="output-secret-${key}" autocomplete="new-password" placeholder="${placeholder}">`;
+        inputs.push(`
+            <div class="form-group">
+                <label for="output-secret-${key}">${escapeHTML(key)}:</label>
+                ${input}
+            </div>
+        `);
+    });
+    document.getElementById('output-fields').innerHTML = inputs.join('');
+}
+
+async function saveOutput(event) {
+    event.preventDefault();
+    const type = document.getElementById('output-type').value;
+    const name = document.getElementById('output-name').value.trim();
+    const fields = OUTPUT_FIELDS[type];
+
+    // Start from the stored settings so that settings without a form field
+    // survive an edit.
+    const settings = Object.assign({}, editingOutput ? editingOutput[type] : {});
+    fields.settings.forEach(key => {
+        const value = document.getElementById('output-setting-' + key).value.trim();
+        if (value) {
+            settings[key] = value;
+        } else {
+            delete settings[key];
+        }
+    });
+    const secrets = {};
+    fields.secrets.forEach(key => {
+        const value = document.getElementById('output-secret-' + key).value;
+        if (value) secrets[key] = value;
+    });
+
+    const body = { name: name, type: type, secrets: secrets };
+    body[type] = settings;
+    try {
+        if (editingOutput) {
+            await apiRequest('PUT', '/api/v1/outputs/' + encodeURIComponent(name), body);
+        } else {
+            await apiRequest('POST', '/api/v1/outputs', body);
+        }
+        showToast('Output saved', 'success');
+        hideOutputForm();
+        loadOutputs();
+    } catch (err) {
+        showToast('Error: ' + err.message, 'error');
+    }
+}
+
+async function editOutput(name) {
+    try {
+        showOutputForm(await apiRequest('GET', '/api/v1/outputs/' + encodeURIComponent(name)));
+    } catch (err) {
+        showToast('Error: ' + err.message, 'error');
+    }
+}
+
+async function deleteOutput(name) {
+    if (!confirm('Delete output ' + name + '?')) return;
+    try {
+        await apiRequest('DELETE', '/api/v1/outputs/' + encodeURIComponent(name));
+        showToast('Output deleted', 'info');
+        loadOutputs();
+    } catch (err) {
+        showToast('Error: ' + err.message, 'error');
+    }
+}
+
+async function testOutput(name) {
+    try {
+        const result = await apiRequest('POST', '/api/v1/outputs/' + encodeURIComponent(name) + '/test');
+        if (result.ok) {
+            showToast(name + ': connection OK', 'success');
+        } else {
+            showToast(name + ': ' + result.error, 'error');
+        }
+    } catch (err) {
+        showToast('Test failed: ' + err.message, 'error');
+    }
+}
+
 // Settings
 async function loadSettings() {
     try {
@@ -192,6 +374,10 @@ async function startScan() {
         req.metadata = { title: title };
     }
 
+    if (previewRegion) {
+        req.options = { area: previewRegion };
+    }
+
     try {
         const job = await apiRequest('POST', '/api/v1/scan', req);
         addJobCard(job);
@@ -205,6 +391,95 @@ async function startScan() {
     }
 }
 
+// Preview and region selection
+let preview = null;       // last preview response (image size in px and mm)
+let previewRegion = null; // selected area in mm, sent as options.area
+
+async function startPreview() {
+    const btn = document.getElementById('preview-btn');
+    btn.disabled = true;
+    btn.textContent = 'Scanning preview...';
+
+    try {
+        preview = await apiRequest('POST', '/api/v1/scanner/preview', {});
+        document.getElementById('preview-image').src = preview.image;
+        document.getElementById('preview-container').hidden = false;
+        clearRegion();
+    } catch (err) {
+        showToast('Preview failed: ' + err.message, 'error');
+    } finally {
+        btn.disabled = false;
+        btn.textContent = 'Preview';
+    }
+}
+
+function clearRegion() {
+    previewRegion = null;
+    document.getElementById('preview-selection').hidden = true;
+    document.getElementById('preview-region').textContent = 'Drag on the preview to select a scan region';
+}
+
+function setupRegionSelection() {
+    const frame = document.getElementById('preview-frame');
+    const selection = document.getElementById('preview-selection');
+    if (!frame) return;
+    let start = null;
+
+    // Position relative to the displayed image, clamped to its bounds.
+    function point(event) {
+        const rect = frame.getBoundingClientRect();
+        return {
+            x: Math.min(Math.max(event.clientX - rect.left, 0), rect.width),
+            y: Math.min(Math.max(event.clientY - rect.top, 0), rect.height),
+        };
+    }
+
+    function draw(a, b) {
+        selection.style.left = Math.min(a.x, b.x) + 'px';
+        selection.style.top = Math.min(a.y, b.y) + 'px';
+        selection.style.width = Math.abs(a.x - b.x) + 'px';
+        selection.style.height = Math.abs(a.y - b.y) + 'px';
+        selection.hidden = false;
+    }
+
+    frame.addEventListener('pointerdown', (event) => {
+        if (!preview) return;
+        event.preventDefault();
+        start = point(event);
+        frame.setPointerCapture(event.pointerId);
+    });
+    frame.addEventListener('pointermove', (event) => {
+        if (start) draw(start, point(event));
+    });
+    frame.addEventListener('pointerup', (event) => {
+        if (!start) return;
+        const end = point(event);
+        const rect = frame.getBoundingClientRect();
+        const a = start;
+        start = null;
+
+        // Tiny drags count as a click and reset the selection.
+        if (Math.abs(a.x - end.x) < 5 || Math.abs(a.y - end.y) < 5) {
+            clearRegion();
+            return;
+        }
+        draw(a, end);
+
+        const mmX = preview.width_mm / rect.width;
+        const mmY = preview.height_mm / rect.height;
+        const round = (v) => Math.round(v * 10) / 10;
+        previewRegion = {
+            tl_x: round(Math.min(a.x, end.x) * mmX),
+            tl_y: round(Math.min(a.y, end.y) * mmY),
+            br_x: round(Math.max(a.x, end.x) * mmX),
+            br_y: round(Math.max(a.y, end.y) * mmY),
+        };
+        document.getElementById('preview-region').textContent =
+            'Region: ' + round(previewRegion.br_x - previewRegion.tl_x) + ' x ' +
+            round(previewRegion.br_y - previewRegion.tl_y) + ' mm (click to clear)';
+    });
+}
+
 // Cancel a job
 async function cancelJob(jobId) {
     try {
@@ -253,15 +528,49 @@ function addJobCard(job) {
         <div class="progress-bar" style="margin-top: 8px;">
             <div class="fill" style="width: ${parseInt(job.progress) || 0}%"></div>
         </div>
+        <div class="job-deliveries"></div>
     `;
 
     container.prepend(card);
+    (job.deliveries || []).forEach(d => updateDelivery(card, {
+        message: d.target, status: d.status, error: d.error,
+        document_url: d.result ? d.result.url : '',
+    }));
+}
+
+// Per-target delivery state; the target name arrives in the message field.
+function updateDelivery(card, update) {
+    const list = card.querySelector('.job-deliveries');
+    if (!list || !update.message) return;
+
+    let item = Array.from(list.children).find(el => el.dataset.target === update.message);
+    if (!item) {
+        item = document.createElement('div');
+        item.className = 'delivery';
+        item.dataset.target = update.message;
+        list.appendChild(item);
+    }
+    item.className = 'delivery ' + update.status;
+    item.textContent = update.message + ': ' + update.status + (update.error ? ' (' + update.error + ')' : '');
+    if (update.document_url && /^https?:\/\//.test(update.document_url)) {
+        const link = document.createElement('a');
+        link.href = update.document_url;
+        link.target = '_blank';
+        link.rel = 'noopener';
+        link.textContent = 'Open document';
+        item.append(' ', link);
+    }
 }
 
 function updateJobCard(update) {
     const card = document.getElementById('job-' + update.job_id);
     if (!card) return;
 
+    if (update.type === 'delivery') {
+        updateDelivery(card, update);
+        return;
+    }
+
     const statusEl = card.querySelector('.job-status');
     if (statusEl && update.status) {
         statusEl.textContent = statusLabel(update.status);